@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planFile     string
+	secretsFile  string
+	dryRun       bool
+	qoveryAPIURL string
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create the migrated applications with the Qovery API, without Terraform",
+	Long: `This command creates the project, the environments, the databases, the applications, the jobs and their variables of a plan.json written by "prepare", with the Qovery API.
+The existing resources are looked up by name and updated, so the command can be run again after editing the plan.
+Set the git_repository of each application in the plan before applying it.
+The secrets of the plan are placeholders: their values are read from the secrets file written by "prepare" in the run directory, or else from the environment variables of the same name.`,
+	Run: runApply,
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVar(&planFile, "plan", "", "plan.json written by \"prepare\" (required)")
+	applyCmd.Flags().StringVar(&secretsFile, "secrets", "", "secrets.json written by \"prepare\" in the run directory, the values of the secrets of the plan (default: the environment variables of the same name)")
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the resources which would be created or updated")
+	applyCmd.Flags().StringVar(&qoveryAPIURL, "api-url", qovery.DefaultAPIURL, "URL of the Qovery API")
+	_ = applyCmd.MarkFlagRequired("plan")
+}
+
+func runApply(cmd *cobra.Command, args []string) {
+	qoveryAPIKey := os.Getenv("QOVERY_API_KEY")
+	if qoveryAPIKey == "" {
+		fmt.Println("Error: QOVERY_API_KEY must be set in the environment")
+		os.Exit(1)
+	}
+
+	plan, err := qovery.LoadPlan(planFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	secrets := qovery.PlanSecrets{}
+	if secretsFile != "" {
+		secrets, err = qovery.LoadPlanSecrets(secretsFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := plan.SetSecrets(secrets, os.LookupEnv); err != nil {
+		if !dryRun {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	client := qovery.NewClient(qoveryAPIKey)
+	client.BaseURL = qoveryAPIURL
+	applier := &qovery.Applier{Client: client, DryRun: dryRun}
+
+	result, err := applier.Apply(context.Background(), plan)
+	if result != nil {
+		for _, action := range result.Actions {
+			if dryRun {
+				fmt.Printf("would %s\n", action)
+			} else {
+				fmt.Println(action)
+			}
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error applying the plan: %v\n", err)
+		os.Exit(1)
+	}
+
+	if dryRun {
+		fmt.Println("\nDry run: nothing was created or updated")
+		return
+	}
+	fmt.Println("\nThe plan was applied, deploy the environments from the Qovery console")
+}
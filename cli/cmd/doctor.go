@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment before preparing a migration",
+	Long: `This command checks the environment variables, the AWS credentials, the clock skew with AWS, the Terraform CLI and the knowledge bundle.
+The clock is compared with the Date header of the Bedrock endpoint: AWS rejects the requests signed with a clock off by more than 5 minutes.`,
+	Run: runDoctor,
+}
+
+var doctorAWSProfile string
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringVar(&doctorAWSProfile, "aws-profile", "", "AWS shared config profile of the Bedrock credentials to check, E.g a SSO profile (default: AWS_PROFILE or the default credential chain)")
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	failed := false
+	check := func(ok bool, message string) {
+		if ok {
+			fmt.Printf("✓ %s\n", message)
+		} else {
+			fmt.Printf("✗ %s\n", message)
+			failed = true
+		}
+	}
+
+	for _, name := range []string{"AWS_BEDROCK_MODEL_ARN", "QOVERY_API_KEY"} {
+		if os.Getenv(name) != "" {
+			check(true, fmt.Sprintf("%s is set", name))
+		} else {
+			check(false, fmt.Sprintf("%s is not set", name))
+		}
+	}
+
+	awsRegion := os.Getenv("AWS_REGION")
+	if awsRegion == "" {
+		awsRegion = "us-east-1"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	bedrockClientConfig := bedrock.DefaultConfig()
+	bedrockClientConfig.AWSRegion = awsRegion
+	bedrockClientConfig.AWSSessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	bedrockClientConfig.AWSProfile = doctorAWSProfile
+	if source, err := bedrock.CheckCredentials(ctx, os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), bedrockClientConfig); err != nil {
+		check(false, err.Error())
+	} else {
+		check(true, fmt.Sprintf("AWS credentials found (%s)", source))
+	}
+
+	skew, err := bedrock.MeasureClockSkew(ctx, awsRegion)
+	switch {
+	case err != nil:
+		fmt.Printf("? Clock skew with AWS %s not measured: %v\n", awsRegion, err)
+	case skew > bedrock.ClockSkewThreshold || skew < -bedrock.ClockSkewThreshold:
+		check(false, fmt.Sprintf("The system clock is off by %v from AWS %s, synchronize it (E.g with NTP). The requests are signed with the corrected time after a first rejection.", skew.Round(time.Second), awsRegion))
+	default:
+		check(true, fmt.Sprintf("The system clock is in sync with AWS %s (%v)", awsRegion, skew.Round(time.Second)))
+	}
+
+	if path, err := exec.LookPath("terraform"); err == nil {
+		check(true, fmt.Sprintf("Terraform CLI found at %s", path))
+	} else {
+		fmt.Println("? Terraform CLI not found, the generated Terraform is only validated in-process")
+	}
+
+	knowledgeBundle, err := kb.LoadOrEmbedded("")
+	switch {
+	case err != nil:
+		check(false, fmt.Sprintf("Error loading the knowledge bundle: %v", err))
+	case knowledgeBundle.Origin == kb.EmbeddedOrigin:
+		fmt.Printf("? No knowledge bundle synced, the embedded one is used (Qovery provider %s). Run \"kb sync\" to get the latest documentation\n", knowledgeBundle.Manifest.ProviderVersion)
+	default:
+		check(true, fmt.Sprintf("Knowledge bundle %s (Qovery provider %s)", knowledgeBundle.Origin, knowledgeBundle.Manifest.ProviderVersion))
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
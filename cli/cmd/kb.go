@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+	"github.com/spf13/cobra"
+)
+
+var kbOutput string
+
+// kbCmd represents the kb command
+var kbCmd = &cobra.Command{
+	Use:   "kb",
+	Short: "Manage the knowledge bundle",
+	Long:  `The knowledge bundle contains the Qovery Terraform provider documentation and the Terraform examples used to generate the Terraform configurations.`,
+}
+
+// kbSyncCmd represents the kb sync command
+var kbSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Download the latest Qovery Terraform provider documentation and examples",
+	Long: `This command downloads the documentation of the latest Qovery Terraform provider release and the Terraform examples into a local knowledge bundle.
+The bundle is written to a directory, or to a tarball if the output ends with .tar.gz, and can be used with "prepare --kb" to run without network access to GitHub.`,
+	Run: runKbSync,
+}
+
+func init() {
+	rootCmd.AddCommand(kbCmd)
+	kbCmd.AddCommand(kbSyncCmd)
+	kbSyncCmd.Flags().StringVarP(&kbOutput, "output", "o", "", fmt.Sprintf("Output directory or tarball (default %s)", filepath.Join(kb.DefaultDir(), "<provider version>")))
+}
+
+func runKbSync(cmd *cobra.Command, args []string) {
+	githubToken := os.Getenv("GITHUB_TOKEN") // optional
+
+	bundle, err := kb.Sync(githubToken)
+	if err != nil {
+		fmt.Printf("Error syncing the knowledge bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	output := kbOutput
+	if output == "" {
+		output = filepath.Join(kb.DefaultDir(), bundle.Manifest.ProviderVersion)
+	}
+
+	if err := bundle.Write(output); err != nil {
+		fmt.Printf("Error writing the knowledge bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Knowledge bundle for the Qovery provider %s written to %s (%d docs, %d examples)\n",
+		bundle.Manifest.ProviderVersion, output, len(bundle.Docs), len(bundle.Examples))
+}
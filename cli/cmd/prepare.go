@@ -1,18 +1,45 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/migration"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 var (
-	source      string
-	destination string
-	outputDir   string
+	source           string
+	destination      string
+	outputDir        string
+	skipTerraformCLI bool
+	kbPath           string
+	maxContextTokens int
+	noDocs           bool
+	noExamples       bool
+	exampleRepos     []string
+	instructionsFile string
+	promptsDir       string
+	maxLLMCost       float64
+	llmPricingFile   string
+	maxRequestsPM    int
+	maxTokensPM      int
+	fallbackModels   []string
+	awsProfile       string
+	outputLayout     string
+	outputFormat     string
+	imageRegistry    string
+	ingressClass     string
+	runDir           string
+	resumeDir        string
 )
 
 // prepareCmd represents the prepare command
@@ -28,6 +55,26 @@ func init() {
 	prepareCmd.Flags().StringVarP(&source, "from", "f", "", "Source platform (e.g., 'heroku', 'clevercloud') (required)")
 	prepareCmd.Flags().StringVarP(&destination, "to", "t", "", "Destination cloud provider (aws, gcp, or scaleway) (required)")
 	prepareCmd.Flags().StringVarP(&outputDir, "output", "o", "", "Output directory for generated files")
+	prepareCmd.Flags().BoolVar(&skipTerraformCLI, "skip-terraform-cli", false, "Only validate the generated Terraform files in-process, without running terraform init and validate")
+	prepareCmd.Flags().StringVar(&kbPath, "kb", "", "Knowledge bundle directory or tarball created with \"kb sync\" (default: the latest synced bundle, or the bundle embedded in the binary)")
+	prepareCmd.Flags().IntVar(&maxContextTokens, "max-context-tokens", migration.DefaultPromptContextOptions().MaxContextTokens, "Token budget of the Qovery provider docs and examples given as reference for each application (0 means no limit)")
+	prepareCmd.Flags().BoolVar(&noDocs, "no-docs", false, "Don't give the Qovery provider documentation to the LLM")
+	prepareCmd.Flags().BoolVar(&noExamples, "no-examples", false, "Don't give the Terraform examples to the LLM")
+	prepareCmd.Flags().StringSliceVar(&exampleRepos, "example-repo", nil, "Additional Terraform examples, as a local directory or a GitHub repository (owner/repo[/path][@ref]), can be repeated")
+	prepareCmd.Flags().StringVar(&instructionsFile, "instructions-file", "", "File of additional instructions for the Terraform generation (E.g naming conventions, mandatory labels)")
+	prepareCmd.Flags().StringVar(&promptsDir, "prompts-dir", "", "Directory of <name>.tmpl files overriding the embedded prompt templates")
+	prepareCmd.Flags().Float64Var(&maxLLMCost, "max-llm-cost", 0, "Budget of the LLM requests in USD, the run is aborted when the estimated spend exceeds it (0 means no budget)")
+	prepareCmd.Flags().StringVar(&llmPricingFile, "llm-pricing-file", "", "JSON file of model prices in USD per million tokens, merged into the default prices")
+	prepareCmd.Flags().IntVar(&maxRequestsPM, "max-requests-per-minute", bedrock.DefaultConfig().MaxRequestsPerMinute, "Bedrock requests per minute quota of the model (0 means no limit)")
+	prepareCmd.Flags().IntVar(&maxTokensPM, "max-tokens-per-minute", bedrock.DefaultConfig().MaxTokensPerMinute, "Bedrock tokens per minute quota of the model (0 means no limit)")
+	prepareCmd.Flags().StringVar(&awsProfile, "aws-profile", "", "AWS shared config profile of the Bedrock credentials, E.g a SSO profile (default: AWS_PROFILE or the default credential chain)")
+	prepareCmd.Flags().StringSliceVar(&fallbackModels, "fallback-model", nil, "Model used when the previous one is throttled or unavailable, as <inference profile ARN>[@<region>], can be repeated")
+	prepareCmd.Flags().StringVar(&outputLayout, "layout", string(migration.LayoutPerApp), "Layout of the Terraform files: \"per-app\" for a configuration per application, or \"root-module\" for a root module calling a module per application")
+	prepareCmd.Flags().StringVar(&outputFormat, "format", string(migration.OutputTerraform), "Format of the generated files: \"terraform\", \"opentofu\" (validated with the tofu CLI), \"pulumi\" (a Pulumi YAML program per application), or \"kubernetes\" and \"helm\" (Kubernetes manifests or a Helm chart per application, deployed without Qovery)")
+	prepareCmd.Flags().StringVar(&imageRegistry, "image-registry", migration.DefaultValidationConfigFor(migration.OutputKubernetes).Kubernetes.ImageRegistry, "Registry the images built from the Dockerfiles are pushed to, with the kubernetes and helm formats (E.g <account>.dkr.ecr.<region>.amazonaws.com)")
+	prepareCmd.Flags().StringVar(&ingressClass, "ingress-class", "", "Ingress class of the public services, with the kubernetes and helm formats (E.g alb, default: the default class of the cluster)")
+	prepareCmd.Flags().StringVar(&runDir, "run-dir", "", "Directory of the checkpoints of the run, the output of each stage of each application (default: ~/.qovery-migration-agent/runs/<date>)")
+	prepareCmd.Flags().StringVar(&resumeDir, "resume", "", "Run directory of a failed or interrupted run to resume: the completed stages are skipped, the failed or missing ones are redone")
 	_ = prepareCmd.MarkFlagRequired("from")
 	_ = prepareCmd.MarkFlagRequired("to")
 }
@@ -45,6 +92,22 @@ func runPrepare(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	layout, err := migration.ParseOutputLayout(outputLayout)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	format, err := migration.ParseOutputFormat(outputFormat)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !format.HCL() && layout == migration.LayoutRootModule {
+		fmt.Printf("Error: the %s layout is only supported by the %s and %s formats\n", layout, migration.OutputTerraform, migration.OutputOpenTofu)
+		os.Exit(1)
+	}
+
 	// Check for HEROKU_API_KEY when source is heroku
 	herokuAPIKey := os.Getenv("HEROKU_API_KEY")
 	if source == "heroku" && herokuAPIKey == "" {
@@ -59,16 +122,12 @@ func runPrepare(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	// Check for AWS credentials for Bedrock
+	// AWS credentials for Bedrock: the static keys of the environment if set, the default credential chain otherwise
+	// (profiles, SSO, web identity, instance roles)
 	awsAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
 	awsSecretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
 	awsRegion := os.Getenv("AWS_REGION")
 
-	if awsAccessKey == "" || awsSecretKey == "" {
-		fmt.Println("Error: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set in the environment")
-		os.Exit(1)
-	}
-
 	if awsRegion == "" {
 		awsRegion = "us-east-1" // Default to us-east-1 if not specified
 		fmt.Println("Warning: AWS_REGION not set, defaulting to us-east-1")
@@ -81,13 +140,21 @@ func runPrepare(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// the kubernetes and helm formats deploy without Qovery
 	qoveryAPIKey := os.Getenv("QOVERY_API_KEY")
-	if qoveryAPIKey == "" {
+	if qoveryAPIKey == "" && format.TargetsQovery() {
 		fmt.Println("Error: QOVERY_API_KEY must be set in the environment")
 		os.Exit(1)
 	}
 
-	githubToken := os.Getenv("GITHUB_TOKEN") // optional
+	knowledgeBundle, err := kb.LoadOrEmbedded(kbPath)
+	if err != nil {
+		fmt.Printf("Error loading the knowledge bundle: %v\n", err)
+		os.Exit(1)
+	}
+	if knowledgeBundle.Origin == kb.EmbeddedOrigin {
+		fmt.Println("Warning: no knowledge bundle found, using the embedded one. Run \"kb sync\" to get the latest Qovery Terraform provider documentation")
+	}
 
 	// Create a progress channel
 	progressChan := make(chan migration.ProgressUpdate)
@@ -108,6 +175,11 @@ func runPrepare(cmd *cobra.Command, args []string) {
 	// Start a goroutine to update the progress bar
 	go func() {
 		for update := range progressChan {
+			if update.Tokens > 0 {
+				// live update of a LLM generation, the progress is unchanged
+				bar.Describe(fmt.Sprintf("%s for %s (~%d tokens)", update.Stage, update.AppName, update.Tokens))
+				continue
+			}
 			_ = bar.Set(int(update.Progress * 100))
 			bar.Describe(update.Stage)
 		}
@@ -116,9 +188,52 @@ func runPrepare(cmd *cobra.Command, args []string) {
 	bedrockClientConfig := bedrock.DefaultConfig()
 	bedrockClientConfig.AWSRegion = awsRegion
 	bedrockClientConfig.InferenceProfileARN = bedrockModelARN
+	bedrockClientConfig.AWSProfile = awsProfile
+	bedrockClientConfig.AWSSessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	bedrockClientConfig.MaxCost = maxLLMCost
+	bedrockClientConfig.MaxRequestsPerMinute = maxRequestsPM
+	bedrockClientConfig.MaxTokensPerMinute = maxTokensPM
+	bedrockClientConfig.Fallbacks, err = bedrock.ParseModelTargets(fallbackModels)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if llmPricingFile != "" {
+		bedrockClientConfig.Pricing, err = bedrock.LoadPricing(llmPricingFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if _, err := bedrock.CheckCredentials(context.Background(), awsAccessKey, awsSecretKey, bedrockClientConfig); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	run, err := openRun(format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	validationConfig := migration.DefaultValidationConfigFor(format)
+	if skipTerraformCLI {
+		validationConfig.TerraformCLI = false
+	}
+	validationConfig.Kubernetes.ImageRegistry = imageRegistry
+	validationConfig.Kubernetes.IngressClassName = ingressClass
+
+	promptContextOptions := migration.DefaultPromptContextOptions()
+	promptContextOptions.MaxContextTokens = maxContextTokens
+	promptContextOptions.IncludeDocs = !noDocs
+	promptContextOptions.IncludeExamples = !noExamples
+	promptContextOptions.ExtraExampleRepos = exampleRepos
+	promptContextOptions.CustomInstructionsFile = instructionsFile
+	promptContextOptions.PromptsDir = promptsDir
+	promptContextOptions.GitHubToken = os.Getenv("GITHUB_TOKEN") // optional
 
 	var assets *migration.Assets
-	var err error
 
 	if source == "heroku" {
 		assets, err = migration.GenerateHerokuMigrationAssets(
@@ -126,9 +241,12 @@ func runPrepare(cmd *cobra.Command, args []string) {
 			awsAccessKey,
 			awsSecretKey,
 			qoveryAPIKey,
-			githubToken,
 			destination,
+			knowledgeBundle,
 			bedrockClientConfig,
+			validationConfig,
+			promptContextOptions,
+			run,
 			progressChan,
 		)
 	}
@@ -139,9 +257,12 @@ func runPrepare(cmd *cobra.Command, args []string) {
 			awsAccessKey,
 			awsSecretKey,
 			qoveryAPIKey,
-			githubToken,
 			destination,
+			knowledgeBundle,
 			bedrockClientConfig,
+			validationConfig,
+			promptContextOptions,
+			run,
 			progressChan,
 		)
 	}
@@ -152,18 +273,41 @@ func runPrepare(cmd *cobra.Command, args []string) {
 	// Ensure the progress bar reaches 100%
 	_ = bar.Finish()
 
+	if errors.Is(err, bedrock.ErrBudgetExceeded) && assets != nil {
+		fmt.Printf("\nLLM cost budget exceeded, the migration was aborted: %v\n", err)
+		fmt.Printf("LLM usage: %s\n", assets.LLMUsage)
+		if outputDir != "" {
+			if writeErr := migration.WriteAssetsWithLayout(outputDir, assets, true, layout); writeErr == nil {
+				fmt.Printf("The assets generated so far are in %s\n", outputDir)
+			}
+		}
+		printResumeCommand(run)
+		os.Exit(1)
+	}
+
 	if err != nil {
 		fmt.Printf("\nError generating migration assets: %v\n", err)
+		printResumeCommand(run)
 		os.Exit(1)
 	}
 
+	fmt.Printf("\nLLM usage: %s\n", assets.LLMUsage)
+
 	if outputDir != "" {
-		err := migration.WriteAssets(outputDir, assets, true)
+		err := migration.WriteAssetsWithLayout(outputDir, assets, true, layout)
 		if err != nil {
 			fmt.Printf("\nError writing migration assets: %v\n", err)
 			return
 		}
-		fmt.Printf("\nMigration assets prepared successfully in %s\n", outputDir)
+		if len(assets.FailedApps()) == 0 {
+			fmt.Printf("\nMigration assets prepared successfully in %s\n", outputDir)
+		} else {
+			fmt.Printf("\nMigration assets prepared in %s\n", outputDir)
+		}
+		if format.TargetsQovery() {
+			printSecretsFile(run, assets)
+		}
+		exitOnFailedApps(run, assets)
 		return
 	}
 
@@ -173,11 +317,23 @@ func runPrepare(cmd *cobra.Command, args []string) {
 		fmt.Println(generatedTfFile.AppName)
 		fmt.Println("====================================")
 
-		fmt.Println("\nTerraform Main Configuration:")
-		fmt.Println(generatedTfFile.MainTf)
+		if len(generatedTfFile.Files) > 0 {
+			var names []string
+			for name := range generatedTfFile.Files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("\n%s:\n", name)
+				fmt.Println(generatedTfFile.Files[name])
+			}
+		} else {
+			fmt.Println("\nTerraform Main Configuration:")
+			fmt.Println(generatedTfFile.MainTf)
 
-		fmt.Println("\nTerraform Variables:")
-		fmt.Println(generatedTfFile.VariablesTf)
+			fmt.Println("\nTerraform Variables:")
+			fmt.Println(generatedTfFile.VariablesTf)
+		}
 
 		// output Dockerfile content if it exists
 		for _, dockerfile := range assets.Dockerfiles {
@@ -188,4 +344,70 @@ func runPrepare(cmd *cobra.Command, args []string) {
 			}
 		}
 	}
+	exitOnFailedApps(run, assets)
+}
+
+// openRun creates the run directory of the checkpoints, or opens the one of --resume
+func openRun(format migration.OutputFormat) (*migration.Run, error) {
+	if resumeDir != "" && runDir != "" && filepath.Clean(resumeDir) != filepath.Clean(runDir) {
+		return nil, fmt.Errorf("--resume and --run-dir must be the same directory")
+	}
+
+	if resumeDir != "" {
+		run, err := migration.ResumeRun(resumeDir, source, destination, format)
+		if err != nil {
+			return nil, err
+		}
+		completed := 0
+		for _, app := range run.Manifest().Apps {
+			for stage, checkpoint := range app.Stages {
+				if stage != migration.StageConfig && checkpoint.Status == migration.StatusCompleted {
+					completed++
+				}
+			}
+		}
+		fmt.Printf("Resuming the run of %s: %d completed stage(s) are skipped\n", run.Dir(), completed)
+		return run, nil
+	}
+
+	dir := runDir
+	if dir == "" {
+		dir = filepath.Join(migration.DefaultRunsDir(), time.Now().Format("20060102-150405"))
+	}
+	run, err := migration.NewRun(dir, source, destination, format)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("The checkpoints of the run are saved in %s\n", run.Dir())
+	return run, nil
+}
+
+// printSecretsFile saves the values of the secrets of plan.json out of the output directory and prints how to apply them
+func printSecretsFile(run *migration.Run, assets *migration.Assets) {
+	secrets := assets.PlanSecrets()
+	if len(secrets) == 0 {
+		return
+	}
+	secretsFile, err := run.SaveSecrets(secrets)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return
+	}
+	fmt.Printf("The secrets of plan.json are placeholders, their values are in %s: pass it to apply with --secrets %s\n", secretsFile, secretsFile)
+}
+
+// exitOnFailedApps exits with an error if the generation of an application failed, once its best files are written
+func exitOnFailedApps(run *migration.Run, assets *migration.Assets) {
+	failed := assets.FailedApps()
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Printf("\nThe generation failed for %d application(s): %s\n", len(failed), strings.Join(failed, ", "))
+	printResumeCommand(run)
+	os.Exit(1)
+}
+
+// printResumeCommand prints how to resume a failed run from its checkpoints
+func printResumeCommand(run *migration.Run) {
+	fmt.Printf("Resume the run by adding --resume %s to the same command\n", run.Dir())
 }
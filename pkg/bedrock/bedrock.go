@@ -7,113 +7,216 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/retry"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/aws/smithy-go"
 )
 
-// RateLimiter handles API request rate limiting
-type RateLimiter struct {
-	tokens   chan struct{}
-	interval time.Duration
-	mu       sync.Mutex
-}
-
-// newRateLimiter creates a new rate limiter with specified requests per interval
-func newRateLimiter(maxRequests int, interval time.Duration) *RateLimiter {
-	limiter := &RateLimiter{
-		tokens:   make(chan struct{}, maxRequests),
-		interval: interval,
-	}
-
-	// Initialize token bucket
-	for i := 0; i < maxRequests; i++ {
-		limiter.tokens <- struct{}{}
-	}
+// ErrToolInputTruncated is returned when a tool input is truncated by max_tokens, it can't be continued
+var ErrToolInputTruncated = errors.New("tool input truncated by max_tokens")
 
-	// Replenish tokens periodically
-	go func() {
-		ticker := time.NewTicker(interval)
-		for range ticker.C {
-			limiter.mu.Lock()
-			currentTokens := len(limiter.tokens)
-			needed := maxRequests - currentTokens
-			for i := 0; i < needed; i++ {
-				select {
-				case limiter.tokens <- struct{}{}:
-				default:
-					// Channel is full
-				}
-			}
-			limiter.mu.Unlock()
-		}
-	}()
-
-	return limiter
+// modelInvoker is the subset of the Bedrock runtime client used to invoke the models
+type modelInvoker interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+	InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelWithResponseStreamOutput, error)
 }
 
-func (r *RateLimiter) wait() {
-	<-r.tokens
+// ModelTarget is a model in a region, E.g a cross-region inference profile
+type ModelTarget struct {
+	InferenceProfileARN string
+	// AWSRegion is the region of the model, ClientConfig.AWSRegion if empty
+	AWSRegion string
 }
 
-func (r *RateLimiter) release() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	select {
-	case r.tokens <- struct{}{}:
-	default:
-		// Channel is full
+// ParseModelTargets parses models given as "<inference profile ARN>[@<region>]", E.g
+// "us.anthropic.claude-3-5-sonnet-20241022-v2:0@us-west-2"
+func ParseModelTargets(values []string) ([]ModelTarget, error) {
+	var targets []ModelTarget
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		arn, region, _ := strings.Cut(value, "@")
+		if arn == "" {
+			return nil, fmt.Errorf("invalid model %q: the inference profile ARN is required", value)
+		}
+		targets = append(targets, ModelTarget{InferenceProfileARN: arn, AWSRegion: region})
 	}
+	return targets, nil
+}
+
+// modelClient is a target of the fallback chain with the runtime client of its region
+type modelClient struct {
+	ModelTarget
+	invoker modelInvoker
 }
 
 // BedrockClient represents a client for interacting with AWS Bedrock
 type BedrockClient struct {
-	bedrockClient *bedrockruntime.Client
-	rateLimiter   *RateLimiter
-	config        ClientConfig
-	semaphore     chan struct{}
+	// targets are the primary model then the fallbacks, in order
+	targets     []modelClient
+	failover    *failoverState
+	clockSkew   *clockSkew
+	rateLimiter *RateLimiter
+	// ownsRateLimiter is false when the rate limiter is shared with other clients, it is then not closed with the client
+	ownsRateLimiter bool
+	config          ClientConfig
+	semaphore       chan struct{}
+	usage           *UsageTracker
+	// stage and appName tag the requests in the usage tracker
+	stage   string
+	appName string
+	// onDelta receives the deltas of the responses of the requests without their own callback
+	onDelta func(Delta)
+	// ctx is the context of the requests sent with Send, context.Background() if nil
+	ctx context.Context
 }
 
 // ClientConfig holds configuration options for the Bedrock client
 type ClientConfig struct {
 	MaxRequestsPerMinute int
-	MaxRetries           int
-	InitialRetryDelay    time.Duration
-	MaxRetryDelay        time.Duration
-	AWSRegion            string
-	InferenceProfileARN  string
-	MaxParallelRequests  int
+	// MaxTokensPerMinute is the tokens per minute quota of the model (input and output tokens), 0 means no limit
+	MaxTokensPerMinute int
+	// RateLimiter is a rate limiter shared with other clients, E.g to respect an account-wide quota across jobs.
+	// MaxRequestsPerMinute and MaxTokensPerMinute are ignored if it is set.
+	RateLimiter         *RateLimiter
+	MaxRetries          int
+	InitialRetryDelay   time.Duration
+	MaxRetryDelay       time.Duration
+	AWSRegion           string
+	InferenceProfileARN string
+	// AWSProfile is the shared config profile of the credentials, AWS_PROFILE or the default profile if empty
+	AWSProfile string
+	// AWSSessionToken is the session token of the static credentials, E.g of temporary credentials
+	AWSSessionToken     string
+	MaxParallelRequests int
+	// MaxContinuations is the maximum number of requests sent to continue a response truncated by max_tokens
+	MaxContinuations int
+	// Pricing is the price of the models used to estimate the spend
+	Pricing map[string]ModelPrice
+	// MaxCost is the budget of the client in USD, the requests fail with ErrBudgetExceeded once it is reached.
+	// 0 means no budget.
+	MaxCost float64
+	// Fallbacks are the models tried in order when the primary model is throttled or unavailable,
+	// E.g the same model in another region
+	Fallbacks []ModelTarget
+	// FailoverAfterRetries is the number of consecutive throttled or unavailable attempts before failing over to the next model
+	FailoverAfterRetries int
+	// FailoverCooldown is the time after which the requests are sent to the primary model again
+	FailoverCooldown time.Duration
 }
 
 // DefaultConfig returns the default client configuration
 func DefaultConfig() ClientConfig {
 	return ClientConfig{
 		MaxRequestsPerMinute: 50,              // 50 requests per minute by default
+		MaxTokensPerMinute:   200000,          // 200k tokens per minute by default
 		MaxRetries:           20,              // Maximum number of retries
 		InitialRetryDelay:    1 * time.Second, // Start with 1 second delay
 		MaxRetryDelay:        3 * time.Minute, // Maximum delay between retries
 		AWSRegion:            "us-east-1",     // Default AWS region
 		InferenceProfileARN:  "",              // Must be set by user
 		MaxParallelRequests:  5,               // Default to 5 parallel requests
+		MaxContinuations:     5,               // Up to 6 times max_tokens per response
+		Pricing:              DefaultPricing(),
+		MaxCost:              0, // No budget by default
+		FailoverAfterRetries: 3,
+		FailoverCooldown:     5 * time.Minute,
+	}
+}
+
+// Request is a request to the model: a system prompt, the conversation and the sampling parameters
+type Request struct {
+	System string
+	// Messages is the conversation, alternating user and assistant messages. A last assistant message is a prefill
+	// the response continues from.
+	Messages      []Message
+	MaxTokens     int
+	Temperature   float64
+	TopP          float64
+	TopK          int
+	StopSequences []string
+	Tools         []Tool
+	ToolChoice    *ToolChoice
+	// OnDelta receives the response as it is generated, the response is streamed if it is set
+	OnDelta func(Delta)
+}
+
+// Delta is a part of a streamed response
+type Delta struct {
+	// Text is the generated text, or the generated JSON of the tool input if ToolInput is true
+	Text      string
+	ToolInput bool
+	// Discarded is set when an attempt failed after streaming deltas: it is the length of their text, which is not part
+	// of the response as the request is retried or fails
+	Discarded int
+}
+
+// NewRequest returns a request of a single user message with the default sampling parameters
+func NewRequest(prompt string) Request {
+	return Request{
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+		MaxTokens:   8192,
+		Temperature: 0.7,
+		TopP:        1,
+		TopK:        250,
 	}
 }
 
+// Response is the response of the model to a request
+type Response struct {
+	// Text is the text of the response, without the prefill of the request
+	Text string
+	// ToolName and ToolInput are set when the model called a tool
+	ToolName  string
+	ToolInput json.RawMessage
+	// StopReason is the reason the model stopped, E.g end_turn, stop_sequence or tool_use
+	StopReason string
+	// Usage is the number of tokens of the request and its continuations
+	Usage Usage
+	// Continuations is the number of requests sent to continue a response truncated by max_tokens
+	Continuations int
+	// Model is the model which produced the response, it differs from the primary model after a failover
+	Model string
+}
+
 // BedrockRequest represents the request structure for Bedrock API
 type BedrockRequest struct {
-	AnthropicVersion string    `json:"anthropic_version"`
-	Messages         []Message `json:"messages"`
-	MaxTokens        int       `json:"max_tokens"`
-	Temperature      float64   `json:"temperature"`
-	TopP             float64   `json:"top_p"`
-	TopK             int       `json:"top_k"`
+	AnthropicVersion string      `json:"anthropic_version"`
+	System           string      `json:"system,omitempty"`
+	Messages         []Message   `json:"messages"`
+	MaxTokens        int         `json:"max_tokens"`
+	Temperature      float64     `json:"temperature"`
+	TopP             float64     `json:"top_p"`
+	TopK             int         `json:"top_k"`
+	StopSequences    []string    `json:"stop_sequences,omitempty"`
+	Tools            []Tool      `json:"tools,omitempty"`
+	ToolChoice       *ToolChoice `json:"tool_choice,omitempty"`
+}
+
+// Tool is a tool the model can call, its input is described by a JSON schema.
+// Forcing the model to call a tool is the way to get a structured output.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice forces the model to use a tool, E.g {"type": "tool", "name": "write_main_tf"}
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 // Message represents a single message in the conversation
@@ -124,42 +227,29 @@ type Message struct {
 
 // BedrockResponse represents the response structure from Bedrock API
 type BedrockResponse struct {
-	Content []struct {
-		Text string `json:"text"`
-	} `json:"content"`
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      Usage          `json:"usage"`
 }
 
-func checkSystemClock() error {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://worldtimeapi.org/api/timezone/Etc/UTC")
-	if err != nil {
-		return fmt.Errorf("failed to check time: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Unixtime int64 `json:"unixtime"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode time response: %v", err)
-	}
-
-	systemTime := time.Now().Unix()
-	diff := abs(systemTime - result.Unixtime)
-	if diff > 300 { // 5 minutes
-		return fmt.Errorf("system clock is off by %d seconds", diff)
-	}
-	return nil
+// ContentBlock is a block of the model response: a text (type "text") or a tool call (type "tool_use")
+type ContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
 }
 
-func abs(n int64) int64 {
-	if n < 0 {
-		return -n
-	}
-	return n
+// ToolResponse is the response of a request forcing the use of a tool
+type ToolResponse struct {
+	// Input is the input of the tool call, as a JSON object matching the tool input schema
+	Input json.RawMessage
+	// Text is the text of the response, set when the model answered without calling the tool
+	Text string
 }
 
-// NewBedrockClient creates a new BedrockClient with AWS credentials and optional config
+// NewBedrockClient creates a new BedrockClient with optional config. The static AWS credentials are used if awsKey
+// and awsSecret are set, the default AWS credential chain otherwise.
 func NewBedrockClient(awsKey string, awsSecret string, config ...ClientConfig) (*BedrockClient, error) {
 	cfg := DefaultConfig()
 	if len(config) > 0 {
@@ -174,95 +264,307 @@ func NewBedrockClient(awsKey string, awsSecret string, config ...ClientConfig) (
 		return nil, fmt.Errorf("MaxParallelRequests must be at least 1")
 	}
 
-	// Check system clock synchronization
-	if err := checkSystemClock(); err != nil {
-		log.Printf("Warning: %v", err)
+	awsCfg, err := loadAWSConfig(context.Background(), awsKey, awsSecret, cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Load AWS configuration with credentials and clock skew manager
-	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
-		awsconfig.WithRegion(cfg.AWSRegion),
-		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(awsKey, awsSecret, "")),
-		awsconfig.WithClientLogMode(aws.LogRetries), // Add logging for retries
-		awsconfig.WithRetryer(func() aws.Retryer {
-			return retry.AddWithMaxBackoffDelay(
-				retry.NewStandard(),
-				time.Second*5,
-			)
-		}),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("unable to load AWS SDK config: %v", err)
+	// Create a Bedrock client per region of the fallback chain, recording the clock skew from their responses
+	skew := &clockSkew{}
+	clients := map[string]*bedrockruntime.Client{}
+	var targets []modelClient
+	for _, target := range append([]ModelTarget{{InferenceProfileARN: cfg.InferenceProfileARN, AWSRegion: cfg.AWSRegion}}, cfg.Fallbacks...) {
+		if target.InferenceProfileARN == "" {
+			return nil, fmt.Errorf("the InferenceProfileARN of a fallback model is required")
+		}
+		if target.AWSRegion == "" {
+			target.AWSRegion = cfg.AWSRegion
+		}
+
+		client, ok := clients[target.AWSRegion]
+		if !ok {
+			client = bedrockruntime.NewFromConfig(awsCfg, func(o *bedrockruntime.Options) {
+				o.Region = target.AWSRegion
+				o.APIOptions = append(o.APIOptions, skew.addMiddleware)
+			})
+			clients[target.AWSRegion] = client
+		}
+		targets = append(targets, modelClient{ModelTarget: target, invoker: client})
+
+		if _, ok := priceOf(cfg.Pricing, target.InferenceProfileARN); !ok {
+			log.Printf("Warning: no price for the model %s, the LLM spend is not estimated", target.InferenceProfileARN)
+			if cfg.MaxCost > 0 {
+				return nil, fmt.Errorf("a LLM cost budget is set but the model %s has no price", target.InferenceProfileARN)
+			}
+		}
 	}
 
-	// Create Bedrock client
-	client := bedrockruntime.NewFromConfig(awsCfg)
+	rateLimiter := cfg.RateLimiter
+	ownsRateLimiter := false
+	if rateLimiter == nil {
+		rateLimiter = NewRateLimiter(cfg.MaxRequestsPerMinute, cfg.MaxTokensPerMinute)
+		ownsRateLimiter = true
+	}
 
 	return &BedrockClient{
-		bedrockClient: client,
-		rateLimiter:   newRateLimiter(cfg.MaxRequestsPerMinute, time.Minute),
-		config:        cfg,
-		semaphore:     make(chan struct{}, cfg.MaxParallelRequests),
+		targets:         targets,
+		failover:        newFailoverState(cfg.FailoverCooldown),
+		clockSkew:       skew,
+		rateLimiter:     rateLimiter,
+		ownsRateLimiter: ownsRateLimiter,
+		config:          cfg,
+		semaphore:       make(chan struct{}, cfg.MaxParallelRequests),
+		usage:           NewUsageTracker(cfg.Pricing, cfg.MaxCost),
 	}, nil
 }
 
+// Close closes the rate limiter of the client, unless it is shared. The waiting requests fail with ErrRateLimiterClosed.
+func (c *BedrockClient) Close() {
+	if c.ownsRateLimiter {
+		c.rateLimiter.Close()
+	}
+}
+
+// WithTags returns a client tagging its requests with the stage (E.g main_tf) and the app name in the usage summary.
+// It shares the rate limits, the parallel requests and the usage tracker of c.
+func (c *BedrockClient) WithTags(stage, appName string) *BedrockClient {
+	tagged := *c
+	tagged.stage = stage
+	tagged.appName = appName
+	return &tagged
+}
+
+// WithDeltas returns a client streaming the responses of its requests to onDelta, unless a request has its own callback.
+// It shares the rate limits, the parallel requests and the usage tracker of c.
+func (c *BedrockClient) WithDeltas(onDelta func(Delta)) *BedrockClient {
+	streaming := *c
+	streaming.onDelta = onDelta
+	return &streaming
+}
+
+// WithContext returns a client sending the requests of Send, Messages and MessagesWithTool with ctx, E.g to cancel the
+// requests of the other apps when one of them fails. It shares the rate limits, the parallel requests and the usage
+// tracker of c.
+func (c *BedrockClient) WithContext(ctx context.Context) *BedrockClient {
+	withContext := *c
+	withContext.ctx = ctx
+	return &withContext
+}
+
+// ClockSkew returns the difference between the AWS time and the local clock, observed on the last response
+func (c *BedrockClient) ClockSkew() time.Duration {
+	return c.clockSkew.get()
+}
+
+// Usage returns the usage of all the requests sent by the client and its tagged clients
+func (c *BedrockClient) Usage() UsageSummary {
+	return c.usage.Summary()
+}
+
 // Messages sends a chat request to Claude AI via AWS Bedrock and returns the response
 func (c *BedrockClient) Messages(prompt string) (string, error) {
+	response, err := c.Send(NewRequest(prompt))
+	if err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
+
+// MessagesWithTool sends a chat request forcing the model to call the tool and returns the tool input.
+// The text of the response is returned instead if the model answered without calling the tool, or if the tool input
+// was too long: the request is then sent again without the tool so that the response can be continued.
+func (c *BedrockClient) MessagesWithTool(prompt string, tool Tool) (ToolResponse, error) {
+	request := NewRequest(prompt)
+	request.Tools = []Tool{tool}
+	request.ToolChoice = &ToolChoice{Type: "tool", Name: tool.Name}
+
+	response, err := c.Send(request)
+	if errors.Is(err, ErrToolInputTruncated) {
+		log.Printf("Warning: %v, retrying without the tool", err)
+		response, err = c.Send(NewRequest(prompt))
+	}
+	if err != nil {
+		return ToolResponse{}, err
+	}
+	if response.ToolName == tool.Name {
+		return ToolResponse{Input: response.ToolInput}, nil
+	}
+	return ToolResponse{Text: response.Text}, nil
+}
+
+// Send sends the request to the model, see SendContext
+func (c *BedrockClient) Send(request Request) (Response, error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.SendContext(ctx, request)
+}
+
+// SendContext sends the request to the model. A text response truncated by max_tokens is continued automatically, up to
+// MaxContinuations times, by sending the partial response back as an assistant prefill.
+func (c *BedrockClient) SendContext(ctx context.Context, request Request) (Response, error) {
+	messages := append([]Message{}, request.Messages...)
+
+	// the API rejects a prefill ending with whitespace
+	prefill := ""
+	if len(messages) > 0 && messages[len(messages)-1].Role == "assistant" {
+		prefill = strings.TrimRight(messages[len(messages)-1].Content, " \t\r\n")
+		messages = messages[:len(messages)-1]
+	}
+	text := prefill
+
+	var response Response
+	for {
+		bedrockRequest := BedrockRequest{
+			AnthropicVersion: "bedrock-2023-05-31",
+			System:           request.System,
+			Messages:         messages,
+			MaxTokens:        request.MaxTokens,
+			Temperature:      request.Temperature,
+			TopP:             request.TopP,
+			TopK:             request.TopK,
+			StopSequences:    request.StopSequences,
+			Tools:            request.Tools,
+			ToolChoice:       request.ToolChoice,
+		}
+		if text != "" {
+			bedrockRequest.Messages = append(append([]Message{}, messages...), Message{Role: "assistant", Content: text})
+		}
+
+		onDelta := request.OnDelta
+		if onDelta == nil {
+			onDelta = c.onDelta
+		}
+
+		bedrockResponse, model, err := c.invoke(ctx, bedrockRequest, onDelta)
+		if err != nil {
+			return Response{}, err
+		}
+		response.Model = model
+
+		response.StopReason = bedrockResponse.StopReason
+		response.Usage.InputTokens += bedrockResponse.Usage.InputTokens
+		response.Usage.OutputTokens += bedrockResponse.Usage.OutputTokens
+		for _, block := range bedrockResponse.Content {
+			switch block.Type {
+			case "tool_use":
+				response.ToolName = block.Name
+				response.ToolInput = block.Input
+			case "", "text":
+				text += block.Text
+			}
+		}
+
+		if response.StopReason != "max_tokens" {
+			break
+		}
+		if response.ToolName != "" {
+			return Response{}, fmt.Errorf("%w: %s (%d)", ErrToolInputTruncated, response.ToolName, request.MaxTokens)
+		}
+		if response.Continuations >= c.config.MaxContinuations {
+			return Response{}, fmt.Errorf("response still truncated by max_tokens (%d) after %d continuations", request.MaxTokens, response.Continuations)
+		}
+
+		response.Continuations++
+		log.Printf("Response truncated by max_tokens, continuing (%d/%d)", response.Continuations, c.config.MaxContinuations)
+		text = strings.TrimRight(text, " \t\r\n")
+	}
+
+	response.Text = strings.TrimPrefix(text, prefill)
+	if response.Text == "" && response.ToolName == "" {
+		return Response{}, fmt.Errorf("empty response from model")
+	}
+	return response, nil
+}
+
+// invoke sends the request, retrying on throttling and transient errors, and returns the response with the model which
+// produced it. The request fails over to the next model of the chain after FailoverAfterRetries consecutive throttled or
+// unavailable attempts. The response is streamed to onDelta if it is set.
+func (c *BedrockClient) invoke(ctx context.Context, request BedrockRequest, onDelta func(Delta)) (BedrockResponse, string, error) {
 	// Acquire semaphore slot
-	c.semaphore <- struct{}{}
+	select {
+	case c.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return BedrockResponse{}, "", ctx.Err()
+	}
 	defer func() {
 		<-c.semaphore // Release semaphore slot
 	}()
 
-	request := BedrockRequest{
-		AnthropicVersion: "bedrock-2023-05-31",
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		MaxTokens:   8192,
-		Temperature: 0.7,
-		TopP:        1,
-		TopK:        250,
+	if err := c.usage.checkBudget(); err != nil {
+		return BedrockResponse{}, "", err
 	}
 
 	jsonPayload, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling payload: %w", err)
+		return BedrockResponse{}, "", fmt.Errorf("error marshaling payload: %w", err)
 	}
 
-	var content string
+	// the max_tokens are reserved until the actual usage is known, as Bedrock does for its quotas
+	reservedTokens := len(jsonPayload)/4 + request.MaxTokens
 	retryDelay := c.config.InitialRetryDelay
+	targetIndex := c.failover.current()
+	unavailableAttempts := 0
 
 	for attempt := 0; attempt < c.config.MaxRetries; attempt++ {
-		c.rateLimiter.wait()
-
-		input := &bedrockruntime.InvokeModelInput{
-			ModelId:     aws.String(c.config.InferenceProfileARN),
-			Accept:      aws.String("application/json"),
-			ContentType: aws.String("application/json"),
-			Body:        jsonPayload,
+		// a canceled request is not sent, even if a slot and the rate limits are free
+		if err := ctx.Err(); err != nil {
+			return BedrockResponse{}, "", err
+		}
+		if err := c.rateLimiter.Wait(ctx, reservedTokens); err != nil {
+			return BedrockResponse{}, "", fmt.Errorf("error waiting for the rate limiter: %w", err)
 		}
 
-		output, err := c.bedrockClient.InvokeModel(context.Background(), input)
+		target := c.targets[targetIndex]
+		var response BedrockResponse
+		if onDelta == nil {
+			response, err = c.invokeModel(ctx, target, jsonPayload)
+		} else {
+			streamed := 0
+			response, err = c.invokeModelWithResponseStream(ctx, target, jsonPayload, func(delta Delta) {
+				streamed += len(delta.Text)
+				onDelta(delta)
+			})
+			if err != nil && streamed > 0 {
+				onDelta(Delta{Discarded: streamed})
+			}
+		}
 
 		if err != nil {
-			c.rateLimiter.release()
+			c.rateLimiter.Adjust(reservedTokens, 0)
 
 			var apiErr smithy.APIError
 			if errors.As(err, &apiErr) {
 				errorCode := apiErr.ErrorCode()
 				errorMessage := apiErr.Error()
 
-				shouldRetry := errorCode == "ThrottlingException" ||
+				unavailable := errorCode == "ThrottlingException" ||
 					errorCode == "ServiceUnavailable" ||
-					errorCode == "InternalServerError" ||
-					errorCode == "InvalidSignatureException" ||
+					errorCode == "ServiceUnavailableException" ||
 					strings.Contains(errorMessage, "503") ||
 					strings.Contains(errorMessage, "ServiceUnavailableException") ||
 					strings.Contains(errorMessage, "Model is getting throttled")
+				shouldRetry := unavailable ||
+					errorCode == "InternalServerError" ||
+					errorCode == "InvalidSignatureException"
+
+				if unavailable {
+					unavailableAttempts++
+				} else {
+					unavailableAttempts = 0
+				}
+
+				if unavailable && unavailableAttempts >= c.config.FailoverAfterRetries && targetIndex < len(c.targets)-1 &&
+					attempt < c.config.MaxRetries-1 {
+					next := c.failover.next(targetIndex, len(c.targets))
+					log.Printf("Warning: model %s in %s is unavailable (%s), failing over to %s in %s",
+						target.InferenceProfileARN, target.AWSRegion, errorCode, c.targets[next].InferenceProfileARN, c.targets[next].AWSRegion)
+					targetIndex = next
+					unavailableAttempts = 0
+					retryDelay = c.config.InitialRetryDelay
+					continue
+				}
 
 				if shouldRetry && attempt < c.config.MaxRetries-1 {
 					// Calculate retry delay with jitter
@@ -276,29 +578,192 @@ func (c *BedrockClient) Messages(prompt string) (string, error) {
 					log.Printf("Request failed with error: %s. Error message: %s. Retrying in %v (attempt %d/%d)",
 						errorCode, errorMessage, sleepTime, attempt+1, c.config.MaxRetries)
 
-					time.Sleep(sleepTime)
+					select {
+					case <-time.After(sleepTime):
+					case <-ctx.Done():
+						return BedrockResponse{}, "", ctx.Err()
+					}
 					retryDelay *= 2 // Exponential backoff
 					continue
 				}
 			}
-			return "", fmt.Errorf("error invoking model: %w", err)
+			if skew := c.clockSkew.get(); errors.As(err, &apiErr) && clockSkewErrorCodes[apiErr.ErrorCode()] && absDuration(skew) > ClockSkewThreshold {
+				return BedrockResponse{}, "", fmt.Errorf("error invoking model %s, the system clock is off by %v from AWS: %w", target.InferenceProfileARN, skew.Round(time.Second), err)
+			}
+			return BedrockResponse{}, "", fmt.Errorf("error invoking model %s: %w", target.InferenceProfileARN, err)
 		}
 
-		var response BedrockResponse
-		if err := json.Unmarshal(output.Body, &response); err != nil {
-			c.rateLimiter.release()
-			return "", fmt.Errorf("error decoding response: %w", err)
+		c.rateLimiter.Adjust(reservedTokens, response.Usage.InputTokens+response.Usage.OutputTokens)
+		c.usage.record(c.stage, c.appName, target.InferenceProfileARN, response.Usage)
+
+		if len(response.Content) > 0 {
+			return response, target.InferenceProfileARN, nil
 		}
 
-		c.rateLimiter.release()
+		return BedrockResponse{}, "", fmt.Errorf("empty response from model")
+	}
 
-		if len(response.Content) > 0 {
-			content = response.Content[0].Text
-			return content, nil
+	return BedrockResponse{}, "", fmt.Errorf("max retries reached without successful response")
+}
+
+func (c *BedrockClient) invokeModel(ctx context.Context, target modelClient, jsonPayload []byte) (BedrockResponse, error) {
+	output, err := target.invoker.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(target.InferenceProfileARN),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        jsonPayload,
+	})
+	if err != nil {
+		return BedrockResponse{}, err
+	}
+
+	var response BedrockResponse
+	if err := json.Unmarshal(output.Body, &response); err != nil {
+		return BedrockResponse{}, fmt.Errorf("error decoding response: %w", err)
+	}
+	return response, nil
+}
+
+func (c *BedrockClient) invokeModelWithResponseStream(ctx context.Context, target modelClient, jsonPayload []byte, onDelta func(Delta)) (BedrockResponse, error) {
+	output, err := target.invoker.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(target.InferenceProfileARN),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        jsonPayload,
+	})
+	if err != nil {
+		return BedrockResponse{}, err
+	}
+
+	stream := output.GetStream()
+	defer stream.Close()
+
+	response, err := readResponseStream(stream.Events(), onDelta)
+	if err != nil {
+		return BedrockResponse{}, err
+	}
+	if err := stream.Err(); err != nil {
+		return BedrockResponse{}, err
+	}
+	return response, nil
+}
+
+// failoverState is the model of the fallback chain the requests are sent to. It is shared by the tagged clients, so
+// that a throttled model is not tried again by every request until the cooldown has elapsed.
+type failoverState struct {
+	mu       sync.Mutex
+	active   int
+	since    time.Time
+	cooldown time.Duration
+	now      func() time.Time
+}
+
+func newFailoverState(cooldown time.Duration) *failoverState {
+	return &failoverState{cooldown: cooldown, now: time.Now}
+}
+
+// current returns the index of the active model, the primary model once the cooldown has elapsed
+func (s *failoverState) current() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active > 0 && s.now().Sub(s.since) >= s.cooldown {
+		log.Printf("Failover cooldown elapsed, sending the requests to the primary model again")
+		s.active = 0
+	}
+	return s.active
+}
+
+// next fails over from the model at index from and returns the index of the model to use. Concurrent requests failing
+// over from the same model move the chain only once.
+func (s *failoverState) next(from, count int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active <= from && from+1 < count {
+		s.active = from + 1
+		s.since = s.now()
+	}
+	if s.active <= from {
+		return from
+	}
+	return s.active
+}
+
+// streamEvent is an event of a streamed response, E.g content_block_delta
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	Message      *streamStart  `json:"message"`
+	ContentBlock *ContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage Usage `json:"usage"`
+}
+
+type streamStart struct {
+	Usage Usage `json:"usage"`
+}
+
+// readResponseStream rebuilds the response from the events of a stream and sends the text deltas to onDelta
+func readResponseStream(events <-chan types.ResponseStream, onDelta func(Delta)) (BedrockResponse, error) {
+	var response BedrockResponse
+	var toolInputs []strings.Builder
+
+	for event := range events {
+		chunk, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+
+		var e streamEvent
+		if err := json.Unmarshal(chunk.Value.Bytes, &e); err != nil {
+			return BedrockResponse{}, fmt.Errorf("error decoding response stream event: %w", err)
 		}
 
-		return "", fmt.Errorf("empty response from model")
+		switch e.Type {
+		case "message_start":
+			if e.Message != nil {
+				response.Usage.InputTokens = e.Message.Usage.InputTokens
+			}
+		case "content_block_start":
+			if e.ContentBlock == nil || e.Index != len(response.Content) {
+				return BedrockResponse{}, fmt.Errorf("unexpected content block %d in response stream", e.Index)
+			}
+			block := *e.ContentBlock
+			block.Input = nil
+			response.Content = append(response.Content, block)
+			toolInputs = append(toolInputs, strings.Builder{})
+		case "content_block_delta":
+			if e.Index >= len(response.Content) {
+				return BedrockResponse{}, fmt.Errorf("unexpected content block %d in response stream", e.Index)
+			}
+			switch e.Delta.Type {
+			case "text_delta":
+				response.Content[e.Index].Text += e.Delta.Text
+				onDelta(Delta{Text: e.Delta.Text})
+			case "input_json_delta":
+				toolInputs[e.Index].WriteString(e.Delta.PartialJSON)
+				onDelta(Delta{Text: e.Delta.PartialJSON, ToolInput: true})
+			}
+		case "message_delta":
+			response.StopReason = e.Delta.StopReason
+			response.Usage.OutputTokens = e.Usage.OutputTokens
+		}
 	}
 
-	return "", fmt.Errorf("max retries reached without successful response")
+	for i := range response.Content {
+		if response.Content[i].Type == "tool_use" {
+			input := toolInputs[i].String()
+			if input == "" {
+				input = "{}"
+			}
+			response.Content[i].Input = json.RawMessage(input)
+		}
+	}
+	return response, nil
 }
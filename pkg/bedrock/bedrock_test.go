@@ -0,0 +1,277 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInvoker returns the responses in order and records the requests, or always fails with err if it is set
+type fakeInvoker struct {
+	responses []BedrockResponse
+	requests  []BedrockRequest
+	err       error
+	calls     int
+}
+
+func (f *fakeInvoker) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var request BedrockRequest
+	if err := json.Unmarshal(params.Body, &request); err != nil {
+		return nil, err
+	}
+	f.requests = append(f.requests, request)
+
+	body, err := json.Marshal(f.responses[len(f.requests)-1])
+	if err != nil {
+		return nil, err
+	}
+	return &bedrockruntime.InvokeModelOutput{Body: body}, nil
+}
+
+// InvokeModelWithResponseStream is not supported: the stream of the output can't be set outside of the SDK,
+// readResponseStream is tested instead
+func (f *fakeInvoker) InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelWithResponseStreamOutput, error) {
+	return nil, errors.New("streaming is not supported by the fake invoker")
+}
+
+// testClient returns a client sending the requests to the invokers in order, as the primary model then the fallbacks
+func testClient(invokers ...modelInvoker) *BedrockClient {
+	config := DefaultConfig()
+	config.MaxContinuations = 2
+	config.InitialRetryDelay = time.Millisecond
+	config.InferenceProfileARN = testModelARN
+
+	var targets []modelClient
+	for i, invoker := range invokers {
+		targets = append(targets, modelClient{
+			ModelTarget: ModelTarget{InferenceProfileARN: config.InferenceProfileARN, AWSRegion: fmt.Sprintf("region-%d", i)},
+			invoker:     invoker,
+		})
+	}
+
+	return &BedrockClient{
+		targets:     targets,
+		failover:    newFailoverState(config.FailoverCooldown),
+		clockSkew:   &clockSkew{},
+		rateLimiter: NewRateLimiter(config.MaxRequestsPerMinute, config.MaxTokensPerMinute),
+		config:      config,
+		semaphore:   make(chan struct{}, 1),
+		usage:       NewUsageTracker(config.Pricing, config.MaxCost),
+	}
+}
+
+func TestSend(t *testing.T) {
+	invoker := &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "text", Text: " \"a\" \"b\" {}"}}, StopReason: "end_turn"},
+	}}
+
+	request := NewRequest("Generate main.tf")
+	request.System = "You are a Terraform expert"
+	request.Temperature = 0
+	request.StopSequences = []string{"```"}
+	request.Messages = append(request.Messages, Message{Role: "assistant", Content: "resource "})
+
+	response, err := testClient(invoker).Send(request)
+	require.NoError(t, err)
+	assert.Equal(t, ` "a" "b" {}`, response.Text, "the prefill is not part of the response")
+	assert.Equal(t, "end_turn", response.StopReason)
+	assert.Equal(t, 0, response.Continuations)
+
+	require.Len(t, invoker.requests, 1)
+	sent := invoker.requests[0]
+	assert.Equal(t, "You are a Terraform expert", sent.System)
+	assert.Equal(t, []string{"```"}, sent.StopSequences)
+	assert.Equal(t, 0.0, sent.Temperature)
+	assert.Equal(t, Message{Role: "assistant", Content: "resource"}, sent.Messages[1], "the prefill must not end with whitespace")
+}
+
+func TestSendContinuesTruncatedResponses(t *testing.T) {
+	invoker := &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "text", Text: "resource \"a\" \"b\" {\n  "}}, StopReason: "max_tokens"},
+		{Content: []ContentBlock{{Type: "text", Text: "\n  name = \"b\"\n}"}}, StopReason: "end_turn"},
+	}}
+
+	response, err := testClient(invoker).Send(NewRequest("Generate main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, "resource \"a\" \"b\" {\n  name = \"b\"\n}", response.Text)
+	assert.Equal(t, 1, response.Continuations)
+
+	require.Len(t, invoker.requests, 2)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "Generate main.tf"},
+		{Role: "assistant", Content: "resource \"a\" \"b\" {"},
+	}, invoker.requests[1].Messages)
+
+	// too many continuations
+	truncated := BedrockResponse{Content: []ContentBlock{{Type: "text", Text: "resource"}}, StopReason: "max_tokens"}
+	invoker = &fakeInvoker{responses: []BedrockResponse{truncated, truncated, truncated}}
+	_, err = testClient(invoker).Send(NewRequest("Generate main.tf"))
+	assert.ErrorContains(t, err, "after 2 continuations")
+
+	// a truncated tool input can't be continued
+	invoker = &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "tool_use", Name: "write_main_tf", Input: json.RawMessage(`{}`)}}, StopReason: "max_tokens"},
+	}}
+	_, err = testClient(invoker).Send(NewRequest("Generate main.tf"))
+	assert.ErrorIs(t, err, ErrToolInputTruncated)
+}
+
+func TestMessagesWithTool(t *testing.T) {
+	tool := Tool{Name: "write_main_tf", InputSchema: json.RawMessage(`{"type": "object"}`)}
+	invoker := &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "tool_use", Name: "write_main_tf", Input: json.RawMessage(`{"main_tf":"resource"}`)}}, StopReason: "tool_use"},
+		{Content: []ContentBlock{{Type: "text", Text: "resource"}}, StopReason: "end_turn"},
+	}}
+	client := testClient(invoker)
+
+	response, err := client.MessagesWithTool("Generate main.tf", tool)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"main_tf":"resource"}`, string(response.Input))
+	assert.Equal(t, &ToolChoice{Type: "tool", Name: "write_main_tf"}, invoker.requests[0].ToolChoice)
+
+	response, err = client.MessagesWithTool("Generate main.tf", tool)
+	require.NoError(t, err)
+	assert.Nil(t, response.Input)
+	assert.Equal(t, "resource", response.Text)
+
+	// a truncated tool input is generated again as text
+	invoker = &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "tool_use", Name: "write_main_tf", Input: json.RawMessage(`{}`)}}, StopReason: "max_tokens"},
+		{Content: []ContentBlock{{Type: "text", Text: "resource"}}, StopReason: "max_tokens"},
+		{Content: []ContentBlock{{Type: "text", Text: " \"a\" \"b\" {}"}}, StopReason: "end_turn"},
+	}}
+	response, err = testClient(invoker).MessagesWithTool("Generate main.tf", tool)
+	require.NoError(t, err)
+	assert.Equal(t, `resource "a" "b" {}`, response.Text)
+	assert.Nil(t, invoker.requests[1].ToolChoice)
+}
+
+func TestSendRecordsUsage(t *testing.T) {
+	invoker := &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "text", Text: "FROM node"}}, StopReason: "max_tokens", Usage: Usage{InputTokens: 100, OutputTokens: 8192}},
+		{Content: []ContentBlock{{Type: "text", Text: ":20"}}, StopReason: "end_turn", Usage: Usage{InputTokens: 8292, OutputTokens: 10}},
+	}}
+	client := testClient(invoker)
+	client.usage = NewUsageTracker(DefaultPricing(), 0.13)
+
+	response, err := client.WithTags("dockerfile", "web").Send(NewRequest("Generate a Dockerfile"))
+	require.NoError(t, err)
+	assert.Equal(t, Usage{InputTokens: 8392, OutputTokens: 8202}, response.Usage)
+
+	summary := client.Usage()
+	assert.Equal(t, 2, summary.Calls)
+	require.Len(t, summary.Groups, 1)
+	assert.Equal(t, "dockerfile", summary.Groups[0].Stage)
+	assert.Equal(t, "web", summary.Groups[0].AppName)
+
+	// the budget is spent, the next requests are not sent
+	_, err = client.Send(NewRequest("Generate a Dockerfile"))
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Len(t, invoker.requests, 2)
+}
+
+func TestSendFailsOver(t *testing.T) {
+	throttled := &fakeInvoker{err: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Too many requests"}}
+	fallback := &fakeInvoker{responses: []BedrockResponse{
+		{Content: []ContentBlock{{Type: "text", Text: "FROM node:20"}}, StopReason: "end_turn"},
+		{Content: []ContentBlock{{Type: "text", Text: "FROM python:3.12"}}, StopReason: "end_turn"},
+	}}
+	client := testClient(throttled, fallback)
+	client.targets[1].InferenceProfileARN = "anthropic.claude-3-haiku"
+
+	response, err := client.WithTags("dockerfile", "web").Send(NewRequest("Generate a Dockerfile"))
+	require.NoError(t, err)
+	assert.Equal(t, "FROM node:20", response.Text)
+	assert.Equal(t, "anthropic.claude-3-haiku", response.Model)
+	assert.Equal(t, client.config.FailoverAfterRetries, throttled.calls)
+	assert.Equal(t, []string{"anthropic.claude-3-haiku"}, client.Usage().Groups[0].Models)
+
+	// the next requests go to the fallback until the cooldown has elapsed
+	_, err = client.Send(NewRequest("Generate a Dockerfile"))
+	require.NoError(t, err)
+	assert.Equal(t, client.config.FailoverAfterRetries, throttled.calls)
+	assert.Len(t, fallback.requests, 2)
+
+	client.failover.now = func() time.Time { return time.Now().Add(client.config.FailoverCooldown) }
+	assert.Equal(t, 0, client.failover.current())
+}
+
+func TestSendDoesNotFailOverOnClientErrors(t *testing.T) {
+	invalid := &fakeInvoker{err: &smithy.GenericAPIError{Code: "ValidationException", Message: "Malformed input request"}}
+	fallback := &fakeInvoker{}
+
+	_, err := testClient(invalid, fallback).Send(NewRequest("Generate a Dockerfile"))
+	assert.ErrorContains(t, err, "ValidationException")
+	assert.Equal(t, 1, invalid.calls)
+	assert.Equal(t, 0, fallback.calls)
+}
+
+func streamEvents(t *testing.T, events ...string) <-chan types.ResponseStream {
+	ch := make(chan types.ResponseStream, len(events))
+	for _, event := range events {
+		require.True(t, json.Valid([]byte(event)), event)
+		ch <- &types.ResponseStreamMemberChunk{Value: types.PayloadPart{Bytes: []byte(event)}}
+	}
+	close(ch)
+	return ch
+}
+
+func TestReadResponseStream(t *testing.T) {
+	var deltas []Delta
+	response, err := readResponseStream(streamEvents(t,
+		`{"type":"message_start","message":{"usage":{"input_tokens":120,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Writing "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"main.tf"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"write_main_tf","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"main_tf\": "}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"resource\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":42}}`,
+		`{"type":"message_stop","amazon-bedrock-invocationMetrics":{"inputTokenCount":120,"outputTokenCount":42}}`,
+	), func(delta Delta) {
+		deltas = append(deltas, delta)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "tool_use", response.StopReason)
+	assert.Equal(t, Usage{InputTokens: 120, OutputTokens: 42}, response.Usage)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, "Writing main.tf", response.Content[0].Text)
+	assert.Equal(t, "write_main_tf", response.Content[1].Name)
+	assert.JSONEq(t, `{"main_tf": "resource"}`, string(response.Content[1].Input))
+	assert.Equal(t, []Delta{
+		{Text: "Writing "},
+		{Text: "main.tf"},
+		{Text: `{"main_tf": `, ToolInput: true},
+		{Text: `"resource"}`, ToolInput: true},
+	}, deltas)
+
+	_, err = readResponseStream(streamEvents(t, `{"type":"content_block_delta","index":3,"delta":{"type":"text_delta","text":"x"}}`), func(Delta) {})
+	assert.Error(t, err)
+}
+
+func TestSendWithContext(t *testing.T) {
+	invoker := &fakeInvoker{responses: []BedrockResponse{{Content: []ContentBlock{{Type: "text", Text: "FROM node:20"}}, StopReason: "end_turn"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := testClient(invoker).WithContext(ctx).Messages("Generate a Dockerfile")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, invoker.calls)
+}
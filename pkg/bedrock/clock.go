@@ -0,0 +1,96 @@
+package bedrock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ClockSkewThreshold is the clock skew from which AWS rejects the request signatures
+const ClockSkewThreshold = 5 * time.Minute
+
+// clockSkewErrorCodes are the AWS error codes of the requests rejected because of the clock skew
+var clockSkewErrorCodes = map[string]bool{
+	"InvalidSignatureException": true,
+	"SignatureDoesNotMatch":     true,
+	"RequestTimeTooSkewed":      true,
+	"RequestExpired":            true,
+}
+
+// clockSkew is the difference between the AWS time, read from the Date header of the responses, and the local clock.
+// The SDK signs the retries of the rejected requests with the corrected time, the skew is tracked to report it.
+type clockSkew struct {
+	nanos  atomic.Int64
+	warned atomic.Bool
+}
+
+// observe records the skew between the time of a response and the local time it was received at
+func (s *clockSkew) observe(serverTime, localTime time.Time) {
+	skew := serverTime.Sub(localTime)
+	s.nanos.Store(int64(skew))
+	if absDuration(skew) > ClockSkewThreshold && s.warned.CompareAndSwap(false, true) {
+		log.Printf("Warning: the system clock is off by %v from AWS, the requests are signed with the corrected time. Run \"qovery-migration-agent doctor\" for details", skew.Round(time.Second))
+	}
+}
+
+// get returns the last skew observed, 0 before the first response
+func (s *clockSkew) get() time.Duration {
+	return time.Duration(s.nanos.Load())
+}
+
+// addMiddleware adds a middleware recording the skew of the responses to the stack of the Bedrock client
+func (s *clockSkew) addMiddleware(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("RecordClockSkew", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleDeserialize(ctx, in)
+		if response, ok := out.RawResponse.(*smithyhttp.Response); ok {
+			if serverTime, parseErr := http.ParseTime(response.Header.Get("Date")); parseErr == nil {
+				s.observe(serverTime, time.Now())
+			}
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// MeasureClockSkew returns the difference between the time of the Bedrock endpoint of the region and the local clock.
+// It sends an unauthenticated request to AWS, no third party is involved.
+func MeasureClockSkew(ctx context.Context, region string) (time.Duration, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return measureClockSkew(ctx, client, fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/", region))
+}
+
+func measureClockSkew(ctx context.Context, client *http.Client, url string) (time.Duration, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating the clock request: %w", err)
+	}
+
+	sentAt := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting %s: %w", url, err)
+	}
+	defer response.Body.Close()
+	receivedAt := time.Now()
+
+	serverTime, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("no valid Date header in the response of %s", url)
+	}
+
+	// the Date header has a resolution of one second, the middle of the request is the best estimate of the local time
+	localTime := sentAt.Add(receivedAt.Sub(sentAt) / 2)
+	return serverTime.Sub(localTime), nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
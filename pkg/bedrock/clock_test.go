@@ -0,0 +1,48 @@
+package bedrock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockSkewObserve(t *testing.T) {
+	skew := &clockSkew{}
+	assert.Equal(t, time.Duration(0), skew.get())
+
+	now := time.Now()
+	skew.observe(now.Add(-10*time.Minute), now)
+	assert.Equal(t, -10*time.Minute, skew.get())
+	assert.True(t, skew.warned.Load())
+
+	skew.observe(now, now)
+	assert.Equal(t, time.Duration(0), skew.get())
+}
+
+func TestMeasureClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	skew, err := measureClockSkew(context.Background(), server.Client(), server.URL)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Hour), float64(skew), float64(2*time.Second))
+}
+
+func TestSendReportsClockSkew(t *testing.T) {
+	invoker := &fakeInvoker{err: &smithy.GenericAPIError{Code: "InvalidSignatureException", Message: "Signature expired"}}
+	client := testClient(invoker)
+	client.config.MaxRetries = 1
+	client.clockSkew.nanos.Store(int64(20 * time.Minute))
+
+	_, err := client.Send(NewRequest("Generate a Dockerfile"))
+	assert.ErrorContains(t, err, "the system clock is off by 20m0s from AWS")
+}
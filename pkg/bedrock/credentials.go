@@ -0,0 +1,59 @@
+package bedrock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// loadAWSConfig loads the AWS configuration of the client. The static keys are used if they are set, otherwise the
+// credentials come from the default chain: environment, shared profiles and SSO, web identity (E.g IRSA) and instance
+// or container roles.
+func loadAWSConfig(ctx context.Context, awsKey, awsSecret string, cfg ClientConfig) (aws.Config, error) {
+	if (awsKey == "") != (awsSecret == "") {
+		return aws.Config{}, fmt.Errorf("both the AWS access key ID and the secret access key must be set to use static credentials")
+	}
+
+	options := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(cfg.AWSRegion),
+		awsconfig.WithClientLogMode(aws.LogRetries), // Add logging for retries
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return retry.AddWithMaxBackoffDelay(
+				retry.NewStandard(),
+				time.Second*5,
+			)
+		}),
+	}
+	if awsKey != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(awsKey, awsSecret, cfg.AWSSessionToken)))
+	}
+	if cfg.AWSProfile != "" {
+		options = append(options, awsconfig.WithSharedConfigProfile(cfg.AWSProfile))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load AWS SDK config: %w", err)
+	}
+	return awsCfg, nil
+}
+
+// CheckCredentials resolves the AWS credentials the client would use and returns their source,
+// E.g SSOProvider or WebIdentityCredentials
+func CheckCredentials(ctx context.Context, awsKey, awsSecret string, cfg ClientConfig) (string, error) {
+	awsCfg, err := loadAWSConfig(ctx, awsKey, awsSecret, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("no AWS credentials found, set a profile (E.g with aws sso login), a web identity or instance role, or the access keys: %w", err)
+	}
+	return creds.Source, nil
+}
@@ -0,0 +1,32 @@
+package bedrock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCredentials(t *testing.T) {
+	config := DefaultConfig()
+	config.AWSSessionToken = "token"
+
+	source, err := CheckCredentials(context.Background(), "AKIA123", "secret", config)
+	require.NoError(t, err)
+	assert.Equal(t, credentials.StaticCredentialsName, source)
+
+	_, err = CheckCredentials(context.Background(), "AKIA123", "", config)
+	assert.ErrorContains(t, err, "both the AWS access key ID and the secret access key must be set")
+}
+
+func TestCheckCredentialsDefaultChain(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIA456")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+
+	source, err := CheckCredentials(context.Background(), "", "", DefaultConfig())
+	require.NoError(t, err)
+	assert.Equal(t, "EnvConfigCredentials", source)
+}
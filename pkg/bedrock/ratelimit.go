@@ -0,0 +1,137 @@
+package bedrock
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimiterClosed is returned by Wait once the rate limiter is closed
+var ErrRateLimiterClosed = errors.New("rate limiter closed")
+
+// RateLimiter limits the requests per minute and the tokens per minute of the Bedrock quotas. The budgets are refilled
+// continuously. It is safe for concurrent use and can be shared by several clients to respect an account-wide quota.
+type RateLimiter struct {
+	mu                sync.Mutex
+	requestsPerMinute float64
+	tokensPerMinute   float64
+	requests          float64
+	tokens            float64
+	last              time.Time
+	closed            chan struct{}
+	closeOnce         sync.Once
+	now               func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter with full budgets, a limit of 0 means no limit
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	return &RateLimiter{
+		requestsPerMinute: float64(requestsPerMinute),
+		tokensPerMinute:   float64(tokensPerMinute),
+		requests:          float64(requestsPerMinute),
+		tokens:            float64(tokensPerMinute),
+		last:              time.Now(),
+		closed:            make(chan struct{}),
+		now:               time.Now,
+	}
+}
+
+// Wait blocks until a request of the given number of tokens fits in the budgets, then reserves it.
+// A request larger than the tokens per minute waits for the full budget.
+func (r *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	for {
+		delay, err := r.reserve(float64(tokens))
+		if err != nil || delay == 0 {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-r.closed:
+			timer.Stop()
+			return ErrRateLimiterClosed
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes the request from the budgets if it fits, otherwise it returns the time to wait for it to fit
+func (r *RateLimiter) reserve(tokens float64) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.closed:
+		return 0, ErrRateLimiterClosed
+	default:
+	}
+
+	r.refill()
+
+	if r.tokensPerMinute > 0 {
+		tokens = math.Min(tokens, r.tokensPerMinute)
+	}
+
+	var delay time.Duration
+	if r.requestsPerMinute > 0 && r.requests < 1 {
+		delay = maxDuration(delay, missingDuration(1-r.requests, r.requestsPerMinute))
+	}
+	if r.tokensPerMinute > 0 && r.tokens < tokens {
+		delay = maxDuration(delay, missingDuration(tokens-r.tokens, r.tokensPerMinute))
+	}
+	if delay > 0 {
+		return delay, nil
+	}
+
+	if r.requestsPerMinute > 0 {
+		r.requests--
+	}
+	if r.tokensPerMinute > 0 {
+		r.tokens -= tokens
+	}
+	return 0, nil
+}
+
+// Adjust corrects the tokens budget once the actual number of tokens of a request is known
+func (r *RateLimiter) Adjust(reservedTokens, actualTokens int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tokensPerMinute == 0 {
+		return
+	}
+	r.refill()
+	r.tokens = math.Min(r.tokens+float64(reservedTokens-actualTokens), r.tokensPerMinute)
+}
+
+// Close wakes up the waiting requests with ErrRateLimiterClosed, the next requests fail too
+func (r *RateLimiter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+}
+
+func (r *RateLimiter) refill() {
+	now := r.now()
+	elapsed := now.Sub(r.last).Minutes()
+	r.last = now
+	r.requests = math.Min(r.requests+elapsed*r.requestsPerMinute, r.requestsPerMinute)
+	r.tokens = math.Min(r.tokens+elapsed*r.tokensPerMinute, r.tokensPerMinute)
+}
+
+// missingDuration returns the time to refill the missing amount of a budget
+func missingDuration(missing, perMinute float64) time.Duration {
+	return time.Duration(math.Ceil(missing / perMinute * float64(time.Minute)))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,115 @@
+package bedrock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRateLimiter returns a rate limiter with a clock advanced by the returned function
+func testRateLimiter(requestsPerMinute, tokensPerMinute int) (*RateLimiter, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(requestsPerMinute, tokensPerMinute)
+	limiter.last = now
+	limiter.now = func() time.Time { return now }
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRateLimiterRequestsPerMinute(t *testing.T) {
+	limiter, advance := testRateLimiter(2, 0)
+
+	for i := 0; i < 2; i++ {
+		delay, err := limiter.reserve(1000)
+		require.NoError(t, err)
+		assert.Zero(t, delay)
+	}
+
+	delay, err := limiter.reserve(1000)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, delay)
+
+	advance(30 * time.Second)
+	delay, err = limiter.reserve(1000)
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+}
+
+func TestRateLimiterTokensPerMinute(t *testing.T) {
+	limiter, advance := testRateLimiter(0, 1000)
+
+	delay, err := limiter.reserve(800)
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	delay, err = limiter.reserve(400)
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Second, delay)
+
+	advance(12 * time.Second)
+	delay, err = limiter.reserve(400)
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	// a request larger than the quota waits for the full budget
+	advance(time.Minute)
+	delay, err = limiter.reserve(5000)
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+}
+
+func TestRateLimiterAdjust(t *testing.T) {
+	limiter, _ := testRateLimiter(0, 1000)
+
+	_, err := limiter.reserve(900)
+	require.NoError(t, err)
+	limiter.Adjust(900, 100)
+
+	delay, err := limiter.reserve(900)
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	// the budget is never refilled over the quota
+	limiter.Adjust(2000, 0)
+	assert.Equal(t, 1000.0, limiter.tokens)
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	limiter := NewRateLimiter(1, 0)
+	require.NoError(t, limiter.Wait(context.Background(), 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := limiter.Wait(ctx, 0)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestRateLimiterClose(t *testing.T) {
+	limiter := NewRateLimiter(1, 0)
+	require.NoError(t, limiter.Wait(context.Background(), 0))
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(context.Background(), 0)
+	}()
+	limiter.Close()
+	limiter.Close()
+
+	select {
+	case err := <-done:
+		assert.True(t, errors.Is(err, ErrRateLimiterClosed))
+	case <-time.After(time.Second):
+		t.Fatal("Wait was not woken up by Close")
+	}
+	assert.True(t, errors.Is(limiter.Wait(context.Background(), 0), ErrRateLimiterClosed))
+}
+
+func TestRateLimiterNoLimit(t *testing.T) {
+	limiter := NewRateLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, limiter.Wait(context.Background(), 100000))
+	}
+}
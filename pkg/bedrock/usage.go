@@ -0,0 +1,232 @@
+package bedrock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned by the requests sent once the estimated spend reached ClientConfig.MaxCost
+var ErrBudgetExceeded = errors.New("LLM cost budget exceeded")
+
+// Usage is the number of tokens of a request, as reported by the model
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	InputPerMillionTokens  float64 `json:"input_per_million_tokens"`
+	OutputPerMillionTokens float64 `json:"output_per_million_tokens"`
+}
+
+// Cost returns the estimated cost of the usage in USD
+func (p ModelPrice) Cost(usage Usage) float64 {
+	return float64(usage.InputTokens)*p.InputPerMillionTokens/1e6 + float64(usage.OutputTokens)*p.OutputPerMillionTokens/1e6
+}
+
+// DefaultPricing returns the on-demand prices of the Anthropic models on Bedrock, by model id.
+// The prices are matched against the model ARN, the longest matching model id wins.
+func DefaultPricing() map[string]ModelPrice {
+	return map[string]ModelPrice{
+		"anthropic.claude-3-haiku":    {InputPerMillionTokens: 0.25, OutputPerMillionTokens: 1.25},
+		"anthropic.claude-3-5-haiku":  {InputPerMillionTokens: 0.8, OutputPerMillionTokens: 4},
+		"anthropic.claude-3-sonnet":   {InputPerMillionTokens: 3, OutputPerMillionTokens: 15},
+		"anthropic.claude-3-5-sonnet": {InputPerMillionTokens: 3, OutputPerMillionTokens: 15},
+		"anthropic.claude-3-7-sonnet": {InputPerMillionTokens: 3, OutputPerMillionTokens: 15},
+		"anthropic.claude-sonnet-4":   {InputPerMillionTokens: 3, OutputPerMillionTokens: 15},
+		"anthropic.claude-3-opus":     {InputPerMillionTokens: 15, OutputPerMillionTokens: 75},
+		"anthropic.claude-opus-4":     {InputPerMillionTokens: 15, OutputPerMillionTokens: 75},
+	}
+}
+
+// LoadPricing reads a JSON price table, E.g {"anthropic.claude-3-5-sonnet": {"input_per_million_tokens": 3,
+// "output_per_million_tokens": 15}}, and merges it into the default prices
+func LoadPricing(path string) (map[string]ModelPrice, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading LLM pricing file: %w", err)
+	}
+
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal(content, &prices); err != nil {
+		return nil, fmt.Errorf("error decoding LLM pricing file %s: %w", path, err)
+	}
+
+	pricing := DefaultPricing()
+	for model, price := range prices {
+		pricing[model] = price
+	}
+	return pricing, nil
+}
+
+// priceOf returns the price of the model, false if it is not in the pricing
+func priceOf(pricing map[string]ModelPrice, model string) (ModelPrice, bool) {
+	match := ""
+	for id := range pricing {
+		if strings.Contains(model, id) && len(id) > len(match) {
+			match = id
+		}
+	}
+	if match == "" {
+		return ModelPrice{}, false
+	}
+	return pricing[match], true
+}
+
+// Call is a request sent to the model, tagged with the stage and the app it was sent for
+type Call struct {
+	Stage   string
+	AppName string
+	Model   string
+	Usage
+	Cost float64
+}
+
+// UsageTracker records the usage of the requests and enforces the cost budget. It is safe for concurrent use.
+type UsageTracker struct {
+	mu      sync.Mutex
+	calls   []Call
+	pricing map[string]ModelPrice
+	maxCost float64
+}
+
+// NewUsageTracker creates a tracker, maxCost is the budget in USD (0 means no budget)
+func NewUsageTracker(pricing map[string]ModelPrice, maxCost float64) *UsageTracker {
+	return &UsageTracker{pricing: pricing, maxCost: maxCost}
+}
+
+// record adds a call and returns its estimated cost
+func (t *UsageTracker) record(stage, appName, model string, usage Usage) float64 {
+	price, _ := priceOf(t.pricing, model)
+	call := Call{Stage: stage, AppName: appName, Model: model, Usage: usage, Cost: price.Cost(usage)}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, call)
+	return call.Cost
+}
+
+// checkBudget returns ErrBudgetExceeded if the estimated spend reached the budget
+func (t *UsageTracker) checkBudget() error {
+	if t.maxCost <= 0 {
+		return nil
+	}
+
+	summary := t.Summary()
+	if summary.Cost >= t.maxCost {
+		return fmt.Errorf("%w: spent $%.2f of $%.2f", ErrBudgetExceeded, summary.Cost, t.maxCost)
+	}
+	return nil
+}
+
+// UsageSummary is the usage of all the requests, in total and per stage and app
+type UsageSummary struct {
+	Calls int
+	Usage
+	Cost float64
+	// MaxCost is the budget in USD, 0 means no budget
+	MaxCost float64
+	// UnpricedModels are the models without a price, their cost is not estimated
+	UnpricedModels []string
+	Groups         []UsageGroup
+}
+
+// UsageGroup is the usage of the requests of a stage for an app
+type UsageGroup struct {
+	Stage   string
+	AppName string
+	Calls   int
+	Usage
+	Cost float64
+	// Models are the models which answered the requests, more than one after a failover
+	Models []string
+}
+
+// Summary returns the total usage, with the groups sorted by stage and app
+func (t *UsageTracker) Summary() UsageSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := UsageSummary{MaxCost: t.maxCost}
+	groups := map[[2]string]*UsageGroup{}
+	unpriced := map[string]bool{}
+	for _, call := range t.calls {
+		summary.Calls++
+		summary.InputTokens += call.InputTokens
+		summary.OutputTokens += call.OutputTokens
+		summary.Cost += call.Cost
+		if _, ok := priceOf(t.pricing, call.Model); !ok {
+			unpriced[call.Model] = true
+		}
+
+		key := [2]string{call.Stage, call.AppName}
+		group, ok := groups[key]
+		if !ok {
+			group = &UsageGroup{Stage: call.Stage, AppName: call.AppName}
+			groups[key] = group
+		}
+		group.Calls++
+		group.InputTokens += call.InputTokens
+		group.OutputTokens += call.OutputTokens
+		group.Cost += call.Cost
+		if !containsString(group.Models, call.Model) {
+			group.Models = append(group.Models, call.Model)
+		}
+	}
+
+	for _, group := range groups {
+		summary.Groups = append(summary.Groups, *group)
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		if summary.Groups[i].Stage != summary.Groups[j].Stage {
+			return summary.Groups[i].Stage < summary.Groups[j].Stage
+		}
+		return summary.Groups[i].AppName < summary.Groups[j].AppName
+	})
+	for model := range unpriced {
+		summary.UnpricedModels = append(summary.UnpricedModels, model)
+	}
+	sort.Strings(summary.UnpricedModels)
+
+	return summary
+}
+
+// ModelsOf returns the models which answered the requests of the app in the stages
+func (s UsageSummary) ModelsOf(appName string, stages ...string) []string {
+	var models []string
+	for _, group := range s.Groups {
+		if group.AppName != appName || !containsString(stages, group.Stage) {
+			continue
+		}
+		for _, model := range group.Models {
+			if !containsString(models, model) {
+				models = append(models, model)
+			}
+		}
+	}
+	return models
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a one line summary, E.g "12 LLM calls, 48210 input tokens, 9120 output tokens, ~$0.28"
+func (s UsageSummary) String() string {
+	line := fmt.Sprintf("%d LLM calls, %d input tokens, %d output tokens, ~$%.2f", s.Calls, s.InputTokens, s.OutputTokens, s.Cost)
+	if s.MaxCost > 0 {
+		line += fmt.Sprintf(" (budget $%.2f)", s.MaxCost)
+	}
+	return line
+}
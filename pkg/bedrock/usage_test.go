@@ -0,0 +1,63 @@
+package bedrock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModelARN = "arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.anthropic.claude-3-5-sonnet-20241022-v2:0"
+
+func TestPriceOf(t *testing.T) {
+	price, ok := priceOf(DefaultPricing(), testModelARN)
+	assert.True(t, ok)
+	assert.Equal(t, ModelPrice{InputPerMillionTokens: 3, OutputPerMillionTokens: 15}, price)
+
+	price, ok = priceOf(DefaultPricing(), "us.anthropic.claude-3-5-haiku-20241022-v1:0")
+	assert.True(t, ok)
+	assert.Equal(t, 0.8, price.InputPerMillionTokens, "the longest model id must win")
+
+	_, ok = priceOf(DefaultPricing(), "arn:aws:bedrock:us-east-1:123456789012:application-inference-profile/abc")
+	assert.False(t, ok)
+}
+
+func TestLoadPricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"application-inference-profile/abc": {"input_per_million_tokens": 1, "output_per_million_tokens": 2}}`), 0644))
+
+	pricing, err := LoadPricing(path)
+	require.NoError(t, err)
+	assert.Equal(t, ModelPrice{InputPerMillionTokens: 1, OutputPerMillionTokens: 2}, pricing["application-inference-profile/abc"])
+	assert.Contains(t, pricing, "anthropic.claude-3-5-sonnet")
+}
+
+func TestUsageTracker(t *testing.T) {
+	tracker := NewUsageTracker(DefaultPricing(), 0.05)
+	assert.NoError(t, tracker.checkBudget())
+
+	cost := tracker.record("main_tf", "web", testModelARN, Usage{InputTokens: 10000, OutputTokens: 1000})
+	assert.InDelta(t, 0.045, cost, 1e-9)
+	tracker.record("main_tf", "web", testModelARN, Usage{InputTokens: 1000})
+	tracker.record("dockerfile", "web", testModelARN, Usage{OutputTokens: 100})
+	tracker.record("main_tf", "api", "unknown-model", Usage{InputTokens: 1000})
+
+	summary := tracker.Summary()
+	assert.Equal(t, 4, summary.Calls)
+	assert.Equal(t, 12000, summary.InputTokens)
+	assert.Equal(t, 1100, summary.OutputTokens)
+	assert.InDelta(t, 0.0495, summary.Cost, 1e-9)
+	assert.Equal(t, []string{"unknown-model"}, summary.UnpricedModels)
+	require.Len(t, summary.Groups, 3)
+	assert.Equal(t, UsageGroup{Stage: "dockerfile", AppName: "web", Calls: 1, Usage: Usage{OutputTokens: 100}, Cost: 0.0015, Models: []string{testModelARN}}, summary.Groups[0])
+	assert.Equal(t, "api", summary.Groups[1].AppName)
+	assert.Equal(t, 2, summary.Groups[2].Calls)
+	assert.Equal(t, []string{testModelARN}, summary.ModelsOf("web", "main_tf", "variables_tf"))
+	assert.Empty(t, summary.ModelsOf("web", "terraform_fix"))
+	assert.NoError(t, tracker.checkBudget())
+
+	tracker.record("main_tf", "web", testModelARN, Usage{OutputTokens: 100})
+	assert.ErrorIs(t, tracker.checkBudget(), ErrBudgetExceeded)
+}
@@ -0,0 +1,116 @@
+terraform {
+  required_providers {
+    qovery = {
+      source = "qovery/qovery"
+    }
+  }
+}
+
+provider "qovery" {
+  token = var.qovery_access_token
+}
+
+# Managed PostgreSQL database in the same environment as the application
+resource "qovery_database" "postgres" {
+  environment_id = var.environment_id
+  name           = "postgres"
+  type           = "POSTGRESQL"
+  version        = "16"
+  mode           = "MANAGED"
+  accessibility  = "PRIVATE"
+  storage        = 10
+}
+
+resource "qovery_application" "web" {
+  environment_id  = var.environment_id
+  name            = "web"
+  build_mode      = "DOCKER"
+  dockerfile_path = "Dockerfile"
+  cpu             = 500
+  memory          = 512
+
+  min_running_instances = 1
+  max_running_instances = 2
+
+  git_repository = {
+    url       = var.git_url
+    branch    = "main"
+    root_path = "/"
+  }
+
+  ports = [
+    {
+      internal_port       = 8080
+      external_port       = 443
+      protocol            = "HTTP"
+      publicly_accessible = true
+      is_default          = true
+    }
+  ]
+
+  healthchecks = {
+    readiness_probe = {
+      type = {
+        http = {
+          path   = "/"
+          port   = 8080
+          scheme = "HTTP"
+        }
+      }
+      initial_delay_seconds = 30
+      period_seconds        = 10
+      timeout_seconds       = 5
+      success_threshold     = 1
+      failure_threshold     = 3
+    }
+    liveness_probe = {
+      type = {
+        tcp = {
+          port = 8080
+        }
+      }
+      initial_delay_seconds = 30
+      period_seconds        = 10
+      timeout_seconds       = 5
+      success_threshold     = 1
+      failure_threshold     = 3
+    }
+  }
+
+  environment_variables = [
+    {
+      key   = "PORT"
+      value = "8080"
+    }
+  ]
+
+  # The database URL is built from the database resource instead of being copied from the source platform
+  secrets = [
+    {
+      key   = "DATABASE_URL"
+      value = "postgresql://${qovery_database.postgres.login}:${qovery_database.postgres.password}@${qovery_database.postgres.internal_host}:${qovery_database.postgres.port}/postgres"
+    },
+    {
+      key   = "SECRET_KEY_BASE"
+      value = var.secret_key_base
+    }
+  ]
+}
+
+variable "qovery_access_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "environment_id" {
+  type = string
+}
+
+variable "git_url" {
+  type = string
+}
+
+variable "secret_key_base" {
+  type      = string
+  sensitive = true
+}
@@ -0,0 +1,77 @@
+terraform {
+  required_providers {
+    qovery = {
+      source = "qovery/qovery"
+    }
+  }
+}
+
+provider "qovery" {
+  token = var.qovery_access_token
+}
+
+# Release phase: runs the database migrations before each deployment
+resource "qovery_job" "release" {
+  environment_id = var.environment_id
+  name           = "release"
+  cpu            = 500
+  memory         = 512
+
+  source = {
+    docker = {
+      dockerfile_path = "Dockerfile"
+      git_repository = {
+        url       = var.git_url
+        branch    = "main"
+        root_path = "/"
+      }
+    }
+  }
+
+  schedule = {
+    on_start = {
+      arguments = ["bundle", "exec", "rails", "db:migrate"]
+    }
+  }
+}
+
+# Scheduled job running every day at 2am UTC
+resource "qovery_job" "nightly_report" {
+  environment_id = var.environment_id
+  name           = "nightly-report"
+  cpu            = 500
+  memory         = 512
+
+  source = {
+    docker = {
+      dockerfile_path = "Dockerfile"
+      git_repository = {
+        url       = var.git_url
+        branch    = "main"
+        root_path = "/"
+      }
+    }
+  }
+
+  schedule = {
+    cronjob = {
+      schedule = "0 2 * * *"
+      command = {
+        arguments = ["bundle", "exec", "rake", "reports:nightly"]
+      }
+    }
+  }
+}
+
+variable "qovery_access_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "environment_id" {
+  type = string
+}
+
+variable "git_url" {
+  type = string
+}
@@ -0,0 +1,363 @@
+// Package kb manages the knowledge bundle: the Qovery Terraform provider documentation and the Terraform examples
+// given to the LLM as reference when generating the Terraform configurations.
+package kb
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed embedded
+var embeddedFS embed.FS
+
+// FormatVersion is the version of the bundle layout written by this package
+const FormatVersion = 1
+
+const manifestFileName = "manifest.json"
+
+// EmbeddedOrigin is the origin of the bundle embedded in the binary
+const EmbeddedOrigin = "embedded"
+
+// Manifest describes the content of a bundle
+type Manifest struct {
+	FormatVersion int `json:"format_version"`
+	// ProviderSource is the Terraform registry source of the provider, E.g qovery/qovery
+	ProviderSource string `json:"provider_source"`
+	// ProviderVersion is the version of the provider the documentation was taken from, E.g 0.40.0
+	ProviderVersion string    `json:"provider_version"`
+	CreatedAt       time.Time `json:"created_at"`
+	Sources         []Source  `json:"sources,omitempty"`
+}
+
+// Source is a GitHub repository the bundle content was downloaded from
+type Source struct {
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	Ref   string `json:"ref"`
+	// Path is the directory of the repository the content was taken from
+	Path string `json:"path"`
+}
+
+// Example is a Terraform example configuration
+type Example struct {
+	Name    string `json:"name"`
+	Source  string `json:"source,omitempty"`
+	Content string `json:"content"`
+}
+
+// Bundle holds the Qovery Terraform provider documentation and the Terraform examples
+type Bundle struct {
+	Manifest Manifest
+	// Docs are keyed by their path in the provider repository, E.g docs/resources/application.md
+	Docs     map[string]string
+	Examples []Example
+	// Origin is the path the bundle was loaded from, or EmbeddedOrigin
+	Origin string
+
+	// index is built on the first Select, the docs and examples must not be changed afterwards
+	indexOnce sync.Once
+	index     *Index
+}
+
+// DefaultDir returns the directory where `kb sync` stores the bundles by default
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".qovery-migration-agent", "kb")
+	}
+	return filepath.Join(home, ".qovery-migration-agent", "kb")
+}
+
+// Embedded returns the bundle embedded in the binary
+func Embedded() (*Bundle, error) {
+	sub, err := fs.Sub(embeddedFS, "embedded")
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedded knowledge bundle: %w", err)
+	}
+	bundle, err := loadFS(sub)
+	if err != nil {
+		return nil, fmt.Errorf("error loading embedded knowledge bundle: %w", err)
+	}
+	bundle.Origin = EmbeddedOrigin
+	return bundle, nil
+}
+
+// Load loads a bundle from a directory or a tarball (.tar.gz or .tgz).
+// If the directory has no manifest, the most recent bundle synced into it is loaded.
+func Load(bundlePath string) (*Bundle, error) {
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading knowledge bundle %s: %w", bundlePath, err)
+	}
+
+	var bundle *Bundle
+	switch {
+	case !info.IsDir():
+		bundle, err = loadTarball(bundlePath)
+	case fileExists(filepath.Join(bundlePath, manifestFileName)):
+		bundle, err = loadFS(os.DirFS(bundlePath))
+	default:
+		return loadLatest(bundlePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading knowledge bundle %s: %w", bundlePath, err)
+	}
+
+	bundle.Origin = bundlePath
+	return bundle, nil
+}
+
+// LoadOrEmbedded loads the bundle at the given path. Without a path, the most recent bundle synced into
+// DefaultDir is loaded, and the embedded bundle is used as a fallback.
+func LoadOrEmbedded(bundlePath string) (*Bundle, error) {
+	if bundlePath != "" {
+		return Load(bundlePath)
+	}
+	if bundle, err := Load(DefaultDir()); err == nil {
+		return bundle, nil
+	}
+	return Embedded()
+}
+
+// loadLatest loads the bundle with the most recent manifest among the direct children of a directory
+func loadLatest(dir string) (*Bundle, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing knowledge bundles in %s: %w", dir, err)
+	}
+
+	var latest *Bundle
+	for _, entry := range entries {
+		if !entry.IsDir() && !isTarball(entry.Name()) {
+			continue
+		}
+		bundle, err := Load(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if latest == nil || bundle.Manifest.CreatedAt.After(latest.Manifest.CreatedAt) {
+			latest = bundle
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("no knowledge bundle found in %s", dir)
+	}
+	return latest, nil
+}
+
+func loadFS(fsys fs.FS) (*Bundle, error) {
+	bundle := newBundle()
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return bundle.add(p, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bundle, bundle.validate()
+}
+
+func loadTarball(tarballPath string) (*Bundle, error) {
+	f, err := os.Open(tarballPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	bundle := newBundle()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if err := bundle.add(header.Name, content); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, bundle.validate()
+}
+
+func newBundle() *Bundle {
+	return &Bundle{Docs: map[string]string{}}
+}
+
+// add adds a file of the bundle layout:
+//
+//	manifest.json
+//	docs/**/*.md
+//	examples/<owner>/<repo>/<name>/main.tf
+func (b *Bundle) add(p string, content []byte) error {
+	p = path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "./"))
+
+	switch {
+	case p == manifestFileName:
+		if err := json.Unmarshal(content, &b.Manifest); err != nil {
+			return fmt.Errorf("error decoding %s: %w", manifestFileName, err)
+		}
+	case strings.HasPrefix(p, "docs/") && strings.HasSuffix(p, ".md"):
+		b.Docs[p] = string(content)
+	case strings.HasPrefix(p, "examples/") && path.Base(p) == "main.tf":
+		parts := strings.Split(p, "/")
+		if len(parts) != 5 {
+			return nil
+		}
+		b.Examples = append(b.Examples, Example{
+			Name:    parts[3],
+			Source:  parts[1] + "/" + parts[2],
+			Content: string(content),
+		})
+	}
+	return nil
+}
+
+func (b *Bundle) validate() error {
+	if b.Manifest.FormatVersion == 0 {
+		return fmt.Errorf("missing %s", manifestFileName)
+	}
+	if b.Manifest.FormatVersion > FormatVersion {
+		return fmt.Errorf("unsupported bundle format version %d, please upgrade the migration agent", b.Manifest.FormatVersion)
+	}
+	sort.Slice(b.Examples, func(i, j int) bool {
+		if b.Examples[i].Source != b.Examples[j].Source {
+			return b.Examples[i].Source < b.Examples[j].Source
+		}
+		return b.Examples[i].Name < b.Examples[j].Name
+	})
+	return nil
+}
+
+// files returns the content of the bundle keyed by path in the bundle layout
+func (b *Bundle) files() (map[string][]byte, error) {
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s: %w", manifestFileName, err)
+	}
+
+	files := map[string][]byte{manifestFileName: manifest}
+	for p, content := range b.Docs {
+		files[p] = []byte(content)
+	}
+	for _, example := range b.Examples {
+		files[path.Join("examples", example.Source, example.Name, "main.tf")] = []byte(example.Content)
+	}
+	return files, nil
+}
+
+// Write writes the bundle to a directory, or to a tarball if the path ends with .tar.gz or .tgz
+func (b *Bundle) Write(bundlePath string) error {
+	files, err := b.files()
+	if err != nil {
+		return err
+	}
+	if isTarball(bundlePath) {
+		return writeTarball(bundlePath, files)
+	}
+
+	// Load reads the whole directory, so the docs and examples of a previous bundle are removed first. The manifest is
+	// written last so that an interrupted write is not taken for the new version.
+	for _, dir := range []string{"docs", "examples"} {
+		if err := os.RemoveAll(filepath.Join(bundlePath, dir)); err != nil {
+			return fmt.Errorf("error removing the %s of the previous bundle: %w", dir, err)
+		}
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		if p != manifestFileName {
+			paths = append(paths, p)
+		}
+	}
+	paths = append(paths, manifestFileName)
+
+	for _, p := range paths {
+		content := files[p]
+		filePath := filepath.Join(bundlePath, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("error creating directory for %s: %w", filePath, err)
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", filePath, err)
+		}
+	}
+	return nil
+}
+
+func writeTarball(tarballPath string, files map[string][]byte) error {
+	if err := os.MkdirAll(filepath.Dir(tarballPath), 0755); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", tarballPath, err)
+	}
+
+	f, err := os.Create(tarballPath)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", tarballPath, err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		header := &tar.Header{Name: p, Mode: 0644, Size: int64(len(files[p])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing %s to %s: %w", p, tarballPath, err)
+		}
+		if _, err := tw.Write(files[p]); err != nil {
+			return fmt.Errorf("error writing %s to %s: %w", p, tarballPath, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", tarballPath, err)
+	}
+	return gz.Close()
+}
+
+func isTarball(p string) bool {
+	return strings.HasSuffix(p, ".tar.gz") || strings.HasSuffix(p, ".tgz")
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -0,0 +1,164 @@
+package kb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBundle(createdAt time.Time) *Bundle {
+	return &Bundle{
+		Manifest: Manifest{
+			FormatVersion:   FormatVersion,
+			ProviderSource:  "qovery/qovery",
+			ProviderVersion: "0.40.0",
+			CreatedAt:       createdAt,
+			Sources:         []Source{{Owner: "Qovery", Repo: "terraform-provider-qovery", Ref: "v0.40.0", Path: "docs"}},
+		},
+		Docs: map[string]string{
+			"docs/index.md":                 "# Qovery Provider",
+			"docs/resources/application.md": "# qovery_application (Resource)",
+		},
+		Examples: []Example{{Name: "simple-app", Source: "Qovery/terraform-examples", Content: "resource \"qovery_application\" \"app\" {}"}},
+	}
+}
+
+func TestWriteAndLoad(t *testing.T) {
+	bundle := testBundle(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	for _, name := range []string{"v0.40.0", "kb.tar.gz"} {
+		bundlePath := filepath.Join(t.TempDir(), name)
+		require.NoError(t, bundle.Write(bundlePath))
+
+		loaded, err := Load(bundlePath)
+		require.NoError(t, err, name)
+		assert.Equal(t, bundle.Manifest, loaded.Manifest, name)
+		assert.Equal(t, bundle.Docs, loaded.Docs, name)
+		assert.Equal(t, bundle.Examples, loaded.Examples, name)
+		assert.Equal(t, bundlePath, loaded.Origin, name)
+	}
+}
+
+func TestWriteRemovesPreviousBundle(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "v0.40.0")
+	require.NoError(t, testBundle(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).Write(bundlePath))
+
+	// a doc and the examples dropped upstream must not survive a sync into the same directory
+	newer := testBundle(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	newer.Manifest.ProviderVersion = "0.41.0"
+	delete(newer.Docs, "docs/resources/application.md")
+	newer.Examples = nil
+	require.NoError(t, newer.Write(bundlePath))
+
+	loaded, err := Load(bundlePath)
+	require.NoError(t, err)
+	assert.Equal(t, "0.41.0", loaded.Manifest.ProviderVersion)
+	assert.Equal(t, newer.Docs, loaded.Docs)
+	assert.Empty(t, loaded.Examples)
+}
+
+func TestLoadLatest(t *testing.T) {
+	root := t.TempDir()
+	older := testBundle(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	newer := testBundle(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	newer.Manifest.ProviderVersion = "0.41.0"
+
+	require.NoError(t, older.Write(filepath.Join(root, "0.40.0")))
+	require.NoError(t, newer.Write(filepath.Join(root, "0.41.0.tar.gz")))
+
+	loaded, err := Load(root)
+	require.NoError(t, err)
+	assert.Equal(t, "0.41.0", loaded.Manifest.ProviderVersion)
+
+	_, err = Load(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestLoadUnsupportedFormatVersion(t *testing.T) {
+	bundle := testBundle(time.Now())
+	bundle.Manifest.FormatVersion = FormatVersion + 1
+	bundlePath := filepath.Join(t.TempDir(), "kb")
+	require.NoError(t, bundle.Write(bundlePath))
+
+	_, err := Load(bundlePath)
+	assert.ErrorContains(t, err, "unsupported bundle format version")
+}
+
+func TestEmbedded(t *testing.T) {
+	bundle, err := Embedded()
+	require.NoError(t, err)
+	assert.Equal(t, EmbeddedOrigin, bundle.Origin)
+	assert.NotEmpty(t, bundle.Manifest.ProviderVersion)
+	assert.Contains(t, bundle.Docs, "docs/resources/application.md")
+	assert.NotEmpty(t, bundle.Examples)
+}
+
+func githubTarball(t *testing.T, files map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestExtractSource(t *testing.T) {
+	bundle := newBundle()
+
+	provider := githubTarball(t, map[string]string{
+		"Qovery-terraform-provider-qovery-abc123/docs/index.md":                  "index",
+		"Qovery-terraform-provider-qovery-abc123/docs/resources/application.md":  "application",
+		"Qovery-terraform-provider-qovery-abc123/docs/data-sources/cluster.md":   "cluster",
+		"Qovery-terraform-provider-qovery-abc123/docs/guides/nested/ignored.md":  "ignored",
+		"Qovery-terraform-provider-qovery-abc123/README.md":                      "ignored",
+		"Qovery-terraform-provider-qovery-abc123/examples/resources/app/main.tf": "ignored",
+	})
+	require.NoError(t, extractSource(provider, Source{Owner: "Qovery", Repo: "terraform-provider-qovery", Ref: "v0.40.0", Path: "docs"}, bundle))
+
+	examples := githubTarball(t, map[string]string{
+		"Qovery-terraform-examples-def456/examples/simple-app/main.tf":      "simple",
+		"Qovery-terraform-examples-def456/examples/simple-app/variables.tf": "ignored",
+		"Qovery-terraform-examples-def456/examples/nested/app/main.tf":      "ignored",
+		"Qovery-terraform-examples-def456/main.tf":                          "ignored",
+	})
+	require.NoError(t, extractSource(examples, Source{Owner: "Qovery", Repo: "terraform-examples", Ref: "main", Path: "examples"}, bundle))
+
+	root := githubTarball(t, map[string]string{
+		"evoxmusic-qovery-airbyte-789/airbyte/main.tf": "airbyte",
+	})
+	require.NoError(t, extractSource(root, Source{Owner: "evoxmusic", Repo: "qovery-airbyte", Ref: "main", Path: "."}, bundle))
+
+	assert.Equal(t, map[string]string{
+		"docs/index.md":                 "index",
+		"docs/resources/application.md": "application",
+		"docs/data-sources/cluster.md":  "cluster",
+	}, bundle.Docs)
+	assert.Equal(t, []Example{
+		{Name: "simple-app", Source: "Qovery/terraform-examples", Content: "simple"},
+		{Name: "airbyte", Source: "evoxmusic/qovery-airbyte", Content: "airbyte"},
+	}, bundle.Examples)
+}
+
+func TestParseSource(t *testing.T) {
+	source, err := ParseSource("Qovery/terraform-examples/examples@main")
+	assert.NoError(t, err)
+	assert.Equal(t, Source{Owner: "Qovery", Repo: "terraform-examples", Ref: "main", Path: "examples"}, source)
+
+	source, err = ParseSource("evoxmusic/qovery-airbyte")
+	assert.NoError(t, err)
+	assert.Equal(t, Source{Owner: "evoxmusic", Repo: "qovery-airbyte", Path: "."}, source)
+
+	_, err = ParseSource("terraform-examples")
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+package kb
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Document kinds of the index
+const (
+	DocumentKindDoc     = "doc"
+	DocumentKindExample = "example"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+var (
+	tokenSplitRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+	stopWords        = map[string]bool{
+		"the": true, "and": true, "for": true, "with": true, "this": true, "that": true, "are": true, "can": true,
+		"from": true, "you": true, "not": true, "use": true, "will": true, "all": true, "true": true, "false": true,
+		"string": true, "number": true, "bool": true, "var": true, "resource": true, "qovery": true,
+	}
+)
+
+// SearchResult is a document of the index matching a query
+type SearchResult struct {
+	ID    string
+	Kind  string
+	Score float64
+}
+
+// Index is a BM25 index of the docs and examples of a bundle
+type Index struct {
+	documents []indexedDocument
+	docFreq   map[string]int
+	avgLength float64
+}
+
+type indexedDocument struct {
+	id       string
+	kind     string
+	termFreq map[string]int
+	length   int
+}
+
+// Selection is the subset of the bundle relevant to a query
+type Selection struct {
+	Docs     map[string]string
+	Examples []Example
+	// Tokens is the estimated number of tokens of the selected docs and examples
+	Tokens int
+}
+
+// EstimateTokens returns a rough estimation of the number of LLM tokens of a text (~4 characters per token)
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// tokenize splits a text into lowercase terms. The plural "s" is removed so that E.g "databases" matches "database".
+func tokenize(text string) []string {
+	var terms []string
+	for _, term := range tokenSplitRegexp.Split(strings.ToLower(text), -1) {
+		if len(term) < 2 || stopWords[term] {
+			continue
+		}
+		if len(term) > 3 && strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss") {
+			term = strings.TrimSuffix(term, "s")
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// NewIndex indexes the docs and examples of a bundle. The doc paths and example names are indexed twice to boost them.
+func NewIndex(bundle *Bundle) *Index {
+	index := &Index{docFreq: map[string]int{}}
+
+	docPaths := make([]string, 0, len(bundle.Docs))
+	for p := range bundle.Docs {
+		docPaths = append(docPaths, p)
+	}
+	sort.Strings(docPaths)
+
+	for _, p := range docPaths {
+		index.add(p, DocumentKindDoc, strings.Repeat(p+" ", 2)+bundle.Docs[p])
+	}
+	for _, example := range bundle.Examples {
+		index.add(exampleID(example), DocumentKindExample, strings.Repeat(example.Name+" ", 2)+example.Content)
+	}
+
+	totalLength := 0
+	for _, document := range index.documents {
+		totalLength += document.length
+	}
+	if len(index.documents) > 0 {
+		index.avgLength = float64(totalLength) / float64(len(index.documents))
+	}
+
+	return index
+}
+
+func (i *Index) add(id, kind, text string) {
+	document := indexedDocument{id: id, kind: kind, termFreq: map[string]int{}}
+	for _, term := range tokenize(text) {
+		if document.termFreq[term] == 0 {
+			i.docFreq[term]++
+		}
+		document.termFreq[term]++
+		document.length++
+	}
+	i.documents = append(i.documents, document)
+}
+
+// Search returns the documents matching the query sorted by descending BM25 score
+func (i *Index) Search(query string) []SearchResult {
+	queryTerms := map[string]bool{}
+	for _, term := range tokenize(query) {
+		queryTerms[term] = true
+	}
+
+	var results []SearchResult
+	n := float64(len(i.documents))
+	for _, document := range i.documents {
+		score := 0.0
+		for term := range queryTerms {
+			tf := float64(document.termFreq[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(i.docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(document.length)/i.avgLength))
+		}
+		if score > 0 {
+			results = append(results, SearchResult{ID: document.id, Kind: document.kind, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Score > results[b].Score
+	})
+	return results
+}
+
+// Select returns the required docs followed by the docs and examples matching the query, within the token budget.
+// A document that doesn't fit in the remaining budget is skipped in favour of smaller ones.
+// Everything is selected if the token budget is 0 or less.
+func (b *Bundle) Select(query string, required []string, tokenBudget int) Selection {
+	selection := Selection{Docs: map[string]string{}}
+
+	if tokenBudget <= 0 {
+		for p, content := range b.Docs {
+			selection.Docs[p] = content
+			selection.Tokens += EstimateTokens(content)
+		}
+		for _, example := range b.Examples {
+			selection.Examples = append(selection.Examples, example)
+			selection.Tokens += EstimateTokens(example.Content)
+		}
+		return selection
+	}
+
+	examples := map[string]Example{}
+	for _, example := range b.Examples {
+		examples[exampleID(example)] = example
+	}
+
+	selected := map[string]bool{}
+	add := func(id, kind string) {
+		if selected[id] {
+			return
+		}
+		var content string
+		switch kind {
+		case DocumentKindDoc:
+			content = b.Docs[id]
+		case DocumentKindExample:
+			content = examples[id].Content
+		}
+		tokens := EstimateTokens(content)
+		if content == "" || selection.Tokens+tokens > tokenBudget {
+			return
+		}
+		selected[id] = true
+		selection.Tokens += tokens
+		if kind == DocumentKindDoc {
+			selection.Docs[id] = content
+		} else {
+			selection.Examples = append(selection.Examples, examples[id])
+		}
+	}
+
+	for _, p := range required {
+		add(p, DocumentKindDoc)
+	}
+	b.indexOnce.Do(func() {
+		b.index = NewIndex(b)
+	})
+	for _, result := range b.index.Search(query) {
+		add(result.ID, result.Kind)
+	}
+
+	return selection
+}
+
+func exampleID(example Example) string {
+	return example.Source + "/" + example.Name
+}
@@ -0,0 +1,72 @@
+package kb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func retrievalBundle() *Bundle {
+	return &Bundle{
+		Docs: map[string]string{
+			"docs/index.md":                  "# Qovery Provider\nConfigure the provider with an API token.",
+			"docs/resources/application.md":  "# qovery_application\nDeploy an application from a git repository with ports and healthchecks.",
+			"docs/resources/database.md":     "# qovery_database\nCreate a managed or container database: POSTGRESQL, MYSQL, MONGODB or REDIS.",
+			"docs/resources/job.md":          "# qovery_job\nRun a job on_start or as a cronjob with a schedule.",
+			"docs/resources/helm.md":         "# qovery_helm\nDeploy a Helm chart from a Helm repository.",
+			"docs/data-sources/cluster.md":   "# qovery_cluster\nRead a cluster.",
+			"docs/resources/organization.md": "# qovery_organization\n" + strings.Repeat("Manage an organization. ", 200),
+		},
+		Examples: []Example{
+			{Name: "postgresql-database", Source: "Qovery/terraform-examples", Content: `resource "qovery_database" "db" { type = "POSTGRESQL" }`},
+			{Name: "helm-chart", Source: "Qovery/terraform-examples", Content: `resource "qovery_helm" "chart" {}`},
+		},
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"database", "postgresql", "job", "on", "start"}, tokenize("The Databases: POSTGRESQL, jobs on_start"))
+}
+
+func TestSearch(t *testing.T) {
+	results := NewIndex(retrievalBundle()).Search("heroku-postgresql database")
+
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	assert.Equal(t, []string{"Qovery/terraform-examples/postgresql-database", "docs/resources/database.md"}, ids)
+	assert.Empty(t, NewIndex(retrievalBundle()).Search("unrelated"))
+}
+
+func TestSelect(t *testing.T) {
+	bundle := retrievalBundle()
+
+	selection := bundle.Select("postgresql database scheduler job cronjob", []string{"docs/index.md", "docs/resources/missing.md"}, 1000)
+	assert.ElementsMatch(t, []string{"docs/index.md", "docs/resources/database.md", "docs/resources/job.md"}, mapKeys(selection.Docs))
+	assert.Equal(t, []Example{bundle.Examples[0]}, selection.Examples)
+	assert.LessOrEqual(t, selection.Tokens, 1000)
+	// the index is built once and reused by the next selections
+	index := bundle.index
+	assert.NotNil(t, index)
+
+	// the required docs are selected first, the least relevant docs are dropped when the budget is exhausted
+	selection = bundle.Select("postgresql database scheduler job cronjob", []string{"docs/index.md"}, EstimateTokens(bundle.Docs["docs/index.md"])+EstimateTokens(bundle.Examples[0].Content))
+	assert.Equal(t, []string{"docs/index.md"}, mapKeys(selection.Docs))
+	assert.Equal(t, []Example{bundle.Examples[0]}, selection.Examples)
+	assert.Same(t, index, bundle.index)
+
+	// no budget: everything is selected
+	selection = bundle.Select("postgresql", nil, 0)
+	assert.Len(t, selection.Docs, len(bundle.Docs))
+	assert.Len(t, selection.Examples, len(bundle.Examples))
+}
+
+func mapKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,217 @@
+package kb
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	providerOwner  = "Qovery"
+	providerRepo   = "terraform-provider-qovery"
+	providerSource = "qovery/qovery"
+)
+
+// exampleSources are the repositories the Terraform examples are downloaded from
+var exampleSources = []Source{
+	{Owner: "Qovery", Repo: "terraform-examples", Ref: "main", Path: "examples"},
+	{Owner: "evoxmusic", Repo: "qovery-airbyte", Ref: "main", Path: "."},
+}
+
+// NewGitHubClient creates a new GitHub client with optional authentication
+func NewGitHubClient(token string) *github.Client {
+	ctx := context.Background()
+	if token != "" {
+		ts := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: token},
+		)
+		tc := oauth2.NewClient(ctx, ts)
+		return github.NewClient(tc)
+	}
+	return github.NewClient(nil)
+}
+
+// Sync downloads the documentation of the latest Qovery Terraform provider release and the Terraform examples.
+// Each repository is downloaded as a single archive to stay far below the GitHub API rate limits.
+func Sync(githubToken string) (*Bundle, error) {
+	client := NewGitHubClient(githubToken)
+	ctx := context.Background()
+
+	release, _, err := client.Repositories.GetLatestRelease(ctx, providerOwner, providerRepo)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the latest release of %s/%s: %w", providerOwner, providerRepo, err)
+	}
+
+	bundle := newBundle()
+	bundle.Manifest = Manifest{
+		FormatVersion:   FormatVersion,
+		ProviderSource:  providerSource,
+		ProviderVersion: strings.TrimPrefix(release.GetTagName(), "v"),
+		CreatedAt:       time.Now().UTC(),
+	}
+
+	sources := append([]Source{{Owner: providerOwner, Repo: providerRepo, Ref: release.GetTagName(), Path: "docs"}}, exampleSources...)
+	for _, source := range sources {
+		fmt.Printf("Downloading %s/%s@%s\n", source.Owner, source.Repo, source.Ref)
+		if err := downloadSource(ctx, client, source, bundle); err != nil {
+			return nil, err
+		}
+		bundle.Manifest.Sources = append(bundle.Manifest.Sources, source)
+	}
+
+	return bundle, bundle.validate()
+}
+
+func downloadSource(ctx context.Context, client *github.Client, source Source, bundle *Bundle) error {
+	archiveURL, _, err := client.Repositories.GetArchiveLink(ctx, source.Owner, source.Repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: source.Ref}, true)
+	if err != nil {
+		return fmt.Errorf("error fetching the archive link of %s/%s: %w", source.Owner, source.Repo, err)
+	}
+
+	resp, err := http.Get(archiveURL.String())
+	if err != nil {
+		return fmt.Errorf("error downloading %s/%s: %w", source.Owner, source.Repo, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading %s/%s: unexpected status code %d", source.Owner, source.Repo, resp.StatusCode)
+	}
+
+	if err := extractSource(resp.Body, source, bundle); err != nil {
+		return fmt.Errorf("error extracting %s/%s: %w", source.Owner, source.Repo, err)
+	}
+	return nil
+}
+
+// extractSource adds the documentation or the examples of a GitHub repository tarball to the bundle.
+// The provider documentation is taken from docs/, docs/resources and docs/data-sources, and the examples
+// are the main.tf files of the direct subdirectories of the source path.
+func extractSource(r io.Reader, source Source, bundle *Bundle) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// GitHub archives have a single top level directory named <owner>-<repo>-<sha>
+		parts := strings.SplitN(header.Name, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		p := parts[1]
+
+		var bundlePath string
+		if source.Path == "docs" {
+			dir := path.Dir(p)
+			if (dir == "docs" || dir == "docs/resources" || dir == "docs/data-sources") && strings.HasSuffix(p, ".md") {
+				bundlePath = p
+			}
+		} else {
+			rel := p
+			if source.Path != "." {
+				if !strings.HasPrefix(p, source.Path+"/") {
+					continue
+				}
+				rel = strings.TrimPrefix(p, source.Path+"/")
+			}
+			if segments := strings.Split(rel, "/"); len(segments) == 2 && segments[1] == "main.tf" {
+				bundlePath = path.Join("examples", source.Owner, source.Repo, segments[0], "main.tf")
+			}
+		}
+		if bundlePath == "" {
+			continue
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := bundle.add(bundlePath, content); err != nil {
+			return err
+		}
+	}
+}
+
+// ParseSource parses a GitHub repository given as owner/repo[/path][@ref]. The path defaults to the repository root
+// and the ref to the default branch.
+func ParseSource(spec string) (Source, error) {
+	source := Source{Path: "."}
+	if idx := strings.LastIndex(spec, "@"); idx != -1 {
+		source.Ref = spec[idx+1:]
+		spec = spec[:idx]
+	}
+
+	parts := strings.SplitN(strings.Trim(spec, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return Source{}, fmt.Errorf("invalid repository %q, expected owner/repo[/path][@ref]", spec)
+	}
+	source.Owner, source.Repo = parts[0], parts[1]
+	if len(parts) == 3 && parts[2] != "" {
+		source.Path = strings.Trim(parts[2], "/")
+	}
+	return source, nil
+}
+
+// LoadExamples loads the Terraform examples of a local directory, or downloads them from a GitHub repository given as
+// owner/repo[/path][@ref]. The examples are the main.tf files of the direct subdirectories.
+func LoadExamples(spec, githubToken string) ([]Example, error) {
+	if info, err := os.Stat(spec); err == nil && info.IsDir() {
+		return loadLocalExamples(spec)
+	}
+
+	source, err := ParseSource(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := newBundle()
+	if err := downloadSource(context.Background(), NewGitHubClient(githubToken), source, bundle); err != nil {
+		return nil, err
+	}
+	return bundle.Examples, nil
+}
+
+func loadLocalExamples(dir string) ([]Example, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing examples in %s: %w", dir, err)
+	}
+
+	var examples []Example
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name(), "main.tf"))
+		if err != nil {
+			continue // Skip if main.tf doesn't exist
+		}
+		examples = append(examples, Example{Name: entry.Name(), Source: filepath.ToSlash(filepath.Clean(dir)), Content: string(content)})
+	}
+	return examples, nil
+}
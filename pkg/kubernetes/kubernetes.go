@@ -0,0 +1,340 @@
+// Package kubernetes renders the Qovery target environment of an application as a Helm chart, or as the Kubernetes
+// manifests of this chart, for the teams deploying to their own cluster without Qovery.
+package kubernetes
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed templates/*.yaml
+var chartTemplatesFS embed.FS
+
+// SecretPlaceholder is the value of the secrets in the generated files, the values of the source are never written
+const SecretPlaceholder = qovery.SecretPlaceholder
+
+const (
+	// defaultTargetCPUUtilization is the average CPU utilization targeted by the autoscalers, in percent
+	defaultTargetCPUUtilization = 70
+	// placeholderDomain is the domain of the public services without a custom domain
+	placeholderDomain = "example.com"
+	// defaultCPU and defaultMemory are the resources of the services without resources, in millicores and MB
+	defaultCPU    = 500
+	defaultMemory = 512
+)
+
+// invalidNameCharsRegexp matches the characters not allowed in a Kubernetes name
+var invalidNameCharsRegexp = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Options holds the configuration options of the generated chart
+type Options struct {
+	// ImageRegistry is the registry the images built from the Dockerfiles are pushed to, E.g an ECR registry
+	ImageRegistry string
+	// IngressClassName is the class of the ingresses, E.g alb for the AWS Load Balancer Controller.
+	// Empty means the default class of the cluster.
+	IngressClassName string
+}
+
+// DefaultOptions returns the default options, the image registry is a placeholder
+func DefaultOptions() Options {
+	return Options{ImageRegistry: "registry.example.com"}
+}
+
+// Values are the values.yaml of the chart of an environment
+type Values struct {
+	Ingress  IngressValues            `yaml:"ingress"`
+	Services map[string]ServiceValues `yaml:"services"`
+	Jobs     map[string]JobValues     `yaml:"jobs"`
+}
+
+// IngressValues are the settings shared by the ingresses
+type IngressValues struct {
+	ClassName string `yaml:"className"`
+}
+
+// ServiceValues are the values of a long-running service: a Deployment, its Service, Ingress, Secret and autoscaler
+type ServiceValues struct {
+	Image       ImageValues        `yaml:"image"`
+	Replicas    int                `yaml:"replicas"`
+	Args        []string           `yaml:"args,omitempty"`
+	Ports       []PortValues       `yaml:"ports,omitempty"`
+	Resources   ResourceValues     `yaml:"resources"`
+	Healthcheck *HealthcheckValues `yaml:"healthcheck,omitempty"`
+	Env         map[string]string  `yaml:"env,omitempty"`
+	// Secrets are set as the environment of the service from a Secret, their values are placeholders
+	Secrets     map[string]string   `yaml:"secrets,omitempty"`
+	Ingress     ServiceIngressValue `yaml:"ingress"`
+	Autoscaling AutoscalingValues   `yaml:"autoscaling"`
+}
+
+// JobValues are the values of a CronJob, or of a Job run before each install and upgrade if it has no schedule
+type JobValues struct {
+	Image    ImageValues       `yaml:"image"`
+	Args     []string          `yaml:"args,omitempty"`
+	Schedule string            `yaml:"schedule,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	// SecretsFrom is the service whose Secret is set as the environment of the job
+	SecretsFrom string         `yaml:"secretsFrom,omitempty"`
+	Resources   ResourceValues `yaml:"resources"`
+}
+
+// ImageValues is the image of a service
+type ImageValues struct {
+	Repository string `yaml:"repository"`
+	Tag        string `yaml:"tag"`
+}
+
+// PortValues is a port of a service
+type PortValues struct {
+	Name     string `yaml:"name"`
+	Port     int    `yaml:"port"`
+	Protocol string `yaml:"protocol"`
+}
+
+// ResourceValues are the resources of a container, as Kubernetes quantities
+type ResourceValues struct {
+	Requests map[string]string `yaml:"requests"`
+	Limits   map[string]string `yaml:"limits"`
+}
+
+// HealthcheckValues is the readiness and liveness probe of a service
+type HealthcheckValues struct {
+	Type string `yaml:"type"`
+	Port int    `yaml:"port"`
+	Path string `yaml:"path,omitempty"`
+}
+
+// ServiceIngressValue are the public hosts of a service, it has no Ingress if empty
+type ServiceIngressValue struct {
+	Hosts []string `yaml:"hosts"`
+	// Port is the name of the port the hosts are routed to
+	Port string `yaml:"port,omitempty"`
+}
+
+// AutoscalingValues is the HorizontalPodAutoscaler of a service
+type AutoscalingValues struct {
+	Enabled                        bool `yaml:"enabled"`
+	MinReplicas                    int  `yaml:"minReplicas"`
+	MaxReplicas                    int  `yaml:"maxReplicas"`
+	TargetCPUUtilizationPercentage int  `yaml:"targetCPUUtilizationPercentage"`
+}
+
+// NewValues returns the values of the chart of an environment. The applications and containers are services, the
+// databases are not deployed: their connection variables are secrets of the applications.
+func NewValues(env qovery.Environment, options Options) Values {
+	values := Values{
+		Ingress:  IngressValues{ClassName: options.IngressClassName},
+		Services: map[string]ServiceValues{},
+		Jobs:     map[string]JobValues{},
+	}
+
+	var connectionVariables []string
+	for _, database := range env.Databases {
+		connectionVariables = append(connectionVariables, database.ConnectionVariables...)
+	}
+
+	applicationImages := map[string]ImageValues{}
+	for _, application := range env.Applications {
+		name := Name(application.Name)
+		image := ImageValues{Repository: strings.TrimSuffix(options.ImageRegistry, "/") + "/" + name, Tag: "latest"}
+		applicationImages[application.Name] = image
+
+		service := newServiceValues(image, application.Arguments, application.Resources, application.Ports, application.Healthcheck, application.EnvironmentVariables)
+		for _, secret := range application.Secrets {
+			service.Secrets[secret.Key] = SecretPlaceholder
+		}
+		for _, key := range connectionVariables {
+			service.Secrets[key] = SecretPlaceholder
+		}
+		service.Ingress = ingressValues(name, application.Ports, application.CustomDomains)
+		values.Services[name] = service
+	}
+
+	for _, container := range env.Containers {
+		name := Name(container.Name)
+		image := ImageValues{Repository: container.ImageName, Tag: container.Tag}
+		if image.Tag == "" {
+			image.Tag = "latest"
+		}
+		service := newServiceValues(image, container.Arguments, container.Resources, container.Ports, container.Healthcheck, container.EnvironmentVariables)
+		for _, secret := range container.Secrets {
+			service.Secrets[secret.Key] = SecretPlaceholder
+		}
+		service.Ingress = ingressValues(name, container.Ports, nil)
+		values.Services[name] = service
+	}
+
+	for _, job := range env.Jobs {
+		jobValues := JobValues{
+			Image:     applicationImages[job.Application],
+			Args:      job.Arguments,
+			Schedule:  job.Schedule,
+			Resources: resourceValues(job.Resources),
+		}
+		// the jobs run the image of their application, with its environment
+		if service, ok := values.Services[Name(job.Application)]; ok {
+			jobValues.Env = service.Env
+			if len(service.Secrets) > 0 {
+				jobValues.SecretsFrom = Name(job.Application)
+			}
+		}
+		values.Jobs[Name(job.Name)] = jobValues
+	}
+
+	return values
+}
+
+func newServiceValues(image ImageValues, args []string, resources qovery.Resources, ports []qovery.Port, healthcheck *qovery.Healthcheck, variables []qovery.EnvironmentVariable) ServiceValues {
+	service := ServiceValues{
+		Image:     image,
+		Replicas:  resources.MinRunningInstances,
+		Args:      args,
+		Resources: resourceValues(resources),
+		Env:       map[string]string{},
+		Secrets:   map[string]string{},
+		Ingress:   ServiceIngressValue{Hosts: []string{}},
+	}
+	if service.Replicas < 1 {
+		service.Replicas = 1
+	}
+	if resources.MaxRunningInstances > service.Replicas {
+		service.Autoscaling = AutoscalingValues{
+			Enabled:                        true,
+			MinReplicas:                    service.Replicas,
+			MaxReplicas:                    resources.MaxRunningInstances,
+			TargetCPUUtilizationPercentage: defaultTargetCPUUtilization,
+		}
+	}
+
+	for _, port := range ports {
+		protocol := "TCP"
+		if port.Protocol == "UDP" {
+			protocol = "UDP"
+		}
+		service.Ports = append(service.Ports, PortValues{Name: portName(port), Port: port.InternalPort, Protocol: protocol})
+	}
+	if healthcheck != nil {
+		service.Healthcheck = &HealthcheckValues{Type: healthcheck.Type, Port: healthcheck.Port, Path: healthcheck.Path}
+		if healthcheck.Type == "HTTP" && healthcheck.Path == "" {
+			service.Healthcheck.Path = "/"
+		}
+	}
+	for _, variable := range variables {
+		service.Env[variable.Key] = variable.Value
+	}
+	return service
+}
+
+// ingressValues returns the hosts of the first public port: the custom domains, or a placeholder host
+func ingressValues(name string, ports []qovery.Port, domains []qovery.CustomDomain) ServiceIngressValue {
+	for _, port := range ports {
+		if !port.PubliclyAccessible || port.Protocol == "TCP" || port.Protocol == "UDP" {
+			continue
+		}
+		ingress := ServiceIngressValue{Hosts: []string{}, Port: portName(port)}
+		for _, domain := range domains {
+			ingress.Hosts = append(ingress.Hosts, domain.Domain)
+		}
+		if len(ingress.Hosts) == 0 {
+			ingress.Hosts = append(ingress.Hosts, fmt.Sprintf("%s.%s", name, placeholderDomain))
+		}
+		return ingress
+	}
+	return ServiceIngressValue{Hosts: []string{}}
+}
+
+// resourceValues returns the requests and limits of a container: the memory is limited, not the CPU to avoid throttling
+func resourceValues(resources qovery.Resources) ResourceValues {
+	cpu, memory := resources.CPU, resources.Memory
+	if cpu <= 0 {
+		cpu = defaultCPU
+	}
+	if memory <= 0 {
+		memory = defaultMemory
+	}
+	return ResourceValues{
+		Requests: map[string]string{"cpu": fmt.Sprintf("%dm", cpu), "memory": fmt.Sprintf("%dMi", memory)},
+		Limits:   map[string]string{"memory": fmt.Sprintf("%dMi", memory)},
+	}
+}
+
+// portName returns the name of a container port, at most 15 characters
+func portName(port qovery.Port) string {
+	name := Name(port.Name)
+	if name == "" {
+		name = fmt.Sprintf("p%d", port.InternalPort)
+	}
+	if len(name) > 15 {
+		name = strings.TrimRight(name[:15], "-")
+	}
+	return name
+}
+
+// Name returns a valid Kubernetes name, E.g my-app for My_App
+func Name(name string) string {
+	return strings.Trim(invalidNameCharsRegexp.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Chart returns the files of the Helm chart of an environment: Chart.yaml, values.yaml and the templates
+func Chart(env qovery.Environment, options Options) (map[string]string, error) {
+	values, err := marshalYAML(NewValues(env, options))
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling the values of %s: %w", env.Name, err)
+	}
+
+	files := map[string]string{
+		"Chart.yaml": fmt.Sprintf(`apiVersion: v2
+name: %s
+description: Kubernetes resources of %s, generated by the Qovery migration agent
+type: application
+version: 0.1.0
+appVersion: "latest"
+`, Name(env.Name), env.Name),
+		"values.yaml": "# The secrets are placeholders, set them with --set or a values file kept out of the repository\n" + values,
+	}
+
+	entries, err := chartTemplatesFS.ReadDir("templates")
+	if err != nil {
+		return nil, fmt.Errorf("error reading the chart templates: %w", err)
+	}
+	for _, entry := range entries {
+		content, err := chartTemplatesFS.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading the chart template %s: %w", entry.Name(), err)
+		}
+		files["templates/"+entry.Name()] = string(content)
+	}
+	return files, nil
+}
+
+// Images returns the images of the services built from the Dockerfiles, they must be pushed to the registry
+func Images(env qovery.Environment, options Options) []string {
+	values := NewValues(env, options)
+	var images []string
+	for _, application := range env.Applications {
+		image := values.Services[Name(application.Name)].Image
+		images = append(images, image.Repository+":"+image.Tag)
+	}
+	sort.Strings(images)
+	return images
+}
+
+func marshalYAML(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
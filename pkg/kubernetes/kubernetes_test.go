@@ -0,0 +1,124 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEnvironment() qovery.Environment {
+	return qovery.Environment{
+		Name: "My Shop",
+		Applications: []qovery.Application{{
+			Name:                 "web",
+			Arguments:            []string{"bundle", "exec", "puma"},
+			Resources:            qovery.Resources{CPU: 250, Memory: 1024, MinRunningInstances: 2, MaxRunningInstances: 4},
+			Ports:                []qovery.Port{{Name: "p8080", InternalPort: 8080, Protocol: "HTTP", PubliclyAccessible: true}},
+			Healthcheck:          &qovery.Healthcheck{Type: "HTTP", Port: 8080},
+			EnvironmentVariables: []qovery.EnvironmentVariable{{Key: "PORT", Value: "8080"}},
+			Secrets:              []qovery.Secret{{Key: "SECRET_KEY_BASE", Value: "s3cr3t"}},
+			CustomDomains:        []qovery.CustomDomain{{Domain: "shop.example.org"}},
+		}},
+		Containers: []qovery.Container{{
+			Name:      "Redis_Cache",
+			ImageName: "redis",
+			Ports:     []qovery.Port{{Name: "redis", InternalPort: 6379, Protocol: "TCP"}},
+		}},
+		Databases: []qovery.Database{{Name: "db", Type: "POSTGRESQL", ConnectionVariables: []string{"DATABASE_URL"}}},
+		Jobs: []qovery.Job{
+			{Name: "release", Application: "web", Arguments: []string{"rails", "db:migrate"}, OnStart: true},
+			{Name: "cleanup", Application: "web", Arguments: []string{"rake", "cleanup"}, Schedule: "0 3 * * *"},
+		},
+	}
+}
+
+func TestNewValues(t *testing.T) {
+	values := NewValues(testEnvironment(), Options{ImageRegistry: "123456789012.dkr.ecr.us-east-1.amazonaws.com/", IngressClassName: "alb"})
+	assert.Equal(t, "alb", values.Ingress.ClassName)
+
+	web := values.Services["web"]
+	assert.Equal(t, ImageValues{Repository: "123456789012.dkr.ecr.us-east-1.amazonaws.com/web", Tag: "latest"}, web.Image)
+	assert.Equal(t, 2, web.Replicas)
+	assert.Equal(t, AutoscalingValues{Enabled: true, MinReplicas: 2, MaxReplicas: 4, TargetCPUUtilizationPercentage: 70}, web.Autoscaling)
+	assert.Equal(t, []PortValues{{Name: "p8080", Port: 8080, Protocol: "TCP"}}, web.Ports)
+	assert.Equal(t, ResourceValues{Requests: map[string]string{"cpu": "250m", "memory": "1024Mi"}, Limits: map[string]string{"memory": "1024Mi"}}, web.Resources)
+	assert.Equal(t, &HealthcheckValues{Type: "HTTP", Port: 8080, Path: "/"}, web.Healthcheck)
+	assert.Equal(t, map[string]string{"PORT": "8080"}, web.Env)
+	// the values of the secrets are never written
+	assert.Equal(t, map[string]string{"SECRET_KEY_BASE": SecretPlaceholder, "DATABASE_URL": SecretPlaceholder}, web.Secrets)
+	assert.Equal(t, ServiceIngressValue{Hosts: []string{"shop.example.org"}, Port: "p8080"}, web.Ingress)
+
+	redis := values.Services["redis-cache"]
+	assert.Equal(t, ImageValues{Repository: "redis", Tag: "latest"}, redis.Image)
+	assert.Equal(t, 1, redis.Replicas)
+	assert.False(t, redis.Autoscaling.Enabled)
+	assert.Empty(t, redis.Ingress.Hosts)
+	assert.Equal(t, "500m", redis.Resources.Requests["cpu"])
+
+	release := values.Jobs["release"]
+	assert.Equal(t, web.Image, release.Image)
+	assert.Empty(t, release.Schedule)
+	assert.Equal(t, "web", release.SecretsFrom)
+	assert.Equal(t, "0 3 * * *", values.Jobs["cleanup"].Schedule)
+}
+
+func TestNewValuesPlaceholderHost(t *testing.T) {
+	env := testEnvironment()
+	env.Applications[0].CustomDomains = nil
+
+	values := NewValues(env, DefaultOptions())
+	assert.Equal(t, []string{"web.example.com"}, values.Services["web"].Ingress.Hosts)
+	assert.Equal(t, []string{"registry.example.com/web:latest"}, Images(env, DefaultOptions()))
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "my-app", Name("My_App"))
+	assert.Equal(t, "api-v2", Name("--API v2--"))
+	assert.Equal(t, "p8080", portName(qovery.Port{InternalPort: 8080}))
+	assert.Equal(t, "a-very-long-por", portName(qovery.Port{Name: "a very long port name"}))
+}
+
+func TestChartRender(t *testing.T) {
+	chart, err := Chart(testEnvironment(), DefaultOptions())
+	require.NoError(t, err)
+	assert.Contains(t, chart["Chart.yaml"], "name: my-shop\n")
+	assert.Contains(t, chart["values.yaml"], "SECRET_KEY_BASE: REPLACE_ME")
+	assert.NotContains(t, chart["values.yaml"], "s3cr3t")
+	assert.Contains(t, chart, "templates/deployment.yaml")
+
+	manifests, err := Render(chart, "my-shop")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"deployment.yaml", "service.yaml", "ingress.yaml", "hpa.yaml", "secret.yaml", "jobs.yaml"}, keys(manifests))
+
+	deployment := manifests["deployment.yaml"]
+	assert.Contains(t, deployment, `image: "registry.example.com/web:latest"`)
+	assert.Contains(t, deployment, "app.kubernetes.io/instance: my-shop")
+	assert.Contains(t, deployment, "value: \"8080\"")
+	assert.Contains(t, deployment, "name: web-secrets")
+	// the replicas of the autoscaled services are managed by the autoscaler
+	assert.NotContains(t, deployment, "replicas: 2")
+	assert.Contains(t, manifests["ingress.yaml"], "host: shop.example.org")
+	assert.Contains(t, manifests["jobs.yaml"], "kind: CronJob")
+	assert.Contains(t, manifests["jobs.yaml"], "helm.sh/hook: pre-install,pre-upgrade")
+
+	// the services without secrets have no Secret
+	env := testEnvironment()
+	env.Applications[0].Secrets = nil
+	env.Databases = nil
+	chart, err = Chart(env, DefaultOptions())
+	require.NoError(t, err)
+	manifests, err = Render(chart, "my-shop")
+	require.NoError(t, err)
+	assert.NotContains(t, manifests, "secret.yaml")
+	assert.NotContains(t, manifests["deployment.yaml"], "envFrom")
+}
+
+func keys(files map[string]string) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateFuncs are the functions of the Helm template language used by the chart templates, the chart is rendered
+// without the helm CLI
+var templateFuncs = template.FuncMap{
+	"toYaml": func(value interface{}) (string, error) {
+		content, err := marshalYAML(value)
+		return strings.TrimSuffix(content, "\n"), err
+	},
+	"nindent": func(spaces int, content string) string {
+		padding := strings.Repeat(" ", spaces)
+		return "\n" + padding + strings.ReplaceAll(content, "\n", "\n"+padding)
+	},
+	"quote": func(value interface{}) string {
+		return strconv.Quote(fmt.Sprint(value))
+	},
+}
+
+// Render renders the templates of a chart with its values.yaml, like helm template. It returns the manifests by
+// template name, E.g deployment.yaml, the templates rendering no resource are omitted.
+func Render(chart map[string]string, releaseName string) (map[string]string, error) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(chart["values.yaml"]), &values); err != nil {
+		return nil, fmt.Errorf("error parsing values.yaml: %w", err)
+	}
+	data := map[string]interface{}{
+		"Values":  values,
+		"Release": map[string]interface{}{"Name": releaseName, "Namespace": "default"},
+	}
+
+	var names []string
+	for name := range chart {
+		if strings.HasPrefix(name, "templates/") && strings.HasSuffix(name, ".yaml") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	manifests := map[string]string{}
+	for _, name := range names {
+		tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(chart[name])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the template %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("error rendering the template %s: %w", name, err)
+		}
+		manifest := strings.TrimSpace(buf.String())
+		if manifest == "" {
+			continue
+		}
+		manifests[path.Base(name)] = manifest + "\n"
+	}
+	return manifests, nil
+}
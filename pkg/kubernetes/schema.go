@@ -0,0 +1,358 @@
+package kubernetes
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubernetesSchemaJSON is a subset of the OpenAPI v2 definitions of Kubernetes, the manifests are validated offline
+//
+//go:embed schemas/kubernetes_schema.json
+var kubernetesSchemaJSON []byte
+
+// quantityRegexp matches a Kubernetes quantity, E.g 500m, 512Mi or 1.5
+var quantityRegexp = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([KMGTPE]i|[numkMGTPE]|[eE][+-]?\d+)?$`)
+
+type kubernetesSchema struct {
+	KubernetesVersion string                 `json:"kubernetes_version"`
+	Definitions       map[string]*schemaNode `json:"definitions"`
+	// kinds are the definitions of the top-level kinds by apiVersion and kind, E.g apps/v1 Deployment
+	kinds map[string]*schemaNode
+}
+
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Pattern              string                 `json:"pattern"`
+	MaxLength            int                    `json:"maxLength"`
+	Enum                 []string               `json:"enum"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties *schemaNode            `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Required             []string               `json:"required"`
+	GroupVersionKinds    []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+var (
+	loadedSchema     *kubernetesSchema
+	loadedSchemaErr  error
+	loadedSchemaOnce sync.Once
+)
+
+func loadSchema() (*kubernetesSchema, error) {
+	loadedSchemaOnce.Do(func() {
+		var schema kubernetesSchema
+		if err := json.Unmarshal(kubernetesSchemaJSON, &schema); err != nil {
+			loadedSchemaErr = fmt.Errorf("error parsing the Kubernetes schema: %w", err)
+			return
+		}
+		schema.kinds = map[string]*schemaNode{}
+		for _, definition := range schema.Definitions {
+			for _, gvk := range definition.GroupVersionKinds {
+				schema.kinds[apiVersion(gvk.Group, gvk.Version)+" "+gvk.Kind] = definition
+			}
+		}
+		loadedSchema = &schema
+	})
+	return loadedSchema, loadedSchemaErr
+}
+
+func apiVersion(group, version string) string {
+	if group == "" {
+		return version
+	}
+	return group + "/" + version
+}
+
+// SchemaVersion returns the Kubernetes version of the bundled schema, E.g 1.31
+func SchemaVersion() string {
+	schema, err := loadSchema()
+	if err != nil {
+		return ""
+	}
+	return schema.KubernetesVersion
+}
+
+// Finding is an error of a manifest found by the schema validation
+type Finding struct {
+	File string
+	Line int
+	// Resource is the kind and name of the resource, E.g Deployment/web
+	Resource string
+	Message  string
+}
+
+func (f Finding) String() string {
+	location := f.File
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	if f.Resource == "" {
+		return fmt.Sprintf("%s: %s", location, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, f.Resource, f.Message)
+}
+
+// Validate validates the resources of manifests, by file name, against the bundled Kubernetes schema
+func Validate(manifests map[string]string) ([]Finding, error) {
+	schema, err := loadSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []Finding
+	for _, name := range names {
+		decoder := yaml.NewDecoder(strings.NewReader(manifests[name]))
+		for {
+			var document yaml.Node
+			err := decoder.Decode(&document)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				findings = append(findings, Finding{File: name, Message: fmt.Sprintf("invalid YAML: %s", err)})
+				break
+			}
+			if len(document.Content) == 0 || document.Content[0].Tag == "!!null" {
+				continue
+			}
+			findings = append(findings, schema.validateResource(name, document.Content[0])...)
+		}
+	}
+	return findings, nil
+}
+
+// ValidateChart renders a chart and validates its Chart.yaml and its resources
+func ValidateChart(chart map[string]string, releaseName string) ([]Finding, error) {
+	var findings []Finding
+	metadata := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(chart["Chart.yaml"]), &metadata); err != nil {
+		findings = append(findings, Finding{File: "Chart.yaml", Message: fmt.Sprintf("invalid YAML: %s", err)})
+	} else {
+		if metadata["apiVersion"] != "v2" {
+			findings = append(findings, Finding{File: "Chart.yaml", Message: "apiVersion must be v2"})
+		}
+		for _, field := range []string{"name", "version"} {
+			if value, ok := metadata[field].(string); !ok || value == "" {
+				findings = append(findings, Finding{File: "Chart.yaml", Message: fmt.Sprintf("%s is required", field)})
+			}
+		}
+	}
+
+	manifests, err := Render(chart, releaseName)
+	if err != nil {
+		return append(findings, Finding{File: "templates", Message: err.Error()}), nil
+	}
+	templates := map[string]string{}
+	for name, manifest := range manifests {
+		templates["templates/"+name] = manifest
+	}
+	manifestFindings, err := Validate(templates)
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, manifestFindings...), nil
+}
+
+func (s *kubernetesSchema) validateResource(file string, resource *yaml.Node) []Finding {
+	if resource.Kind != yaml.MappingNode {
+		return []Finding{{File: file, Line: resource.Line, Message: "a resource must be an object"}}
+	}
+	version, kind, name := mappingScalar(resource, "apiVersion"), mappingScalar(resource, "kind"), ""
+	if metadata := mappingValue(resource, "metadata"); metadata != nil {
+		name = mappingScalar(metadata, "name")
+	}
+	finding := Finding{File: file, Line: resource.Line, Resource: kind + "/" + name}
+
+	definition, ok := s.kinds[version+" "+kind]
+	if !ok {
+		finding.Message = fmt.Sprintf("unknown kind %q of apiVersion %q", kind, version)
+		return []Finding{finding}
+	}
+	if name == "" {
+		finding.Message = "metadata.name is required"
+		return []Finding{finding}
+	}
+
+	var findings []Finding
+	for _, issue := range s.validateNode(resource, definition, "") {
+		findings = append(findings, Finding{File: file, Line: issue.line, Resource: finding.Resource, Message: issue.message})
+	}
+	return findings
+}
+
+type schemaIssue struct {
+	line    int
+	message string
+}
+
+// validateNode validates a YAML node against a schema node, the path of the node is written in the messages
+func (s *kubernetesSchema) validateNode(node *yaml.Node, schema *schemaNode, path string) []schemaIssue {
+	for schema.Ref != "" {
+		schema = s.Definitions[strings.TrimPrefix(schema.Ref, "#/definitions/")]
+		if schema == nil {
+			return nil
+		}
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	// a null value is an unset field
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	issue := func(format string, args ...interface{}) []schemaIssue {
+		return []schemaIssue{{line: node.Line, message: fmt.Sprintf("%s: %s", displayPath(path), fmt.Sprintf(format, args...))}}
+	}
+
+	switch schema.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			return issue("must be an object")
+		}
+		var issues []schemaIssue
+		present := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			present[key] = true
+			fieldPath := joinPath(path, key)
+			if property, ok := schema.Properties[key]; ok {
+				issues = append(issues, s.validateNode(value, property, fieldPath)...)
+			} else if schema.AdditionalProperties != nil {
+				issues = append(issues, s.validateNode(value, schema.AdditionalProperties, fieldPath)...)
+			} else if len(schema.Properties) > 0 {
+				issues = append(issues, schemaIssue{line: node.Content[i].Line, message: fmt.Sprintf("%s: unknown field", displayPath(fieldPath))})
+			}
+		}
+		for _, required := range schema.Required {
+			if !present[required] {
+				issues = append(issues, issue("missing required field %q", required)...)
+			}
+		}
+		return issues
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			return issue("must be an array")
+		}
+		var issues []schemaIssue
+		if schema.Items != nil {
+			for i, item := range node.Content {
+				issues = append(issues, s.validateNode(item, schema.Items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+		return issues
+	case "string":
+		if node.Kind != yaml.ScalarNode {
+			return issue("must be a string")
+		}
+		switch schema.Format {
+		case "int-or-string":
+			if node.Tag != "!!int" && node.Tag != "!!str" {
+				return issue("must be an integer or a string")
+			}
+			return nil
+		case "quantity":
+			if (node.Tag != "!!str" && node.Tag != "!!int" && node.Tag != "!!float") || !quantityRegexp.MatchString(node.Value) {
+				return issue("invalid quantity %q", node.Value)
+			}
+			return nil
+		}
+		if node.Tag != "!!str" {
+			return issue("must be a string, got %s: quote the value", strings.TrimPrefix(node.Tag, "!!"))
+		}
+		if schema.MaxLength > 0 && len(node.Value) > schema.MaxLength {
+			return issue("must be at most %d characters", schema.MaxLength)
+		}
+		if schema.Pattern != "" && !regexp.MustCompile(schema.Pattern).MatchString(node.Value) {
+			return issue("%q must match %s", node.Value, schema.Pattern)
+		}
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, node.Value) {
+			return issue("%q must be one of %s", node.Value, strings.Join(schema.Enum, ", "))
+		}
+		return nil
+	case "integer":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			return issue("must be an integer")
+		}
+		if _, err := strconv.ParseInt(node.Value, 0, 64); err != nil {
+			return issue("must be an integer")
+		}
+		return nil
+	case "number":
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			return issue("must be a number")
+		}
+		return nil
+	case "boolean":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			return issue("must be a boolean")
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mappingScalar(node *yaml.Node, key string) string {
+	value := mappingValue(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "resource"
+	}
+	return path
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateChart(t *testing.T) {
+	chart, err := Chart(testEnvironment(), DefaultOptions())
+	require.NoError(t, err)
+
+	findings, err := ValidateChart(chart, "my-shop")
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+	assert.Equal(t, "1.31", SchemaVersion())
+
+	chart["Chart.yaml"] = "apiVersion: v1\nname: my-shop\n"
+	chart["templates/broken.yaml"] = "{{ .Values.services | foo }}"
+	findings, err = ValidateChart(chart, "my-shop")
+	require.NoError(t, err)
+	require.Len(t, findings, 3)
+	assert.Equal(t, "Chart.yaml: apiVersion must be v2", findings[0].String())
+	assert.Equal(t, "Chart.yaml: version is required", findings[1].String())
+	assert.Contains(t, findings[2].Message, `function "foo" not defined`)
+}
+
+func TestValidate(t *testing.T) {
+	findings, err := Validate(map[string]string{"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: Web_App
+spec:
+  replicas: "2"
+  selector:
+    matchLabels:
+      app: web
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:latest
+          ports:
+            - containerPort: 8080
+              protocol: HTTP
+          env:
+            - name: PORT
+              value: 8080
+          resources:
+            requests:
+              cpu: half
+          readinessProbe:
+            httpGet:
+              port: http
+              paht: /
+---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+`, "service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: web
+`, "broken.yaml": "kind: [",
+	})
+	require.NoError(t, err)
+
+	var messages []string
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	assert.Equal(t, []string{
+		"broken.yaml: invalid YAML: yaml: line 1: did not find expected node content",
+		`deployment.yaml:4: Deployment/Web_App: metadata.name: "Web_App" must match ^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`,
+		"deployment.yaml:6: Deployment/Web_App: spec.replicas: must be an integer",
+		`deployment.yaml:17: Deployment/Web_App: spec.template.spec.containers[0].ports[0].protocol: "HTTP" must be one of TCP, UDP, SCTP`,
+		"deployment.yaml:20: Deployment/Web_App: spec.template.spec.containers[0].env[0].value: must be a string, got int: quote the value",
+		`deployment.yaml:23: Deployment/Web_App: spec.template.spec.containers[0].resources.requests.cpu: invalid quantity "half"`,
+		"deployment.yaml:27: Deployment/Web_App: spec.template.spec.containers[0].readinessProbe.httpGet.paht: unknown field",
+		`deployment.yaml:29: Ingress/web: unknown kind "Ingress" of apiVersion "networking.k8s.io/v1beta1"`,
+		"service.yaml:1: Service/: metadata.name is required",
+	}, messages)
+}
@@ -0,0 +1,363 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
+)
+
+// runManifestFile is the manifest of the checkpoints in a run directory
+const runManifestFile = "manifest.json"
+
+// runSecretsFile has the values of the secrets of plan.json, "apply --secrets" reads them
+const runSecretsFile = "secrets.json"
+
+// runManifestVersion is the version of the manifest format, a run of another version can't be resumed
+const runManifestVersion = 1
+
+const (
+	// StageConfig is the checkpoint of the config fetched from the source platform
+	StageConfig = "config"
+	// StageDockerfile is the checkpoint of the Dockerfile of an app
+	StageDockerfile = "dockerfile"
+	// StageGeneration is the checkpoint of the validated files of an app in the output format, E.g main.tf and variables.tf
+	StageGeneration = "generation"
+)
+
+const (
+	// StatusCompleted is the status of a stage whose output is reused by a resumed run
+	StatusCompleted = "completed"
+	// StatusFailed is the status of a stage redone by a resumed run, its output is kept for debugging
+	StatusFailed = "failed"
+)
+
+// generationStages are the LLM stages of the generation of the files of an app in the output formats
+var generationStages = []string{"main_tf", "variables_tf", "terraform_fix", "pulumi_yaml", "pulumi_fix"}
+
+// DefaultRunsDir returns the directory of the run directories created by `prepare` by default
+func DefaultRunsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".qovery-migration-agent", "runs")
+	}
+	return filepath.Join(home, ".qovery-migration-agent", "runs")
+}
+
+// RunManifest is the manifest.json of a run directory, the status of each stage of each app
+type RunManifest struct {
+	Version     int                       `json:"version"`
+	Source      string                    `json:"source"`
+	Destination string                    `json:"destination"`
+	Format      OutputFormat              `json:"format"`
+	CreatedAt   time.Time                 `json:"created_at"`
+	UpdatedAt   time.Time                 `json:"updated_at"`
+	Apps        map[string]*AppCheckpoint `json:"apps"`
+}
+
+// AppCheckpoint are the checkpoints of the stages of an app, their files are in the directory of the app
+type AppCheckpoint struct {
+	// Dir is the directory of the files of the stages, relative to the run directory
+	Dir string `json:"dir"`
+	// ConfigHash is the SHA-256 of the fetched config, the stages are redone if the config changed
+	ConfigHash string                     `json:"config_hash"`
+	Stages     map[string]StageCheckpoint `json:"stages"`
+}
+
+// StageCheckpoint is the status of a stage of an app
+type StageCheckpoint struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// ValidationErrors is the number of errors left by the validation of the generated files
+	ValidationErrors int       `json:"validation_errors,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Run persists the output of each stage of each app in a run directory, as soon as it completes. A resumed run reuses
+// the completed stages and only redoes the failed or missing ones. The methods of a nil Run do nothing.
+type Run struct {
+	dir string
+	// usage returns the LLM usage of the run, to record the models of the stages
+	usage func() bedrock.UsageSummary
+
+	mu       sync.Mutex
+	manifest RunManifest
+}
+
+// NewRun creates a run directory, it fails if the directory already holds a run
+func NewRun(dir, source, destination string, format OutputFormat) (*Run, error) {
+	if _, err := os.Stat(filepath.Join(dir, runManifestFile)); err == nil {
+		return nil, fmt.Errorf("%s already holds a run, resume it with --resume", dir)
+	}
+	// the fetched configs hold the environment variables of the apps
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating the run directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	run := &Run{dir: dir, manifest: RunManifest{
+		Version:     runManifestVersion,
+		Source:      source,
+		Destination: destination,
+		Format:      format,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Apps:        map[string]*AppCheckpoint{},
+	}}
+	if err := run.writeManifest(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ResumeRun opens a run directory to resume it, the source, destination and output format must be the ones of the run
+func ResumeRun(dir, source, destination string, format OutputFormat) (*Run, error) {
+	content, err := os.ReadFile(filepath.Join(dir, runManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s is not a run directory: %s not found", dir, runManifestFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the run manifest: %w", err)
+	}
+
+	run := &Run{dir: dir}
+	if err := json.Unmarshal(content, &run.manifest); err != nil {
+		return nil, fmt.Errorf("error parsing the run manifest: %w", err)
+	}
+	manifest := run.manifest
+	if manifest.Version != runManifestVersion {
+		return nil, fmt.Errorf("the run has version %d of the manifest, only version %d can be resumed", manifest.Version, runManifestVersion)
+	}
+	if manifest.Source != source || manifest.Destination != destination || manifest.Format != format {
+		return nil, fmt.Errorf("the run was prepared from %s to %s in the %s format, resume it with the same --from, --to and --format",
+			manifest.Source, manifest.Destination, manifest.Format)
+	}
+	if run.manifest.Apps == nil {
+		run.manifest.Apps = map[string]*AppCheckpoint{}
+	}
+	return run, nil
+}
+
+// Dir returns the run directory
+func (r *Run) Dir() string {
+	if r == nil {
+		return ""
+	}
+	return r.dir
+}
+
+// SaveSecrets writes the values of the secrets of the plan to secrets.json in the run directory, readable by the owner
+// only, and returns its path. The plan.json of the output directory only has placeholders.
+func (r *Run) SaveSecrets(secrets qovery.PlanSecrets) (string, error) {
+	if r == nil {
+		return "", fmt.Errorf("the secrets are only saved in a run directory")
+	}
+	content, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling the secrets: %w", err)
+	}
+	path := filepath.Join(r.dir, runSecretsFile)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return "", fmt.Errorf("error writing the secrets: %w", err)
+	}
+	return path, nil
+}
+
+// Manifest returns a copy of the manifest of the run
+func (r *Run) Manifest() RunManifest {
+	if r == nil {
+		return RunManifest{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	manifest := r.manifest
+	manifest.Apps = map[string]*AppCheckpoint{}
+	for appName, app := range r.manifest.Apps {
+		checkpoint := *app
+		checkpoint.Stages = map[string]StageCheckpoint{}
+		for stage, status := range app.Stages {
+			checkpoint.Stages[stage] = status
+		}
+		manifest.Apps[appName] = &checkpoint
+	}
+	return manifest
+}
+
+// trackUsage records the models of the LLM usage of the run along with the stages
+func (r *Run) trackUsage(usage func() bedrock.UsageSummary) {
+	if r == nil {
+		return
+	}
+	r.usage = usage
+}
+
+// saveConfig saves the fetched config of an app. The stages of the app are redone if its config changed since the
+// checkpoint: the configs are fetched again by a resumed run.
+func (r *Run) saveConfig(app sources.AppConfig) {
+	if r == nil {
+		return
+	}
+	appName := app.Name()
+	content, err := json.MarshalIndent(app.Map(), "", "  ")
+	if err != nil {
+		fmt.Printf("Warning: the config of %s is not saved in the run: %v\n", appName, err)
+		return
+	}
+	hash := sha256.Sum256(content)
+	configHash := hex.EncodeToString(hash[:])
+
+	r.mu.Lock()
+	checkpoint, ok := r.manifest.Apps[appName]
+	if ok && checkpoint.ConfigHash != configHash {
+		fmt.Printf("Warning: the config of %s changed since the checkpoint, its stages are redone\n", appName)
+		checkpoint.Stages = map[string]StageCheckpoint{}
+	}
+	if !ok {
+		checkpoint = &AppCheckpoint{Dir: filepath.Join("apps", GeneratedTerraform{AppName: appName}.SanitizeAppName()), Stages: map[string]StageCheckpoint{}}
+		r.manifest.Apps[appName] = checkpoint
+	}
+	checkpoint.ConfigHash = configHash
+	r.mu.Unlock()
+
+	r.saveStage(appName, StageConfig, map[string]string{"config.json": string(content)}, nil, 0)
+}
+
+// dockerfile returns the Dockerfile of an app if its stage is completed
+func (r *Run) dockerfile(appName string) (Dockerfile, bool) {
+	var dockerfile Dockerfile
+	return dockerfile, r.loadStage(appName, StageDockerfile, "dockerfile.json", &dockerfile)
+}
+
+// saveDockerfile saves the Dockerfile of an app, the stage is failed if err is set
+func (r *Run) saveDockerfile(appName string, dockerfile Dockerfile, err error) {
+	if r == nil {
+		return
+	}
+	if r.usage != nil {
+		dockerfile.Models = r.usage().ModelsOf(appName, "dockerfile")
+	}
+	files := map[string]string{}
+	if dockerfile.DockerfileContent != "" {
+		files["Dockerfile"] = dockerfile.DockerfileContent
+	}
+	if content, marshalErr := json.MarshalIndent(dockerfile, "", "  "); marshalErr == nil {
+		files["dockerfile.json"] = string(content)
+	}
+	r.saveStage(appName, StageDockerfile, files, err, 0)
+}
+
+// generated returns the generated files of an app if its stage is completed
+func (r *Run) generated(appName string) (GeneratedTerraform, bool) {
+	var generated GeneratedTerraform
+	return generated, r.loadStage(appName, StageGeneration, "generation.json", &generated)
+}
+
+// saveGenerated saves the generated files of an app and their validation status, the stage is failed if err is set
+func (r *Run) saveGenerated(generated GeneratedTerraform, err error) {
+	if r == nil {
+		return
+	}
+	if r.usage != nil {
+		generated.Models = r.usage().ModelsOf(generated.AppName, generationStages...)
+	}
+	files := map[string]string{}
+	if generated.MainTf != "" {
+		files["main.tf"] = generated.MainTf
+		files["variables.tf"] = generated.VariablesTf
+	}
+	if content, marshalErr := json.MarshalIndent(generated, "", "  "); marshalErr == nil {
+		files["generation.json"] = string(content)
+	}
+	validationErrors := 0
+	if len(generated.ValidationIterations) > 0 {
+		validationErrors = generated.ValidationIterations[len(generated.ValidationIterations)-1].ErrorCount()
+	}
+	r.saveStage(generated.AppName, StageGeneration, files, err, validationErrors)
+}
+
+// loadStage reads the output of a completed stage of an app from a JSON file
+func (r *Run) loadStage(appName, stage, file string, output interface{}) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	checkpoint, ok := r.manifest.Apps[appName]
+	if !ok || checkpoint.Stages[stage].Status != StatusCompleted {
+		r.mu.Unlock()
+		return false
+	}
+	appDir := filepath.Join(r.dir, checkpoint.Dir)
+	r.mu.Unlock()
+
+	content, err := os.ReadFile(filepath.Join(appDir, file))
+	if err == nil {
+		err = json.Unmarshal(content, output)
+	}
+	if err != nil {
+		fmt.Printf("Warning: the %s checkpoint of %s can't be read, the stage is redone: %v\n", stage, appName, err)
+		return false
+	}
+	return true
+}
+
+// saveStage writes the files of a stage of an app and its status in the manifest. The run goes on if they can't be
+// written, it only can't be resumed from this stage.
+func (r *Run) saveStage(appName, stage string, files map[string]string, stageErr error, validationErrors int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	checkpoint, ok := r.manifest.Apps[appName]
+	if !ok {
+		checkpoint = &AppCheckpoint{Dir: filepath.Join("apps", GeneratedTerraform{AppName: appName}.SanitizeAppName()), Stages: map[string]StageCheckpoint{}}
+		r.manifest.Apps[appName] = checkpoint
+	}
+
+	appDir := filepath.Join(r.dir, checkpoint.Dir)
+	if err := os.MkdirAll(appDir, 0700); err != nil {
+		fmt.Printf("Warning: the %s checkpoint of %s is not saved: %v\n", stage, appName, err)
+		return
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(appDir, name), []byte(content), 0600); err != nil {
+			fmt.Printf("Warning: the %s checkpoint of %s is not saved: %v\n", stage, appName, err)
+			return
+		}
+	}
+
+	status := StageCheckpoint{Status: StatusCompleted, ValidationErrors: validationErrors, UpdatedAt: time.Now().UTC()}
+	if stageErr != nil {
+		status.Status = StatusFailed
+		status.Error = stageErr.Error()
+	}
+	checkpoint.Stages[stage] = status
+	r.manifest.UpdatedAt = status.UpdatedAt
+	if err := r.writeManifest(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// writeManifest writes the manifest atomically, a run interrupted while writing it can still be resumed
+func (r *Run) writeManifest() error {
+	content, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling the run manifest: %w", err)
+	}
+	tmpFile := filepath.Join(r.dir, runManifestFile+".tmp")
+	if err := os.WriteFile(tmpFile, content, 0600); err != nil {
+		return fmt.Errorf("error writing the run manifest: %w", err)
+	}
+	if err := os.Rename(tmpFile, filepath.Join(r.dir, runManifestFile)); err != nil {
+		return fmt.Errorf("error writing the run manifest: %w", err)
+	}
+	return nil
+}
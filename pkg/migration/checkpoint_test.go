@@ -0,0 +1,112 @@
+package migration
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCheckpoints(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	run, err := NewRun(dir, "heroku", "aws", OutputTerraform)
+	require.NoError(t, err)
+
+	web := fakeAppConfig{name: "my-web", build: sources.BuildInfo{Language: "ruby"}}
+	worker := fakeAppConfig{name: "my-worker"}
+	run.saveConfig(web)
+	run.saveConfig(worker)
+	run.saveDockerfile("my-web", Dockerfile{AppName: "my-web", DockerfileContent: "FROM ruby:3.3", Template: "ruby"}, nil)
+	run.saveDockerfile("my-worker", Dockerfile{}, errors.New("throttled"))
+	run.saveGenerated(GeneratedTerraform{AppName: "my-web", MainTf: "# main", VariablesTf: "# variables",
+		ValidationIterations: []TerraformValidationIteration{{Gate: TerraformGateHCL, Diagnostics: []TerraformDiagnostic{{Severity: "error", Summary: "Unsupported argument"}}}},
+	}, errors.New("exceeded maximum iterations"))
+
+	assert.FileExists(t, filepath.Join(dir, "apps", "my_web", "config.json"))
+	assert.FileExists(t, filepath.Join(dir, "apps", "my_web", "Dockerfile"))
+	assert.FileExists(t, filepath.Join(dir, "apps", "my_web", "main.tf"))
+	assert.NoFileExists(t, filepath.Join(dir, "apps", "my_worker", "Dockerfile"))
+
+	_, err = NewRun(dir, "heroku", "aws", OutputTerraform)
+	assert.ErrorContains(t, err, "already holds a run")
+	_, err = ResumeRun(dir, "heroku", "gcp", OutputTerraform)
+	assert.ErrorContains(t, err, "the run was prepared from heroku to aws in the terraform format")
+	_, err = ResumeRun(t.TempDir(), "heroku", "aws", OutputTerraform)
+	assert.ErrorContains(t, err, "is not a run directory")
+
+	resumed, err := ResumeRun(dir, "heroku", "aws", OutputTerraform)
+	require.NoError(t, err)
+	manifest := resumed.Manifest()
+	assert.Equal(t, StatusCompleted, manifest.Apps["my-web"].Stages[StageDockerfile].Status)
+	assert.Equal(t, StageCheckpoint{Status: StatusFailed, Error: "exceeded maximum iterations", ValidationErrors: 1, UpdatedAt: manifest.Apps["my-web"].Stages[StageGeneration].UpdatedAt},
+		manifest.Apps["my-web"].Stages[StageGeneration])
+	assert.Equal(t, "throttled", manifest.Apps["my-worker"].Stages[StageDockerfile].Error)
+
+	// the completed stages are restored, the failed ones are redone
+	dockerfile, ok := resumed.dockerfile("my-web")
+	assert.True(t, ok)
+	assert.Equal(t, Dockerfile{AppName: "my-web", DockerfileContent: "FROM ruby:3.3", Template: "ruby"}, dockerfile)
+	_, ok = resumed.dockerfile("my-worker")
+	assert.False(t, ok)
+	_, ok = resumed.generated("my-web")
+	assert.False(t, ok)
+	_, ok = resumed.dockerfile("unknown")
+	assert.False(t, ok)
+
+	// the stages of an app are redone if its config changed
+	resumed.saveConfig(web)
+	_, ok = resumed.dockerfile("my-web")
+	assert.True(t, ok)
+	resumed.saveConfig(fakeAppConfig{name: "my-web", build: sources.BuildInfo{Language: "node"}})
+	_, ok = resumed.dockerfile("my-web")
+	assert.False(t, ok)
+
+	// the secrets of the plan are only readable by the owner
+	secretsFile, err := resumed.SaveSecrets(qovery.PlanSecrets{"my-web/my-web": {"STRIPE_API_KEY": "sk_live_123"}})
+	require.NoError(t, err)
+	info, err := os.Stat(secretsFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	secrets, err := qovery.LoadPlanSecrets(secretsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "sk_live_123", secrets["my-web/my-web"]["STRIPE_API_KEY"])
+
+	// a nil run saves nothing
+	var noRun *Run
+	noRun.saveConfig(web)
+	_, ok = noRun.dockerfile("my-web")
+	assert.False(t, ok)
+	_, err = noRun.SaveSecrets(secrets)
+	assert.Error(t, err)
+}
+
+func TestGenerateTerraformFilesResume(t *testing.T) {
+	dir := t.TempDir()
+	run, err := NewRun(dir, "heroku", "aws", OutputKubernetes)
+	require.NoError(t, err)
+	run.saveGenerated(GeneratedTerraform{AppName: "api", Format: OutputKubernetes, Files: map[string]string{"deployment.yaml": "# restored"}}, nil)
+
+	qoveryConfigs := map[string]qovery.TranslatedApp{"api": testKubernetesTarget(), "web": testKubernetesTarget()}
+	generated, err := generateTerraformFiles(qoveryConfigs, "aws", nil, nil, DefaultValidationConfigFor(OutputKubernetes), run, nil)
+	require.NoError(t, err)
+	require.Len(t, generated, 2)
+	for _, generatedTf := range generated {
+		if generatedTf.AppName == "api" {
+			assert.Equal(t, "# restored", generatedTf.Files["deployment.yaml"])
+		} else {
+			assert.Contains(t, generatedTf.Files["deployment.yaml"], "kind: Deployment")
+		}
+		assert.Equal(t, testKubernetesTarget().Target, generatedTf.Target)
+	}
+
+	manifest := run.Manifest()
+	assert.Equal(t, StatusCompleted, manifest.Apps["web"].Stages[StageGeneration].Status)
+	content, err := os.ReadFile(filepath.Join(dir, manifest.Apps["web"].Dir, "generation.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "kind: Deployment")
+}
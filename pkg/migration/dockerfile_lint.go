@@ -0,0 +1,291 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dockerfile lint rules
+const (
+	DockerfileRuleSyntax       = "syntax"
+	DockerfileRuleLatestImage  = "unpinned-base-image"
+	DockerfileRuleRootUser     = "root-user"
+	DockerfileRuleExpose       = "expose"
+	DockerfileRuleBakedSecrets = "baked-secret"
+)
+
+// DockerfileGateLint is the validation gate of the Dockerfiles, the static lint of lintDockerfile
+const DockerfileGateLint = "dockerfile lint"
+
+// dockerfileFile is the name of the Dockerfile of an app
+const dockerfileFile = "Dockerfile"
+
+// DockerfileFinding represents an issue found by the static validation of a Dockerfile
+type DockerfileFinding struct {
+	Rule    string
+	Line    int
+	Message string
+}
+
+// dockerfileDiagnostics returns the findings as error diagnostics of the validation loop
+func dockerfileDiagnostics(findings []DockerfileFinding) []TerraformDiagnostic {
+	var diagnostics []TerraformDiagnostic
+	for _, finding := range findings {
+		diagnostics = append(diagnostics, TerraformDiagnostic{Severity: "error", Summary: finding.Rule, Detail: finding.Message, File: dockerfileFile, Line: finding.Line})
+	}
+	return diagnostics
+}
+
+func (f DockerfileFinding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("line %d: [%s] %s", f.Line, f.Rule, f.Message)
+	}
+	return fmt.Sprintf("[%s] %s", f.Rule, f.Message)
+}
+
+// dockerfileInstruction is a single instruction of a Dockerfile, continuation lines included
+type dockerfileInstruction struct {
+	Line    int
+	Command string
+	Args    string
+}
+
+var (
+	dockerfileCommands = map[string]bool{
+		"FROM": true, "RUN": true, "CMD": true, "LABEL": true, "MAINTAINER": true, "EXPOSE": true,
+		"ENV": true, "ADD": true, "COPY": true, "ENTRYPOINT": true, "VOLUME": true, "USER": true,
+		"WORKDIR": true, "ARG": true, "ONBUILD": true, "STOPSIGNAL": true, "HEALTHCHECK": true, "SHELL": true,
+	}
+	heredocRegexp      = regexp.MustCompile(`<<-?["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+	secretKeyRegexp    = regexp.MustCompile(`(?i)(secret|passw(or)?d|token|credential|api_?key|private_?key|access_?key|(^|_)key($|_)|_uri$|database_url)`)
+	variableRefRegexp  = regexp.MustCompile(`^\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?$`)
+	exposePortRegexp   = regexp.MustCompile(`^(\d+)(/(tcp|udp))?$`)
+	userRootNameRegexp = regexp.MustCompile(`^(root|0)(:.*)?$`)
+)
+
+// parseDockerfile splits a Dockerfile into instructions and reports syntax errors
+func parseDockerfile(content string) ([]dockerfileInstruction, []DockerfileFinding) {
+	var instructions []dockerfileInstruction
+	var findings []DockerfileFinding
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		startLine := i + 1
+		// join continuation lines, comments in between are ignored by Docker
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			next := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(next, "#") {
+				continue
+			}
+			line = strings.TrimSuffix(line, "\\") + " " + next
+		}
+
+		// skip heredoc bodies (E.g RUN <<EOF ... EOF)
+		if match := heredocRegexp.FindStringSubmatch(line); match != nil {
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != match[1] {
+				i++
+			}
+			i++
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		command := strings.ToUpper(fields[0])
+		args := ""
+		if len(fields) > 1 {
+			args = strings.TrimSpace(fields[1])
+		}
+
+		if !dockerfileCommands[command] {
+			findings = append(findings, DockerfileFinding{Rule: DockerfileRuleSyntax, Line: startLine, Message: fmt.Sprintf("unknown instruction %q", fields[0])})
+			continue
+		}
+		if args == "" {
+			findings = append(findings, DockerfileFinding{Rule: DockerfileRuleSyntax, Line: startLine, Message: fmt.Sprintf("%s requires at least one argument", command)})
+			continue
+		}
+
+		instructions = append(instructions, dockerfileInstruction{Line: startLine, Command: command, Args: args})
+	}
+
+	return instructions, findings
+}
+
+// lintDockerfile statically validates a Dockerfile. The EXPOSE check is skipped when port is 0 (E.g workers).
+func lintDockerfile(content string, port int) []DockerfileFinding {
+	instructions, findings := parseDockerfile(content)
+
+	stages := map[string]bool{}
+	lastFrom := -1
+	for i, instruction := range instructions {
+		if instruction.Command == "FROM" {
+			if lastFrom == -1 {
+				for _, previous := range instructions[:i] {
+					if previous.Command != "ARG" {
+						findings = append(findings, DockerfileFinding{Rule: DockerfileRuleSyntax, Line: previous.Line, Message: fmt.Sprintf("%s is not allowed before the first FROM", previous.Command)})
+					}
+				}
+			}
+			lastFrom = i
+
+			image, stage := parseFromArgs(instruction.Args)
+			if !stages[strings.ToLower(image)] && !isPinnedImage(image) {
+				findings = append(findings, DockerfileFinding{Rule: DockerfileRuleLatestImage, Line: instruction.Line, Message: fmt.Sprintf("base image %q is not pinned to a version (implicit or explicit \"latest\" tag)", image)})
+			}
+			if stage != "" {
+				stages[strings.ToLower(stage)] = true
+			}
+		}
+
+		if instruction.Command == "ENV" || instruction.Command == "ARG" {
+			for _, kv := range parseKeyValues(instruction.Args, instruction.Command == "ENV") {
+				if kv[1] != "" && secretKeyRegexp.MatchString(kv[0]) && !variableRefRegexp.MatchString(kv[1]) {
+					findings = append(findings, DockerfileFinding{Rule: DockerfileRuleBakedSecrets, Line: instruction.Line, Message: fmt.Sprintf("%s %s looks like a secret baked into the image, pass it at runtime as an environment variable instead", instruction.Command, kv[0])})
+				}
+			}
+		}
+	}
+
+	if lastFrom == -1 {
+		findings = append(findings, DockerfileFinding{Rule: DockerfileRuleSyntax, Message: "no FROM instruction found"})
+		return findings
+	}
+
+	// user and ports are only relevant for the final stage
+	finalStage := instructions[lastFrom:]
+	env := map[string]string{}
+	user := ""
+	userLine := 0
+	var exposes []dockerfileInstruction
+	for _, instruction := range finalStage {
+		switch instruction.Command {
+		case "ENV":
+			for _, kv := range parseKeyValues(instruction.Args, true) {
+				env[kv[0]] = kv[1]
+			}
+		case "USER":
+			user = instruction.Args
+			userLine = instruction.Line
+		case "EXPOSE":
+			exposes = append(exposes, instruction)
+		}
+	}
+
+	if user == "" {
+		findings = append(findings, DockerfileFinding{Rule: DockerfileRuleRootUser, Message: "the final stage has no USER instruction, the container runs as root"})
+	} else if userRootNameRegexp.MatchString(user) {
+		findings = append(findings, DockerfileFinding{Rule: DockerfileRuleRootUser, Line: userLine, Message: "the container runs as root, switch to a non-root user"})
+	}
+
+	if port > 0 {
+		if len(exposes) == 0 {
+			findings = append(findings, DockerfileFinding{Rule: DockerfileRuleExpose, Message: fmt.Sprintf("missing EXPOSE %d for the application port", port)})
+		} else if !exposesPort(exposes, env, port) {
+			findings = append(findings, DockerfileFinding{Rule: DockerfileRuleExpose, Line: exposes[0].Line, Message: fmt.Sprintf("EXPOSE %s does not match the application port %d", exposes[0].Args, port)})
+		}
+	}
+
+	return findings
+}
+
+// parseFromArgs returns the image and the stage name of a FROM instruction
+func parseFromArgs(args string) (string, string) {
+	var fields []string
+	for _, field := range strings.Fields(args) {
+		if !strings.HasPrefix(field, "--") {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return "", ""
+	}
+	if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+		return fields[0], fields[2]
+	}
+	return fields[0], ""
+}
+
+func isPinnedImage(image string) bool {
+	if image == "scratch" || strings.Contains(image, "$") || strings.Contains(image, "@sha256:") {
+		return true
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	idx := strings.LastIndex(name, ":")
+	return idx != -1 && name[idx+1:] != "latest"
+}
+
+func exposesPort(exposes []dockerfileInstruction, env map[string]string, port int) bool {
+	for _, expose := range exposes {
+		for _, value := range strings.Fields(expose.Args) {
+			if match := variableRefRegexp.FindStringSubmatch(value); match != nil {
+				value = env[match[1]]
+			}
+			if match := exposePortRegexp.FindStringSubmatch(value); match != nil {
+				if p, _ := strconv.Atoi(match[1]); p == port {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// parseKeyValues parses ENV/ARG arguments ("KEY=value KEY2=value", the legacy "KEY value" form for ENV, or "NAME" for ARG)
+func parseKeyValues(args string, legacyForm bool) [][2]string {
+	tokens := splitQuoted(args)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	if legacyForm && !strings.Contains(tokens[0], "=") {
+		return [][2]string{{tokens[0], strings.TrimSpace(strings.TrimPrefix(args, tokens[0]))}}
+	}
+
+	var result [][2]string
+	for _, token := range tokens {
+		kv := strings.SplitN(token, "=", 2)
+		if len(kv) == 1 {
+			result = append(result, [2]string{kv[0], ""})
+			continue
+		}
+		result = append(result, [2]string{kv[0], strings.Trim(kv[1], `"'`)})
+	}
+	return result
+}
+
+// splitQuoted splits on whitespace while keeping quoted values together
+func splitQuoted(s string) []string {
+	var tokens []string
+	var current strings.Builder
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			current.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
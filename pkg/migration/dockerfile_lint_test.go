@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func findingRules(findings []DockerfileFinding) []string {
+	var rules []string
+	for _, finding := range findings {
+		rules = append(rules, finding.Rule)
+	}
+	return rules
+}
+
+func TestLintDockerfile(t *testing.T) {
+	valid := `# syntax=docker/dockerfile:1
+ARG NODE_VERSION=20
+FROM node:${NODE_VERSION} AS build
+WORKDIR /app
+COPY . .
+RUN npm ci && \
+    npm run build
+
+FROM gcr.io/distroless/nodejs20-debian12@sha256:0123456789abcdef
+ENV PORT=8080 \
+    NODE_ENV=production
+COPY --from=build /app /app
+USER nonroot
+EXPOSE $PORT
+CMD ["server.js"]
+`
+	assert.Empty(t, lintDockerfile(valid, 8080))
+
+	invalid := `FROM node
+ENV API_KEY=abcd1234 NODE_ENV=production
+ARG GITHUB_TOKEN=ghp_123
+ARG NPM_TOKEN
+EXPOSE 3000
+USER root
+CMD ["node", "server.js"]
+`
+	assert.ElementsMatch(t, []string{
+		DockerfileRuleLatestImage,
+		DockerfileRuleBakedSecrets,
+		DockerfileRuleBakedSecrets,
+		DockerfileRuleExpose,
+		DockerfileRuleRootUser,
+	}, findingRules(lintDockerfile(invalid, 8080)))
+
+	// workers don't need to expose a port but still need a non-root user
+	assert.Equal(t, []string{DockerfileRuleRootUser}, findingRules(lintDockerfile("FROM python:3.12-slim\nCMD [\"celery\", \"worker\"]\n", 0)))
+
+	syntaxErrors := lintDockerfile("RUN echo hello\nFROM alpine:3.20\nCOPYY . .\nUSER app\n", 0)
+	assert.Equal(t, []string{DockerfileRuleSyntax, DockerfileRuleSyntax}, findingRules(syntaxErrors))
+	assert.Equal(t, 3, syntaxErrors[0].Line)
+}
@@ -0,0 +1,144 @@
+package migration
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
+)
+
+//go:embed templates/dockerfiles/*.Dockerfile.tmpl
+var dockerfileTemplatesFS embed.FS
+
+// defaultAppPort is the port the generated images listen on (exposed through the PORT env var like on Heroku)
+const defaultAppPort = 8080
+
+// dockerfileTemplate is a curated Dockerfile template for a language/buildpack
+type dockerfileTemplate struct {
+	Name           string
+	DefaultVersion string
+	DefaultCommand string
+	// Keywords matched against the detected language and buildpacks
+	Keywords []string
+	// UseDetectedCommand is false when the build produces an artifact that the detected command can't refer to
+	UseDetectedCommand bool
+}
+
+// dockerfileTemplates is ordered by priority, the first matching template is used
+var dockerfileTemplates = []dockerfileTemplate{
+	{Name: "java-gradle", DefaultVersion: "21", Keywords: []string{"gradle"}},
+	{Name: "java-maven", DefaultVersion: "21", Keywords: []string{"java", "maven", "jvm", "war"}},
+	{Name: "node", DefaultVersion: "20", DefaultCommand: "npm start", Keywords: []string{"node", "nodejs"}, UseDetectedCommand: true},
+	{Name: "ruby", DefaultVersion: "3.3", DefaultCommand: "bundle exec puma -p $PORT", Keywords: []string{"ruby", "rails"}, UseDetectedCommand: true},
+	{Name: "python", DefaultVersion: "3.12", DefaultCommand: "gunicorn --bind 0.0.0.0:$PORT app:app", Keywords: []string{"python", "django"}, UseDetectedCommand: true},
+	{Name: "go", DefaultVersion: "1.22", Keywords: []string{"go", "golang"}},
+	{Name: "php", DefaultVersion: "8.3", Keywords: []string{"php"}},
+	{Name: "static", DefaultVersion: "", Keywords: []string{"static", "html"}},
+}
+
+// dockerfileTemplateData holds the values rendered into a Dockerfile template
+type dockerfileTemplateData struct {
+	Version              string
+	Port                 int
+	Framework            string
+	StartCommand         string
+	StartCommandDetected bool
+	DocumentRoot         string
+}
+
+var (
+	versionRegexp      = regexp.MustCompile(`^\d+(\.\d+)*$`)
+	keywordSplitRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+	// E.g "vendor/bin/heroku-php-apache2 public/"
+	phpDocumentRootRegexp = regexp.MustCompile(`heroku-php-(?:apache2|nginx)\s+(\S+)`)
+)
+
+// detectDockerfileTemplate picks the template matching the detected language first, then the buildpacks.
+// Buildpacks are checked from the last one as it is the one providing the process types on Heroku.
+// The runtime files of the app (E.g package.json, .ruby-version) are not used: the sources only read the platform
+// APIs, not the code of the app.
+func detectDockerfileTemplate(build sources.BuildInfo) (dockerfileTemplate, bool) {
+	candidates := []string{build.Language}
+	for i := len(build.Buildpacks) - 1; i >= 0; i-- {
+		candidates = append(candidates, build.Buildpacks[i])
+	}
+
+	for _, candidate := range candidates {
+		keywords := keywordSplitRegexp.Split(strings.ToLower(candidate), -1)
+		for _, tmpl := range dockerfileTemplates {
+			for _, keyword := range tmpl.Keywords {
+				for _, k := range keywords {
+					if k == keyword {
+						return tmpl, true
+					}
+				}
+			}
+		}
+	}
+
+	return dockerfileTemplate{}, false
+}
+
+// detectFramework returns the framework ("rails", "django") when it can be inferred from the build info
+func detectFramework(build sources.BuildInfo) string {
+	language := strings.ToLower(build.Language)
+	webCommand := build.ProcessTypes["web"]
+
+	switch {
+	case strings.Contains(language, "rails") || strings.Contains(webCommand, "rails"):
+		return "rails"
+	case strings.Contains(language, "django") || strings.Contains(webCommand, "manage.py") || strings.Contains(webCommand, ".wsgi"):
+		return "django"
+	}
+	return ""
+}
+
+// renderDockerfileTemplate renders a curated Dockerfile for the given build info
+func renderDockerfileTemplate(tmpl dockerfileTemplate, build sources.BuildInfo) (string, error) {
+	content, err := dockerfileTemplatesFS.ReadFile(fmt.Sprintf("templates/dockerfiles/%s.Dockerfile.tmpl", tmpl.Name))
+	if err != nil {
+		return "", fmt.Errorf("error reading Dockerfile template %s: %w", tmpl.Name, err)
+	}
+
+	t, err := template.New(tmpl.Name).Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("error parsing Dockerfile template %s: %w", tmpl.Name, err)
+	}
+
+	data := dockerfileTemplateData{
+		Version:      tmpl.DefaultVersion,
+		Port:         defaultAppPort,
+		Framework:    detectFramework(build),
+		StartCommand: tmpl.DefaultCommand,
+		DocumentRoot: ".",
+	}
+
+	// only trust versions that look like a version number to avoid generating an invalid image tag
+	if versionRegexp.MatchString(build.LanguageVersion) {
+		data.Version = build.LanguageVersion
+	}
+
+	webCommand := strings.TrimSpace(build.ProcessTypes["web"])
+	if tmpl.UseDetectedCommand && webCommand != "" {
+		data.StartCommand = webCommand
+		data.StartCommandDetected = true
+	}
+
+	if match := phpDocumentRootRegexp.FindStringSubmatch(webCommand); match != nil {
+		data.DocumentRoot = strings.TrimSuffix(match[1], "/")
+	}
+	if tmpl.Name == "php" && data.DocumentRoot == "." {
+		data.DocumentRoot = ""
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering Dockerfile template %s: %w", tmpl.Name, err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectDockerfileTemplate(t *testing.T) {
+	tests := []struct {
+		build    sources.BuildInfo
+		expected string
+	}{
+		{sources.BuildInfo{Language: "Ruby/Rails", Buildpacks: []string{"heroku/nodejs", "heroku/ruby"}}, "ruby"},
+		{sources.BuildInfo{Buildpacks: []string{"heroku/nodejs", "heroku/ruby"}}, "ruby"},
+		{sources.BuildInfo{Buildpacks: []string{"heroku/gradle"}}, "java-gradle"},
+		{sources.BuildInfo{Buildpacks: []string{"heroku/java"}}, "java-maven"},
+		{sources.BuildInfo{Buildpacks: []string{"https://github.com/heroku/heroku-buildpack-go"}}, "go"},
+		{sources.BuildInfo{Language: "python"}, "python"},
+		{sources.BuildInfo{Language: "php"}, "php"},
+		{sources.BuildInfo{Language: "static-apache"}, "static"},
+		{sources.BuildInfo{Language: "node"}, "node"},
+	}
+
+	for _, tt := range tests {
+		tmpl, ok := detectDockerfileTemplate(tt.build)
+		assert.True(t, ok, "%+v", tt.build)
+		assert.Equal(t, tt.expected, tmpl.Name, "%+v", tt.build)
+	}
+
+	_, ok := detectDockerfileTemplate(sources.BuildInfo{Buildpacks: []string{"https://github.com/HashNuke/heroku-buildpack-elixir"}})
+	assert.False(t, ok)
+}
+
+func TestRenderDockerfileTemplate(t *testing.T) {
+	for _, tmpl := range dockerfileTemplates {
+		content, err := renderDockerfileTemplate(tmpl, sources.BuildInfo{})
+		assert.NoError(t, err, tmpl.Name)
+		assert.Contains(t, content, "EXPOSE 8080", tmpl.Name)
+		assert.Contains(t, content, "USER ", tmpl.Name)
+		assert.NotContains(t, content, ":latest", tmpl.Name)
+		assert.NotContains(t, content, "<no value>", tmpl.Name)
+		assert.Empty(t, lintDockerfile(content, defaultAppPort), tmpl.Name)
+	}
+
+	content, err := renderDockerfileTemplate(dockerfileTemplateByName(t, "python"), sources.BuildInfo{
+		LanguageVersion: "3.11",
+		ProcessTypes:    map[string]string{"web": "gunicorn mysite.wsgi --bind 0.0.0.0:$PORT"},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, content, "FROM python:3.11-slim")
+	assert.Contains(t, content, "collectstatic")
+	assert.Contains(t, content, "CMD gunicorn mysite.wsgi --bind 0.0.0.0:$PORT")
+}
+
+func dockerfileTemplateByName(t *testing.T, name string) dockerfileTemplate {
+	t.Helper()
+	for _, tmpl := range dockerfileTemplates {
+		if tmpl.Name == name {
+			return tmpl
+		}
+	}
+	t.Fatalf("no Dockerfile template named %s", name)
+	return dockerfileTemplate{}
+}
@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kubernetes"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+)
+
+// KubernetesGateSchema is the validation gate of the kubernetes and helm formats, run in-process against the bundled
+// Kubernetes schema
+const KubernetesGateSchema = "kubernetes schema"
+
+// helmChartDir is the directory of the chart in the directory of each app
+const helmChartDir = "chart"
+
+// kubernetesGenerator renders the Kubernetes manifests or the Helm chart of the kubernetes and helm formats from the
+// target environment, without the LLM: the files are deterministic and there is nothing to fix
+type kubernetesGenerator struct {
+	format  OutputFormat
+	options kubernetes.Options
+}
+
+func (g *kubernetesGenerator) generate(appName string, qoveryConfig qovery.TranslatedApp) (GeneratedTerraform, error) {
+	options := g.options
+	if options.ImageRegistry == "" {
+		options.ImageRegistry = kubernetes.DefaultOptions().ImageRegistry
+	}
+	releaseName := kubernetes.Name(appName)
+	generated := GeneratedTerraform{AppName: appName, Format: g.format, Notes: kubernetesNotes(g.format, releaseName, qoveryConfig.Target, options)}
+
+	chart, err := kubernetes.Chart(qoveryConfig.Target, options)
+	if err != nil {
+		return generated, fmt.Errorf("error generating the Helm chart of %s: %w", appName, err)
+	}
+
+	var findings []kubernetes.Finding
+	generated.Files = map[string]string{}
+	if g.format == OutputHelm {
+		for name, content := range chart {
+			generated.Files[path.Join(helmChartDir, name)] = content
+		}
+		findings, err = kubernetes.ValidateChart(chart, releaseName)
+	} else {
+		manifests, renderErr := kubernetes.Render(chart, releaseName)
+		if renderErr != nil {
+			return generated, fmt.Errorf("error rendering the Kubernetes manifests of %s: %w", appName, renderErr)
+		}
+		generated.Files = manifests
+		findings, err = kubernetes.Validate(manifests)
+	}
+	if err != nil {
+		return generated, fmt.Errorf("error validating the %s files of %s: %w", g.format.Title(), appName, err)
+	}
+
+	iteration := TerraformValidationIteration{Gate: KubernetesGateSchema}
+	for _, finding := range findings {
+		file := finding.File
+		if g.format == OutputHelm {
+			file = path.Join(helmChartDir, file)
+		}
+		iteration.Diagnostics = append(iteration.Diagnostics, TerraformDiagnostic{
+			Severity: "error",
+			Summary:  "Invalid Kubernetes resource",
+			Detail:   strings.TrimPrefix(fmt.Sprintf("%s: %s", finding.Resource, finding.Message), ": "),
+			File:     file,
+			Line:     finding.Line,
+		})
+	}
+	generated.Diagnostics = iteration.Diagnostics
+	generated.ValidationIterations = []TerraformValidationIteration{iteration}
+	if iteration.ErrorCount() > 0 {
+		return generated, fmt.Errorf("the %s files of %s have %d schema error(s)", g.format.Title(), appName, iteration.ErrorCount())
+	}
+	return generated, nil
+}
+
+// kubernetesNotes returns the steps left to deploy the files of an app: the images to push, the secrets to set and
+// the databases to provision
+func kubernetesNotes(format OutputFormat, releaseName string, target qovery.Environment, options kubernetes.Options) []string {
+	var notes []string
+	if images := kubernetes.Images(target, options); len(images) > 0 {
+		notes = append(notes, fmt.Sprintf("Build the images from the Dockerfile and push them before deploying: %s", strings.Join(images, ", ")))
+	}
+
+	var secrets []string
+	for _, application := range target.Applications {
+		for _, secret := range application.Secrets {
+			secrets = append(secrets, secret.Key)
+		}
+	}
+	for _, container := range target.Containers {
+		for _, secret := range container.Secrets {
+			secrets = append(secrets, secret.Key)
+		}
+	}
+	for _, database := range target.Databases {
+		secrets = append(secrets, database.ConnectionVariables...)
+		notes = append(notes, fmt.Sprintf("The %s database %s is not deployed: provision it, E.g with Amazon RDS, and set its connection variables in the secrets", database.Type, database.Name))
+	}
+	if len(secrets) > 0 {
+		sort.Strings(secrets)
+		notes = append(notes, fmt.Sprintf("The secrets are set to %s, replace them before deploying: %s", kubernetes.SecretPlaceholder, strings.Join(secrets, ", ")))
+	}
+
+	for _, application := range target.Applications {
+		if len(application.CustomDomains) == 0 && hasPublicPort(application.Ports) {
+			notes = append(notes, fmt.Sprintf("The ingress host of %s is a placeholder, set its domain", application.Name))
+		}
+	}
+
+	if format == OutputHelm {
+		notes = append(notes, fmt.Sprintf("Install the chart with `helm upgrade --install %s ./%s`", releaseName, helmChartDir))
+	} else {
+		notes = append(notes, "Apply the manifests with `kubectl apply -f .`, the Jobs run before each deployment are applied as is")
+	}
+	return notes
+}
+
+func hasPublicPort(ports []qovery.Port) bool {
+	for _, port := range ports {
+		if port.PubliclyAccessible && port.Protocol != "TCP" && port.Protocol != "UDP" {
+			return true
+		}
+	}
+	return false
+}
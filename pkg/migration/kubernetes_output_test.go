@@ -0,0 +1,93 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kubernetes"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKubernetesTarget() qovery.TranslatedApp {
+	return qovery.TranslatedApp{AppName: "my-app", Target: qovery.Environment{
+		Name: "my-app",
+		Applications: []qovery.Application{{
+			Name:      "web",
+			Resources: qovery.Resources{CPU: 500, Memory: 512, MinRunningInstances: 1, MaxRunningInstances: 1},
+			Ports:     []qovery.Port{{Name: "p3000", InternalPort: 3000, Protocol: "HTTP", PubliclyAccessible: true}},
+			Secrets:   []qovery.Secret{{Key: "SECRET_KEY_BASE", Value: "s3cr3t"}},
+		}},
+		Databases: []qovery.Database{{Name: "db", Type: "POSTGRESQL", ConnectionVariables: []string{"DATABASE_URL"}}},
+	}}
+}
+
+func TestKubernetesGenerator(t *testing.T) {
+	generator := newOutputGenerator(nil, nil, DefaultValidationConfigFor(OutputKubernetes), nil)
+
+	generated, err := generator.generate("my-app", testKubernetesTarget())
+	require.NoError(t, err)
+	assert.Equal(t, OutputKubernetes, generated.Format)
+	assert.True(t, generated.generated())
+	assert.Contains(t, generated.Files["deployment.yaml"], `image: "registry.example.com/web:latest"`)
+	assert.Contains(t, generated.Files["secret.yaml"], `SECRET_KEY_BASE: "REPLACE_ME"`)
+	assert.NotContains(t, generated.Files, "hpa.yaml")
+	require.Len(t, generated.ValidationIterations, 1)
+	assert.Equal(t, KubernetesGateSchema, generated.ValidationIterations[0].Gate)
+	assert.Equal(t, 0, generated.ValidationIterations[0].ErrorCount())
+	assert.Contains(t, generated.Notes, "The POSTGRESQL database db is not deployed: provision it, E.g with Amazon RDS, and set its connection variables in the secrets")
+	assert.Contains(t, generated.Notes, "The secrets are set to REPLACE_ME, replace them before deploying: DATABASE_URL, SECRET_KEY_BASE")
+	assert.Contains(t, generated.Notes, "The ingress host of web is a placeholder, set its domain")
+
+	// the target coverage compares Qovery resources, there are none
+	assert.Nil(t, targetCoverage(testKubernetesTarget().Target, generated))
+
+	config := DefaultValidationConfigFor(OutputHelm)
+	config.Kubernetes = kubernetes.Options{ImageRegistry: "123456789012.dkr.ecr.us-east-1.amazonaws.com", IngressClassName: "alb"}
+	generated, err = newOutputGenerator(nil, nil, config, nil).generate("my-app", testKubernetesTarget())
+	require.NoError(t, err)
+	assert.Contains(t, generated.Files, "chart/Chart.yaml")
+	assert.Contains(t, generated.Files["chart/values.yaml"], "className: alb")
+	assert.Contains(t, generated.Files["chart/values.yaml"], "repository: 123456789012.dkr.ecr.us-east-1.amazonaws.com/web")
+	assert.Contains(t, generated.Notes, "Install the chart with `helm upgrade --install my-app ./chart`")
+}
+
+func TestKubernetesGeneratorInvalid(t *testing.T) {
+	target := testKubernetesTarget()
+	// a name without any valid character can't be sanitized
+	target.Target.Containers = []qovery.Container{{Name: "!!!", ImageName: "nginx"}}
+
+	generated, err := newOutputGenerator(nil, nil, DefaultValidationConfigFor(OutputKubernetes), nil).generate("my-app", target)
+	assert.ErrorContains(t, err, "the Kubernetes files of my-app have 1 schema error(s)")
+	require.Len(t, generated.Diagnostics, 1)
+	assert.Equal(t, "deployment.yaml:2: error: Invalid Kubernetes resource; Deployment/: metadata.name is required", generated.Diagnostics[0].String())
+	assert.True(t, generated.generated())
+}
+
+func TestWriteAssetsHelm(t *testing.T) {
+	generated, err := newOutputGenerator(nil, nil, DefaultValidationConfigFor(OutputHelm), nil).generate("my-app", testKubernetesTarget())
+	require.NoError(t, err)
+	assets := &Assets{
+		GeneratedTerraformFiles: []GeneratedTerraform{generated},
+		Dockerfiles:             []Dockerfile{{AppName: "my-app", DockerfileContent: "FROM ruby:3.3"}},
+	}
+	dir := t.TempDir()
+
+	require.NoError(t, WriteAssets(dir, assets, false))
+	assert.FileExists(t, filepath.Join(dir, "my_app", "chart", "Chart.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "my_app", "chart", "templates", "deployment.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "my_app", "Dockerfile"))
+	assert.NoFileExists(t, filepath.Join(dir, "my_app", "main.tf"))
+	assert.NoFileExists(t, filepath.Join(dir, "plan.json"))
+
+	report, err := os.ReadFile(filepath.Join(dir, "migration_report.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "## Helm\n")
+	assert.Contains(t, string(report), "validated against the bundled schema of Kubernetes 1.31")
+	assert.Contains(t, string(report), "| my-app | 1 | 0 (kubernetes schema) | ✅ |")
+	assert.NotContains(t, string(report), "## Qovery organization")
+
+	assert.ErrorContains(t, WriteAssetsWithLayout(dir, assets, false, LayoutRootModule), "not supported by the helm output format")
+}
@@ -0,0 +1,292 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// terraformFilesOutput is the structured output of the Terraform generation prompts
+type terraformFilesOutput struct {
+	MainTf      string   `json:"main_tf"`
+	VariablesTf string   `json:"variables_tf"`
+	Notes       []string `json:"notes"`
+	Assumptions []string `json:"assumptions"`
+}
+
+var notesAndAssumptionsSchema = `
+		"notes": {
+			"type": "array",
+			"items": {"type": "string"},
+			"description": "Things the user must know or do before applying the configuration, E.g manual steps"
+		},
+		"assumptions": {
+			"type": "array",
+			"items": {"type": "string"},
+			"description": "The assumptions made where the source configuration was incomplete or ambiguous"
+		}`
+
+// mainTfTool is the tool the LLM must call to return the main.tf file
+var mainTfTool = bedrock.Tool{
+	Name:        "write_main_tf",
+	Description: "Write the main.tf Terraform configuration of the application",
+	InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"main_tf": {
+			"type": "string",
+			"description": "The content of the main.tf file, without variable declarations"
+		},` + notesAndAssumptionsSchema + `
+	},
+	"required": ["main_tf", "notes", "assumptions"]
+}`),
+}
+
+// variablesTfTool is the tool the LLM must call to return the variables.tf file
+var variablesTfTool = bedrock.Tool{
+	Name:        "write_variables_tf",
+	Description: "Write the variables.tf Terraform configuration of the application",
+	InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"variables_tf": {
+			"type": "string",
+			"description": "The content of the variables.tf file"
+		},` + notesAndAssumptionsSchema + `
+	},
+	"required": ["variables_tf"]
+}`),
+}
+
+// generateMainTf asks the LLM for the main.tf file. Plain-text replies are parsed with the code extractor.
+func generateMainTf(client llmClient, prompt string) (terraformFilesOutput, error) {
+	response, err := client.MessagesWithTool(prompt, mainTfTool)
+	if err != nil {
+		return terraformFilesOutput{}, err
+	}
+
+	var output terraformFilesOutput
+	if response.Input != nil {
+		if err := json.Unmarshal(response.Input, &output); err != nil {
+			return terraformFilesOutput{}, fmt.Errorf("error decoding %s output: %w", mainTfTool.Name, err)
+		}
+	} else {
+		output.MainTf = response.Text
+	}
+
+	output.MainTf, err = parseMainTfResponse(output.MainTf)
+	if err != nil {
+		return terraformFilesOutput{}, err
+	}
+	return output, nil
+}
+
+// generateVariablesTf asks the LLM for the variables.tf file. Plain-text replies are parsed with the code extractor.
+func generateVariablesTf(client llmClient, prompt string) (terraformFilesOutput, error) {
+	response, err := client.MessagesWithTool(prompt, variablesTfTool)
+	if err != nil {
+		return terraformFilesOutput{}, err
+	}
+
+	var output terraformFilesOutput
+	if response.Input != nil {
+		if err := json.Unmarshal(response.Input, &output); err != nil {
+			return terraformFilesOutput{}, fmt.Errorf("error decoding %s output: %w", variablesTfTool.Name, err)
+		}
+	} else {
+		output.VariablesTf = response.Text
+	}
+
+	output.VariablesTf, err = parseVariablesTfResponse(output.VariablesTf)
+	if err != nil {
+		return terraformFilesOutput{}, err
+	}
+	return output, nil
+}
+
+// pulumiOutput is the structured output of the Pulumi generation prompt
+type pulumiOutput struct {
+	PulumiYAML  string   `json:"pulumi_yaml"`
+	Notes       []string `json:"notes"`
+	Assumptions []string `json:"assumptions"`
+}
+
+// pulumiYAMLTool is the tool the LLM must call to return the Pulumi.yaml program
+var pulumiYAMLTool = bedrock.Tool{
+	Name:        "write_pulumi_yaml",
+	Description: "Write the Pulumi.yaml program of the application",
+	InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"pulumi_yaml": {
+			"type": "string",
+			"description": "The content of the Pulumi.yaml file"
+		},` + notesAndAssumptionsSchema + `
+	},
+	"required": ["pulumi_yaml", "notes", "assumptions"]
+}`),
+}
+
+// generatePulumiYAML asks the LLM for the Pulumi.yaml program. Plain-text replies are parsed with the code extractor.
+func generatePulumiYAML(client llmClient, prompt string) (pulumiOutput, error) {
+	response, err := client.MessagesWithTool(prompt, pulumiYAMLTool)
+	if err != nil {
+		return pulumiOutput{}, err
+	}
+
+	var output pulumiOutput
+	if response.Input != nil {
+		if err := json.Unmarshal(response.Input, &output); err != nil {
+			return pulumiOutput{}, fmt.Errorf("error decoding %s output: %w", pulumiYAMLTool.Name, err)
+		}
+	} else {
+		output.PulumiYAML = response.Text
+	}
+
+	output.PulumiYAML = extractCode(output.PulumiYAML)
+	if output.PulumiYAML == "" {
+		return pulumiOutput{}, fmt.Errorf("empty %s response", pulumiProgramFile)
+	}
+	return output, nil
+}
+
+// parseMainTfResponse extracts main.tf from a reply. The variable declarations are removed: they belong to variables.tf,
+// which is generated from the references of main.tf.
+func parseMainTfResponse(response string) (string, error) {
+	files := extractTerraformFiles(response)
+	mainTf := files["main.tf"]
+	if mainTf == "" {
+		mainTf = files[""]
+	}
+	mainTf = strings.TrimSpace(removeVariableBlocks(mainTf))
+	if mainTf == "" {
+		return "", fmt.Errorf("empty main.tf response")
+	}
+	return mainTf, nil
+}
+
+func parseVariablesTfResponse(response string) (string, error) {
+	files := extractTerraformFiles(response)
+	variablesTf := files["variables.tf"]
+	if variablesTf == "" {
+		variablesTf = files[""]
+	}
+	variablesTf = strings.TrimSpace(variablesTf)
+	if variablesTf == "" {
+		return "", fmt.Errorf("empty variables.tf response")
+	}
+	return variablesTf, nil
+}
+
+var (
+	codeFenceRegexp = regexp.MustCompile("(?ms)```([a-zA-Z0-9_+.-]*)[^\n]*\n(.*?)(?:^[ \t]*```|\\z)")
+	fileNameRegexp  = regexp.MustCompile(`([A-Za-z0-9_.-]+\.tf|Dockerfile)\b`)
+	// commentFileNameRegexp matches a file name in the first comment line of a block, E.g "# variables.tf"
+	commentFileNameRegexp = regexp.MustCompile(`^(?:#|//)\s*([A-Za-z0-9_.-]+\.tf|Dockerfile)\b`)
+	blankLinesRegexp      = regexp.MustCompile(`\n{3,}`)
+	// terraformStartRegexp matches the first line of a Terraform file, to strip the prose before unfenced code
+	terraformStartRegexp = regexp.MustCompile(`^(terraform|provider|resource|data|variable|locals|output|module)\b|^(#|//|/\*)`)
+)
+
+// codeBlock is a fenced code block of an LLM reply
+type codeBlock struct {
+	Language string
+	// FileName is the last file name mentioned before the block, E.g "Here is the main.tf file:", or in its first comment line
+	FileName string
+	Content  string
+}
+
+// extractCodeBlocks returns the fenced code blocks of an LLM reply. An unterminated block ends with the reply.
+func extractCodeBlocks(response string) []codeBlock {
+	var blocks []codeBlock
+	previousEnd := 0
+	for _, match := range codeFenceRegexp.FindAllStringSubmatchIndex(response, -1) {
+		block := codeBlock{
+			Language: response[match[2]:match[3]],
+			Content:  strings.TrimSpace(response[match[4]:match[5]]),
+		}
+
+		if name := commentFileNameRegexp.FindStringSubmatch(block.Content); name != nil {
+			block.FileName = name[1]
+		} else {
+			if names := fileNameRegexp.FindAllString(response[previousEnd:match[0]], -1); len(names) > 0 {
+				block.FileName = names[len(names)-1]
+			}
+		}
+
+		blocks = append(blocks, block)
+		previousEnd = match[1]
+	}
+	return blocks
+}
+
+// extractCode returns the code of an LLM reply expected to be a single file: the first fenced block, or the reply itself
+func extractCode(response string) string {
+	if blocks := extractCodeBlocks(response); len(blocks) > 0 {
+		return blocks[0].Content
+	}
+	return strings.TrimSpace(response)
+}
+
+// extractTerraformFiles returns the Terraform files of an LLM reply by file name. The blocks without a file name and
+// unfenced replies are returned under the "" key. Leading prose is stripped from unfenced replies.
+func extractTerraformFiles(response string) map[string]string {
+	blocks := extractCodeBlocks(response)
+	if len(blocks) == 0 {
+		return map[string]string{"": stripLeadingProse(strings.TrimSpace(response))}
+	}
+
+	contents := map[string][]string{}
+	for _, block := range blocks {
+		name := block.FileName
+		if name != "" && !strings.HasSuffix(name, ".tf") {
+			continue
+		}
+		contents[name] = append(contents[name], block.Content)
+	}
+
+	files := map[string]string{}
+	for name, parts := range contents {
+		files[name] = strings.Join(parts, "\n\n")
+	}
+	return files
+}
+
+func stripLeadingProse(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if terraformStartRegexp.MatchString(strings.TrimSpace(line)) {
+			return strings.Join(lines[i:], "\n")
+		}
+	}
+	return text
+}
+
+// removeVariableBlocks removes the variable blocks of a Terraform file. The file is returned as is if it can't be parsed.
+func removeVariableBlocks(content string) string {
+	file, diags := hclsyntax.ParseConfig([]byte(content), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return content
+	}
+
+	var ranges []hcl.Range
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type == "variable" {
+			ranges = append(ranges, block.Range())
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start.Byte > ranges[j].Start.Byte
+	})
+
+	for _, r := range ranges {
+		content = content[:r.Start.Byte] + content[r.End.Byte:]
+	}
+	return blankLinesRegexp.ReplaceAllString(content, "\n\n")
+}
@@ -0,0 +1,93 @@
+package migration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMainTfResponse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		response string
+		expected string
+	}{
+		"plain": {
+			response: "resource \"qovery_application\" \"app\" {}\n",
+			expected: `resource "qovery_application" "app" {}`,
+		},
+		"code fence with leading prose": {
+			response: "Here is the configuration:\n\n```hcl\nresource \"qovery_application\" \"app\" {}\n```\n\nLet me know if you need anything else.",
+			expected: `resource "qovery_application" "app" {}`,
+		},
+		"unterminated code fence": {
+			response: "```terraform\nresource \"qovery_application\" \"app\" {}\n",
+			expected: `resource "qovery_application" "app" {}`,
+		},
+		"leading prose without code fence": {
+			response: "Sure! Here is the main.tf file.\n# application\nresource \"qovery_application\" \"app\" {}",
+			expected: "# application\nresource \"qovery_application\" \"app\" {}",
+		},
+		"combined main.tf and variables.tf": {
+			response: "main.tf:\n```hcl\nresource \"qovery_application\" \"app\" {}\n```\n\nvariables.tf:\n```hcl\nvariable \"environment_id\" {\n  type = string\n}\n```",
+			expected: `resource "qovery_application" "app" {}`,
+		},
+		"variables declared in main.tf": {
+			response: "variable \"environment_id\" {\n  type = string\n}\n\nresource \"qovery_application\" \"app\" {}\n\nvariable \"project_id\" {}\n",
+			expected: `resource "qovery_application" "app" {}`,
+		},
+	} {
+		mainTf, err := parseMainTfResponse(tc.response)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.expected, mainTf, name)
+	}
+
+	_, err := parseMainTfResponse("```hcl\n```")
+	assert.Error(t, err)
+}
+
+func TestParseVariablesTfResponse(t *testing.T) {
+	variablesTf, err := parseVariablesTfResponse("```hcl\n# main.tf\nresource \"qovery_application\" \"app\" {}\n```\n```hcl\n# variables.tf\nvariable \"environment_id\" {}\n```")
+	require.NoError(t, err)
+	assert.Equal(t, "# variables.tf\nvariable \"environment_id\" {}", variablesTf)
+}
+
+func TestExtractCode(t *testing.T) {
+	assert.Equal(t, "FROM node:20\nUSER node", extractCode("```dockerfile\nFROM node:20\nUSER node\n```"))
+	assert.Equal(t, "FROM node:20", extractCode("  FROM node:20\n"))
+}
+
+func TestGenerateMainTf(t *testing.T) {
+	mockClaudeClient := new(MockClaudeClient)
+	input, err := json.Marshal(terraformFilesOutput{
+		MainTf:      "```hcl\nresource \"qovery_application\" \"app\" {}\n```",
+		Notes:       []string{"Create the Qovery environment first"},
+		Assumptions: []string{"The worker doesn't need a public port"},
+	})
+	require.NoError(t, err)
+	mockClaudeClient.On("MessagesWithTool", "structured", mainTfTool).Return(bedrock.ToolResponse{Input: input}, nil).Once()
+	mockClaudeClient.On("MessagesWithTool", "text", mainTfTool).Return(bedrock.ToolResponse{Text: "```hcl\nresource \"qovery_application\" \"app\" {}\n```"}, nil).Once()
+
+	output, err := generateMainTf(mockClaudeClient, "structured")
+	require.NoError(t, err)
+	assert.Equal(t, `resource "qovery_application" "app" {}`, output.MainTf)
+	assert.Equal(t, []string{"Create the Qovery environment first"}, output.Notes)
+	assert.Equal(t, []string{"The worker doesn't need a public port"}, output.Assumptions)
+
+	// fallback to the code extractor when the model doesn't call the tool
+	output, err = generateMainTf(mockClaudeClient, "text")
+	require.NoError(t, err)
+	assert.Equal(t, `resource "qovery_application" "app" {}`, output.MainTf)
+	assert.Empty(t, output.Notes)
+
+	mockClaudeClient.AssertExpectations(t)
+}
+
+func TestGeneratedTerraformReadmeMarkdown(t *testing.T) {
+	readme := GeneratedTerraform{AppName: "app", Notes: []string{"Set the custom domain DNS records"}}.ReadmeMarkdown()
+	assert.Contains(t, readme, "# app")
+	assert.Contains(t, readme, "## Notes\n\n- Set the custom domain DNS records\n")
+	assert.Contains(t, readme, "## Assumptions\n\nNone.")
+}
@@ -4,16 +4,18 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kubernetes"
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
-	"github.com/google/go-github/v39/github"
-	"golang.org/x/oauth2"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -27,21 +29,135 @@ type Assets struct {
 	GeneratedTerraformFiles      []GeneratedTerraform
 	Dockerfiles                  []Dockerfile
 	CostEstimationReportMarkdown string
+	// KnowledgeBundle describes the Qovery Terraform provider documentation and examples used as reference
+	KnowledgeBundle       kb.Manifest
+	KnowledgeBundleOrigin string
+	// LLMUsage is the number of tokens and the estimated spend of the LLM requests
+	LLMUsage bedrock.UsageSummary
+	// QoveryTarget is the Qovery organization the applications are migrated to
+	QoveryTarget QoveryTarget
+}
+
+// FailedApps returns the applications whose generation failed, sorted by name
+func (a *Assets) FailedApps() []string {
+	var failed []string
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		if generatedTf.Error != "" {
+			failed = append(failed, generatedTf.AppName)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// OutputFormat returns the output format of the applications, OutputTerraform if there is none
+func (a *Assets) OutputFormat() OutputFormat {
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		if generatedTf.Format != "" {
+			return generatedTf.Format
+		}
+	}
+	return OutputTerraform
 }
 
 // Dockerfile represents a generated Dockerfile for an app
 type Dockerfile struct {
 	AppName           string
 	DockerfileContent string
+	// Template is the name of the curated template used to render the Dockerfile, empty if generated by the LLM
+	Template string
+	// Findings are the issues found by the static validation of the first version of the Dockerfile
+	Findings []DockerfileFinding
+	// UnresolvedFindings are the issues still present after the fix-up iterations
+	UnresolvedFindings []DockerfileFinding
+	// PromptVersions are the IDs of the prompt templates used to generate the Dockerfile, E.g dockerfile@1
+	PromptVersions []string
+	// Models are the LLM models which generated the Dockerfile, more than one after a failover
+	Models []string
+}
+
+// ValidationConfig holds configuration options for the validation of the generated assets
+type ValidationConfig struct {
+	// TerraformCLI runs `init` and `validate` of the CLI of the format (terraform or tofu) after the in-process validation.
+	// It requires the binary and network access to the registry.
+	TerraformCLI bool
+	// Format is the output format of the applications, it selects their generator and validation step.
+	// Empty means OutputTerraform.
+	Format OutputFormat
+	// Kubernetes are the options of the charts of the kubernetes and helm formats
+	Kubernetes kubernetes.Options
+}
+
+// DefaultValidationConfig returns the default validation configuration, the terraform CLI is used if it is installed
+func DefaultValidationConfig() ValidationConfig {
+	return DefaultValidationConfigFor(OutputTerraform)
+}
+
+// maxValidationIterations is the maximum number of LLM fix-up iterations of a validation loop
+const maxValidationIterations = 10
+
+// llmClient is the subset of the Bedrock client used to generate assets
+type llmClient interface {
+	Messages(prompt string) (string, error)
+	MessagesWithTool(prompt string, tool bedrock.Tool) (bedrock.ToolResponse, error)
+}
+
+// forStage tags the requests of the client with the stage and the app name in the LLM usage summary, and streams the
+// responses to live progress updates if progressChan is set
+func forStage(client llmClient, stage, appName string, progressChan chan<- ProgressUpdate) llmClient {
+	bedrockClient, ok := client.(*bedrock.BedrockClient)
+	if !ok {
+		return client
+	}
+
+	tagged := bedrockClient.WithTags(stage, appName)
+	if progressChan == nil {
+		return tagged
+	}
+	return tagged.WithDeltas(generationProgress(stageDescriptions[stage], appName, progressChan))
+}
+
+// stageDescriptions are the descriptions of the LLM stages in the progress updates
+var stageDescriptions = map[string]string{
+	"dockerfile":    "Generating Dockerfile",
+	"main_tf":       "Generating main.tf",
+	"variables_tf":  "Generating variables.tf",
+	"terraform_fix": "Fixing Terraform",
+	"pulumi_yaml":   "Generating Pulumi.yaml",
+	"pulumi_fix":    "Fixing Pulumi program",
+}
+
+// progressTokensInterval is the number of generated tokens between two live progress updates
+const progressTokensInterval = 50
+
+// generationProgress returns a callback sending a progress update with the estimated number of tokens generated,
+// every progressTokensInterval tokens. The tokens of a failed attempt are taken back when the request is retried, so
+// that they are not counted twice.
+func generationProgress(stage, appName string, progressChan chan<- ProgressUpdate) func(bedrock.Delta) {
+	characters := 0
+	lastTokens := 0
+	return func(delta bedrock.Delta) {
+		characters += len(delta.Text) - delta.Discarded
+		tokens := characters / 4 // ~4 characters per token
+		if delta.Discarded == 0 && tokens-lastTokens < progressTokensInterval {
+			return
+		}
+		lastTokens = tokens
+		progressChan <- ProgressUpdate{Stage: stage, AppName: appName, Tokens: tokens}
+	}
 }
 
 // ProgressUpdate represents a progress update
 type ProgressUpdate struct {
 	Stage    string
 	Progress float64
+	// AppName and Tokens are set by the live updates of the LLM generations, Tokens is the estimated number of tokens
+	// generated for the app in the stage. Progress is not set by these updates.
+	AppName string
+	Tokens  int
 }
 
-func GenerateHerokuMigrationAssets(herokuAPIKey, awsKey, awsSecret, qoveryAPIKey, githubToken, destination string, bedrockClientConfig bedrock.ClientConfig, progressChan chan<- ProgressUpdate) (*Assets, error) {
+func GenerateHerokuMigrationAssets(herokuAPIKey, awsKey, awsSecret, qoveryAPIKey, destination string, knowledgeBundle *kb.Bundle, bedrockClientConfig bedrock.ClientConfig, validationConfig ValidationConfig, promptContextOptions PromptContextOptions, run *Run, progressChan chan<- ProgressUpdate) (*Assets, error) {
 	progressChan <- ProgressUpdate{Stage: "Fetching configs", Progress: 0.1}
 
 	herokuProvider := sources.NewHerokuProvider(herokuAPIKey)
@@ -50,10 +166,10 @@ func GenerateHerokuMigrationAssets(herokuAPIKey, awsKey, awsSecret, qoveryAPIKey
 		return nil, fmt.Errorf("error fetching Heroku configs: %w", err)
 	}
 
-	return GenerateMigrationAssets(configs, awsKey, awsSecret, qoveryAPIKey, githubToken, destination, bedrockClientConfig, progressChan)
+	return GenerateMigrationAssets(configs, awsKey, awsSecret, qoveryAPIKey, destination, knowledgeBundle, bedrockClientConfig, validationConfig, promptContextOptions, run, progressChan)
 }
 
-func GenerateCleverCloudMigrationAssets(authToken, awsKey, awsSecret, qoveryAPIKey, githubToken, destination string, bedrockClientConfig bedrock.ClientConfig, progressChan chan<- ProgressUpdate) (*Assets, error) {
+func GenerateCleverCloudMigrationAssets(authToken, awsKey, awsSecret, qoveryAPIKey, destination string, knowledgeBundle *kb.Bundle, bedrockClientConfig bedrock.ClientConfig, validationConfig ValidationConfig, promptContextOptions PromptContextOptions, run *Run, progressChan chan<- ProgressUpdate) (*Assets, error) {
 	progressChan <- ProgressUpdate{Stage: "Fetching configs", Progress: 0.1}
 
 	clevercloudProvider := sources.NewCleverCloudProvider(authToken)
@@ -62,18 +178,45 @@ func GenerateCleverCloudMigrationAssets(authToken, awsKey, awsSecret, qoveryAPIK
 		return nil, fmt.Errorf("error fetching Clever Cloud configs: %w", err)
 	}
 
-	return GenerateMigrationAssets(configs, awsKey, awsSecret, qoveryAPIKey, githubToken, destination, bedrockClientConfig, progressChan)
+	return GenerateMigrationAssets(configs, awsKey, awsSecret, qoveryAPIKey, destination, knowledgeBundle, bedrockClientConfig, validationConfig, promptContextOptions, run, progressChan)
 }
 
-// GenerateMigrationAssets generates all necessary assets for migration and reports progress
-func GenerateMigrationAssets(configs []sources.AppConfig, awsKey, awsSecret, qoveryAPIKey, githubToken, destination string, bedrockClientConfig bedrock.ClientConfig, progressChan chan<- ProgressUpdate) (*Assets, error) {
+// GenerateMigrationAssets generates all necessary assets for migration and reports progress.
+// The embedded knowledge bundle is used if knowledgeBundle is nil. The output of each stage of each app is saved in the
+// run if it is set, and the stages it already completed are skipped.
+func GenerateMigrationAssets(configs []sources.AppConfig, awsKey, awsSecret, qoveryAPIKey, destination string, knowledgeBundle *kb.Bundle, bedrockClientConfig bedrock.ClientConfig, validationConfig ValidationConfig, promptContextOptions PromptContextOptions, run *Run, progressChan chan<- ProgressUpdate) (*Assets, error) {
+	if knowledgeBundle == nil {
+		embeddedBundle, err := kb.Embedded()
+		if err != nil {
+			return nil, err
+		}
+		knowledgeBundle = embeddedBundle
+	}
+
+	promptCtx, err := newPromptContext(knowledgeBundle, promptContextOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize Bedrock client with AWS credentials
 	bedrockClient, err := bedrock.NewBedrockClient(awsKey, awsSecret, bedrockClientConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing Bedrock client: %w", err)
 	}
+	defer bedrockClient.Close()
+	run.trackUsage(bedrockClient.Usage)
 
+	// the destination is checked against the Qovery clusters before spending on the LLM, the formats deploying without
+	// Qovery skip it
 	qoveryProvider := qovery.NewQoveryProvider(qoveryAPIKey)
+	var qoveryTarget QoveryTarget
+	if validationConfig.Format.TargetsQovery() {
+		qoveryTarget, err = resolveQoveryTarget(context.Background(), qoveryProvider, destination)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	progressChan <- ProgressUpdate{Stage: "Processing configs", Progress: 0.3}
 
 	totalApps := len(configs)
@@ -81,13 +224,19 @@ func GenerateMigrationAssets(configs []sources.AppConfig, awsKey, awsSecret, qov
 	// Create channels for collecting results and errors
 	type dockerfileResult struct {
 		dockerfile   Dockerfile
-		qoveryConfig map[string]interface{}
+		qoveryConfig qovery.TranslatedApp
 		appName      string
 		err          error
 		index        int
 	}
 	resultChan := make(chan dockerfileResult, totalApps)
 
+	// the requests of the other apps are canceled when a Dockerfile fails, and the goroutines are waited for before
+	// returning: they send to progressChan, which the caller closes once this function returns
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dockerfileClient := bedrockClient.WithContext(ctx)
+
 	// Launch goroutines for parallel Dockerfile generation
 	var wg sync.WaitGroup
 	for i, app := range configs {
@@ -96,9 +245,15 @@ func GenerateMigrationAssets(configs []sources.AppConfig, awsKey, awsSecret, qov
 			defer wg.Done()
 
 			appName := app.Name()
-			qoveryConfig := qoveryProvider.TranslateConfig(appName, app.Map(), destination)
-
-			dockerfile, _, err := generateDockerfile(app.App(), bedrockClient)
+			qoveryConfig := qoveryProvider.TranslateConfig(app, destination)
+			run.saveConfig(app)
+
+			dockerfile, ok := run.dockerfile(appName)
+			var err error
+			if !ok {
+				dockerfile, err = generateDockerfileForApp(app, forStage(dockerfileClient, "dockerfile", appName, progressChan), promptCtx.templates.renderer())
+				run.saveDockerfile(appName, dockerfile, err)
+			}
 			if err != nil {
 				resultChan <- dockerfileResult{
 					err:   fmt.Errorf("error generating Dockerfile for %s: %w", appName, err),
@@ -108,15 +263,10 @@ func GenerateMigrationAssets(configs []sources.AppConfig, awsKey, awsSecret, qov
 			}
 
 			resultChan <- dockerfileResult{
-				dockerfile: Dockerfile{
-					AppName:           appName,
-					DockerfileContent: dockerfile,
-				},
-				qoveryConfig: map[string]interface{}{
-					appName: qoveryConfig,
-				},
-				appName: appName,
-				index:   index,
+				dockerfile:   dockerfile,
+				qoveryConfig: qoveryConfig,
+				appName:      appName,
+				index:        index,
 			}
 
 			progress := 0.3 + (float64(index+1) / float64(totalApps) * 0.4)
@@ -135,65 +285,229 @@ func GenerateMigrationAssets(configs []sources.AppConfig, awsKey, awsSecret, qov
 
 	// Collect results maintaining original order
 	dockerfiles := make([]Dockerfile, totalApps)
-	qoveryConfigs := make(map[string]interface{})
+	qoveryConfigs := make(map[string]qovery.TranslatedApp)
 
 	// Collect results and build maps after all goroutines complete
+	var budgetErr, dockerfileErr error
 	for result := range resultChan {
-		if result.err != nil {
-			return nil, result.err
+		if errors.Is(result.err, bedrock.ErrBudgetExceeded) {
+			budgetErr = result.err
+			continue
 		}
-		dockerfiles[result.index] = result.dockerfile
-		if result.qoveryConfig != nil {
-			for k, v := range result.qoveryConfig {
-				qoveryConfigs[k] = v
+		if result.err != nil {
+			if dockerfileErr == nil {
+				dockerfileErr = result.err
+				cancel()
 			}
+			continue
 		}
+		dockerfiles[result.index] = result.dockerfile
+		qoveryConfigs[result.appName] = result.qoveryConfig
+	}
+	if dockerfileErr != nil {
+		return nil, dockerfileErr
+	}
+
+	if budgetErr != nil {
+		// abort gracefully: the assets generated so far and the usage are returned along with the error
+		return newAssets(knowledgeBundle, qoveryTarget, nil, generatedDockerfiles(dockerfiles), bedrockClient), fmt.Errorf("error generating Dockerfiles: %w", budgetErr)
 	}
 
 	progressChan <- ProgressUpdate{Stage: "Generating Terraform configs", Progress: 0.7}
 
-	generatedTerraformFiles, err := generateTerraformFiles(qoveryConfigs, destination, bedrockClient, githubToken, false)
+	generatedTerraformFiles, err := generateTerraformFiles(qoveryConfigs, destination, bedrockClient, promptCtx, validationConfig, run, progressChan)
+	if errors.Is(err, bedrock.ErrBudgetExceeded) {
+		return newAssets(knowledgeBundle, qoveryTarget, generatedTerraformFiles, dockerfiles, bedrockClient), fmt.Errorf("error generating Terraform configs: %w", err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error generating Terraform configs: %w", err)
 	}
 
 	progressChan <- ProgressUpdate{Stage: "Estimating costs", Progress: 0.9}
 
-	assets := &Assets{
+	assets := newAssets(knowledgeBundle, qoveryTarget, generatedTerraformFiles, dockerfiles, bedrockClient)
+
+	progressChan <- ProgressUpdate{Stage: "Completed", Progress: 1.0}
+
+	return assets, nil
+}
+
+func newAssets(knowledgeBundle *kb.Bundle, qoveryTarget QoveryTarget, generatedTerraformFiles []GeneratedTerraform, dockerfiles []Dockerfile, bedrockClient *bedrock.BedrockClient) *Assets {
+	usage := bedrockClient.Usage()
+	// the models of the stages restored from a run are the ones of its checkpoints
+	for i := range dockerfiles {
+		if models := usage.ModelsOf(dockerfiles[i].AppName, "dockerfile"); len(models) > 0 {
+			dockerfiles[i].Models = models
+		}
+	}
+	for i := range generatedTerraformFiles {
+		if models := usage.ModelsOf(generatedTerraformFiles[i].AppName, generationStages...); len(models) > 0 {
+			generatedTerraformFiles[i].Models = models
+		}
+	}
+
+	return &Assets{
 		ReadmeMarkdown:               readmeContent,
 		GeneratedTerraformFiles:      generatedTerraformFiles,
 		Dockerfiles:                  dockerfiles,
 		CostEstimationReportMarkdown: "",
+		KnowledgeBundle:              knowledgeBundle.Manifest,
+		KnowledgeBundleOrigin:        knowledgeBundle.Origin,
+		LLMUsage:                     usage,
+		QoveryTarget:                 qoveryTarget,
 	}
+}
 
-	progressChan <- ProgressUpdate{Stage: "Completed", Progress: 1.0}
+// generatedDockerfiles returns the Dockerfiles that were generated, the others are left empty when a run is aborted
+func generatedDockerfiles(dockerfiles []Dockerfile) []Dockerfile {
+	var generated []Dockerfile
+	for _, dockerfile := range dockerfiles {
+		if dockerfile.AppName != "" {
+			generated = append(generated, dockerfile)
+		}
+	}
+	return generated
+}
 
-	return assets, nil
+// generateDockerfileForApp renders a curated Dockerfile template when the stack is known and falls back to the LLM otherwise.
+// The Dockerfile is then statically validated and fixed by the LLM if needed.
+func generateDockerfileForApp(app sources.AppConfig, client llmClient, prompts *promptRenderer) (Dockerfile, error) {
+	dockerfile := Dockerfile{AppName: app.Name()}
+
+	if tmpl, ok := detectDockerfileTemplate(app.Build()); ok {
+		content, err := renderDockerfileTemplate(tmpl, app.Build())
+		if err != nil {
+			return Dockerfile{}, err
+		}
+		dockerfile.DockerfileContent = content
+		dockerfile.Template = tmpl.Name
+	} else {
+		content, _, err := generateDockerfile(app, client, prompts)
+		if err != nil {
+			return Dockerfile{}, err
+		}
+		dockerfile.DockerfileContent = content
+	}
+
+	content, findings, unresolvedFindings, err := validateDockerfile(dockerfile.DockerfileContent, appPort(app.Build()), client, prompts)
+	if err != nil {
+		return Dockerfile{}, err
+	}
+	dockerfile.DockerfileContent = content
+	dockerfile.Findings = findings
+	dockerfile.UnresolvedFindings = unresolvedFindings
+	dockerfile.PromptVersions = prompts.versions()
+
+	return dockerfile, nil
+}
+
+// appPort returns the port the app listens on, or 0 when the app has no web process (E.g worker only)
+func appPort(build sources.BuildInfo) int {
+	if len(build.ProcessTypes) > 0 && build.ProcessTypes["web"] == "" {
+		return 0
+	}
+	return defaultAppPort
+}
+
+// validateDockerfile lints the Dockerfile and asks the LLM to fix the violations with the validation loop of the
+// Terraform files, the version with the fewest findings is kept. It returns the final Dockerfile, the findings of the
+// original Dockerfile and the findings that could not be fixed.
+func validateDockerfile(dockerfile string, port int, client llmClient, prompts *promptRenderer) (string, []DockerfileFinding, []DockerfileFinding, error) {
+	initialFindings := lintDockerfile(dockerfile, port)
+	if len(initialFindings) == 0 {
+		return dockerfile, nil, nil, nil
+	}
+
+	var findings []DockerfileFinding
+	gate := func(files map[string]string) (TerraformValidationIteration, string, error) {
+		findings = lintDockerfile(files[dockerfileFile], port)
+		return TerraformValidationIteration{Gate: DockerfileGateLint, Diagnostics: dockerfileDiagnostics(findings)}, "", nil
+	}
+	// the errors of the LLM fail the Dockerfile, the findings left when the loop stops are only reported
+	var fixErr error
+	fix := func(files map[string]string, _ TerraformValidationIteration, _ string) (map[string]string, error) {
+		prompt, err := prompts.render(PromptDockerfileFix, struct {
+			Dockerfile string
+			Findings   []DockerfileFinding
+			Port       int
+		}{files[dockerfileFile], findings, port})
+		if err != nil {
+			fixErr = err
+			return nil, err
+		}
+
+		response, err := client.Messages(prompt)
+		if err != nil {
+			fixErr = fmt.Errorf("error getting response from Bedrock for Dockerfile: %w", err)
+			return nil, fixErr
+		}
+		return map[string]string{dockerfileFile: extractCode(response)}, nil
+	}
+
+	result, err := runValidationLoop(map[string]string{dockerfileFile: dockerfile}, "Dockerfile", gate, fix)
+	if fixErr != nil {
+		return "", nil, nil, fixErr
+	}
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	dockerfile = result.Files[dockerfileFile]
+	return dockerfile, initialFindings, lintDockerfile(dockerfile, port), nil
 }
 
 // generateDockerfile generates a Dockerfile for a given app configuration
-func generateDockerfile(appConfig map[string]interface{}, bedrockClient *bedrock.BedrockClient) (string, string, error) {
-	configJSON, err := json.Marshal(appConfig)
+func generateDockerfile(app sources.AppConfig, bedrockClient llmClient, prompts *promptRenderer) (string, string, error) {
+	configJSON, err := json.Marshal(app.App())
 	if err != nil {
 		return "", "", fmt.Errorf("error marshaling app config: %w", err)
 	}
 
-	prompt := fmt.Sprintf(`GENERATE A DOCKERFILE FOR THE FOLLOWING APP CONFIGURATION:\n%s\n\n
-INSTRUCTIONS THAT MUST BE FOLLOWED:
-- You should find all the information you need like the language, the potential framework and the version associated.
-- The Dockerfile should be optimized for the best performance and security.
-- Generate just the Dockerfile content and nothing else.
-`, string(configJSON))
+	buildJSON, err := json.Marshal(app.Build())
+	if err != nil {
+		return "", "", fmt.Errorf("error marshaling build info: %w", err)
+	}
+
+	prompt, err := prompts.render(PromptDockerfile, struct {
+		Config string
+		Build  string
+	}{string(configJSON), string(buildJSON)})
+	if err != nil {
+		return "", "", err
+	}
 
 	result, err := bedrockClient.Messages(prompt)
-	return result, prompt, err
+	if err != nil {
+		return "", prompt, err
+	}
+	return extractCode(result), prompt, nil
 }
 
 type GeneratedTerraform struct {
-	AppName     string
+	AppName string
+	// Format is the output format of the files, empty means OutputTerraform
+	Format      OutputFormat `json:",omitempty"`
 	MainTf      string
 	VariablesTf string
-	Prompt      string
+	// Files are the files of the formats without main.tf and variables.tf by path, E.g Pulumi.yaml or chart/Chart.yaml
+	Files  map[string]string `json:",omitempty"`
+	Prompt string
+	// Diagnostics are the warnings left once the configuration is valid, or the errors left if it could not be fixed
+	Diagnostics          []TerraformDiagnostic
+	ValidationIterations []TerraformValidationIteration
+	// PromptVersions are the IDs of the prompt templates used to generate the Terraform files, E.g main_tf@1
+	PromptVersions []string
+	// Models are the LLM models which generated the Terraform files, more than one after a failover
+	Models []string
+	// Notes and Assumptions are given by the LLM along with the Terraform files, they are listed in the app README
+	Notes       []string
+	Assumptions []string
+	// Target is the Qovery environment the app was translated to before the generation
+	Target qovery.Environment
+	// TargetCoverage are the differences between the services of the target and the resources of main.tf
+	TargetCoverage []string
+	// Error is the error of the generation of the app, E.g the validation ran out of iterations. The run can be resumed
+	// to generate it again.
+	Error string `json:",omitempty"`
 }
 
 func (g GeneratedTerraform) SanitizeAppName() string {
@@ -202,41 +516,49 @@ func (g GeneratedTerraform) SanitizeAppName() string {
 	return strings.ToLower(s)
 }
 
-// generateTerraformFiles generates Terraform configurations for Qovery in parallel
-func generateTerraformFiles(qoveryConfigs map[string]interface{}, destination string, bedrockClient *bedrock.BedrockClient,
-	githubToken string, loadQoveryTerraformDocMarkdown bool) ([]GeneratedTerraform, error) {
-
-	officialExamples, err := loadTerraformExamples("Qovery", "terraform-examples", "examples", githubToken)
-	if err != nil {
-		return nil, fmt.Errorf("error loading Terraform examples: %w", err)
-	}
-
-	airbyteExample, err := loadTerraformExamples("evoxmusic", "qovery-airbyte", ".", githubToken)
-	if err != nil {
-		return nil, fmt.Errorf("error loading Airbyte Terraform example: %w", err)
+// generated returns true if the files of the app were generated, valid or not
+func (g GeneratedTerraform) generated() bool {
+	if !g.Format.HCL() {
+		for _, content := range g.Files {
+			if content != "" {
+				return true
+			}
+		}
+		return false
 	}
+	return g.MainTf != ""
+}
 
-	qoveryTerraformDocMarkdown, err := loadMarkdownFiles("Qovery", "terraform-provider-qovery", "main", githubToken)
-	if err != nil {
-		return nil, fmt.Errorf("error loading Qovery Terraform Provider markdown documentation: %w", err)
+// ReadmeMarkdown returns the README of the app directory, with the notes and assumptions of the LLM
+func (g GeneratedTerraform) ReadmeMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# %s\n\n", g.AppName))
+	sb.WriteString("This directory contains the generated files of the application. Review the notes and assumptions below before applying it.\n\n")
+
+	for _, section := range []struct {
+		title string
+		items []string
+	}{{"Notes", g.Notes}, {"Assumptions", g.Assumptions}} {
+		sb.WriteString(fmt.Sprintf("## %s\n\n", section.title))
+		if len(section.items) == 0 {
+			sb.WriteString("None.\n\n")
+			continue
+		}
+		for _, item := range section.items {
+			sb.WriteString(fmt.Sprintf("- %s\n", item))
+		}
+		sb.WriteString("\n")
 	}
 
-	examples := append(officialExamples, airbyteExample...)
+	return sb.String()
+}
 
-	examplesJSON, err := json.Marshal(examples)
-	if err != nil {
-		return nil, fmt.Errorf("error marshaling Terraform examples: %w", err)
-	}
+// generateTerraformFiles generates the infrastructure as code files of the apps in parallel, with the generator of the
+// output format of the validation configuration. The apps whose generation stage is completed in the run are restored.
+func generateTerraformFiles(qoveryConfigs map[string]qovery.TranslatedApp, destination string, bedrockClient llmClient,
+	promptCtx *promptContext, validationConfig ValidationConfig, run *Run, progressChan chan<- ProgressUpdate) ([]GeneratedTerraform, error) {
 
-	var qoveryTerraformDocMarkdownJSON []byte
-	if loadQoveryTerraformDocMarkdown {
-		qoveryTerraformDocMarkdownJSON = []byte("")
-	} else {
-		qoveryTerraformDocMarkdownJSON, err = json.Marshal(qoveryTerraformDocMarkdown)
-		if err != nil {
-			return nil, fmt.Errorf("error marshaling Qovery Terraform Provider markdown documentation: %w", err)
-		}
-	}
+	generator := newOutputGenerator(bedrockClient, promptCtx, validationConfig, progressChan)
 
 	// Create channels for results and errors
 	type result struct {
@@ -251,167 +573,16 @@ func generateTerraformFiles(qoveryConfigs map[string]interface{}, destination st
 	// Process each app configuration in parallel
 	for appName, qoveryConfigValue := range qoveryConfigs {
 		wg.Add(1)
-		go func(appName string, qoveryConfigValue interface{}) {
+		go func(appName string, qoveryConfigValue qovery.TranslatedApp) {
 			defer wg.Done()
 
-			qoveryConfigValueJSON, err := json.Marshal(qoveryConfigValue)
-			if err != nil {
-				resultChan <- result{
-					terraform: GeneratedTerraform{
-						AppName: appName,
-					},
-					err: fmt.Errorf("error marshaling Qovery config for %s: %w", appName, err),
-				}
+			if terraform, ok := run.generated(appName); ok {
+				resultChan <- result{terraform: terraform}
 				return
 			}
-
-			// First request: Generate main.tf
-			mainTfPrompt := fmt.Sprintf(`CONTEXT:
-This function must return the main.tf Terraform configuration that will be used to deploy the application with Qovery.
-
-OUTPUT FORMAT REQUIREMENTS:
-Provide only the main.tf configuration without any variables declarations.
-Format the response as a single string containing only the main.tf content, without any separators or additional text. The response must look like this:
-terraform {
-  required_providers {
-    qovery = {
-      source = "qovery/qovery"
-    }
-  }
-}
-
-provider "qovery" {
-  token = var.qovery_access_token
-}
-
-GENERATE A CONSOLIDATED TERRAFORM CONFIGURATION FOR QOVERY THAT INCLUDE THE FOLLOWING APP AND THE DEPENDENCIES (DATABASES, SERVICES, ETC):
-%s
-
-TERRAFORM GENERATION INSTRUCTIONS:
-- Don't use Buildpacks, only use Dockerfiles for build_mode.
-- Export secrets or sensitive information (E.g environment variable key with name containaing SECRET, KEY, URI, TOKEN, and every value that looks like a secret) from the main.tf file into variables.
-- If an application refer to a database that is created by another application, make sure to use the same existing database in the Terraform configuration.
-- If an application to another application via the environment variables, make sure to use the "environment_variable_aliases" from the Qovery Terraform Provider resource (if available. cf doc).
-- If in the service you see an application that can be provided by a container image from the DockerHub, use the "container_image" from the Qovery Terraform Provider resource (if available. cf doc).
-- If the configuration has different pipelines/stages/environments, make sure to create different Qovery environments for each set of services/applications/databases.
-- If some services use the "review app" then turn on the preview environment for them with Qoverys's Terraform Provider.
-- The cluster and environment resources are not required in the configuration. Export the cluster and environment ids as variables.
-- Include comment into the Terraform files to explain the configuration if needed - users are technical but can be not familiar with Terraform.
-- When setting up healthchecks for the services, make sure to use scheme "HTTP" for the healthcheck type http and "TCP" for the healthcheck type tcp. Refer to the Qovery Terraform Provider Documentation for more information.
-- Try to optimize the Terraform configuration as much as possible.
-- Don't include Qovery Terraform resources "qovery_deployment", "qovery_project", "qovery_environment", and "qovery_cluster" in the main.tf; use the variable references "var.project_id" etc.. to them instead.
-- Refer to the Qovery Terraform Provider Documentation below to see all the options of the provider and how to use it:
-%s
-
-USE THE FOLLOWING TERRAFORM EXAMPLES AS REFERENCE TO GENERATE THE CONFIGURATION:
-%s`, string(qoveryConfigValueJSON), string(qoveryTerraformDocMarkdownJSON), string(examplesJSON))
-
-			mainTfResponse, err := bedrockClient.Messages(mainTfPrompt)
-			if err != nil {
-				resultChan <- result{
-					terraform: GeneratedTerraform{
-						AppName: appName,
-						Prompt:  mainTfPrompt,
-					},
-					err: fmt.Errorf("error generating main.tf for %s: %w", appName, err),
-				}
-				return
-			}
-
-			// Parse and validate main.tf
-			mainTf, err := parseMainTfResponse(mainTfResponse)
-			if err != nil {
-				resultChan <- result{
-					terraform: GeneratedTerraform{
-						AppName: appName,
-						Prompt:  mainTfPrompt,
-					},
-					err: fmt.Errorf("error parsing main.tf response for %s: %w", appName, err),
-				}
-				return
-			}
-
-			// Second request: Generate variables.tf based on main.tf
-			variablesTfPrompt := fmt.Sprintf(`CONTEXT:
-Generate the variables.tf file for the following main.tf Terraform configuration:
-
-%s
-
-VARIABLE GENERATION INSTRUCTIONS:
-- Include all necessary variables referenced in the main.tf file
-- Don't provide default values for sensitive information (secrets, tokens, keys, URIs)
-- Include appropriate descriptions for all variables
-- Group related variables together with comments
-- Include type constraints for all variables
-- Make sure to include all environment IDs, cluster IDs, and other referenced variables from main.tf
-
-OUTPUT FORMAT REQUIREMENTS:
-Provide only the variables.tf configuration.
-Format the response as a single string containing only the variables.tf content, without any separators or additional text. The response must look like this:
-variable "project_id" {
-  type        = string
-  description = "The ID of the Qovery project"
-}
-
-variable "environment_id" {
-  type        = string
-  description = "The ID of the Qovery environment"
-}
-
-variable "application_name" {
-  type        = string
-  description = "The name of the application"
-}`, mainTf)
-
-			variablesTfResponse, err := bedrockClient.Messages(variablesTfPrompt)
-			if err != nil {
-				resultChan <- result{
-					terraform: GeneratedTerraform{
-						AppName: appName,
-						MainTf:  mainTf,
-						Prompt:  variablesTfPrompt,
-					},
-					err: fmt.Errorf("error generating variables.tf for %s: %w", appName, err),
-				}
-				return
-			}
-
-			// Parse variables.tf
-			variablesTf, err := parseVariablesTfResponse(variablesTfResponse)
-			if err != nil {
-				resultChan <- result{
-					terraform: GeneratedTerraform{
-						AppName: appName,
-						MainTf:  mainTf,
-						Prompt:  variablesTfPrompt,
-					},
-					err: fmt.Errorf("error parsing variables.tf response for %s: %w", appName, err),
-				}
-				return
-			}
-
-			// Validate the complete Terraform configuration
-			finalMainTf, finalVariablesTf, err := validateTerraform(mainTf, variablesTf, bedrockClient)
-			if err != nil {
-				resultChan <- result{
-					terraform: GeneratedTerraform{
-						AppName: appName,
-						Prompt:  mainTfPrompt + "\n\n" + variablesTfPrompt,
-					},
-					err: fmt.Errorf("error validating Terraform configuration for %s: %w", appName, err),
-				}
-				return
-			}
-
-			resultChan <- result{
-				terraform: GeneratedTerraform{
-					AppName:     appName,
-					MainTf:      finalMainTf,
-					VariablesTf: finalVariablesTf,
-					Prompt:      mainTfPrompt + "\n\n" + variablesTfPrompt,
-				},
-				err: nil,
-			}
+			terraform, err := generator.generate(appName, qoveryConfigValue)
+			run.saveGenerated(terraform, err)
+			resultChan <- result{terraform: terraform, err: err}
 		}(appName, qoveryConfigValue)
 	}
 
@@ -423,86 +594,50 @@ variable "application_name" {
 
 	// Collect results and check for errors
 	var generatedTerraformFiles []GeneratedTerraform
-	var errors []error
+	var budgetErr error
 
 	for result := range resultChan {
+		if errors.Is(result.err, bedrock.ErrBudgetExceeded) {
+			budgetErr = result.err
+		}
+		terraform := result.terraform
 		if result.err != nil {
-			errors = append(errors, result.err)
+			terraform.Error = result.err.Error()
 		}
-		generatedTerraformFiles = append(generatedTerraformFiles, result.terraform)
+		terraform.Format = validationConfig.Format
+		terraform.Target = qoveryConfigs[terraform.AppName].Target
+		terraform.TargetCoverage = targetCoverage(terraform.Target, terraform)
+		generatedTerraformFiles = append(generatedTerraformFiles, terraform)
 	}
 
 	// we even return the errors to the user - they can be useful for debugging
+	// but the run is aborted once the LLM cost budget is exceeded
 
-	return generatedTerraformFiles, nil
-}
-
-// Helper functions to parse individual responses
-func parseMainTfResponse(response string) (string, error) {
-	mainTf := strings.TrimSpace(response)
-	if mainTf == "" {
-		return "", fmt.Errorf("empty main.tf response")
-	}
-	return mainTf, nil
+	return generatedTerraformFiles, budgetErr
 }
 
-func parseVariablesTfResponse(response string) (string, error) {
-	variablesTf := strings.TrimSpace(response)
-	if variablesTf == "" {
-		return "", fmt.Errorf("empty variables.tf response")
+// EstimateWorkloadCosts estimates the costs of running the workload and provides a comparison report.
+// The embedded prompt template is used if prompts is nil.
+func EstimateWorkloadCosts(mainTfContent string, currentCosts float64, bedrockClient *bedrock.BedrockClient, prompts *PromptTemplates) (string, string, error) {
+	if prompts == nil {
+		embeddedPrompts, err := LoadPromptTemplates("")
+		if err != nil {
+			return "", "", err
+		}
+		prompts = embeddedPrompts
 	}
-	return variablesTf, nil
-}
 
-// EstimateWorkloadCosts estimates the costs of running the workload and provides a comparison report
-func EstimateWorkloadCosts(mainTfContent string, currentCosts float64, bedrockClient *bedrock.BedrockClient) (string, string, error) {
 	// Prepare the prompt for Bedrock
-	prompt := fmt.Sprintf(`Given the following Terraform configuration for Qovery:
-
-%s
-
-And the following comparison information between Qovery + Cloud Provider and Heroku:
-
-| Feature | Qovery + Cloud Provider | Heroku |
-|---------|-------------------------|--------|
-| Applications run in your own cloud | ✅ | ❌ |
-| Private VPC | ✅ | Enterprise only |
-| Autoscaling | ✅ | Performance dynos only |
-| Multiple Single tenant infrastructure | ✅ | ❌ |
-| SOC2 & HIPAA compliance | ✅ | Enterprise only |
-| Microservices support | ✅ | ❌ |
-| Mono repository support | ✅ | ❌ |
-| Static IPs | ✅ | ❌ |
-| Global regions availability | Many (US, EU, Asia, etc.) | Limited (US, EU, AU) |
-| Cost at scale (150 instances) | $31K/year | $450K/year |
-
-Please provide a comprehensive cost estimation report in Markdown format. Include the following:
-
-1. Estimated monthly costs for running this workload on the cloud provider specified in the Terraform configuration.
-2. A detailed breakdown of the costs for each resource.
-3. Comparison with the current costs of $%.2f per month on Heroku.
-4. An analysis of cost-effectiveness, considering both direct costs and potential indirect savings from improved features and flexibility.
-5. Estimated costs if the workload were to be run on other major cloud providers (AWS, GCP, Azure) for comparison.
-6. A summary recommendation on whether to proceed with the migration, considering both costs and feature benefits.
-
-Also, include the following Qovery-specific costs in your calculations:
-- Managed cluster: $199/month (or $0 if using a self-managed Kubernetes cluster)
-- 1 user: $29/month
-- Deployment: $0.16 per minute (free up to 1000 minutes per month if using their own CI/CD)
-
-Consider potential cost savings from:
-- More efficient resource utilization
-- Autoscaling capabilities
-- Reduced need for enterprise-level features that are standard with Qovery
-- Improved developer productivity due to better tooling and flexibility
-
-Provide a comprehensive report that a decision-maker could use to determine if migration is worthwhile, considering both immediate cost impacts and long-term strategic benefits.
-
-Important for the report: use as much as possible tables for the comparison and make it easy to read.
-`, mainTfContent, currentCosts)
+	prompt, err := prompts.renderer().render(PromptCostEstimation, struct {
+		MainTf       string
+		CurrentCosts float64
+	}{mainTfContent, currentCosts})
+	if err != nil {
+		return "", "", err
+	}
 
 	// Get Bedrock's response
-	response, err := bedrockClient.Messages(prompt)
+	response, err := bedrockClient.WithTags("cost_estimation", "").Messages(prompt)
 	if err != nil {
 		return "", prompt, fmt.Errorf("error getting response from Bedrock: %w", err)
 	}
@@ -513,339 +648,194 @@ Important for the report: use as much as possible tables for the comparison and
 	return response, prompt, nil
 }
 
-// NewGitHubClient creates a new GitHub client with optional authentication
-func NewGitHubClient(token string) *github.Client {
-	ctx := context.Background()
-	if token != "" {
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: token},
-		)
-		tc := oauth2.NewClient(ctx, ts)
-		return github.NewClient(tc)
-	}
-	return github.NewClient(nil)
+// terraformValidation is the outcome of the Terraform validation loop
+type terraformValidation struct {
+	MainTf      string
+	VariablesTf string
+	// Diagnostics are the diagnostics of the returned files: warnings if they are valid, errors otherwise
+	Diagnostics []TerraformDiagnostic
+	Iterations  []TerraformValidationIteration
 }
 
-func loadTerraformExamples(owner, repo, exampleDir, token string) ([]map[string]string, error) {
-	client := NewGitHubClient(token)
-
-	_, dirContent, _, err := client.Repositories.GetContents(context.Background(), owner, repo, exampleDir, nil)
+// ValidateTerraform takes an original Terraform manifest, validates it, and returns the final valid manifest or an error.
+// The in-process validation is the first gate, the terraform CLI is an optional second gate.
+// On error, the best version of the manifests found so far is returned along with its diagnostics.
+func validateTerraform(originalMainManifest string, originalVariablesManifest string, providerDocs map[string]string, validationConfig ValidationConfig, bedrockClient llmClient, prompts *promptRenderer) (terraformValidation, error) {
+	// Create a temporary directory for Terraform files
+	tempDir, err := ioutil.TempDir("", "terraform-validate")
 	if err != nil {
-		return nil, fmt.Errorf("error fetching repository contents: %w", err)
+		return terraformValidation{}, fmt.Errorf("failed to create temp directory: %w", err)
 	}
+	defer os.RemoveAll(tempDir)
 
-	var examples []map[string]string
-
-	for _, content := range dirContent {
-		if content.GetType() == "dir" {
-			mainTFPath := filepath.Join(exampleDir, content.GetName(), "main.tf")
-			fileContent, _, _, err := client.Repositories.GetContents(context.Background(), owner, repo, mainTFPath, nil)
-			if err != nil {
-				continue // Skip if main.tf doesn't exist
-			}
-
-			decodedContent, err := fileContent.GetContent()
-			if err != nil {
-				return nil, fmt.Errorf("error decoding file content: %w", err)
-			}
+	files := map[string]string{
+		"main.tf":      originalMainManifest,
+		"variables.tf": originalVariablesManifest,
+	}
 
-			examples = append(examples, map[string]string{
-				"name":    content.GetName(),
-				"content": decodedContent,
-			})
+	gate := func(files map[string]string) (TerraformValidationIteration, string, error) {
+		return runTerraformValidationGates(files, tempDir, validationConfig)
+	}
+	fix := func(files map[string]string, iteration TerraformValidationIteration, initOutput string) (map[string]string, error) {
+		if iteration.Gate == TerraformGateInit || iteration.Gate == TofuGateInit {
+			return fixTerraformInitErrors(files, initOutput, bedrockClient, prompts)
 		}
+		return fixTerraformDiagnostics(files, iteration.Diagnostics, providerDocs, bedrockClient, prompts)
 	}
 
-	return examples, nil
+	result, err := runValidationLoop(files, "Terraform configuration", gate, fix)
+	return terraformValidation{
+		MainTf:      result.Files["main.tf"],
+		VariablesTf: result.Files["variables.tf"],
+		Diagnostics: result.Diagnostics,
+		Iterations:  result.Iterations,
+	}, err
 }
 
-func loadMarkdownFiles(owner, repo, branch, token string) (map[string]string, error) {
-	client := NewGitHubClient(token)
-	ctx := context.Background()
-
-	result := make(map[string]string)
+// runTerraformValidationGates runs the validation gates until one fails. The output of terraform init is returned
+// when it fails as it isn't structured.
+func runTerraformValidationGates(files map[string]string, tempDir string, validationConfig ValidationConfig) (TerraformValidationIteration, string, error) {
+	// First gate: in-process HCL parsing and schema validation, it needs neither the terraform binary nor network access
+	diagnostics, err := validateTerraformHCL(files)
+	if err != nil {
+		return TerraformValidationIteration{}, "", err
+	}
 
-	// Folders to search
-	folders := []string{"", "data-sources", "resources"}
+	iteration := TerraformValidationIteration{Gate: TerraformGateHCL, Diagnostics: diagnostics}
+	cli := validationConfig.Format.CLI()
+	if iteration.ErrorCount() > 0 || !validationConfig.TerraformCLI || cli == "" {
+		return iteration, "", nil
+	}
+	initGate, validateGate := TerraformGateInit, TerraformGateValidate
+	if cli == "tofu" {
+		initGate, validateGate = TofuGateInit, TofuGateValidate
+	}
 
-	for _, folder := range folders {
-		// List files in the folder
-		_, directoryContent, _, err := client.Repositories.GetContents(ctx, owner, repo, "docs/"+folder, &github.RepositoryContentGetOptions{Ref: branch})
-		if err != nil {
-			return nil, fmt.Errorf("error listing contents of %s: %v", folder, err)
+	// Second gate (optional): init and validate, they need the terraform or tofu binary and access to the registry
+	for fileName, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(tempDir, fileName), []byte(content), 0644); err != nil {
+			return TerraformValidationIteration{}, "", fmt.Errorf("failed to write %s file: %w", fileName, err)
 		}
+	}
 
-		for _, content := range directoryContent {
-			if content.GetType() == "file" && strings.HasSuffix(content.GetName(), ".md") {
-				// Get file content
-				fileContent, _, _, err := client.Repositories.GetContents(ctx, owner, repo, content.GetPath(), &github.RepositoryContentGetOptions{Ref: branch})
-				if err != nil {
-					return nil, fmt.Errorf("error getting content of %s: %v", content.GetPath(), err)
-				}
-
-				// Decode content
-				decodedContent, err := fileContent.GetContent()
-				if err != nil {
-					return nil, fmt.Errorf("error decoding content of %s: %v", content.GetPath(), err)
-				}
-
-				// Add to result map
-				result[content.GetPath()] = decodedContent
-			}
+	// Run terraform init
+	initCmd := exec.Command(cli, "init")
+	initCmd.Dir = tempDir
+	initOutput, err := initCmd.CombinedOutput()
+	if err != nil {
+		return TerraformValidationIteration{
+			Gate: initGate,
+			Diagnostics: []TerraformDiagnostic{{
+				Severity: "error",
+				Summary:  fmt.Sprintf("%s init failed", validationConfig.Format.Title()),
+				Detail:   strings.TrimSpace(string(initOutput)),
+			}},
+		}, string(initOutput), nil
+	}
+
+	// Run terraform validate
+	validateCmd := exec.Command(cli, "validate", "-json")
+	validateCmd.Dir = tempDir
+
+	// stdout only: the JSON output must not be mixed with the logs
+	output, err := validateCmd.Output()
+	validateDiagnostics, parseErr := parseTerraformValidateJSON(output)
+	if parseErr != nil {
+		if err == nil {
+			return TerraformValidationIteration{Gate: validateGate, Diagnostics: diagnostics}, "", nil
 		}
+		validateDiagnostics = []TerraformDiagnostic{{
+			Severity: "error",
+			Summary:  fmt.Sprintf("%s validate failed", validationConfig.Format.Title()),
+			Detail:   strings.TrimSpace(string(output)),
+		}}
 	}
 
-	return result, nil
+	// keep the in-process warnings (E.g unused variables)
+	return TerraformValidationIteration{Gate: validateGate, Diagnostics: append(diagnostics, validateDiagnostics...)}, "", nil
 }
 
-// ValidateTerraform takes an original Terraform manifest, validates it, and returns the final valid manifest or an error
-func validateTerraform(originalMainManifest string, originalVariablesManifest string, bedrockClient *bedrock.BedrockClient) (string, string, error) {
-	// Create a temporary directory for Terraform files
-	tempDir, err := ioutil.TempDir("", "terraform-validate")
+// fixTerraformInitErrors asks the LLM to fix main.tf then variables.tf for terraform init errors
+func fixTerraformInitErrors(files map[string]string, initOutput string, bedrockClient llmClient, prompts *promptRenderer) (map[string]string, error) {
+	// First prompt for main.tf fixes, including variables.tf content
+	mainPrompt, err := prompts.render(PromptTerraformInitFixMain, terraformFixPromptData{files["main.tf"], files["variables.tf"], initOutput})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, err
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Write the original manifests to files in the temp directory
-	tfFilePath := filepath.Join(tempDir, "main.tf")
-	if err := ioutil.WriteFile(tfFilePath, []byte(originalMainManifest), 0644); err != nil {
-		return "", "", fmt.Errorf("failed to write main.tf file: %w", err)
+	// Get Bedrock's response for main.tf
+	correctedMain, err := bedrockClient.Messages(mainPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response from Bedrock for main.tf: %w", err)
 	}
 
-	tfVarFilePath := filepath.Join(tempDir, "variables.tf")
-	if err := ioutil.WriteFile(tfVarFilePath, []byte(originalVariablesManifest), 0644); err != nil {
-		return "", "", fmt.Errorf("failed to write variables.tf file: %w", err)
+	// Second prompt for variables.tf fixes, including the corrected main.tf
+	varsPrompt, err := prompts.render(PromptTerraformInitFixVariables, terraformFixPromptData{correctedMain, files["variables.tf"], initOutput})
+	if err != nil {
+		return nil, err
 	}
 
-	maxIterations := 10
-	for i := 0; i < maxIterations; i++ {
-		fmt.Printf("Iteration %d:\n", i+1)
-
-		// Run terraform init
-		initCmd := exec.Command("terraform", "init")
-		initCmd.Dir = tempDir
-		initOutput, err := initCmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Terraform init failed: %s\n", initOutput)
-
-			// Read the current Terraform files
-			mainContent, err := ioutil.ReadFile(tfFilePath)
-			if err != nil {
-				return "", "", fmt.Errorf("error reading main.tf file: %w", err)
-			}
-
-			varsContent, err := ioutil.ReadFile(tfVarFilePath)
-			if err != nil {
-				return "", "", fmt.Errorf("error reading variables.tf file: %w", err)
-			}
-
-			// First prompt for main.tf fixes, including variables.tf content
-			mainPrompt := fmt.Sprintf(`The following Terraform configuration failed during initialization:
-
-Main Terraform file (main.tf):
-%s
-
-Current variables file (variables.tf):
-%s
-
-The initialization error is:
-%s
-
-Please fix the main.tf configuration to resolve these initialization errors while ensuring compatibility with the variables.tf file. Focus on issues like:
-- Missing or incorrect provider configurations
-- Invalid backend configurations
-- Module source problems
-- Version constraints
-- Variable references matching variables.tf declarations
-
-Provide only the corrected main.tf code without any explanations and no formatting. Output must look like this:
-terraform {
-  required_providers {
-    qovery = {
-      source = "qovery/qovery"
-    }
-  }
-}
-
-provider "qovery" {
-  token = var.qovery_access_token
-}`, mainContent, varsContent, initOutput)
-
-			// Get Bedrock's response for main.tf
-			correctedMain, err := bedrockClient.Messages(mainPrompt)
-			if err != nil {
-				return "", "", fmt.Errorf("error getting response from Bedrock for main.tf: %w", err)
-			}
-
-			// Write the corrected main.tf first
-			if err := ioutil.WriteFile(tfFilePath, []byte(correctedMain), 0644); err != nil {
-				return "", "", fmt.Errorf("error writing corrected main.tf: %w", err)
-			}
-
-			// Second prompt for variables.tf fixes, including the corrected main.tf
-			varsPrompt := fmt.Sprintf(`The following Terraform configuration failed during initialization:
-
-Current main.tf (already corrected):
-%s
-
-Variables file (variables.tf):
-%s
-
-The initialization error is:
-%s
-
-Please fix the variables.tf configuration to resolve these initialization errors while ensuring compatibility with the main.tf file. Focus on issues like:
-- Variable declarations matching those referenced in main.tf
-- Type constraints
-- Default values
-- Variable validation rules
-
-Provide only the corrected variables.tf code without any explanations and no formatting. Output must look like this:
-variable "project_id" {
-  type        = string
-  description = "The ID of the Qovery project"
-}
+	// Get Bedrock's response for variables.tf
+	correctedVars, err := bedrockClient.Messages(varsPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response from Bedrock for variables.tf: %w", err)
+	}
 
-variable "environment_id" {
-  type        = string
-  description = "The ID of the Qovery environment"
+	return map[string]string{"main.tf": extractCode(correctedMain), "variables.tf": extractCode(correctedVars)}, nil
 }
 
-variable "application_name" {
-  type        = string
-  description = "The name of the application"
-}`, correctedMain, varsContent, initOutput)
-
-			// Get Bedrock's response for variables.tf
-			correctedVars, err := bedrockClient.Messages(varsPrompt)
-			if err != nil {
-				return "", "", fmt.Errorf("error getting response from Bedrock for variables.tf: %w", err)
-			}
-
-			if err := ioutil.WriteFile(tfVarFilePath, []byte(correctedVars), 0644); err != nil {
-				return "", "", fmt.Errorf("error writing corrected variables.tf: %w", err)
-			}
-
-			fmt.Println("Applied initialization corrections from Bedrock. Retrying...")
-			continue
-		}
-
-		// Run terraform validate
-		validateCmd := exec.Command("terraform", "validate", "-json")
-		validateCmd.Dir = tempDir
-
-		output, err := validateCmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Terraform validation failed: %s\n", output)
-
-			// Read the current Terraform files
-			mainContent, err := ioutil.ReadFile(tfFilePath)
-			if err != nil {
-				return "", "", fmt.Errorf("error reading main.tf file: %w", err)
-			}
-
-			varsContent, err := ioutil.ReadFile(tfVarFilePath)
-			if err != nil {
-				return "", "", fmt.Errorf("error reading variables.tf file: %w", err)
-			}
-
-			// Prompt for main.tf validation fixes, including variables.tf
-			mainPrompt := fmt.Sprintf(`The following Terraform configuration has validation errors:
-
-Current main.tf:
-%s
-
-Current variables.tf:
-%s
-
-The validation error is:
-%s
-
-Please fix the main.tf configuration to resolve these errors while ensuring compatibility with variables.tf. Provide only the corrected code without any explanations. Output must look like this:
-terraform {
-  required_providers {
-    qovery = {
-      source = "qovery/qovery"
-    }
-  }
+// terraformFixPromptData is the data of the Terraform init and validate fix prompts
+type terraformFixPromptData struct {
+	MainTf      string
+	VariablesTf string
+	Errors      string
 }
 
-provider "qovery" {
-  token = var.qovery_access_token
-}`, mainContent, varsContent, output)
-
-			// Get Bedrock's response for main.tf
-			correctedMain, err := bedrockClient.Messages(mainPrompt)
-			if err != nil {
-				return "", "", fmt.Errorf("error getting response from Bedrock for main.tf: %w", err)
-			}
-
-			// Write the corrected main.tf first
-			if err := ioutil.WriteFile(tfFilePath, []byte(correctedMain), 0644); err != nil {
-				return "", "", fmt.Errorf("error writing corrected main.tf: %w", err)
-			}
-
-			// Prompt for variables.tf validation fixes, including corrected main.tf
-			varsPrompt := fmt.Sprintf(`The following Terraform configuration has validation errors:
-
-Current main.tf (already corrected):
-%s
-
-Current variables.tf:
-%s
-
-The validation error is:
-%s
+// fixTerraformFile asks the LLM to fix a whole Terraform file, it is used when the errors can't be located in blocks
+func fixTerraformFile(fileName string, files map[string]string, validationErrors string, bedrockClient llmClient, prompts *promptRenderer) (string, error) {
+	// both prompts include main.tf and variables.tf to keep them compatible
+	name := PromptTerraformValidateFixMain
+	if fileName == "variables.tf" {
+		name = PromptTerraformValidateFixVariables
+	}
 
-Please fix the variables.tf configuration to resolve these errors while ensuring compatibility with main.tf. Provide only the corrected code without any explanations. Output must look like this:
-variable "project_id" {
-  type        = string
-  description = "The ID of the Qovery project"
-}
+	prompt, err := prompts.render(name, terraformFixPromptData{files["main.tf"], files["variables.tf"], validationErrors})
+	if err != nil {
+		return "", err
+	}
 
-variable "environment_id" {
-  type        = string
-  description = "The ID of the Qovery environment"
+	corrected, err := bedrockClient.Messages(prompt)
+	if err != nil {
+		return "", fmt.Errorf("error getting response from Bedrock for %s: %w", fileName, err)
+	}
+	return extractCode(corrected), nil
 }
 
-variable "application_name" {
-  type        = string
-  description = "The name of the application"
-}`, correctedMain, varsContent, output)
-
-			// Get Bedrock's response for variables.tf
-			correctedVars, err := bedrockClient.Messages(varsPrompt)
-			if err != nil {
-				return "", "", fmt.Errorf("error getting response from Bedrock for variables.tf: %w", err)
-			}
-
-			if err := ioutil.WriteFile(tfVarFilePath, []byte(correctedVars), 0644); err != nil {
-				return "", "", fmt.Errorf("error writing corrected variables.tf: %w", err)
-			}
-
-			fmt.Println("Applied validation corrections from Bedrock. Retrying...")
-		} else {
-			// Read and return both final valid Terraform manifests
-			finalMain, err := ioutil.ReadFile(tfFilePath)
-			if err != nil {
-				return "", "", fmt.Errorf("error reading final main.tf manifest: %w", err)
-			}
-
-			finalVars, err := ioutil.ReadFile(tfVarFilePath)
-			if err != nil {
-				return "", "", fmt.Errorf("error reading final variables.tf manifest: %w", err)
-			}
-
-			return string(finalMain), string(finalVars), nil
+func hasErrorDiagnostics(diagnostics []TerraformDiagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == "error" {
+			return true
 		}
 	}
+	return false
+}
 
-	return "", "", fmt.Errorf("exceeded maximum iterations (%d) without achieving a valid Terraform configuration", maxIterations)
+func formatTerraformDiagnostics(diagnostics []TerraformDiagnostic) string {
+	var lines []string
+	for _, diagnostic := range diagnostics {
+		lines = append(lines, diagnostic.String())
+	}
+	return strings.Join(lines, "\n")
 }
 
 // WriteAssets writes the generated assets to the output directory
 func WriteAssets(outputDir string, assets *Assets, writePrompts bool) error {
+	return WriteAssetsWithLayout(outputDir, assets, writePrompts, LayoutPerApp)
+}
+
+// WriteAssetsWithLayout writes the assets with the Terraform files of the applications laid out as a configuration
+// per application, or as a root module calling a child module per application
+func WriteAssetsWithLayout(outputDir string, assets *Assets, writePrompts bool, layout OutputLayout) error {
 	// Create the output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("error creating output directory: %w", err)
@@ -856,31 +846,53 @@ func WriteAssets(outputDir string, assets *Assets, writePrompts bool) error {
 		return fmt.Errorf("error writing README.md: %w", err)
 	}
 
+	format := assets.OutputFormat()
+	if layout == LayoutRootModule && !format.HCL() {
+		return fmt.Errorf("the %s layout is not supported by the %s output format", LayoutRootModule, format)
+	}
+
+	var root *rootModule
+	moduleFiles := map[string]map[string]string{}
+	if layout == LayoutRootModule {
+		root = newRootModule(assets.GeneratedTerraformFiles)
+		for _, module := range root.modules {
+			moduleFiles[module.name] = module.files
+		}
+		for _, appName := range root.skipped {
+			fmt.Printf("Warning: the Terraform files of %s could not be parsed, it is not included in the root module\n", appName)
+		}
+	}
+
 	// Write Terraform files for each app in their own directory
 	for _, generatedTf := range assets.GeneratedTerraformFiles {
 		appDir := filepath.Join(outputDir, generatedTf.SanitizeAppName())
+		if root != nil {
+			appDir = filepath.Join(outputDir, "modules", generatedTf.SanitizeAppName())
+		}
 		if err := os.MkdirAll(appDir, 0755); err != nil {
 			return fmt.Errorf("error creating app directory: %w", err)
 		}
 
-		mainTf := generatedTf.MainTf
-		if generatedTf.MainTf == "" {
-			mainTf = "# An error occurred while generating the main.tf file. Please refer to the prompt for more information."
-		}
-
-		// Write main.tf
-		if err := writeToFile(filepath.Join(appDir, "main.tf"), mainTf); err != nil {
-			return fmt.Errorf("error writing main.tf: %w", err)
-		}
-
-		variablesTf := generatedTf.VariablesTf
-		if generatedTf.VariablesTf == "" {
-			variablesTf = "# An error occurred while generating the variables.tf file. Please refer to the prompt for more information."
+		// Write the files of the formats without main.tf, E.g Pulumi.yaml, or main.tf and variables.tf
+		if !generatedTf.Format.HCL() {
+			for name, content := range generatedTf.Files {
+				if content == "" {
+					content = fmt.Sprintf("# An error occurred while generating the %s file. Please refer to the prompt for more information.", name)
+				}
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(appDir, name)), 0755); err != nil {
+					return fmt.Errorf("error creating the directory of %s: %w", name, err)
+				}
+				if err := writeToFile(filepath.Join(appDir, name), content); err != nil {
+					return fmt.Errorf("error writing %s: %w", name, err)
+				}
+			}
+		} else if err := writeTerraformAppFiles(appDir, generatedTf, moduleFiles[generatedTf.SanitizeAppName()], assets.QoveryTarget.TerraformVars, root == nil); err != nil {
+			return err
 		}
 
-		// Write variables.tf
-		if err := writeToFile(filepath.Join(appDir, "variables.tf"), variablesTf); err != nil {
-			return fmt.Errorf("error writing variables.tf: %w", err)
+		// Write the notes and assumptions of the LLM
+		if err := writeToFile(filepath.Join(appDir, "README.md"), generatedTf.ReadmeMarkdown()); err != nil {
+			return fmt.Errorf("error writing app README.md: %w", err)
 		}
 
 		// check if the app has a dockerfile associated
@@ -894,6 +906,34 @@ func WriteAssets(outputDir string, assets *Assets, writePrompts bool) error {
 		}
 	}
 
+	if root != nil {
+		providerVersion := assets.KnowledgeBundle.ProviderVersion
+		if schema, err := loadQoveryProviderSchema(); providerVersion == "" && err == nil {
+			providerVersion = schema.ProviderVersion
+		}
+		for name, content := range root.files(format, providerVersion, assets.QoveryTarget.TerraformVars.Values()) {
+			if err := writeToFile(filepath.Join(outputDir, name), content); err != nil {
+				return fmt.Errorf("error writing %s: %w", name, err)
+			}
+		}
+	}
+
+	// Write migration report
+	if err := writeToFile(filepath.Join(outputDir, "migration_report.md"), assets.MigrationReportMarkdown()); err != nil {
+		return fmt.Errorf("error writing migration_report.md: %w", err)
+	}
+
+	// Write the plan of the Qovery resources, applied without Terraform with "apply --plan plan.json"
+	if format.TargetsQovery() {
+		planJSON, err := json.MarshalIndent(assets.Plan(), "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling plan: %w", err)
+		}
+		if err := writeToFile(filepath.Join(outputDir, "plan.json"), string(planJSON)); err != nil {
+			return fmt.Errorf("error writing plan.json: %w", err)
+		}
+	}
+
 	// Write cost estimation report
 	if err := writeToFile(filepath.Join(outputDir, "cost_estimation_report.md"), assets.CostEstimationReportMarkdown); err != nil {
 		return fmt.Errorf("error writing cost_estimation_report.md: %w", err)
@@ -926,6 +966,45 @@ func WriteAssets(outputDir string, assets *Assets, writePrompts bool) error {
 	return nil
 }
 
+// writeTerraformAppFiles writes main.tf and variables.tf of an app, with the child module files of the root-module
+// layout or the terraform.tfvars pre-filled with the Qovery IDs
+func writeTerraformAppFiles(appDir string, generatedTf GeneratedTerraform, moduleFiles map[string]string, vars qovery.TerraformVars, writeTfvars bool) error {
+	mainTf := generatedTf.MainTf
+	if generatedTf.MainTf == "" {
+		mainTf = "# An error occurred while generating the main.tf file. Please refer to the prompt for more information."
+	}
+
+	// Write main.tf
+	if err := writeToFile(filepath.Join(appDir, "main.tf"), mainTf); err != nil {
+		return fmt.Errorf("error writing main.tf: %w", err)
+	}
+
+	variablesTf := generatedTf.VariablesTf
+	if generatedTf.VariablesTf == "" {
+		variablesTf = "# An error occurred while generating the variables.tf file. Please refer to the prompt for more information."
+	}
+
+	// Write variables.tf
+	if err := writeToFile(filepath.Join(appDir, "variables.tf"), variablesTf); err != nil {
+		return fmt.Errorf("error writing variables.tf: %w", err)
+	}
+
+	// Write the child module files, without the provider configured by the root module
+	for name, content := range moduleFiles {
+		if err := writeToFile(filepath.Join(appDir, name), content); err != nil {
+			return fmt.Errorf("error writing module %s: %w", name, err)
+		}
+	}
+
+	// Write the Qovery IDs of the organization, given by the root module in the root-module layout
+	if tfvars := terraformTfvars(vars, variablesTf); tfvars != "" && writeTfvars {
+		if err := writeToFile(filepath.Join(appDir, "terraform.tfvars"), tfvars); err != nil {
+			return fmt.Errorf("error writing terraform.tfvars: %w", err)
+		}
+	}
+	return nil
+}
+
 func writeToFile(filename, content string) error {
 	return os.WriteFile(filename, []byte(content), 0644)
 }
@@ -1,80 +1,182 @@
 package migration
 
 import (
-	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-// MockClaudeClient is a mock for the ClaudeClient
+// MockClaudeClient is a mock for the Bedrock client
 type MockClaudeClient struct {
 	mock.Mock
 }
 
-func (m *MockClaudeClient) Chat(prompt string) (string, error) {
+func (m *MockClaudeClient) Messages(prompt string) (string, error) {
 	args := m.Called(prompt)
 	return args.String(0), args.Error(1)
 }
 
-// MockHerokuProvider is a mock for the HerokuProvider
-type MockHerokuProvider struct {
-	mock.Mock
+func (m *MockClaudeClient) MessagesWithTool(prompt string, tool bedrock.Tool) (bedrock.ToolResponse, error) {
+	args := m.Called(prompt, tool)
+	return args.Get(0).(bedrock.ToolResponse), args.Error(1)
 }
 
-func (m *MockHerokuProvider) GetAllAppsConfig() ([]map[string]interface{}, error) {
-	args := m.Called()
-	return args.Get(0).([]map[string]interface{}), args.Error(1)
+// fakeAppConfig is a minimal sources.AppConfig
+type fakeAppConfig struct {
+	name  string
+	build sources.BuildInfo
 }
 
-func TestGenerateMigrationAssets(t *testing.T) {
-	// Create mock objects
-	mockClaudeClient := new(MockClaudeClient)
-	mockHerokuProvider := new(MockHerokuProvider)
-
-	// Set up expectations
-	mockHerokuProvider.On("GetAllAppsConfig").Return([]map[string]interface{}{
-		{"name": "app1", "stack": "heroku-18"},
-		{"name": "app2", "stack": "heroku-20"},
-	}, nil)
-
-	mockClaudeClient.On("Messages", mock.AnythingOfType("string")).Return("FROM ruby:2.7\nCMD [\"ruby\", \"app.rb\"]", nil).Times(2)
-	mockClaudeClient.On("Messages", mock.AnythingOfType("string")).Return("(resource \"qovery_project\" \"my_project\" {}, variable \"qovery_api_token\" {})", nil).Once()
-
-	// Create a test instance of GenerateMigrationAssets with mock dependencies
-	testGenerateMigrationAssets := func(source, herokuAPIKey, claudeAPIKey, qoveryAPIKey, destination string) (*Assets, error) {
-		herokuProvider := mockHerokuProvider
-		claudeClient := mockClaudeClient
-		qoveryProvider := qovery.NewQoveryProvider(qoveryAPIKey)
-
-		var configs []map[string]interface{}
-		var err error
-
-		switch source {
-		case "heroku":
-			configs, err = herokuProvider.GetAllAppsConfig()
-			if err != nil {
-				return nil, err
-			}
-		default:
-			return nil, fmt.Errorf("unsupported source: %s", source)
-		}
+func (f fakeAppConfig) App() map[string]interface{} {
+	return map[string]interface{}{"name": f.name}
+}
 
-		// ... (rest of the function remains the same as in the original GenerateMigrationAssets)
-	}
+func (f fakeAppConfig) Name() string {
+	return f.name
+}
 
-	// Run the test
-	assets, err := testGenerateMigrationAssets("heroku", "fake-heroku-key", "fake-claude-key", "fake-qovery-key", "aws")
+func (f fakeAppConfig) Cost() float64 {
+	return 0
+}
 
-	// Assert results
+func (f fakeAppConfig) Build() sources.BuildInfo {
+	return f.build
+}
+
+func (f fakeAppConfig) Map() map[string]interface{} {
+	return map[string]interface{}{"app": f.App(), "build": f.build}
+}
+
+func TestGenerateDockerfileForApp(t *testing.T) {
+	mockClaudeClient := new(MockClaudeClient)
+	mockClaudeClient.On("Messages", mock.AnythingOfType("string")).Return("FROM elixir:1.16\nCMD [\"mix\", \"phx.server\"]", nil).Once()
+	mockClaudeClient.On("Messages", mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, "has validation errors")
+	})).Return("FROM elixir:1.16\nUSER nobody\nEXPOSE 8080\nCMD [\"mix\", \"phx.server\"]", nil).Once()
+
+	// known stack: the curated template is used and the LLM is not called
+	dockerfile, err := generateDockerfileForApp(fakeAppConfig{
+		name: "app1",
+		build: sources.BuildInfo{
+			Buildpacks:   []string{"heroku/nodejs"},
+			ProcessTypes: map[string]string{"web": "node server.js"},
+		},
+	}, mockClaudeClient, testPromptRenderer(t))
 	assert.NoError(t, err)
-	assert.NotNil(t, assets)
-	assert.Len(t, assets.Dockerfiles, 2)
-	assert.Equal(t, "resource \"qovery_project\" \"my_project\" {}", assets.TerraformMain)
-	assert.Equal(t, "variable \"qovery_api_token\" {}", assets.TerraformVariables)
+	assert.Equal(t, "app1", dockerfile.AppName)
+	assert.Equal(t, "node", dockerfile.Template)
+	assert.Contains(t, dockerfile.DockerfileContent, "CMD node server.js")
+
+	// unknown stack: fallback to the LLM
+	dockerfile, err = generateDockerfileForApp(fakeAppConfig{
+		name:  "app2",
+		build: sources.BuildInfo{Buildpacks: []string{"https://github.com/HashNuke/heroku-buildpack-elixir"}},
+	}, mockClaudeClient, testPromptRenderer(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "app2", dockerfile.AppName)
+	assert.Empty(t, dockerfile.Template)
+	assert.Contains(t, dockerfile.DockerfileContent, "USER nobody")
+	assert.Len(t, dockerfile.Findings, 2)
+	assert.Empty(t, dockerfile.UnresolvedFindings)
+	assert.Equal(t, []string{"dockerfile@1", "dockerfile_fix@1"}, dockerfile.PromptVersions)
+
+	mockClaudeClient.AssertExpectations(t)
+}
 
-	// Verify that all expectations were met
-	mockHerokuProvider.AssertExpectations(t)
+func TestFailedApps(t *testing.T) {
+	assets := &Assets{GeneratedTerraformFiles: []GeneratedTerraform{
+		{AppName: "web", Error: "exceeded maximum iterations (10) without achieving a valid Terraform configuration"},
+		{AppName: "api"},
+		{AppName: "admin", Error: "error generating main.tf for admin: throttled"},
+	}}
+	assert.Equal(t, []string{"admin", "web"}, assets.FailedApps())
+	assert.Empty(t, (&Assets{}).FailedApps())
+}
+
+func TestValidateDockerfile(t *testing.T) {
+	original := "FROM node:20\nEXPOSE 8080\nCMD node server.js"
+	mockClaudeClient := new(MockClaudeClient)
+	mockClaudeClient.On("Messages", mock.AnythingOfType("string")).Return("Sorry, here is the Dockerfile:", nil).Once()
+
+	// the garbled reply has more findings than the original, which is kept
+	dockerfile, findings, unresolvedFindings, err := validateDockerfile(original, defaultAppPort, mockClaudeClient, testPromptRenderer(t))
+
+	require.NoError(t, err)
+	assert.Equal(t, original, dockerfile)
+	require.Len(t, findings, 1)
+	assert.Equal(t, DockerfileRuleRootUser, findings[0].Rule)
+	assert.Equal(t, findings, unresolvedFindings)
 	mockClaudeClient.AssertExpectations(t)
 }
+
+// TestStageDescriptions checks every stage passed to forStage in the package has a description for the live progress
+func TestStageDescriptions(t *testing.T) {
+	names, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+
+	fset := token.NewFileSet()
+	var stages []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		require.NoError(t, err)
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			if function, ok := call.Fun.(*ast.Ident); !ok || function.Name != "forStage" {
+				return true
+			}
+			literal, ok := call.Args[1].(*ast.BasicLit)
+			require.True(t, ok, "the stage of forStage must be a string literal at %s", fset.Position(call.Pos()))
+			stage, err := strconv.Unquote(literal.Value)
+			require.NoError(t, err)
+			stages = append(stages, stage)
+			return true
+		})
+	}
+
+	assert.Subset(t, stages, append([]string{"dockerfile"}, generationStages...))
+	for _, stage := range stages {
+		assert.NotEmpty(t, stageDescriptions[stage], "no description of the stage %s", stage)
+	}
+}
+
+func TestGenerationProgress(t *testing.T) {
+	progressChan := make(chan ProgressUpdate, 10)
+	onDelta := generationProgress("Generating main.tf", "web", progressChan)
+
+	onDelta(bedrock.Delta{Text: strings.Repeat("a", 196)}) // 49 tokens
+	assert.Empty(t, progressChan)
+	onDelta(bedrock.Delta{Text: "resource", ToolInput: true})
+	onDelta(bedrock.Delta{Text: strings.Repeat("a", 100)})
+	onDelta(bedrock.Delta{Text: strings.Repeat("a", 200)})
+	// the attempt streaming the last 300 characters failed, the retried one streams them again
+	onDelta(bedrock.Delta{Discarded: 300})
+	onDelta(bedrock.Delta{Text: strings.Repeat("a", 300)})
+	close(progressChan)
+
+	var updates []ProgressUpdate
+	for update := range progressChan {
+		updates = append(updates, update)
+	}
+	assert.Equal(t, []ProgressUpdate{
+		{Stage: "Generating main.tf", AppName: "web", Tokens: 51},
+		{Stage: "Generating main.tf", AppName: "web", Tokens: 126},
+		{Stage: "Generating main.tf", AppName: "web", Tokens: 51},
+		{Stage: "Generating main.tf", AppName: "web", Tokens: 126},
+	}, updates)
+}
@@ -0,0 +1,266 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kubernetes"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// OutputFormat is the infrastructure as code format of the files generated for the applications
+type OutputFormat string
+
+const (
+	// OutputTerraform generates Terraform HCL files validated with the terraform CLI
+	OutputTerraform OutputFormat = "terraform"
+	// OutputOpenTofu generates HCL files using the OpenTofu registry, validated with the tofu CLI
+	OutputOpenTofu OutputFormat = "opentofu"
+	// OutputPulumi generates a Pulumi YAML program using the Qovery provider
+	OutputPulumi OutputFormat = "pulumi"
+	// OutputKubernetes renders the Kubernetes manifests of the apps without Qovery, validated against the bundled
+	// Kubernetes schema
+	OutputKubernetes OutputFormat = "kubernetes"
+	// OutputHelm renders a Helm chart per app without Qovery, its manifests are validated like OutputKubernetes
+	OutputHelm OutputFormat = "helm"
+)
+
+// ParseOutputFormat returns the format of its name, E.g opentofu
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch format := OutputFormat(name); format {
+	case OutputTerraform, OutputOpenTofu, OutputPulumi, OutputKubernetes, OutputHelm:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, must be %s, %s, %s, %s or %s", name, OutputTerraform, OutputOpenTofu,
+			OutputPulumi, OutputKubernetes, OutputHelm)
+	}
+}
+
+// Title returns the name of the format in the reports, E.g OpenTofu
+func (f OutputFormat) Title() string {
+	switch f {
+	case OutputOpenTofu:
+		return "OpenTofu"
+	case OutputPulumi:
+		return "Pulumi"
+	case OutputKubernetes:
+		return "Kubernetes"
+	case OutputHelm:
+		return "Helm"
+	default:
+		return "Terraform"
+	}
+}
+
+// CLI returns the binary running the second validation gate of the format, empty if the files are only validated in-process
+func (f OutputFormat) CLI() string {
+	switch f {
+	case OutputTerraform, "":
+		return "terraform"
+	case OutputOpenTofu:
+		return "tofu"
+	default:
+		return ""
+	}
+}
+
+// HCL returns true for the formats generating main.tf and variables.tf, E.g terraform
+func (f OutputFormat) HCL() bool {
+	return f == OutputTerraform || f == OutputOpenTofu || f == ""
+}
+
+// TargetsQovery returns false for the formats deploying without Qovery, they need no Qovery API key
+func (f OutputFormat) TargetsQovery() bool {
+	return f != OutputKubernetes && f != OutputHelm
+}
+
+// providerSource returns the source of the Qovery provider in the required_providers block of the HCL formats.
+// OpenTofu resolves the short source on its own registry, it is written in full to make it explicit.
+func (f OutputFormat) providerSource() string {
+	if f == OutputOpenTofu {
+		return "registry.opentofu.org/qovery/qovery"
+	}
+	return "qovery/qovery"
+}
+
+// requiredVersion returns the minimum version of the CLI of the HCL formats, OpenTofu starts at 1.6
+func (f OutputFormat) requiredVersion() string {
+	if f == OutputOpenTofu {
+		return ">= 1.6"
+	}
+	return ">= 1.5"
+}
+
+// DefaultValidationConfigFor returns the default validation configuration of an output format, the CLI of the format
+// is used if it is installed
+func DefaultValidationConfigFor(format OutputFormat) ValidationConfig {
+	config := ValidationConfig{Format: format, Kubernetes: kubernetes.DefaultOptions()}
+	if cli := format.CLI(); cli != "" {
+		_, err := exec.LookPath(cli)
+		config.TerraformCLI = err == nil
+	}
+	return config
+}
+
+// outputGenerator generates the files of an application in an output format and validates them
+type outputGenerator interface {
+	generate(appName string, qoveryConfig qovery.TranslatedApp) (GeneratedTerraform, error)
+}
+
+// newOutputGenerator returns the generator of the output format of the validation configuration
+func newOutputGenerator(bedrockClient llmClient, promptCtx *promptContext, validationConfig ValidationConfig, progressChan chan<- ProgressUpdate) outputGenerator {
+	switch validationConfig.Format {
+	case OutputPulumi:
+		return &pulumiGenerator{bedrockClient: bedrockClient, promptCtx: promptCtx, progressChan: progressChan}
+	case OutputKubernetes, OutputHelm:
+		return &kubernetesGenerator{format: validationConfig.Format, options: validationConfig.Kubernetes}
+	}
+	return &terraformGenerator{bedrockClient: bedrockClient, promptCtx: promptCtx, validationConfig: validationConfig, progressChan: progressChan}
+}
+
+// terraformGenerator generates the main.tf and variables.tf files of the Terraform and OpenTofu formats
+type terraformGenerator struct {
+	bedrockClient    llmClient
+	promptCtx        *promptContext
+	validationConfig ValidationConfig
+	progressChan     chan<- ProgressUpdate
+}
+
+func (g *terraformGenerator) generate(appName string, qoveryConfig qovery.TranslatedApp) (GeneratedTerraform, error) {
+	format := g.validationConfig.Format
+	prompts := g.promptCtx.templates.renderer()
+
+	promptData, err := appPromptData(g.promptCtx, qoveryConfig)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName}, fmt.Errorf("error preparing the prompt of %s: %w", appName, err)
+	}
+
+	// First request: Generate main.tf
+	mainTfPrompt, err := prompts.render(PromptMainTf, promptData)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName}, err
+	}
+
+	mainTfOutput, err := generateMainTf(forStage(g.bedrockClient, "main_tf", appName, g.progressChan), mainTfPrompt)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName, Prompt: mainTfPrompt}, fmt.Errorf("error generating main.tf for %s: %w", appName, err)
+	}
+	mainTf := setProviderSource(mainTfOutput.MainTf, format.providerSource())
+
+	// Second request: Generate variables.tf based on main.tf
+	variablesTfPrompt, err := prompts.render(PromptVariablesTf, struct{ MainTf string }{mainTf})
+	if err != nil {
+		return GeneratedTerraform{AppName: appName, MainTf: mainTf}, err
+	}
+
+	variablesTfOutput, err := generateVariablesTf(forStage(g.bedrockClient, "variables_tf", appName, g.progressChan), variablesTfPrompt)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName, MainTf: mainTf, Prompt: variablesTfPrompt}, fmt.Errorf("error generating variables.tf for %s: %w", appName, err)
+	}
+
+	// Validate the complete Terraform configuration
+	validation, err := validateTerraform(mainTf, variablesTfOutput.VariablesTf, g.promptCtx.knowledgeBundle.Docs, g.validationConfig, forStage(g.bedrockClient, "terraform_fix", appName, g.progressChan), prompts)
+
+	// keep the closest version to a valid configuration on error, the remaining errors are listed in the migration report
+	generated := GeneratedTerraform{
+		AppName:              appName,
+		Format:               format,
+		MainTf:               setProviderSource(validation.MainTf, format.providerSource()),
+		VariablesTf:          validation.VariablesTf,
+		Prompt:               mainTfPrompt + "\n\n" + variablesTfPrompt,
+		Diagnostics:          validation.Diagnostics,
+		ValidationIterations: validation.Iterations,
+		PromptVersions:       prompts.versions(),
+		Notes:                append(mainTfOutput.Notes, variablesTfOutput.Notes...),
+		Assumptions:          append(mainTfOutput.Assumptions, variablesTfOutput.Assumptions...),
+	}
+	if err != nil {
+		return generated, fmt.Errorf("error validating %s configuration for %s: %w", format.Title(), appName, err)
+	}
+	return generated, nil
+}
+
+// appPromptData returns the data of the generation prompt of an app, with the provider docs and examples relevant to it
+func appPromptData(promptCtx *promptContext, qoveryConfig qovery.TranslatedApp) (mainTfPromptData, error) {
+	qoveryConfigJSON, err := json.Marshal(qoveryConfig)
+	if err != nil {
+		return mainTfPromptData{}, fmt.Errorf("error marshaling Qovery config: %w", err)
+	}
+
+	// only the provider docs and examples relevant to the app are given as reference
+	selection, err := promptCtx.selectPromptContext(qoveryConfig)
+	if err != nil {
+		return mainTfPromptData{}, fmt.Errorf("error selecting the prompt context: %w", err)
+	}
+
+	promptData, err := promptCtx.mainTfPromptData(string(qoveryConfigJSON), selection)
+	if err != nil {
+		return mainTfPromptData{}, fmt.Errorf("error rendering the prompt context: %w", err)
+	}
+	return promptData, nil
+}
+
+// setProviderSource sets the source of the Qovery provider in the required_providers block of main.tf, the file is
+// returned as is if it can't be parsed or doesn't require the provider
+func setProviderSource(mainTf, source string) string {
+	file, diags := hclwrite.ParseConfig([]byte(mainTf), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return mainTf
+	}
+
+	changed := false
+	for _, terraform := range file.Body().Blocks() {
+		if terraform.Type() != "terraform" {
+			continue
+		}
+		for _, requiredProviders := range terraform.Body().Blocks() {
+			if requiredProviders.Type() != "required_providers" {
+				continue
+			}
+			attribute := requiredProviders.Body().GetAttribute("qovery")
+			if attribute == nil {
+				continue
+			}
+			provider, ok := parseStringObject(attribute.Expr().BuildTokens(nil).Bytes())
+			if !ok || provider["source"] == source {
+				continue
+			}
+			provider["source"] = source
+			values := map[string]cty.Value{}
+			for key, value := range provider {
+				values[key] = cty.StringVal(value)
+			}
+			requiredProviders.Body().SetAttributeValue("qovery", cty.ObjectVal(values))
+			changed = true
+		}
+	}
+	if !changed {
+		return mainTf
+	}
+	return string(hclwrite.Format(file.Bytes()))
+}
+
+// parseStringObject returns the attributes of an HCL object of string literals, E.g { source = "qovery/qovery" }
+func parseStringObject(expr []byte) (map[string]string, bool) {
+	parsed, diags := hclsyntax.ParseExpression(expr, "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, false
+	}
+	value, diags := parsed.Value(nil)
+	if diags.HasErrors() || !value.Type().IsObjectType() || !value.IsWhollyKnown() {
+		return nil, false
+	}
+	object := map[string]string{}
+	for key, attribute := range value.AsValueMap() {
+		if !attribute.Type().Equals(cty.String) || attribute.IsNull() {
+			return nil, false
+		}
+		object[key] = attribute.AsString()
+	}
+	return object, true
+}
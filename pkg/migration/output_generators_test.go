@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	format, err := ParseOutputFormat("opentofu")
+	assert.NoError(t, err)
+	assert.Equal(t, OutputOpenTofu, format)
+	assert.Equal(t, "tofu", format.CLI())
+	assert.Equal(t, "", OutputPulumi.CLI())
+	assert.Equal(t, "terraform", OutputFormat("").CLI())
+	assert.Equal(t, "", OutputHelm.CLI())
+	assert.True(t, OutputOpenTofu.HCL())
+	assert.False(t, OutputKubernetes.HCL())
+	assert.False(t, OutputHelm.TargetsQovery())
+	assert.True(t, OutputPulumi.TargetsQovery())
+
+	_, err = ParseOutputFormat("cdk")
+	assert.ErrorContains(t, err, `unknown output format "cdk"`)
+}
+
+func TestSetProviderSource(t *testing.T) {
+	mainTf := `terraform {
+  required_providers {
+    qovery = {
+      source  = "qovery/qovery"
+      version = "0.41.0"
+    }
+  }
+}
+
+provider "qovery" {
+  token = var.qovery_access_token
+}
+`
+	assert.Equal(t, mainTf, setProviderSource(mainTf, OutputTerraform.providerSource()))
+
+	tofuMainTf := setProviderSource(mainTf, OutputOpenTofu.providerSource())
+	assert.Contains(t, tofuMainTf, `source  = "registry.opentofu.org/qovery/qovery"`)
+	assert.Contains(t, tofuMainTf, `version = "0.41.0"`)
+	assert.Contains(t, tofuMainTf, `token = var.qovery_access_token`)
+
+	// unparsable files are returned as is
+	assert.Equal(t, "resource {", setProviderSource("resource {", OutputOpenTofu.providerSource()))
+}
+
+func TestQoveryRequiredProvidersOpenTofu(t *testing.T) {
+	versions := qoveryRequiredProviders(OutputOpenTofu, "0.41.0")
+	assert.Contains(t, versions, `required_version = ">= 1.6"`)
+	assert.Contains(t, versions, `source  = "registry.opentofu.org/qovery/qovery"`)
+}
+
+func TestWriteAssetsPulumi(t *testing.T) {
+	assets := &Assets{
+		GeneratedTerraformFiles: []GeneratedTerraform{{
+			AppName: "my-app",
+			Format:  OutputPulumi,
+			Files:   map[string]string{pulumiProgramFile: testPulumiYAML},
+		}},
+		Dockerfiles: []Dockerfile{{AppName: "my-app", DockerfileContent: "FROM ruby:3.3"}},
+	}
+	dir := t.TempDir()
+
+	require.NoError(t, WriteAssets(dir, assets, false))
+	content, err := os.ReadFile(filepath.Join(dir, "my_app", "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, testPulumiYAML, string(content))
+	assert.FileExists(t, filepath.Join(dir, "my_app", "Dockerfile"))
+	assert.NoFileExists(t, filepath.Join(dir, "my_app", "main.tf"))
+
+	report, err := os.ReadFile(filepath.Join(dir, "migration_report.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "## Pulumi\n")
+	assert.Contains(t, string(report), "| my-app | 0 |  | ✅ |")
+
+	assert.ErrorContains(t, WriteAssetsWithLayout(dir, assets, false, LayoutRootModule), "not supported by the pulumi output format")
+}
@@ -0,0 +1,230 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+)
+
+// PromptContextOptions holds configuration options for the reference context given to the LLM
+type PromptContextOptions struct {
+	// IncludeDocs adds the relevant Qovery Terraform provider documentation to the main.tf prompt
+	IncludeDocs bool
+	// IncludeExamples adds the relevant Terraform examples to the main.tf prompt
+	IncludeExamples bool
+	// ExtraExampleRepos are additional examples, as local directories or GitHub repositories (owner/repo[/path][@ref])
+	ExtraExampleRepos []string
+	// CustomInstructionsFile is a file of additional instructions appended to the main.tf prompt (E.g naming conventions)
+	CustomInstructionsFile string
+	// MaxContextTokens is the token budget of the provider docs and examples of each main.tf prompt, 0 means no limit
+	MaxContextTokens int
+	// GitHubToken is used to download the extra example repositories without being rate limited
+	GitHubToken string
+	// PromptsDir is a directory of <name>.tmpl files overriding the embedded prompt templates
+	PromptsDir string
+}
+
+// DefaultPromptContextOptions returns the default prompt context options
+func DefaultPromptContextOptions() PromptContextOptions {
+	return PromptContextOptions{
+		IncludeDocs:      true,
+		IncludeExamples:  true,
+		MaxContextTokens: 40000,
+	}
+}
+
+// promptContext is the reference context shared by the main.tf prompts of all the apps
+type promptContext struct {
+	knowledgeBundle    *kb.Bundle
+	customInstructions string
+	templates          *PromptTemplates
+	options            PromptContextOptions
+}
+
+// newPromptContext adds the extra examples to the knowledge bundle and reads the custom instructions. The bundle only
+// keeps the included kinds of context, so that the budget is only spent on them.
+func newPromptContext(knowledgeBundle *kb.Bundle, options PromptContextOptions) (*promptContext, error) {
+	bundle := &kb.Bundle{Manifest: knowledgeBundle.Manifest, Origin: knowledgeBundle.Origin}
+	if options.IncludeDocs {
+		bundle.Docs = knowledgeBundle.Docs
+	}
+	if options.IncludeExamples {
+		bundle.Examples = append([]kb.Example{}, knowledgeBundle.Examples...)
+		for _, repo := range options.ExtraExampleRepos {
+			examples, err := kb.LoadExamples(repo, options.GitHubToken)
+			if err != nil {
+				return nil, fmt.Errorf("error loading the examples of %s: %w", repo, err)
+			}
+			bundle.Examples = append(bundle.Examples, examples...)
+		}
+	}
+
+	customInstructions := ""
+	if options.CustomInstructionsFile != "" {
+		content, err := os.ReadFile(options.CustomInstructionsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading custom instructions file: %w", err)
+		}
+		customInstructions = strings.TrimSpace(string(content))
+	}
+
+	templates, err := LoadPromptTemplates(options.PromptsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &promptContext{knowledgeBundle: bundle, customInstructions: customInstructions, templates: templates, options: options}, nil
+}
+
+// requiredContextDocs are always part of the context: the provider configuration and the application resource
+var requiredContextDocs = []string{"docs/index.md", "docs/resources/application.md"}
+
+// contextQueryHints maps the terms found in an app configuration to the Qovery provider terms they relate to
+var contextQueryHints = map[string]string{
+	"postgres":    "database postgresql",
+	"postgresql":  "database postgresql",
+	"redis":       "database redis",
+	"rediscloud":  "database redis",
+	"mysql":       "database mysql",
+	"cleardb":     "database mysql",
+	"jawsdb":      "database mysql",
+	"mongo":       "database mongodb",
+	"mongodb":     "database mongodb",
+	"addon":       "database",
+	"scheduler":   "job cronjob schedule",
+	"scheduled":   "job cronjob schedule",
+	"cron":        "job cronjob schedule",
+	"release":     "job on_start schedule",
+	"worker":      "application",
+	"domain":      "custom_domains",
+	"cname":       "custom_domains",
+	"review_apps": "preview environment auto_preview",
+	"docker":      "container image",
+}
+
+// promptContextQuery builds the retrieval query of an app from its configuration: addons, domains, process types,
+// jobs and build info. The values of the environment variables are left out, only their names are relevant.
+func promptContextQuery(qoveryConfig interface{}) (string, error) {
+	configJSON, err := json.Marshal(qoveryConfig)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling Qovery config: %w", err)
+	}
+
+	var config interface{}
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return "", fmt.Errorf("error decoding Qovery config: %w", err)
+	}
+
+	var terms []string
+	collectContextTerms(config, "", &terms)
+
+	hints := map[string]bool{}
+	for _, term := range terms {
+		for _, word := range strings.FieldsFunc(strings.ToLower(term), func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+		}) {
+			// match the whole word (E.g review_apps) and its parts, singular or plural
+			for _, part := range append([]string{word}, strings.Split(word, "_")...) {
+				for _, candidate := range []string{part, strings.TrimSuffix(part, "s")} {
+					if hint, ok := contextQueryHints[candidate]; ok {
+						hints[hint] = true
+					}
+				}
+			}
+		}
+	}
+
+	sortedHints := make([]string, 0, len(hints))
+	for hint := range hints {
+		sortedHints = append(sortedHints, hint)
+	}
+	sort.Strings(sortedHints)
+
+	return strings.Join(append(terms, sortedHints...), " "), nil
+}
+
+func collectContextTerms(value interface{}, key string, terms *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			*terms = append(*terms, k)
+			if key == "config" || key == "env" || key == "environment_variables" || key == "secrets" {
+				// environment variables: only the names are relevant
+				continue
+			}
+			collectContextTerms(v[k], k, terms)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectContextTerms(item, key, terms)
+		}
+	case string:
+		*terms = append(*terms, v)
+	}
+}
+
+// selectPromptContext returns the provider docs and examples relevant to an app within the token budget
+func (c *promptContext) selectPromptContext(qoveryConfig interface{}) (kb.Selection, error) {
+	if !c.options.IncludeDocs && !c.options.IncludeExamples {
+		return kb.Selection{}, nil
+	}
+
+	query, err := promptContextQuery(qoveryConfig)
+	if err != nil {
+		return kb.Selection{}, err
+	}
+
+	required := requiredContextDocs
+	if !c.options.IncludeDocs {
+		required = nil
+	}
+
+	return c.knowledgeBundle.Select(query, required, c.options.MaxContextTokens), nil
+}
+
+// mainTfPromptData is the data of the main.tf prompt template
+type mainTfPromptData struct {
+	QoveryConfig string
+	// ProviderVersion is the version of the provider the docs are taken from
+	ProviderVersion string
+	// Docs and Examples are JSON encoded, they are empty when not included
+	Docs               string
+	Examples           string
+	CustomInstructions string
+}
+
+// mainTfPromptData returns the data of the main.tf prompt with the selected docs and examples
+func (c *promptContext) mainTfPromptData(qoveryConfig string, selection kb.Selection) (mainTfPromptData, error) {
+	data := mainTfPromptData{
+		QoveryConfig:       qoveryConfig,
+		ProviderVersion:    c.knowledgeBundle.Manifest.ProviderVersion,
+		CustomInstructions: c.customInstructions,
+	}
+
+	if c.options.IncludeDocs && len(selection.Docs) > 0 {
+		docsJSON, err := json.Marshal(selection.Docs)
+		if err != nil {
+			return mainTfPromptData{}, fmt.Errorf("error marshaling Qovery Terraform Provider markdown documentation: %w", err)
+		}
+		data.Docs = string(docsJSON)
+	}
+
+	if c.options.IncludeExamples && len(selection.Examples) > 0 {
+		examplesJSON, err := json.Marshal(selection.Examples)
+		if err != nil {
+			return mainTfPromptData{}, fmt.Errorf("error marshaling Terraform examples: %w", err)
+		}
+		data.Examples = string(examplesJSON)
+	}
+
+	return data, nil
+}
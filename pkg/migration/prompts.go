@@ -0,0 +1,184 @@
+package migration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/prompts/*.tmpl
+var promptTemplatesFS embed.FS
+
+// Prompt template names, the templates are named <name>.tmpl
+const (
+	PromptDockerfile                    = "dockerfile"
+	PromptDockerfileFix                 = "dockerfile_fix"
+	PromptMainTf                        = "main_tf"
+	PromptVariablesTf                   = "variables_tf"
+	PromptTerraformInitFixMain          = "terraform_init_fix_main"
+	PromptTerraformInitFixVariables     = "terraform_init_fix_variables"
+	PromptTerraformValidateFixMain      = "terraform_validate_fix_main"
+	PromptTerraformValidateFixVariables = "terraform_validate_fix_variables"
+	PromptTerraformBlocksFix            = "terraform_blocks_fix"
+	PromptCostEstimation                = "cost_estimation"
+	PromptPulumiYAML                    = "pulumi_yaml"
+	PromptPulumiYAMLFix                 = "pulumi_yaml_fix"
+)
+
+// promptVersionRegexp matches the version header of a template, E.g {{- /* version: 1 */ -}}
+var promptVersionRegexp = regexp.MustCompile(`^\{\{-?\s*/\*\s*version:\s*(\S+)\s*\*/\s*-?\}\}`)
+
+var promptTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// PromptTemplate is a text/template used to build an LLM prompt
+type PromptTemplate struct {
+	Name    string
+	Version string
+	// Source is the file the template was loaded from, empty for the embedded templates
+	Source   string
+	template *template.Template
+}
+
+// ID returns the name and the version of the template, E.g main_tf@1
+func (p *PromptTemplate) ID() string {
+	return fmt.Sprintf("%s@%s", p.Name, p.Version)
+}
+
+// PromptTemplates holds the prompt templates: the embedded ones, possibly overridden from a directory
+type PromptTemplates struct {
+	templates map[string]*PromptTemplate
+}
+
+// LoadPromptTemplates loads the embedded prompt templates and overrides them with the <name>.tmpl files of the
+// directory, if any. A template without a version header gets a version computed from its content.
+func LoadPromptTemplates(dir string) (*PromptTemplates, error) {
+	entries, err := promptTemplatesFS.ReadDir("templates/prompts")
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedded prompt templates: %w", err)
+	}
+
+	prompts := &PromptTemplates{templates: map[string]*PromptTemplate{}}
+	for _, entry := range entries {
+		content, err := promptTemplatesFS.ReadFile("templates/prompts/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading prompt template %s: %w", entry.Name(), err)
+		}
+		tmpl, err := parsePromptTemplate(strings.TrimSuffix(entry.Name(), ".tmpl"), string(content), "")
+		if err != nil {
+			return nil, err
+		}
+		prompts.templates[tmpl.Name] = tmpl
+	}
+
+	if dir == "" {
+		return prompts, nil
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing prompt templates in %s: %w", dir, err)
+	}
+	for _, path := range overrides {
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		if _, ok := prompts.templates[name]; !ok {
+			return nil, fmt.Errorf("unknown prompt template %s, expected one of: %s", path, strings.Join(prompts.Names(), ", "))
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading prompt template %s: %w", path, err)
+		}
+		tmpl, err := parsePromptTemplate(name, string(content), path)
+		if err != nil {
+			return nil, err
+		}
+		prompts.templates[name] = tmpl
+	}
+
+	return prompts, nil
+}
+
+func parsePromptTemplate(name, content, source string) (*PromptTemplate, error) {
+	version := ""
+	if match := promptVersionRegexp.FindStringSubmatch(content); match != nil {
+		version = match[1]
+	} else {
+		sum := sha256.Sum256([]byte(content))
+		version = "sha256-" + hex.EncodeToString(sum[:])[:12]
+	}
+
+	t, err := template.New(name).Funcs(promptTemplateFuncs).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing prompt template %s: %w", name, err)
+	}
+
+	return &PromptTemplate{Name: name, Version: version, Source: source, template: t}, nil
+}
+
+// Names returns the sorted names of the templates
+func (p *PromptTemplates) Names() []string {
+	names := make([]string, 0, len(p.templates))
+	for name := range p.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns a template by name
+func (p *PromptTemplates) Get(name string) (*PromptTemplate, bool) {
+	tmpl, ok := p.templates[name]
+	return tmpl, ok
+}
+
+// renderer returns a renderer recording the templates used to generate an asset
+func (p *PromptTemplates) renderer() *promptRenderer {
+	return &promptRenderer{templates: p}
+}
+
+// promptRenderer renders prompts and records the versions of the templates used. It is not safe for concurrent use,
+// a renderer is created per generated asset.
+type promptRenderer struct {
+	templates *PromptTemplates
+	used      []string
+}
+
+func (r *promptRenderer) render(name string, data interface{}) (string, error) {
+	tmpl, ok := r.templates.Get(name)
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering prompt template %s: %w", tmpl.ID(), err)
+	}
+
+	id := tmpl.ID()
+	found := false
+	for _, used := range r.used {
+		if used == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		r.used = append(r.used, id)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// versions returns the IDs of the templates used, in order of first use
+func (r *promptRenderer) versions() []string {
+	return append([]string{}, r.used...)
+}
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPromptRenderer(t *testing.T) *promptRenderer {
+	prompts, err := LoadPromptTemplates("")
+	require.NoError(t, err)
+	return prompts.renderer()
+}
+
+func TestLoadEmbeddedPromptTemplates(t *testing.T) {
+	prompts, err := LoadPromptTemplates("")
+	require.NoError(t, err)
+
+	for _, name := range []string{PromptDockerfile, PromptDockerfileFix, PromptMainTf, PromptVariablesTf, PromptTerraformInitFixMain,
+		PromptTerraformInitFixVariables, PromptTerraformValidateFixMain, PromptTerraformValidateFixVariables,
+		PromptTerraformBlocksFix, PromptCostEstimation, PromptPulumiYAML, PromptPulumiYAMLFix} {
+		tmpl, ok := prompts.Get(name)
+		require.True(t, ok, name)
+		assert.Regexp(t, `^`+name+`@\d+$`, tmpl.ID())
+		assert.Empty(t, tmpl.Source)
+	}
+}
+
+func TestLoadPromptTemplatesOverrides(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "variables_tf.tmpl"), []byte("{{- /* version: acme-2 */ -}}\nDeclare the variables of:\n{{ .MainTf }}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cost_estimation.tmpl"), []byte("Estimate {{ .MainTf }}"), 0644))
+
+	prompts, err := LoadPromptTemplates(dir)
+	require.NoError(t, err)
+
+	tmpl, _ := prompts.Get(PromptVariablesTf)
+	assert.Equal(t, "variables_tf@acme-2", tmpl.ID())
+	assert.Equal(t, filepath.Join(dir, "variables_tf.tmpl"), tmpl.Source)
+
+	// without a version header, the version is computed from the content
+	tmpl, _ = prompts.Get(PromptCostEstimation)
+	assert.True(t, strings.HasPrefix(tmpl.Version, "sha256-"), tmpl.Version)
+
+	tmpl, _ = prompts.Get(PromptMainTf)
+	assert.Empty(t, tmpl.Source)
+
+	renderer := prompts.renderer()
+	prompt, err := renderer.render(PromptVariablesTf, struct{ MainTf string }{"resource {}"})
+	require.NoError(t, err)
+	assert.Equal(t, "Declare the variables of:\nresource {}", prompt)
+	_, err = renderer.render(PromptVariablesTf, struct{ MainTf string }{"resource {}"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"variables_tf@acme-2"}, renderer.versions())
+
+	// a field missing from the data is an error
+	_, err = renderer.render(PromptVariablesTf, struct{}{})
+	assert.Error(t, err)
+}
+
+func TestLoadPromptTemplatesUnknownName(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unknown.tmpl"), []byte("prompt"), 0644))
+
+	_, err := LoadPromptTemplates(dir)
+	assert.ErrorContains(t, err, "unknown prompt template")
+}
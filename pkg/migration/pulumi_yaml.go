@@ -0,0 +1,379 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"gopkg.in/yaml.v3"
+)
+
+// PulumiGateYAML is the validation gate of the Pulumi YAML programs, run in-process against the bundled provider schema
+const PulumiGateYAML = "pulumi yaml"
+
+// pulumiProgramFile is the file of the Pulumi YAML program in the directory of each app
+const pulumiProgramFile = "Pulumi.yaml"
+
+// pulumiReferenceRegexp matches the interpolations of a Pulumi YAML program, E.g ${database.internalHost}
+var pulumiReferenceRegexp = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// pulumiGenerator generates the Pulumi.yaml program of the Pulumi format
+type pulumiGenerator struct {
+	bedrockClient llmClient
+	promptCtx     *promptContext
+	progressChan  chan<- ProgressUpdate
+}
+
+func (g *pulumiGenerator) generate(appName string, qoveryConfig qovery.TranslatedApp) (GeneratedTerraform, error) {
+	prompts := g.promptCtx.templates.renderer()
+
+	promptData, err := appPromptData(g.promptCtx, qoveryConfig)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName}, fmt.Errorf("error preparing the prompt of %s: %w", appName, err)
+	}
+
+	prompt, err := prompts.render(PromptPulumiYAML, promptData)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName}, err
+	}
+
+	output, err := generatePulumiYAML(forStage(g.bedrockClient, "pulumi_yaml", appName, g.progressChan), prompt)
+	if err != nil {
+		return GeneratedTerraform{AppName: appName, Prompt: prompt}, fmt.Errorf("error generating %s for %s: %w", pulumiProgramFile, appName, err)
+	}
+
+	validation, err := validatePulumi(output.PulumiYAML, forStage(g.bedrockClient, "pulumi_fix", appName, g.progressChan), prompts)
+
+	// on error, the program is the best one of the validation loop and its errors are listed in the migration report
+	generated := GeneratedTerraform{
+		AppName:              appName,
+		Format:               OutputPulumi,
+		Files:                map[string]string{pulumiProgramFile: validation.PulumiYAML},
+		Prompt:               prompt,
+		Diagnostics:          validation.Diagnostics,
+		ValidationIterations: validation.Iterations,
+		PromptVersions:       prompts.versions(),
+		Notes:                output.Notes,
+		Assumptions:          output.Assumptions,
+	}
+	if err != nil {
+		return generated, fmt.Errorf("error validating Pulumi program for %s: %w", appName, err)
+	}
+	return generated, nil
+}
+
+// pulumiValidation is the outcome of the Pulumi validation loop
+type pulumiValidation struct {
+	PulumiYAML string
+	// Diagnostics are the diagnostics of the returned program: warnings if it is valid, errors otherwise
+	Diagnostics []TerraformDiagnostic
+	Iterations  []TerraformValidationIteration
+}
+
+// validatePulumi validates a Pulumi YAML program and asks the LLM to fix it until it is valid. There is no CLI gate:
+// `pulumi preview` needs a backend and a stack. On error, the best version of the program found so far is returned
+// along with its diagnostics.
+func validatePulumi(original string, bedrockClient llmClient, prompts *promptRenderer) (pulumiValidation, error) {
+	gate := func(files map[string]string) (TerraformValidationIteration, string, error) {
+		diagnostics, err := validatePulumiYAML(files[pulumiProgramFile])
+		return TerraformValidationIteration{Gate: PulumiGateYAML, Diagnostics: diagnostics}, "", err
+	}
+	fix := func(files map[string]string, iteration TerraformValidationIteration, _ string) (map[string]string, error) {
+		prompt, err := prompts.render(PromptPulumiYAMLFix, struct {
+			PulumiYAML string
+			Errors     string
+		}{files[pulumiProgramFile], formatTerraformDiagnostics(iteration.Diagnostics)})
+		if err != nil {
+			return nil, err
+		}
+		corrected, err := bedrockClient.Messages(prompt)
+		if err != nil {
+			return nil, fmt.Errorf("error getting response from Bedrock for %s: %w", pulumiProgramFile, err)
+		}
+		return map[string]string{pulumiProgramFile: extractCode(corrected)}, nil
+	}
+
+	result, err := runValidationLoop(map[string]string{pulumiProgramFile: original}, "Pulumi program", gate, fix)
+	return pulumiValidation{PulumiYAML: result.Files[pulumiProgramFile], Diagnostics: result.Diagnostics, Iterations: result.Iterations}, err
+}
+
+// validatePulumiYAML parses a Pulumi YAML program in-process and checks the Qovery resources against the bundled
+// schema of the Terraform provider the Pulumi provider is bridged from: the resource types are PascalCase, E.g
+// qovery:Application for qovery_application, and the properties camelCase. The interpolations must reference a
+// resource, a variable or a configuration key of the program.
+func validatePulumiYAML(content string) ([]TerraformDiagnostic, error) {
+	schema, err := loadQoveryProviderSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return []TerraformDiagnostic{{Severity: "error", Summary: "Invalid YAML", Detail: err.Error(), File: pulumiProgramFile}}, nil
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return []TerraformDiagnostic{{Severity: "error", Summary: "Invalid Pulumi program", Detail: "the program must be a YAML mapping", File: pulumiProgramFile}}, nil
+	}
+	root := document.Content[0]
+
+	var diagnostics []TerraformDiagnostic
+	if name := yamlMappingValue(root, "name"); name == nil || name.Value == "" {
+		diagnostics = append(diagnostics, pulumiDiagnostic("error", "Missing project name", "the program must have a \"name\"", root))
+	}
+	runtime := yamlMappingValue(root, "runtime")
+	if runtime != nil && runtime.Kind == yaml.MappingNode {
+		runtime = yamlMappingValue(runtime, "name")
+	}
+	if runtime == nil || runtime.Value != "yaml" {
+		diagnostics = append(diagnostics, pulumiDiagnostic("error", "Invalid runtime", "the runtime of a Pulumi YAML program must be \"yaml\"", root))
+	}
+
+	// the names which can be referenced, with the node declaring them
+	declared := map[string]*yaml.Node{"pulumi": nil}
+	configKeys := map[string]*yaml.Node{}
+	for _, section := range []string{"config", "variables", "resources"} {
+		mapping := yamlMappingValue(root, section)
+		if mapping == nil {
+			continue
+		}
+		if mapping.Kind != yaml.MappingNode {
+			diagnostics = append(diagnostics, pulumiDiagnostic("error", "Invalid section", fmt.Sprintf("%q must be a mapping", section), mapping))
+			continue
+		}
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			declared[mapping.Content[i].Value] = mapping.Content[i]
+			if section == "config" {
+				configKeys[mapping.Content[i].Value] = mapping.Content[i]
+			}
+		}
+	}
+
+	if resources := yamlMappingValue(root, "resources"); resources != nil && resources.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(resources.Content); i += 2 {
+			diagnostics = append(diagnostics, validatePulumiResource(resources.Content[i].Value, resources.Content[i+1], schema.ResourceSchemas)...)
+		}
+	}
+
+	used := map[string]*yaml.Node{}
+	collectPulumiReferences(root, used)
+
+	var undeclared []string
+	for name := range used {
+		if _, ok := declared[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		diagnostics = append(diagnostics, pulumiDiagnostic("error", "Reference to undeclared name",
+			fmt.Sprintf("${%s} is referenced but no resource, variable or configuration key %q is declared", name, name), used[name]))
+	}
+
+	var unused []string
+	for name := range configKeys {
+		// the configuration of the providers, E.g qovery:token, is not referenced
+		if _, ok := used[name]; !ok && !strings.Contains(name, ":") {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		diagnostics = append(diagnostics, pulumiDiagnostic("warning", "Unused configuration key", fmt.Sprintf("configuration key %q is declared but never used", name), configKeys[name]))
+	}
+
+	return diagnostics, nil
+}
+
+func validatePulumiResource(name string, resource *yaml.Node, schemas map[string]schemaBlock) []TerraformDiagnostic {
+	if resource.Kind != yaml.MappingNode {
+		return []TerraformDiagnostic{pulumiDiagnostic("error", "Invalid resource", fmt.Sprintf("the resource %q must be a mapping", name), resource)}
+	}
+	typeNode := yamlMappingValue(resource, "type")
+	if typeNode == nil || typeNode.Value == "" {
+		return []TerraformDiagnostic{pulumiDiagnostic("error", "Missing resource type", fmt.Sprintf("the resource %q has no \"type\"", name), resource)}
+	}
+
+	// only the Qovery provider schema is bundled
+	resourceType, ok := pulumiTerraformType(typeNode.Value)
+	if !ok {
+		return nil
+	}
+	schema, ok := schemas[resourceType]
+	if !ok {
+		return []TerraformDiagnostic{pulumiDiagnostic("error", "Invalid resource type",
+			fmt.Sprintf("the Qovery provider does not support resource %q", typeNode.Value), typeNode)}
+	}
+	if schema.Open {
+		return nil
+	}
+
+	properties := yamlMappingValue(resource, "properties")
+	if properties == nil {
+		return pulumiMissingProperties(name, map[string]bool{}, schema, resource)
+	}
+	return validatePulumiObject(name, properties, schema)
+}
+
+func validatePulumiObject(path string, object *yaml.Node, schema schemaBlock) []TerraformDiagnostic {
+	// functions (E.g fn::secret) and interpolations are not validated
+	if object.Kind != yaml.MappingNode || isPulumiFunction(object) {
+		return nil
+	}
+
+	var diagnostics []TerraformDiagnostic
+	setAttributes := map[string]bool{}
+	for i := 0; i+1 < len(object.Content); i += 2 {
+		key, value := object.Content[i], object.Content[i+1]
+		name := snakeCase(key.Value)
+		setAttributes[name] = true
+
+		attribute, ok := schema.Attributes[name]
+		if !ok {
+			diagnostics = append(diagnostics, pulumiDiagnostic("error", "Unsupported property",
+				fmt.Sprintf("a property named %q is not expected in %s", key.Value, path), key))
+			continue
+		}
+		if attribute.Computed {
+			diagnostics = append(diagnostics, pulumiDiagnostic("error", "Invalid configuration for read-only property",
+				fmt.Sprintf("%s.%s is computed by the provider and cannot be set", path, key.Value), key))
+			continue
+		}
+		if attribute.Open || attribute.Nested == nil {
+			continue
+		}
+
+		nestedPath := fmt.Sprintf("%s.%s", path, key.Value)
+		switch value.Kind {
+		case yaml.MappingNode:
+			diagnostics = append(diagnostics, validatePulumiObject(nestedPath, value, *attribute.Nested)...)
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				diagnostics = append(diagnostics, validatePulumiObject(nestedPath, item, *attribute.Nested)...)
+			}
+		}
+	}
+
+	return append(diagnostics, pulumiMissingProperties(path, setAttributes, schema, object)...)
+}
+
+func pulumiMissingProperties(path string, setAttributes map[string]bool, schema schemaBlock, node *yaml.Node) []TerraformDiagnostic {
+	var missing []string
+	for name, attribute := range schema.Attributes {
+		if attribute.Required && !setAttributes[name] {
+			missing = append(missing, camelCase(name))
+		}
+	}
+	sort.Strings(missing)
+
+	var diagnostics []TerraformDiagnostic
+	for _, name := range missing {
+		diagnostics = append(diagnostics, pulumiDiagnostic("error", "Missing required property",
+			fmt.Sprintf("the property %q is required in %s, but no definition was found", name, path), node))
+	}
+	return diagnostics
+}
+
+func isPulumiFunction(node *yaml.Node) bool {
+	return len(node.Content) == 2 && strings.HasPrefix(node.Content[0].Value, "fn::")
+}
+
+// collectPulumiReferences records the first node referencing each name, E.g database for ${database.internalHost}
+func collectPulumiReferences(node *yaml.Node, used map[string]*yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		for _, match := range pulumiReferenceRegexp.FindAllStringSubmatch(node.Value, -1) {
+			name := strings.TrimSpace(match[1])
+			if end := strings.IndexAny(name, ".["); end >= 0 {
+				name = name[:end]
+			}
+			if _, ok := used[name]; !ok {
+				used[name] = node
+			}
+		}
+		return
+	}
+	for _, child := range node.Content {
+		collectPulumiReferences(child, used)
+	}
+}
+
+// pulumiTerraformType returns the Terraform type of a Qovery Pulumi resource type, E.g qovery_application for
+// qovery:Application, qovery:index:Application or qovery:index/application:Application
+func pulumiTerraformType(pulumiType string) (string, bool) {
+	parts := strings.Split(pulumiType, ":")
+	if parts[0] != "qovery" || len(parts) < 2 || len(parts) > 3 {
+		return "", false
+	}
+	return "qovery_" + snakeCase(parts[len(parts)-1]), true
+}
+
+// pulumiResourceCounts returns the number of resources of each Terraform type of a Pulumi YAML program, none if it
+// can't be parsed
+func pulumiResourceCounts(content string) (map[string]int, bool) {
+	if strings.TrimSpace(content) == "" {
+		return nil, false
+	}
+	var program struct {
+		Resources map[string]struct {
+			Type string `yaml:"type"`
+		} `yaml:"resources"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &program); err != nil {
+		return nil, false
+	}
+	counts := map[string]int{}
+	for _, resource := range program.Resources {
+		if resourceType, ok := pulumiTerraformType(resource.Type); ok {
+			counts[resourceType]++
+		}
+	}
+	return counts, true
+}
+
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func pulumiDiagnostic(severity, summary, detail string, node *yaml.Node) TerraformDiagnostic {
+	diagnostic := TerraformDiagnostic{Severity: severity, Summary: summary, Detail: detail, File: pulumiProgramFile}
+	if node != nil {
+		diagnostic.Line = node.Line
+	}
+	return diagnostic
+}
+
+// snakeCase returns the Terraform name of a Pulumi name, E.g environment_variable_aliases for environmentVariableAliases
+func snakeCase(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// camelCase returns the Pulumi name of a Terraform attribute, E.g environmentId for environment_id
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
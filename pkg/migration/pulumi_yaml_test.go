@@ -0,0 +1,135 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testPulumiYAML = `name: my-app
+runtime: yaml
+config:
+  environmentId:
+    type: string
+  gitUrl:
+    type: string
+  databasePassword:
+    type: string
+    secret: true
+resources:
+  database:
+    type: qovery:Database
+    properties:
+      environmentId: ${environmentId}
+      name: postgresql
+      type: POSTGRESQL
+      version: "16"
+      mode: CONTAINER
+      accessibility: PRIVATE
+  web:
+    type: qovery:index:Application
+    properties:
+      environmentId: ${environmentId}
+      name: web
+      buildMode: DOCKER
+      gitRepository:
+        url: ${gitUrl}
+        branch: main
+      healthchecks: {}
+      ports:
+        - internalPort: 8080
+          publiclyAccessible: true
+      secrets:
+        - key: DATABASE_URL
+          value:
+            fn::secret: postgresql://${database.internalHost}
+`
+
+func TestValidatePulumiYAML(t *testing.T) {
+	diagnostics, err := validatePulumiYAML(testPulumiYAML)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Unused configuration key"}, diagnosticSummaries(diagnostics))
+	assert.Contains(t, diagnostics[0].Detail, `"databasePassword"`)
+
+	invalid := `name: my-app
+runtime: nodejs
+resources:
+  web:
+    type: qovery:Application
+    properties:
+      environmentId: ${environmentId}
+      name: web
+      foo: bar
+      internalHost: web.internal
+      ports:
+        - publiclyAccessible: true
+  worker:
+    type: qovery:Worker
+`
+	diagnostics, err = validatePulumiYAML(invalid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Invalid runtime",
+		"Unsupported property",
+		"Invalid configuration for read-only property",
+		"Missing required property",
+		"Missing required property",
+		"Invalid resource type",
+		"Reference to undeclared name",
+	}, diagnosticSummaries(diagnostics))
+	assert.Equal(t, "Pulumi.yaml", diagnostics[1].File)
+	assert.Equal(t, 9, diagnostics[1].Line)
+	assert.Contains(t, diagnostics[3].Detail, `the property "internalPort" is required in web.ports`)
+	assert.Contains(t, diagnostics[4].Detail, `the property "gitRepository" is required in web`)
+
+	diagnostics, err = validatePulumiYAML("name: [")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Invalid YAML"}, diagnosticSummaries(diagnostics))
+}
+
+func TestPulumiTerraformType(t *testing.T) {
+	for pulumiType, expected := range map[string]string{
+		"qovery:Application":                         "qovery_application",
+		"qovery:index:DeploymentStage":               "qovery_deployment_stage",
+		"qovery:index/application:Application":       "qovery_application",
+		"qovery:index/helmRepository:HelmRepository": "qovery_helm_repository",
+	} {
+		resourceType, ok := pulumiTerraformType(pulumiType)
+		assert.True(t, ok, pulumiType)
+		assert.Equal(t, expected, resourceType)
+	}
+
+	_, ok := pulumiTerraformType("aws:s3:Bucket")
+	assert.False(t, ok)
+	assert.Equal(t, "environmentVariableAliases", camelCase("environment_variable_aliases"))
+}
+
+func TestPulumiResourceCounts(t *testing.T) {
+	counts, ok := pulumiResourceCounts(testPulumiYAML)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"qovery_database": 1, "qovery_application": 1}, counts)
+
+	_, ok = pulumiResourceCounts("")
+	assert.False(t, ok)
+}
+
+func TestValidatePulumi(t *testing.T) {
+	mockClaudeClient := new(MockClaudeClient)
+	mockClaudeClient.On("Messages", mock.MatchedBy(func(prompt string) bool {
+		return assert.Contains(t, prompt, "qovery:Worker")
+	})).Return("```yaml\n"+testPulumiYAML+"```", nil).Once()
+
+	validation, err := validatePulumi(testPulumiYAML+`  worker:
+    type: qovery:Worker
+`, mockClaudeClient, testPromptRenderer(t))
+	require.NoError(t, err)
+	assert.Equal(t, testPulumiYAML[:len(testPulumiYAML)-1], validation.PulumiYAML)
+	require.Len(t, validation.Iterations, 2)
+	assert.Equal(t, PulumiGateYAML, validation.Iterations[0].Gate)
+	assert.Equal(t, 1, validation.Iterations[0].ErrorCount())
+	assert.Equal(t, 0, validation.Iterations[1].ErrorCount())
+
+	mockClaudeClient.AssertExpectations(t)
+}
@@ -0,0 +1,199 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// QoveryTarget is the Qovery organization the applications are migrated to
+type QoveryTarget struct {
+	// TerraformVars are the IDs of the project and cluster pre-filled in terraform.tfvars
+	TerraformVars qovery.TerraformVars
+	// Warnings are the issues met while reading the organization, E.g the API key has insufficient permissions
+	Warnings []string
+}
+
+// resolveQoveryTarget reads the organization of the API key to pre-fill the Terraform variables. It fails if the
+// organization has clusters but none on the destination cloud provider, the other issues are only warnings.
+func resolveQoveryTarget(ctx context.Context, provider *qovery.QoveryProvider, destination string) (QoveryTarget, error) {
+	var target QoveryTarget
+	if provider.APIKey == "" {
+		target.Warnings = append(target.Warnings, "no Qovery API key, the project and cluster IDs are not pre-filled")
+		return target, nil
+	}
+
+	inventory, err := provider.FetchInventory(ctx)
+	if err != nil {
+		if qovery.IsPermissionError(err) {
+			target.Warnings = append(target.Warnings, fmt.Sprintf("the Qovery API key has insufficient permissions, the IDs are not pre-filled: %v", err))
+		} else {
+			target.Warnings = append(target.Warnings, fmt.Sprintf("the Qovery organization could not be read, the IDs are not pre-filled: %v", err))
+		}
+		logQoveryWarnings(target.Warnings)
+		return target, nil
+	}
+	target.Warnings = append(target.Warnings, inventory.Warnings...)
+
+	cluster, err := inventory.ClusterFor(destination)
+	if errors.Is(err, qovery.ErrDestinationMismatch) {
+		return QoveryTarget{}, err
+	}
+	if err != nil {
+		target.Warnings = append(target.Warnings, fmt.Sprintf("%v, the cluster ID is not pre-filled", err))
+	}
+
+	var picked []string
+	target.TerraformVars, picked = inventory.TerraformVars(cluster)
+	target.Warnings = append(target.Warnings, picked...)
+	logQoveryWarnings(target.Warnings)
+	return target, nil
+}
+
+func logQoveryWarnings(warnings []string) {
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+	}
+}
+
+// terraformTfvars returns the terraform.tfvars content of the Qovery IDs declared as variables in variables.tf,
+// empty if none is declared
+func terraformTfvars(vars qovery.TerraformVars, variablesTf string) string {
+	declared := declaredVariables(variablesTf)
+
+	var names []string
+	for name := range vars.Values() {
+		if declared[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Pre-filled from the Qovery organization %s\n", vars.OrganizationName))
+	values := vars.Values()
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s = %q\n", name, values[name]))
+	}
+	return sb.String()
+}
+
+// declaredVariables returns the names of the variables declared in a Terraform file, none if it can't be parsed
+func declaredVariables(content string) map[string]bool {
+	declared := map[string]bool{}
+	file, diags := hclsyntax.ParseConfig([]byte(content), "variables.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return declared
+	}
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type == "variable" && len(block.Labels) == 1 {
+			declared[block.Labels[0]] = true
+		}
+	}
+	return declared
+}
+
+// targetCoverage compares the services of the target environment with the Qovery resources declared in main.tf, or in
+// Pulumi.yaml, E.g a worker of the target without its qovery_application. None is returned if the file can't be parsed
+// or the format deploys without Qovery.
+func targetCoverage(target qovery.Environment, generated GeneratedTerraform) []string {
+	if !generated.Format.TargetsQovery() {
+		return nil
+	}
+	fileName := "main.tf"
+	declared, ok := declaredResources(generated.MainTf)
+	if generated.Format == OutputPulumi {
+		fileName = pulumiProgramFile
+		declared, ok = pulumiResourceCounts(generated.Files[pulumiProgramFile])
+	}
+	if !ok {
+		return nil
+	}
+
+	var warnings []string
+	for _, services := range []struct {
+		name          string
+		count         int
+		resourceTypes []string
+	}{
+		{"applications and containers", len(target.Applications) + len(target.Containers), []string{"qovery_application", "qovery_container"}},
+		{"databases", len(target.Databases), []string{"qovery_database"}},
+		{"jobs", len(target.Jobs), []string{"qovery_job"}},
+	} {
+		count := 0
+		for _, resourceType := range services.resourceTypes {
+			count += declared[resourceType]
+		}
+		if count != services.count {
+			warnings = append(warnings, fmt.Sprintf("the target has %d %s but %s declares %d %s resources",
+				services.count, services.name, fileName, count, strings.Join(services.resourceTypes, "/")))
+		}
+	}
+	return warnings
+}
+
+// declaredResources returns the number of resources of each type of main.tf, none if it is empty or can't be parsed
+func declaredResources(mainTf string) (map[string]int, bool) {
+	if mainTf == "" {
+		return nil, false
+	}
+	file, diags := hclsyntax.ParseConfig([]byte(mainTf), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, false
+	}
+
+	declared := map[string]int{}
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type == "resource" && len(block.Labels) == 2 {
+			declared[block.Labels[0]]++
+		}
+	}
+	return declared, true
+}
+
+// defaultPlanProjectName is the project of the plan when the organization has none
+const defaultPlanProjectName = "Migration"
+
+// Plan returns the plan of the Qovery resources created by "apply", with the target environment of each application.
+// The values of the secrets are placeholders, they are returned by PlanSecrets.
+func (a *Assets) Plan() qovery.Plan {
+	plan, _ := a.targetPlan().WithoutSecrets()
+	return plan
+}
+
+// PlanSecrets returns the values of the secrets of the plan, written out of the output directory
+func (a *Assets) PlanSecrets() qovery.PlanSecrets {
+	_, secrets := a.targetPlan().WithoutSecrets()
+	return secrets
+}
+
+func (a *Assets) targetPlan() qovery.Plan {
+	vars := a.QoveryTarget.TerraformVars
+	plan := qovery.Plan{
+		OrganizationID: vars.OrganizationID,
+		ProjectName:    vars.ProjectName,
+		ClusterID:      vars.ClusterID,
+		// the registry is only required by the containers, which may be added to the plan by the user
+		ContainerRegistryID: vars.ContainerRegistryID,
+		Environments:        []qovery.Environment{},
+	}
+	if plan.ProjectName == "" {
+		plan.ProjectName = defaultPlanProjectName
+	}
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		if generatedTf.Target.Name != "" {
+			plan.Environments = append(plan.Environments, generatedTf.Target)
+		}
+	}
+	return plan
+}
@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerraformTfvars(t *testing.T) {
+	vars := qovery.TerraformVars{
+		OrganizationName: "Acme",
+		ProjectID:        "project-1",
+		ClusterID:        "cluster-1",
+	}
+	variablesTf := `
+variable "environment_id" {
+  type = string
+}
+
+variable "project_id" {
+  type = string
+}
+
+variable "database_password" {
+  type      = string
+  sensitive = true
+}
+`
+
+	assert.Equal(t, `# Pre-filled from the Qovery organization Acme
+project_id = "project-1"
+`, terraformTfvars(vars, variablesTf))
+	assert.Empty(t, terraformTfvars(vars, `variable "database_password" {}`))
+	assert.Empty(t, terraformTfvars(qovery.TerraformVars{}, variablesTf))
+}
+
+func TestResolveQoveryTargetWithoutAPIKey(t *testing.T) {
+	target, err := resolveQoveryTarget(context.Background(), qovery.NewQoveryProvider(""), "aws")
+	require.NoError(t, err)
+	assert.Empty(t, target.TerraformVars.Values())
+	assert.Len(t, target.Warnings, 1)
+}
+
+func TestTargetCoverage(t *testing.T) {
+	target := qovery.Environment{
+		Applications: []qovery.Application{{Name: "my-app"}, {Name: "my-app-worker"}},
+		Databases:    []qovery.Database{{Name: "postgresql", Type: "POSTGRESQL"}},
+	}
+	mainTf := `
+resource "qovery_application" "my_app" {
+  name = "my-app"
+}
+
+resource "qovery_database" "postgresql" {
+  name = "postgresql"
+}
+`
+
+	assert.Equal(t, []string{
+		"the target has 2 applications and containers but main.tf declares 1 qovery_application/qovery_container resources",
+	}, targetCoverage(target, GeneratedTerraform{MainTf: mainTf}))
+	assert.Empty(t, targetCoverage(target, GeneratedTerraform{}))
+	assert.Empty(t, targetCoverage(target, GeneratedTerraform{MainTf: "resource {"}))
+}
+
+func TestAssetsPlan(t *testing.T) {
+	assets := &Assets{
+		QoveryTarget: QoveryTarget{TerraformVars: qovery.TerraformVars{OrganizationID: "org-1", ClusterID: "cluster-1", ContainerRegistryID: "registry-1"}},
+		GeneratedTerraformFiles: []GeneratedTerraform{
+			{AppName: "my-app", Target: qovery.Environment{Name: "my-app", Mode: "PRODUCTION", Applications: []qovery.Application{{Name: "web", Secrets: []qovery.Secret{{Key: "STRIPE_API_KEY", Value: "sk_live_123"}}}}}},
+			{AppName: "failed-app"},
+		},
+	}
+
+	assert.Equal(t, qovery.Plan{
+		OrganizationID:      "org-1",
+		ProjectName:         "Migration",
+		ClusterID:           "cluster-1",
+		ContainerRegistryID: "registry-1",
+		Environments:        []qovery.Environment{{Name: "my-app", Mode: "PRODUCTION", Applications: []qovery.Application{{Name: "web", Secrets: []qovery.Secret{{Key: "STRIPE_API_KEY", Value: qovery.SecretPlaceholder}}}}}},
+	}, assets.Plan())
+	assert.Equal(t, qovery.PlanSecrets{"my-app/web": {"STRIPE_API_KEY": "sk_live_123"}}, assets.PlanSecrets())
+}
@@ -0,0 +1,191 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kubernetes"
+)
+
+// MigrationReportMarkdown returns a Markdown report of how the assets were generated and the issues found along the way
+func (a *Assets) MigrationReportMarkdown() string {
+	var sb strings.Builder
+
+	sb.WriteString("# Migration Report\n\n")
+	sb.WriteString("This report summarizes how the migration assets were generated and the issues detected by the validation steps. Review the unresolved issues before deploying.\n\n")
+
+	sb.WriteString("## Dockerfiles\n\n")
+	sb.WriteString("| Application | Generated with | Issues found | Unresolved issues |\n")
+	sb.WriteString("|-------------|----------------|--------------|-------------------|\n")
+	for _, dockerfile := range a.Dockerfiles {
+		generatedWith := "LLM"
+		if dockerfile.Template != "" {
+			generatedWith = fmt.Sprintf("`%s` template", dockerfile.Template)
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %d | %d |\n", dockerfile.AppName, generatedWith, len(dockerfile.Findings), len(dockerfile.UnresolvedFindings)))
+	}
+
+	for _, dockerfile := range a.Dockerfiles {
+		if len(dockerfile.Findings) == 0 && len(dockerfile.UnresolvedFindings) == 0 {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("\n### %s\n\n", dockerfile.AppName))
+		if len(dockerfile.Findings) > 0 {
+			sb.WriteString("Issues found in the generated Dockerfile:\n\n")
+			for _, finding := range dockerfile.Findings {
+				sb.WriteString(fmt.Sprintf("- %s\n", finding))
+			}
+			sb.WriteString("\n")
+		}
+		if len(dockerfile.UnresolvedFindings) > 0 {
+			sb.WriteString("Issues that could not be fixed automatically:\n\n")
+			for _, finding := range dockerfile.UnresolvedFindings {
+				sb.WriteString(fmt.Sprintf("- %s\n", finding))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	format := a.OutputFormat()
+	files := fmt.Sprintf("The %s files", format.Title())
+	switch format {
+	case OutputPulumi:
+		files = "The Pulumi programs"
+	case OutputKubernetes:
+		files = "The Kubernetes manifests"
+	case OutputHelm:
+		files = "The manifests of the Helm charts"
+	}
+	sb.WriteString(fmt.Sprintf("## %s\n\n", format.Title()))
+	if !format.TargetsQovery() {
+		sb.WriteString(fmt.Sprintf("%s were validated against the bundled schema of Kubernetes %s.\n\n", files, kubernetes.SchemaVersion()))
+	} else if schema, err := loadQoveryProviderSchema(); err == nil {
+		sb.WriteString(fmt.Sprintf("%s were validated against the bundled schema of the Qovery provider %s.\n\n", files, schema.ProviderVersion))
+	}
+	if a.KnowledgeBundle.ProviderVersion != "" && format.TargetsQovery() {
+		sb.WriteString(fmt.Sprintf("%s were generated with the documentation of the Qovery provider %s (knowledge bundle: %s, created at %s).\n\n",
+			files, a.KnowledgeBundle.ProviderVersion, a.KnowledgeBundleOrigin, a.KnowledgeBundle.CreatedAt.Format("2006-01-02")))
+	}
+	sb.WriteString("| Application | Validation iterations | Errors per iteration | Valid |\n")
+	sb.WriteString("|-------------|-----------------------|----------------------|-------|\n")
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		var errorCounts []string
+		for _, iteration := range generatedTf.ValidationIterations {
+			errorCounts = append(errorCounts, fmt.Sprintf("%d (%s)", iteration.ErrorCount(), iteration.Gate))
+		}
+		valid := "❌"
+		if generatedTf.generated() && !hasErrorDiagnostics(generatedTf.Diagnostics) {
+			valid = "✅"
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %d | %s | %s |\n", generatedTf.AppName, len(generatedTf.ValidationIterations), strings.Join(errorCounts, " → "), valid))
+	}
+	sb.WriteString("\n")
+
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		if len(generatedTf.Diagnostics) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("### %s\n\n", generatedTf.AppName))
+		for _, diagnostic := range generatedTf.Diagnostics {
+			sb.WriteString(fmt.Sprintf("- %s\n", diagnostic))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("## Target model\n\n")
+	sb.WriteString(fmt.Sprintf("The services each application was translated to before the %s generation. The resources are the total of the instances, databases excluded.\n\n", format.Title()))
+	sb.WriteString("| Application | Mode | Applications | Containers | Databases | Jobs | CPU (millicores) | Memory (MB) |\n")
+	sb.WriteString("|-------------|------|--------------|------------|-----------|------|------------------|-------------|\n")
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		target := generatedTf.Target
+		resources := target.TotalResources()
+		sb.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %d | %d | %d | %d |\n", generatedTf.AppName, target.Mode, len(target.Applications),
+			len(target.Containers), len(target.Databases), len(target.Jobs), resources.CPU, resources.Memory))
+	}
+	sb.WriteString("\n")
+
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		if len(generatedTf.Target.Unmapped) == 0 && len(generatedTf.TargetCoverage) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("### %s\n\n", generatedTf.AppName))
+		for _, unmapped := range generatedTf.Target.Unmapped {
+			sb.WriteString(fmt.Sprintf("- Not migrated: %s\n", unmapped))
+		}
+		for _, warning := range generatedTf.TargetCoverage {
+			sb.WriteString(fmt.Sprintf("- Warning: %s\n", warning))
+		}
+		sb.WriteString("\n")
+	}
+
+	vars := a.QoveryTarget.TerraformVars
+	if format.TargetsQovery() {
+		sb.WriteString("## Qovery organization\n\n")
+	}
+	if vars.OrganizationName != "" {
+		if format == OutputPulumi {
+			sb.WriteString(fmt.Sprintf("Set the IDs of the organization %s as configuration of the stacks, E.g `pulumi config set environmentId <id>`.\n\n", vars.OrganizationName))
+		} else {
+			sb.WriteString(fmt.Sprintf("The IDs of the organization %s are pre-filled in the `terraform.tfvars` files of the applications.\n\n", vars.OrganizationName))
+		}
+		sb.WriteString("| Variable | Resource | ID |\n")
+		sb.WriteString("|----------|----------|----|\n")
+		for _, row := range [][3]string{
+			{"project_id", vars.ProjectName, vars.ProjectID},
+			{"cluster_id", vars.ClusterName, vars.ClusterID},
+		} {
+			if row[2] != "" {
+				sb.WriteString(fmt.Sprintf("| %s | %s | `%s` |\n", row[0], row[1], row[2]))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	for _, warning := range a.QoveryTarget.Warnings {
+		sb.WriteString(fmt.Sprintf("- Warning: %s\n", warning))
+	}
+	if len(a.QoveryTarget.Warnings) > 0 {
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("## Prompt templates\n\n")
+	sb.WriteString("The versions of the prompt templates and the models used to generate each asset.\n\n")
+	sb.WriteString("| Asset | Prompt templates | Models |\n")
+	sb.WriteString("|-------|------------------|--------|\n")
+	for _, dockerfile := range a.Dockerfiles {
+		sb.WriteString(fmt.Sprintf("| %s Dockerfile | %s | %s |\n", dockerfile.AppName, promptVersionsMarkdown(dockerfile.PromptVersions), modelsMarkdown(dockerfile.Models)))
+	}
+	for _, generatedTf := range a.GeneratedTerraformFiles {
+		sb.WriteString(fmt.Sprintf("| %s %s | %s | %s |\n", generatedTf.AppName, format.Title(), promptVersionsMarkdown(generatedTf.PromptVersions), modelsMarkdown(generatedTf.Models)))
+	}
+
+	sb.WriteString("\n## LLM usage\n\n")
+	usage := a.LLMUsage
+	sb.WriteString(fmt.Sprintf("Total: %s.\n\n", usage))
+	if len(usage.UnpricedModels) > 0 {
+		sb.WriteString(fmt.Sprintf("The spend of the models without a price is not estimated: %s.\n\n", strings.Join(usage.UnpricedModels, ", ")))
+	}
+	if len(usage.Groups) > 0 {
+		sb.WriteString("| Stage | Application | Calls | Input tokens | Output tokens | Estimated cost |\n")
+		sb.WriteString("|-------|-------------|-------|--------------|---------------|----------------|\n")
+		for _, group := range usage.Groups {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %d | $%.4f |\n", group.Stage, group.AppName, group.Calls, group.InputTokens, group.OutputTokens, group.Cost))
+		}
+	}
+
+	return sb.String()
+}
+
+func modelsMarkdown(models []string) string {
+	if len(models) == 0 {
+		return "none"
+	}
+	return "`" + strings.Join(models, "`, `") + "`"
+}
+
+func promptVersionsMarkdown(versions []string) string {
+	if len(versions) == 0 {
+		return "none (curated template)"
+	}
+	return "`" + strings.Join(versions, "`, `") + "`"
+}
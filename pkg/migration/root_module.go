@@ -0,0 +1,271 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// OutputLayout is how WriteAssets lays out the Terraform files of the applications
+type OutputLayout string
+
+const (
+	// LayoutPerApp writes an independent Terraform configuration in the directory of each application
+	LayoutPerApp OutputLayout = "per-app"
+	// LayoutRootModule writes a root module calling a child module per application under modules/, so all the
+	// applications are planned and applied at once
+	LayoutRootModule OutputLayout = "root-module"
+)
+
+// ParseOutputLayout returns the layout of its name, E.g root-module
+func ParseOutputLayout(name string) (OutputLayout, error) {
+	switch layout := OutputLayout(name); layout {
+	case LayoutPerApp, LayoutRootModule:
+		return layout, nil
+	default:
+		return "", fmt.Errorf("unknown output layout %q, must be %s or %s", name, LayoutPerApp, LayoutRootModule)
+	}
+}
+
+// rootModuleSharedVariables are the variables passed to every child module declaring them, the other variables are
+// prefixed with the module name in the root module, E.g my_app_database_password, even if several modules declare them:
+// the secrets and settings of an application are never given to another one
+var rootModuleSharedVariables = map[string]bool{
+	"qovery_access_token": true,
+	"organization_id":     true,
+	"project_id":          true,
+	"environment_id":      true,
+	"cluster_id":          true,
+}
+
+// rootModule is the root module of the LayoutRootModule layout
+type rootModule struct {
+	modules []childModule
+	// skipped are the applications whose Terraform files can't be parsed, they are not called by the root module
+	skipped []string
+}
+
+// childModule is the module of an application under modules/
+type childModule struct {
+	name  string
+	files map[string]string
+	// variables are the declared variables, in order
+	variables []*hclwrite.Block
+}
+
+// newRootModule turns the configuration of each application into a child module, without its provider configuration
+func newRootModule(generatedTerraformFiles []GeneratedTerraform) *rootModule {
+	root := &rootModule{}
+	for _, generatedTf := range generatedTerraformFiles {
+		module, err := newChildModule(generatedTf.SanitizeAppName(), generatedTf.Format, generatedTf.MainTf, generatedTf.VariablesTf)
+		if err != nil {
+			root.skipped = append(root.skipped, generatedTf.AppName)
+			continue
+		}
+		root.modules = append(root.modules, module)
+	}
+	return root
+}
+
+func newChildModule(name string, format OutputFormat, mainTf, variablesTf string) (childModule, error) {
+	if mainTf == "" {
+		return childModule{}, fmt.Errorf("main.tf of %s is empty", name)
+	}
+	mainFile, diags := hclwrite.ParseConfig([]byte(mainTf), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return childModule{}, fmt.Errorf("error parsing main.tf of %s: %s", name, diags.Error())
+	}
+	variablesFile, diags := hclwrite.ParseConfig([]byte(variablesTf), "variables.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return childModule{}, fmt.Errorf("error parsing variables.tf of %s: %s", name, diags.Error())
+	}
+
+	// the provider is configured once by the root module
+	outputs := hclwrite.NewEmptyFile()
+	for _, block := range mainFile.Body().Blocks() {
+		switch {
+		case block.Type() == "terraform" || block.Type() == "provider":
+			mainFile.Body().RemoveBlock(block)
+		case block.Type() == "resource" && len(block.Labels()) == 2:
+			resourceType, resourceName := block.Labels()[0], block.Labels()[1]
+			if len(outputs.Body().Blocks()) > 0 {
+				outputs.Body().AppendNewline()
+			}
+			output := outputs.Body().AppendNewBlock("output", []string{fmt.Sprintf("%s_%s_id", resourceType, resourceName)})
+			output.Body().SetAttributeTraversal("value", hcl.Traversal{
+				hcl.TraverseRoot{Name: resourceType},
+				hcl.TraverseAttr{Name: resourceName},
+				hcl.TraverseAttr{Name: "id"},
+			})
+		}
+	}
+
+	module := childModule{
+		name: name,
+		files: map[string]string{
+			"main.tf":      strings.TrimLeft(string(hclwrite.Format(mainFile.Bytes())), "\n"),
+			"variables.tf": variablesTf,
+			"versions.tf":  qoveryRequiredProviders(format, ""),
+			"outputs.tf":   string(hclwrite.Format(outputs.Bytes())),
+		},
+	}
+	for _, block := range variablesFile.Body().Blocks() {
+		if block.Type() == "variable" && len(block.Labels()) == 1 {
+			module.variables = append(module.variables, block)
+		}
+	}
+	return module, nil
+}
+
+// rootVariableName returns the name of the root module variable given to a variable of a child module
+func rootVariableName(module childModule, name string) string {
+	if rootModuleSharedVariables[name] {
+		return name
+	}
+	return module.name + "_" + name
+}
+
+// files returns the files of the root module: versions.tf, providers.tf, main.tf, variables.tf, outputs.tf and
+// terraform.tfvars.example pre-filled with the Qovery IDs
+func (r *rootModule) files(format OutputFormat, providerVersion string, qoveryIDs map[string]string) map[string]string {
+	// variables: the shared ones first, declared once, then the ones of each module
+	variables := hclwrite.NewEmptyFile()
+	declared := map[string]bool{}
+	declare := func(name string, block *hclwrite.Block) {
+		if declared[name] {
+			return
+		}
+		declared[name] = true
+		if len(variables.Body().Blocks()) > 0 {
+			variables.Body().AppendNewline()
+		}
+		variables.Body().AppendBlock(copyVariableBlock(block, name))
+	}
+
+	var sharedNames []string
+	sharedBlocks := map[string]*hclwrite.Block{}
+	for _, module := range r.modules {
+		for _, variable := range module.variables {
+			name := variable.Labels()[0]
+			if rootModuleSharedVariables[name] && sharedBlocks[name] == nil {
+				sharedBlocks[name] = variable
+				sharedNames = append(sharedNames, name)
+			}
+		}
+	}
+	if sharedBlocks["qovery_access_token"] == nil {
+		sharedBlocks["qovery_access_token"] = accessTokenVariable()
+		sharedNames = append(sharedNames, "qovery_access_token")
+	}
+	sort.Strings(sharedNames)
+	for _, name := range sharedNames {
+		declare(name, sharedBlocks[name])
+	}
+	for _, module := range r.modules {
+		for _, variable := range module.variables {
+			declare(rootVariableName(module, variable.Labels()[0]), variable)
+		}
+	}
+
+	main := hclwrite.NewEmptyFile()
+	outputs := hclwrite.NewEmptyFile()
+	for i, module := range r.modules {
+		if i > 0 {
+			main.Body().AppendNewline()
+			outputs.Body().AppendNewline()
+		}
+		block := main.Body().AppendNewBlock("module", []string{module.name})
+		block.Body().SetAttributeValue("source", cty.StringVal("./modules/"+module.name))
+		for _, variable := range module.variables {
+			name := variable.Labels()[0]
+			block.Body().SetAttributeTraversal(name, hcl.Traversal{
+				hcl.TraverseRoot{Name: "var"},
+				hcl.TraverseAttr{Name: rootVariableName(module, name)},
+			})
+		}
+
+		output := outputs.Body().AppendNewBlock("output", []string{module.name})
+		output.Body().SetAttributeValue("description", cty.StringVal(fmt.Sprintf("IDs of the Qovery resources of %s", module.name)))
+		output.Body().SetAttributeTraversal("value", hcl.Traversal{hcl.TraverseRoot{Name: "module"}, hcl.TraverseAttr{Name: module.name}})
+	}
+	mainTf := string(hclwrite.Format(main.Bytes()))
+	for _, appName := range r.skipped {
+		mainTf += fmt.Sprintf("\n# %s is not included: its Terraform files could not be parsed, see modules/%s\n", appName, GeneratedTerraform{AppName: appName}.SanitizeAppName())
+	}
+
+	return map[string]string{
+		"versions.tf":              qoveryRequiredProviders(format, providerVersion),
+		"providers.tf":             "provider \"qovery\" {\n  token = var.qovery_access_token\n}\n",
+		"main.tf":                  mainTf,
+		"variables.tf":             string(hclwrite.Format(variables.Bytes())),
+		"outputs.tf":               string(hclwrite.Format(outputs.Bytes())),
+		"terraform.tfvars.example": tfvarsExample(variables.Body().Blocks(), qoveryIDs),
+	}
+}
+
+// qoveryRequiredProviders returns the terraform block requiring the Qovery provider from the registry of the format,
+// pinned to the version if not empty
+func qoveryRequiredProviders(format OutputFormat, version string) string {
+	file := hclwrite.NewEmptyFile()
+	terraform := file.Body().AppendNewBlock("terraform", nil)
+	provider := map[string]cty.Value{"source": cty.StringVal(format.providerSource())}
+	if version != "" {
+		terraform.Body().SetAttributeValue("required_version", cty.StringVal(format.requiredVersion()))
+		provider["version"] = cty.StringVal(version)
+	}
+	terraform.Body().AppendNewBlock("required_providers", nil).Body().SetAttributeValue("qovery", cty.ObjectVal(provider))
+	return string(hclwrite.Format(file.Bytes()))
+}
+
+// copyVariableBlock returns a copy of a variable block with another name
+func copyVariableBlock(block *hclwrite.Block, name string) *hclwrite.Block {
+	file, _ := hclwrite.ParseConfig(block.BuildTokens(nil).Bytes(), "variables.tf", hcl.InitialPos)
+	variable := file.Body().Blocks()[0]
+	variable.SetLabels([]string{name})
+	return variable
+}
+
+func accessTokenVariable() *hclwrite.Block {
+	block := hclwrite.NewBlock("variable", []string{"qovery_access_token"})
+	block.Body().SetAttributeValue("description", cty.StringVal("Qovery API token"))
+	block.Body().SetAttributeTraversal("type", hcl.Traversal{hcl.TraverseRoot{Name: "string"}})
+	block.Body().SetAttributeValue("sensitive", cty.True)
+	return block
+}
+
+// tfvarsExample returns a terraform.tfvars example with a placeholder of the type of each variable, the Qovery IDs
+// are pre-filled. The variables with a default value are commented with their default.
+func tfvarsExample(variables []*hclwrite.Block, qoveryIDs map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString("# Copy this file to terraform.tfvars and set the values\n")
+	for _, variable := range variables {
+		name := variable.Labels()[0]
+		value := `""`
+		if id, ok := qoveryIDs[name]; ok {
+			value = fmt.Sprintf("%q", id)
+		} else if typeAttribute := variable.Body().GetAttribute("type"); typeAttribute != nil {
+			variableType := strings.TrimSpace(string(typeAttribute.Expr().BuildTokens(nil).Bytes()))
+			switch {
+			case variableType == "number":
+				value = "0"
+			case variableType == "bool":
+				value = "false"
+			case strings.HasPrefix(variableType, "list") || strings.HasPrefix(variableType, "set") || strings.HasPrefix(variableType, "tuple"):
+				value = "[]"
+			case strings.HasPrefix(variableType, "map") || strings.HasPrefix(variableType, "object"):
+				value = "{}"
+			}
+		}
+		if defaultAttribute := variable.Body().GetAttribute("default"); defaultAttribute != nil {
+			value = strings.TrimSpace(string(hclwrite.Format(defaultAttribute.Expr().BuildTokens(nil).Bytes())))
+			sb.WriteString(fmt.Sprintf("# %s = %s\n", name, strings.ReplaceAll(value, "\n", "\n# ")))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s = %s\n", name, value))
+	}
+	return sb.String()
+}
@@ -0,0 +1,127 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/qovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rootModuleTestMainTf = `terraform {
+  required_providers {
+    qovery = {
+      source  = "qovery/qovery"
+      version = "0.40.0"
+    }
+  }
+}
+
+provider "qovery" {
+  token = var.qovery_access_token
+}
+
+resource "qovery_application" "app" {
+  environment_id = var.environment_id
+  name           = "app"
+}
+`
+
+const rootModuleTestVariablesTf = `variable "qovery_access_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "environment_id" {
+  type = string
+}
+
+variable "database_password" {
+  type      = string
+  sensitive = true
+}
+
+variable "min_running_instances" {
+  type    = number
+  default = 1
+}
+`
+
+func TestWriteAssetsRootModule(t *testing.T) {
+	assets := &Assets{
+		GeneratedTerraformFiles: []GeneratedTerraform{
+			{AppName: "front-app", MainTf: rootModuleTestMainTf, VariablesTf: rootModuleTestVariablesTf},
+			{AppName: "api", MainTf: rootModuleTestMainTf, VariablesTf: "variable \"environment_id\" {}\nvariable \"project_id\" {}\nvariable \"database_password\" {\n  type = string\n}\nvariable \"regions\" {\n  default = [\n    \"eu\",\n  ]\n}"},
+			{AppName: "broken", MainTf: "resource {"},
+		},
+		QoveryTarget: QoveryTarget{TerraformVars: qovery.TerraformVars{ProjectID: "project-1"}},
+	}
+	assets.KnowledgeBundle.ProviderVersion = "0.41.0"
+	dir := t.TempDir()
+
+	require.NoError(t, WriteAssetsWithLayout(dir, assets, false, LayoutRootModule))
+
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(content)
+	}
+	for _, name := range []string{"versions.tf", "providers.tf", "main.tf", "variables.tf", "outputs.tf",
+		"modules/front_app/main.tf", "modules/front_app/variables.tf", "modules/front_app/versions.tf", "modules/front_app/outputs.tf"} {
+		_, diags := hclsyntax.ParseConfig([]byte(read(name)), name, hcl.InitialPos)
+		assert.False(t, diags.HasErrors(), "%s: %s", name, diags.Error())
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "front_app", "main.tf"))
+	assert.NoFileExists(t, filepath.Join(dir, "modules", "front_app", "terraform.tfvars"))
+
+	assert.Contains(t, read("versions.tf"), `version = "0.41.0"`)
+	assert.Contains(t, read("providers.tf"), "token = var.qovery_access_token")
+
+	moduleMainTf := read("modules/front_app/main.tf")
+	assert.NotContains(t, moduleMainTf, "provider")
+	assert.NotContains(t, moduleMainTf, "required_providers")
+	assert.Contains(t, moduleMainTf, `resource "qovery_application" "app"`)
+	assert.Contains(t, read("modules/front_app/versions.tf"), `source = "qovery/qovery"`)
+	assert.Contains(t, read("modules/front_app/outputs.tf"), "value = qovery_application.app.id")
+
+	mainTf := read("main.tf")
+	assert.Contains(t, mainTf, `source                = "./modules/front_app"`)
+	assert.Contains(t, mainTf, "environment_id        = var.environment_id")
+	assert.Contains(t, mainTf, "database_password     = var.front_app_database_password")
+	assert.Contains(t, mainTf, `source            = "./modules/api"`)
+	// the variables declared by several modules are not shared, except the Qovery IDs
+	assert.Contains(t, mainTf, "database_password = var.api_database_password")
+	assert.Contains(t, mainTf, "# broken is not included")
+
+	variablesTf := read("variables.tf")
+	assert.Contains(t, variablesTf, `variable "qovery_access_token"`)
+	assert.Contains(t, variablesTf, `variable "front_app_database_password"`)
+	assert.NotContains(t, variablesTf, `variable "api_environment_id"`)
+	assert.Contains(t, variablesTf, `variable "api_database_password"`)
+	assert.NotContains(t, variablesTf, `variable "database_password"`)
+
+	assert.Equal(t, `# Copy this file to terraform.tfvars and set the values
+environment_id = ""
+project_id = "project-1"
+qovery_access_token = ""
+front_app_database_password = ""
+# front_app_min_running_instances = 1
+api_database_password = ""
+# api_regions = [
+#   "eu",
+# ]
+`, read("terraform.tfvars.example"))
+}
+
+func TestParseOutputLayout(t *testing.T) {
+	layout, err := ParseOutputLayout("root-module")
+	require.NoError(t, err)
+	assert.Equal(t, LayoutRootModule, layout)
+
+	_, err = ParseOutputLayout("monorepo")
+	assert.Error(t, err)
+}
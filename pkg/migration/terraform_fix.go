@@ -0,0 +1,357 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Terraform validation gates, in the order they are run
+const (
+	TerraformGateHCL      = "hcl"
+	TerraformGateInit     = "terraform init"
+	TerraformGateValidate = "terraform validate"
+	TofuGateInit          = "tofu init"
+	TofuGateValidate      = "tofu validate"
+)
+
+// TerraformValidationIteration records the outcome of one iteration of the validation loop
+type TerraformValidationIteration struct {
+	Gate        string                `json:"gate"`
+	Diagnostics []TerraformDiagnostic `json:"diagnostics,omitempty"`
+}
+
+// ErrorCount returns the number of error diagnostics of the iteration
+func (i TerraformValidationIteration) ErrorCount() int {
+	count := 0
+	for _, diagnostic := range i.Diagnostics {
+		if diagnostic.Severity == "error" {
+			count++
+		}
+	}
+	return count
+}
+
+// worseThan returns true if the iteration is further from a valid configuration than the other one:
+// it failed at an earlier gate, or at the same gate with more errors
+func (i TerraformValidationIteration) worseThan(other TerraformValidationIteration) bool {
+	rank, otherRank := terraformGateRank(i.Gate), terraformGateRank(other.Gate)
+	if rank != otherRank {
+		return rank < otherRank
+	}
+	return i.ErrorCount() > other.ErrorCount()
+}
+
+func terraformGateRank(gate string) int {
+	switch gate {
+	case TerraformGateHCL:
+		return 0
+	case TerraformGateInit, TofuGateInit:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// parseTerraformValidateJSON parses the output of `terraform validate -json`
+func parseTerraformValidateJSON(output []byte) ([]TerraformDiagnostic, error) {
+	var result struct {
+		Diagnostics []struct {
+			Severity string `json:"severity"`
+			Summary  string `json:"summary"`
+			Detail   string `json:"detail"`
+			Range    *struct {
+				Filename string `json:"filename"`
+				Start    struct {
+					Line int `json:"line"`
+				} `json:"start"`
+			} `json:"range"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("error decoding terraform validate output: %w", err)
+	}
+
+	var diagnostics []TerraformDiagnostic
+	for _, d := range result.Diagnostics {
+		diagnostic := TerraformDiagnostic{Severity: d.Severity, Summary: d.Summary, Detail: d.Detail}
+		if d.Range != nil {
+			diagnostic.File = d.Range.Filename
+			diagnostic.Line = d.Range.Start.Line
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics, nil
+}
+
+// fixTerraformDiagnostics asks the LLM to fix only the blocks targeted by the error diagnostics, with the provider
+// documentation of their resource types, and splices the corrected blocks back into the files.
+// A file that can't be parsed, or with errors without a location or outside of any block, is fixed as a whole.
+func fixTerraformDiagnostics(files map[string]string, diagnostics []TerraformDiagnostic, providerDocs map[string]string, bedrockClient llmClient, prompts *promptRenderer) (map[string]string, error) {
+	diagnosticsByFile := map[string][]TerraformDiagnostic{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity != "error" {
+			continue
+		}
+		fileName := diagnostic.File
+		if _, ok := files[fileName]; !ok {
+			fileName = "main.tf"
+		}
+		diagnosticsByFile[fileName] = append(diagnosticsByFile[fileName], diagnostic)
+	}
+
+	fixed := map[string]string{}
+	for fileName, content := range files {
+		fixed[fileName] = content
+	}
+
+	fileNames := make([]string, 0, len(diagnosticsByFile))
+	for fileName := range diagnosticsByFile {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		fileDiagnostics := diagnosticsByFile[fileName]
+
+		blocks, ok := failingBlocks(fixed[fileName], fileName, fileDiagnostics)
+		if !ok {
+			content, err := fixTerraformFile(fileName, fixed, formatTerraformDiagnostics(fileDiagnostics), bedrockClient, prompts)
+			if err != nil {
+				return nil, err
+			}
+			fixed[fileName] = content
+			continue
+		}
+
+		prompt, err := terraformBlocksFixPrompt(fileName, fixed[fileName], blocks, fileDiagnostics, fixed, providerDocs, prompts)
+		if err != nil {
+			return nil, err
+		}
+		response, err := bedrockClient.Messages(prompt)
+		if err != nil {
+			return nil, fmt.Errorf("error getting response from Bedrock for %s: %w", fileName, err)
+		}
+
+		if !spliceTerraformBlocks(fixed, fileName, blocks, extractCode(response)) {
+			// the reply is not a set of valid blocks, fall back to fixing the whole file
+			content, err := fixTerraformFile(fileName, fixed, formatTerraformDiagnostics(fileDiagnostics), bedrockClient, prompts)
+			if err != nil {
+				return nil, err
+			}
+			fixed[fileName] = content
+		}
+	}
+
+	return fixed, nil
+}
+
+// failingBlocks returns the top level blocks containing the diagnostics.
+// It returns false if the file can't be parsed or if a diagnostic has no location or is not located in a block: the
+// fix may need the whole file, E.g to add a missing block.
+func failingBlocks(content, fileName string, diagnostics []TerraformDiagnostic) ([]*hclsyntax.Block, bool) {
+	file, diags := hclsyntax.ParseConfig([]byte(content), fileName, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, false
+	}
+
+	var blocks []*hclsyntax.Block
+	seen := map[*hclsyntax.Block]bool{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Line == 0 {
+			return nil, false
+		}
+
+		var found *hclsyntax.Block
+		for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+			r := block.Range()
+			if diagnostic.Line >= r.Start.Line && diagnostic.Line <= r.End.Line {
+				found = block
+				break
+			}
+		}
+		if found == nil {
+			return nil, false
+		}
+		if !seen[found] {
+			seen[found] = true
+			blocks = append(blocks, found)
+		}
+	}
+
+	return blocks, true
+}
+
+func terraformBlocksFixPrompt(fileName, content string, blocks []*hclsyntax.Block, diagnostics []TerraformDiagnostic, files map[string]string, providerDocs map[string]string, prompts *promptRenderer) (string, error) {
+	var snippets []string
+	docs := map[string]string{}
+	for _, block := range blocks {
+		r := block.Range()
+		snippets = append(snippets, fmt.Sprintf("# %s lines %d-%d\n%s", fileName, r.Start.Line, r.End.Line, content[r.Start.Byte:r.End.Byte]))
+
+		if doc, path := providerDocForBlock(block, providerDocs); doc != "" {
+			docs[path] = doc
+		}
+	}
+
+	var docSections []string
+	for path, doc := range docs {
+		docSections = append(docSections, fmt.Sprintf("%s:\n%s", path, doc))
+	}
+	sort.Strings(docSections)
+
+	return prompts.render(PromptTerraformBlocksFix, struct {
+		FileName  string
+		Blocks    []string
+		Errors    string
+		Variables []string
+		Docs      []string
+	}{fileName, snippets, formatTerraformDiagnostics(diagnostics), declaredVariableNames(files["variables.tf"]), docSections})
+}
+
+// providerDocForBlock returns the provider documentation of the resource or data source type of a block
+func providerDocForBlock(block *hclsyntax.Block, providerDocs map[string]string) (string, string) {
+	if len(block.Labels) == 0 || !strings.HasPrefix(block.Labels[0], "qovery_") {
+		return "", ""
+	}
+
+	name := strings.TrimPrefix(block.Labels[0], "qovery_")
+	var path string
+	switch block.Type {
+	case "resource":
+		path = fmt.Sprintf("docs/resources/%s.md", name)
+	case "data":
+		path = fmt.Sprintf("docs/data-sources/%s.md", name)
+	default:
+		return "", ""
+	}
+	return providerDocs[path], path
+}
+
+func declaredVariableNames(variablesTf string) []string {
+	file, diags := hclsyntax.ParseConfig([]byte(variablesTf), "variables.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	var names []string
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type == "variable" && len(block.Labels) == 1 {
+			names = append(names, block.Labels[0])
+		}
+	}
+	return names
+}
+
+// spliceTerraformBlocks replaces the failing blocks with the corrected blocks of the response.
+// A block of the response declared in the file already, E.g re-emitted unchanged, replaces it instead of being
+// duplicated, and a variable declared in variables.tf already is dropped. New variable declarations are added to
+// variables.tf, other new blocks to the fixed file. It returns false if the response is not a set of valid blocks, or
+// if it renames a failing block: the failing block would be kept along with the renamed one.
+func spliceTerraformBlocks(files map[string]string, fileName string, blocks []*hclsyntax.Block, response string) bool {
+	response = trimCodeFence(response)
+	file, diags := hclsyntax.ParseConfig([]byte(response), "response.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return false
+	}
+	target, diags := hclsyntax.ParseConfig([]byte(files[fileName]), fileName, hcl.InitialPos)
+	if diags.HasErrors() {
+		return false
+	}
+
+	existing := map[string]*hclsyntax.Block{}
+	for _, block := range target.Body.(*hclsyntax.Body).Blocks {
+		existing[terraformBlockKey(block)] = block
+	}
+	declaredVariables := map[string]bool{}
+	for _, name := range declaredVariableNames(files["variables.tf"]) {
+		declaredVariables[name] = true
+	}
+
+	replacements := map[*hclsyntax.Block]string{}
+	var newBlocks []*hclsyntax.Block
+	var newTexts []string
+	var newVariables []string
+
+	for _, corrected := range file.Body.(*hclsyntax.Body).Blocks {
+		r := corrected.Range()
+		text := response[r.Start.Byte:r.End.Byte]
+
+		switch {
+		case existing[terraformBlockKey(corrected)] != nil:
+			replacements[existing[terraformBlockKey(corrected)]] = text
+		case corrected.Type == "variable" && fileName != "variables.tf":
+			if len(corrected.Labels) == 1 && declaredVariables[corrected.Labels[0]] {
+				continue
+			}
+			newVariables = append(newVariables, text)
+		default:
+			newBlocks = append(newBlocks, corrected)
+			newTexts = append(newTexts, text)
+		}
+	}
+
+	if len(replacements) == 0 && len(newTexts) == 0 && len(newVariables) == 0 {
+		return false
+	}
+
+	// a failing block missing from the response while a new block of its type is added was renamed
+	for _, block := range blocks {
+		if replacements[existing[terraformBlockKey(block)]] != "" {
+			continue
+		}
+		for _, added := range newBlocks {
+			if added.Type == block.Type && len(added.Labels) > 0 && len(block.Labels) > 0 && added.Labels[0] == block.Labels[0] {
+				return false
+			}
+		}
+	}
+
+	// replace from the end of the file to keep the byte offsets valid
+	sortedBlocks := make([]*hclsyntax.Block, 0, len(replacements))
+	for block := range replacements {
+		sortedBlocks = append(sortedBlocks, block)
+	}
+	sort.Slice(sortedBlocks, func(i, j int) bool {
+		return sortedBlocks[i].Range().Start.Byte > sortedBlocks[j].Range().Start.Byte
+	})
+
+	content := files[fileName]
+	for _, block := range sortedBlocks {
+		r := block.Range()
+		content = content[:r.Start.Byte] + replacements[block] + content[r.End.Byte:]
+	}
+	for _, text := range newTexts {
+		content = strings.TrimRight(content, "\n") + "\n\n" + text + "\n"
+	}
+	files[fileName] = content
+
+	for _, variable := range newVariables {
+		files["variables.tf"] = strings.TrimRight(files["variables.tf"], "\n") + "\n\n" + variable + "\n"
+	}
+
+	return true
+}
+
+// terraformBlockKey identifies a block by its type and labels, E.g resource.qovery_application.web
+func terraformBlockKey(block *hclsyntax.Block) string {
+	return strings.Join(append([]string{block.Type}, block.Labels...), ".")
+}
+
+// trimCodeFence removes a Markdown code fence wrapping the whole response
+func trimCodeFence(response string) string {
+	response = strings.TrimSpace(response)
+	if !strings.HasPrefix(response, "```") {
+		return response
+	}
+	lines := strings.Split(response, "\n")
+	lines = lines[1:]
+	if len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "```") {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,166 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const fixTestMainTf = `provider "qovery" {
+  token = var.qovery_access_token
+}
+
+resource "qovery_database" "db" {
+  environment_id = var.environment_id
+  name           = "db"
+  type           = "POSTGRESQL"
+  version        = "16"
+  mode           = "CONTAINER"
+}
+
+resource "qovery_application" "web" {
+  environment_id = var.environment_id
+  name           = "web"
+  git_repository = {
+    url = var.git_url
+  }
+  port = 8080
+}
+`
+
+const fixTestVariablesTf = `variable "qovery_access_token" {
+  type = string
+}
+
+variable "environment_id" {
+  type = string
+}
+`
+
+func TestParseTerraformValidateJSON(t *testing.T) {
+	output := `{"format_version":"1.0","valid":false,"error_count":1,"warning_count":0,"diagnostics":[{"severity":"error","summary":"Unsupported argument","detail":"An argument named \"port\" is not expected here.","range":{"filename":"main.tf","start":{"line":19,"column":3,"byte":10},"end":{"line":19,"column":7,"byte":14}}}]}`
+
+	diagnostics, err := parseTerraformValidateJSON([]byte(output))
+	assert.NoError(t, err)
+	assert.Equal(t, []TerraformDiagnostic{{
+		Severity: "error",
+		Summary:  "Unsupported argument",
+		Detail:   "An argument named \"port\" is not expected here.",
+		File:     "main.tf",
+		Line:     19,
+	}}, diagnostics)
+}
+
+func TestFixTerraformDiagnostics(t *testing.T) {
+	files := map[string]string{"main.tf": fixTestMainTf, "variables.tf": fixTestVariablesTf}
+	diagnostics, err := validateTerraformHCL(files)
+	assert.NoError(t, err)
+
+	providerDocs := map[string]string{
+		"docs/resources/application.md": "# qovery_application (Resource)",
+		"docs/resources/database.md":    "# qovery_database (Resource)",
+	}
+
+	mockClaudeClient := new(MockClaudeClient)
+	mockClaudeClient.On("Messages", mock.MatchedBy(func(prompt string) bool {
+		// only the failing block and the docs of its resource type are sent
+		return strings.Contains(prompt, `resource "qovery_application" "web"`) &&
+			!strings.Contains(prompt, `resource "qovery_database" "db"`) &&
+			strings.Contains(prompt, "# qovery_application (Resource)") &&
+			!strings.Contains(prompt, "# qovery_database (Resource)")
+	})).Return("```hcl\n"+`resource "qovery_application" "web" {
+  environment_id = var.environment_id
+  name           = "web"
+  git_repository = {
+    url = var.git_url
+  }
+  ports = [{
+    internal_port = 8080
+  }]
+}
+
+variable "git_url" {
+  type = string
+}`+"\n```", nil).Once()
+
+	fixed, err := fixTerraformDiagnostics(files, diagnostics, providerDocs, mockClaudeClient, testPromptRenderer(t))
+	assert.NoError(t, err)
+	assert.Contains(t, fixed["main.tf"], `resource "qovery_database" "db"`)
+	assert.Contains(t, fixed["main.tf"], "internal_port = 8080")
+	assert.NotContains(t, fixed["main.tf"], "port = 8080\n}")
+	assert.Contains(t, fixed["variables.tf"], `variable "git_url"`)
+
+	diagnostics, err = validateTerraformHCL(fixed)
+	assert.NoError(t, err)
+	assert.False(t, hasErrorDiagnostics(diagnostics))
+
+	mockClaudeClient.AssertExpectations(t)
+}
+
+func TestValidateTerraformStopsWhenFixMakesThingsWorse(t *testing.T) {
+	mockClaudeClient := new(MockClaudeClient)
+	// the fix breaks the whole block
+	mockClaudeClient.On("Messages", mock.AnythingOfType("string")).Return(`resource "qovery_application" "web" {
+  foo = "bar"
+  bar = "foo"
+}`, nil).Once()
+
+	validation, err := validateTerraform(fixTestMainTf, fixTestVariablesTf, nil, ValidationConfig{}, mockClaudeClient, testPromptRenderer(t))
+	assert.Error(t, err)
+	assert.Len(t, validation.Iterations, 2)
+	assert.Equal(t, fixTestMainTf, validation.MainTf)
+	assert.True(t, validation.Iterations[1].worseThan(validation.Iterations[0]))
+
+	mockClaudeClient.AssertExpectations(t)
+}
+
+func TestSpliceTerraformBlocks(t *testing.T) {
+	failing := func(t *testing.T) []*hclsyntax.Block {
+		blocks, ok := failingBlocks(fixTestMainTf, "main.tf", []TerraformDiagnostic{{Severity: "error", File: "main.tf", Line: 19}})
+		require.True(t, ok)
+		require.Len(t, blocks, 1)
+		return blocks
+	}
+	fixedWeb := `resource "qovery_application" "web" {
+  environment_id = var.environment_id
+  name           = "web"
+  ports = [{
+    internal_port = 8080
+  }]
+}`
+
+	// a block of the file re-emitted by the response replaces it, a variable declared already is dropped
+	files := map[string]string{"main.tf": fixTestMainTf, "variables.tf": fixTestVariablesTf}
+	response := fixedWeb + `
+
+resource "qovery_database" "db" {
+  environment_id = var.environment_id
+  name           = "db"
+  type           = "POSTGRESQL"
+  version        = "17"
+  mode           = "CONTAINER"
+}
+
+variable "environment_id" {
+  type = string
+}`
+	require.True(t, spliceTerraformBlocks(files, "main.tf", failing(t), response))
+	assert.Equal(t, 1, strings.Count(files["main.tf"], `resource "qovery_database" "db"`))
+	assert.Contains(t, files["main.tf"], `version        = "17"`)
+	assert.Equal(t, 1, strings.Count(files["main.tf"], `resource "qovery_application" "web"`))
+	assert.Equal(t, fixTestVariablesTf, files["variables.tf"])
+
+	// a renamed failing block is rejected, it would be kept along with the renamed one
+	files = map[string]string{"main.tf": fixTestMainTf, "variables.tf": fixTestVariablesTf}
+	renamed := strings.Replace(fixedWeb, `"web" {`, `"web_app" {`, 1)
+	assert.False(t, spliceTerraformBlocks(files, "main.tf", failing(t), renamed))
+	assert.Equal(t, fixTestMainTf, files["main.tf"])
+
+	// the diagnostics without a location are fixed with the whole file
+	_, ok := failingBlocks(fixTestMainTf, "main.tf", []TerraformDiagnostic{{Severity: "error", Summary: "Missing required provider"}})
+	assert.False(t, ok)
+}
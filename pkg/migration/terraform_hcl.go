@@ -0,0 +1,341 @@
+package migration
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+//go:embed schemas/qovery_provider_schema.json
+var qoveryProviderSchemaJSON []byte
+
+// TerraformDiagnostic is an error or a warning found while validating the generated Terraform files
+type TerraformDiagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+func (d TerraformDiagnostic) String() string {
+	location := ""
+	if d.File != "" && d.Line > 0 {
+		location = fmt.Sprintf("%s:%d: ", d.File, d.Line)
+	} else if d.File != "" {
+		location = fmt.Sprintf("%s: ", d.File)
+	}
+	if d.Detail != "" {
+		return fmt.Sprintf("%s%s: %s; %s", location, d.Severity, d.Summary, d.Detail)
+	}
+	return fmt.Sprintf("%s%s: %s", location, d.Severity, d.Summary)
+}
+
+// providerSchema is a snapshot of the Qovery Terraform provider schema
+type providerSchema struct {
+	ProviderSource    string                 `json:"provider_source"`
+	ProviderVersion   string                 `json:"provider_version"`
+	ResourceSchemas   map[string]schemaBlock `json:"resource_schemas"`
+	DataSourceSchemas map[string]schemaBlock `json:"data_source_schemas"`
+}
+
+// schemaBlock describes the attributes of a resource or of a nested attribute.
+// Open schemas are not validated beyond their existence.
+type schemaBlock struct {
+	Open       bool                       `json:"open,omitempty"`
+	Nesting    string                     `json:"nesting,omitempty"`
+	Attributes map[string]schemaAttribute `json:"attributes,omitempty"`
+}
+
+type schemaAttribute struct {
+	Required bool         `json:"required,omitempty"`
+	Computed bool         `json:"computed,omitempty"`
+	Open     bool         `json:"open,omitempty"`
+	Nested   *schemaBlock `json:"nested,omitempty"`
+}
+
+// terraformMetaArguments are accepted by every resource
+var terraformMetaArguments = map[string]bool{
+	"count": true, "for_each": true, "depends_on": true, "provider": true, "lifecycle": true, "provisioner": true, "connection": true,
+}
+
+// loadQoveryProviderSchema returns the bundled snapshot of the Qovery provider schema
+func loadQoveryProviderSchema() (*providerSchema, error) {
+	var schema providerSchema
+	if err := json.Unmarshal(qoveryProviderSchemaJSON, &schema); err != nil {
+		return nil, fmt.Errorf("error decoding Qovery provider schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// validateTerraformHCL parses the Terraform files in-process and checks the variables and the Qovery resources
+// against the bundled provider schema. It doesn't need the terraform binary nor network access.
+func validateTerraformHCL(files map[string]string) ([]TerraformDiagnostic, error) {
+	schema, err := loadQoveryProviderSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	var diagnostics []TerraformDiagnostic
+	declaredVariables := map[string]hcl.Range{}
+	usedVariables := map[string]hcl.Range{}
+
+	// iterate in a stable order to get stable diagnostics
+	fileNames := make([]string, 0, len(files))
+	for name := range files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		file, diags := hclsyntax.ParseConfig([]byte(files[fileName]), fileName, hcl.InitialPos)
+		diagnostics = append(diagnostics, hclDiagnostics(diags)...)
+		if diags.HasErrors() {
+			continue
+		}
+
+		body := file.Body.(*hclsyntax.Body)
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "variable":
+				if len(block.Labels) == 1 {
+					declaredVariables[block.Labels[0]] = block.DefRange()
+				}
+				continue
+			case "resource":
+				if len(block.Labels) == 2 {
+					diagnostics = append(diagnostics, validateResourceBlock(block, schema.ResourceSchemas, "resource")...)
+				}
+			case "data":
+				if len(block.Labels) == 2 {
+					diagnostics = append(diagnostics, validateResourceBlock(block, schema.DataSourceSchemas, "data source")...)
+				}
+			}
+			collectVariableReferences(block.Body, usedVariables)
+		}
+		for _, attribute := range body.Attributes {
+			collectVariableReferencesInExpr(attribute.Expr, usedVariables)
+		}
+	}
+
+	var undeclared []string
+	for name := range usedVariables {
+		if _, ok := declaredVariables[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		r := usedVariables[name]
+		diagnostics = append(diagnostics, TerraformDiagnostic{
+			Severity: "error",
+			Summary:  "Reference to undeclared input variable",
+			Detail:   fmt.Sprintf("var.%s is referenced but no variable %q is declared in variables.tf", name, name),
+			File:     r.Filename,
+			Line:     r.Start.Line,
+		})
+	}
+
+	var unused []string
+	for name := range declaredVariables {
+		if _, ok := usedVariables[name]; !ok {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		r := declaredVariables[name]
+		diagnostics = append(diagnostics, TerraformDiagnostic{
+			Severity: "warning",
+			Summary:  "Unused input variable",
+			Detail:   fmt.Sprintf("variable %q is declared but never used", name),
+			File:     r.Filename,
+			Line:     r.Start.Line,
+		})
+	}
+
+	return diagnostics, nil
+}
+
+func hclDiagnostics(diags hcl.Diagnostics) []TerraformDiagnostic {
+	var diagnostics []TerraformDiagnostic
+	for _, diag := range diags {
+		d := TerraformDiagnostic{Severity: "error", Summary: diag.Summary, Detail: diag.Detail}
+		if diag.Severity == hcl.DiagWarning {
+			d.Severity = "warning"
+		}
+		if diag.Subject != nil {
+			d.File = diag.Subject.Filename
+			d.Line = diag.Subject.Start.Line
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+func validateResourceBlock(block *hclsyntax.Block, schemas map[string]schemaBlock, kind string) []TerraformDiagnostic {
+	resourceType := block.Labels[0]
+	r := block.DefRange()
+
+	// only the Qovery provider schema is bundled
+	if !strings.HasPrefix(resourceType, "qovery_") {
+		return nil
+	}
+
+	schema, ok := schemas[resourceType]
+	if !ok {
+		return []TerraformDiagnostic{{
+			Severity: "error",
+			Summary:  fmt.Sprintf("Invalid %s type", kind),
+			Detail:   fmt.Sprintf("the Qovery provider does not support %s %q", kind, resourceType),
+			File:     r.Filename,
+			Line:     r.Start.Line,
+		}}
+	}
+	if schema.Open {
+		return nil
+	}
+
+	var diagnostics []TerraformDiagnostic
+	address := fmt.Sprintf("%s.%s", resourceType, block.Labels[1])
+
+	for _, nestedBlock := range block.Body.Blocks {
+		if terraformMetaArguments[nestedBlock.Type] {
+			continue
+		}
+		br := nestedBlock.DefRange()
+		detail := fmt.Sprintf("blocks of type %q are not expected in %s", nestedBlock.Type, address)
+		if _, ok := schema.Attributes[nestedBlock.Type]; ok {
+			detail = fmt.Sprintf("%q is an attribute in %s, use the syntax `%s = { ... }` instead of a block", nestedBlock.Type, address, nestedBlock.Type)
+		}
+		diagnostics = append(diagnostics, TerraformDiagnostic{Severity: "error", Summary: "Unsupported block type", Detail: detail, File: br.Filename, Line: br.Start.Line})
+	}
+
+	names := make([]string, 0, len(block.Body.Attributes))
+	for name := range block.Body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	setAttributes := map[string]bool{}
+	for _, name := range names {
+		setAttributes[name] = true
+		if terraformMetaArguments[name] {
+			continue
+		}
+		diagnostics = append(diagnostics, validateAttribute(address, name, block.Body.Attributes[name].Expr, schema)...)
+	}
+
+	diagnostics = append(diagnostics, missingRequiredAttributes(address, setAttributes, schema, r)...)
+
+	return diagnostics
+}
+
+func validateAttribute(path, name string, expr hclsyntax.Expression, schema schemaBlock) []TerraformDiagnostic {
+	r := expr.Range()
+	attribute, ok := schema.Attributes[name]
+	if !ok {
+		return []TerraformDiagnostic{{
+			Severity: "error",
+			Summary:  "Unsupported argument",
+			Detail:   fmt.Sprintf("an argument named %q is not expected in %s", name, path),
+			File:     r.Filename,
+			Line:     r.Start.Line,
+		}}
+	}
+	if attribute.Computed {
+		return []TerraformDiagnostic{{
+			Severity: "error",
+			Summary:  "Invalid configuration for read-only attribute",
+			Detail:   fmt.Sprintf("%s.%s is computed by the provider and cannot be set", path, name),
+			File:     r.Filename,
+			Line:     r.Start.Line,
+		}}
+	}
+	if attribute.Open || attribute.Nested == nil {
+		return nil
+	}
+
+	// only literal objects are validated, expressions (E.g var references, for expressions) are checked by terraform validate
+	path = fmt.Sprintf("%s.%s", path, name)
+	var diagnostics []TerraformDiagnostic
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		diagnostics = append(diagnostics, validateNestedObject(path, e, *attribute.Nested)...)
+	case *hclsyntax.TupleConsExpr:
+		for _, item := range e.Exprs {
+			if object, ok := item.(*hclsyntax.ObjectConsExpr); ok {
+				diagnostics = append(diagnostics, validateNestedObject(path, object, *attribute.Nested)...)
+			}
+		}
+	}
+	return diagnostics
+}
+
+func validateNestedObject(path string, object *hclsyntax.ObjectConsExpr, schema schemaBlock) []TerraformDiagnostic {
+	var diagnostics []TerraformDiagnostic
+	setAttributes := map[string]bool{}
+
+	for _, item := range object.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || !key.Type().Equals(cty.String) || key.IsNull() {
+			continue
+		}
+		name := key.AsString()
+		setAttributes[name] = true
+		diagnostics = append(diagnostics, validateAttribute(path, name, item.ValueExpr, schema)...)
+	}
+
+	return append(diagnostics, missingRequiredAttributes(path, setAttributes, schema, object.Range())...)
+}
+
+func missingRequiredAttributes(path string, setAttributes map[string]bool, schema schemaBlock, r hcl.Range) []TerraformDiagnostic {
+	var missing []string
+	for name, attribute := range schema.Attributes {
+		if attribute.Required && !setAttributes[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	var diagnostics []TerraformDiagnostic
+	for _, name := range missing {
+		diagnostics = append(diagnostics, TerraformDiagnostic{
+			Severity: "error",
+			Summary:  "Missing required argument",
+			Detail:   fmt.Sprintf("the argument %q is required in %s, but no definition was found", name, path),
+			File:     r.Filename,
+			Line:     r.Start.Line,
+		})
+	}
+	return diagnostics
+}
+
+// collectVariableReferences records the first reference of each variable
+func collectVariableReferences(body *hclsyntax.Body, used map[string]hcl.Range) {
+	for _, attribute := range body.Attributes {
+		collectVariableReferencesInExpr(attribute.Expr, used)
+	}
+	for _, block := range body.Blocks {
+		collectVariableReferences(block.Body, used)
+	}
+}
+
+func collectVariableReferencesInExpr(expr hclsyntax.Expression, used map[string]hcl.Range) {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "var" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			if _, ok := used[attr.Name]; !ok {
+				used[attr.Name] = traversal.SourceRange()
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+	"github.com/stretchr/testify/assert"
+)
+
+func diagnosticSummaries(diagnostics []TerraformDiagnostic) []string {
+	var summaries []string
+	for _, diagnostic := range diagnostics {
+		summaries = append(summaries, diagnostic.Summary)
+	}
+	return summaries
+}
+
+func TestValidateTerraformHCL(t *testing.T) {
+	mainTf := `terraform {
+  required_providers {
+    qovery = {
+      source = "qovery/qovery"
+    }
+  }
+}
+
+provider "qovery" {
+  token = var.qovery_access_token
+}
+
+resource "qovery_application" "web" {
+  environment_id = var.environment_id
+  name           = "web"
+  build_mode     = "DOCKER"
+  git_repository = {
+    url    = var.git_url
+    branch = "main"
+  }
+  ports = [{
+    internal_port       = 8080
+    publicly_accessible = true
+  }]
+  secrets = [{
+    key   = "DATABASE_URL"
+    value = var.database_url
+  }]
+}
+`
+	variablesTf := `variable "qovery_access_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "environment_id" {
+  type = string
+}
+
+variable "git_url" {
+  type = string
+}
+
+variable "database_url" {
+  type = string
+}
+`
+
+	diagnostics, err := validateTerraformHCL(map[string]string{"main.tf": mainTf, "variables.tf": variablesTf})
+	assert.NoError(t, err)
+	assert.Empty(t, diagnostics)
+
+	invalidMainTf := `resource "qovery_application" "web" {
+  environment_id = var.env_id
+  name           = "web"
+  internal_host  = "web.internal"
+  git_repository {
+    url = var.git_url
+  }
+  ports = [{
+    port = 8080
+  }]
+}
+
+resource "qovery_app" "worker" {
+  name = "worker"
+}
+`
+	diagnostics, err = validateTerraformHCL(map[string]string{"main.tf": invalidMainTf, "variables.tf": variablesTf})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"Unsupported block type",
+		"Invalid configuration for read-only attribute",
+		"Unsupported argument",
+		"Missing required argument",
+		"Missing required argument",
+		"Invalid resource type",
+		"Reference to undeclared input variable",
+		"Unused input variable",
+		"Unused input variable",
+		"Unused input variable",
+	}, diagnosticSummaries(diagnostics))
+	assert.True(t, hasErrorDiagnostics(diagnostics))
+
+	diagnostics, err = validateTerraformHCL(map[string]string{"main.tf": "resource \"qovery_application\" \"web\" {\n  name = \n}\n"})
+	assert.NoError(t, err)
+	assert.True(t, hasErrorDiagnostics(diagnostics))
+	assert.Equal(t, "main.tf", diagnostics[0].File)
+}
+
+func TestEmbeddedKnowledgeBundleExamplesAreValid(t *testing.T) {
+	bundle, err := kb.Embedded()
+	assert.NoError(t, err)
+
+	for _, example := range bundle.Examples {
+		diagnostics, err := validateTerraformHCL(map[string]string{"main.tf": example.Content})
+		assert.NoError(t, err)
+		assert.Empty(t, diagnostics, example.Name)
+	}
+}
@@ -0,0 +1,70 @@
+package migration
+
+import "fmt"
+
+// validationGate validates the files of an app and returns the diagnostics of the first failing gate, with its output
+// when it isn't structured, E.g the output of terraform init
+type validationGate func(files map[string]string) (TerraformValidationIteration, string, error)
+
+// validationFixer asks the LLM to correct the files for the diagnostics of a failed gate, and returns the new files
+type validationFixer func(files map[string]string, iteration TerraformValidationIteration, gateOutput string) (map[string]string, error)
+
+// validationResult is the outcome of a validation loop
+type validationResult struct {
+	Files map[string]string
+	// Diagnostics are the diagnostics of the returned files: warnings if they are valid, errors otherwise
+	Diagnostics []TerraformDiagnostic
+	Iterations  []TerraformValidationIteration
+}
+
+// runValidationLoop runs the gate on the files and the fixer on its errors until the files are valid, up to
+// maxValidationIterations. It stops early when the last fix made the files worse. On error, the best version of the
+// files found so far is returned along with its diagnostics. subject names the files in the errors, E.g Pulumi program.
+func runValidationLoop(files map[string]string, subject string, gate validationGate, fix validationFixer) (validationResult, error) {
+	var best validationResult
+	var bestIteration TerraformValidationIteration
+	var iterations []TerraformValidationIteration
+
+	for i := 0; i < maxValidationIterations; i++ {
+		fmt.Printf("Iteration %d:\n", i+1)
+
+		iteration, gateOutput, err := gate(files)
+		if err != nil {
+			return best, err
+		}
+		iterations = append(iterations, iteration)
+
+		if iteration.ErrorCount() == 0 {
+			return validationResult{Files: copyFiles(files), Diagnostics: iteration.Diagnostics, Iterations: iterations}, nil
+		}
+
+		fmt.Printf("%s failed with %d error(s):\n%s\n", iteration.Gate, iteration.ErrorCount(), formatTerraformDiagnostics(iteration.Diagnostics))
+
+		// the previous version is kept
+		if i > 0 && iteration.worseThan(bestIteration) {
+			best.Iterations = iterations
+			return best, fmt.Errorf("stopped at iteration %d: the last fix made the %s worse (%s with %d error(s), was %s with %d error(s))",
+				i+1, subject, iteration.Gate, iteration.ErrorCount(), bestIteration.Gate, bestIteration.ErrorCount())
+		}
+
+		bestIteration = iteration
+		best = validationResult{Files: copyFiles(files), Diagnostics: iteration.Diagnostics, Iterations: iterations}
+
+		files, err = fix(files, iteration, gateOutput)
+		if err != nil {
+			return best, err
+		}
+		fmt.Println("Applied validation corrections from Bedrock. Retrying...")
+	}
+
+	best.Iterations = iterations
+	return best, fmt.Errorf("exceeded maximum iterations (%d) without achieving a valid %s", maxValidationIterations, subject)
+}
+
+func copyFiles(files map[string]string) map[string]string {
+	copied := make(map[string]string, len(files))
+	for name, content := range files {
+		copied[name] = content
+	}
+	return copied
+}
@@ -0,0 +1,617 @@
+package qovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultDatabaseVersions are the versions of the databases created without a version
+var defaultDatabaseVersions = map[string]string{
+	"POSTGRESQL": "16",
+	"MYSQL":      "8.0",
+	"MONGODB":    "7.0",
+	"REDIS":      "7",
+}
+
+// Plan is the Qovery target of the migrated applications, written to plan.json and created by "apply"
+type Plan struct {
+	// OrganizationID is the organization to create the resources in, the first organization of the API key if empty
+	OrganizationID string `json:"organization_id,omitempty"`
+	// ProjectName is the project of the environments, created if it doesn't exist
+	ProjectName string `json:"project_name"`
+	// ClusterID is the cluster the new environments are deployed on
+	ClusterID string `json:"cluster_id,omitempty"`
+	// ContainerRegistryID is the registry of the container images, required if the plan has containers
+	ContainerRegistryID string        `json:"container_registry_id,omitempty"`
+	Environments        []Environment `json:"environments"`
+}
+
+// LoadPlan reads and validates a plan file
+func LoadPlan(path string) (Plan, error) {
+	var plan Plan
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return plan, fmt.Errorf("error reading the plan: %w", err)
+	}
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return plan, fmt.Errorf("error decoding the plan %s: %w", path, err)
+	}
+	return plan, plan.Validate()
+}
+
+// SecretPlaceholder is the value of the secrets in plan.json, the plan can be shared without the values of the source.
+// "apply" reads the values from a secrets file or from the environment.
+const SecretPlaceholder = "REPLACE_ME"
+
+// PlanSecrets are the values of the secrets of a plan by service, E.g my-env/my-app, and by key. They are written to a
+// file kept out of the output directory.
+type PlanSecrets map[string]map[string]string
+
+// LoadPlanSecrets reads a secrets file written by "prepare"
+func LoadPlanSecrets(path string) (PlanSecrets, error) {
+	secrets := PlanSecrets{}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the secrets: %w", err)
+	}
+	if err := json.Unmarshal(content, &secrets); err != nil {
+		return nil, fmt.Errorf("error decoding the secrets %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// WithoutSecrets returns a copy of the plan with the values of the secrets replaced by SecretPlaceholder, and the
+// values it replaced
+func (p Plan) WithoutSecrets() (Plan, PlanSecrets) {
+	secrets := PlanSecrets{}
+	redact := func(envName, serviceName string, values []Secret) []Secret {
+		if len(values) == 0 {
+			return values
+		}
+		redacted := make([]Secret, len(values))
+		for i, secret := range values {
+			service := envName + "/" + serviceName
+			if secrets[service] == nil {
+				secrets[service] = map[string]string{}
+			}
+			secrets[service][secret.Key] = secret.Value
+			redacted[i] = Secret{Key: secret.Key, Value: SecretPlaceholder}
+		}
+		return redacted
+	}
+
+	environments := make([]Environment, len(p.Environments))
+	for i, env := range p.Environments {
+		env.Applications = append([]Application(nil), env.Applications...)
+		for j := range env.Applications {
+			env.Applications[j].Secrets = redact(env.Name, env.Applications[j].Name, env.Applications[j].Secrets)
+		}
+		env.Containers = append([]Container(nil), env.Containers...)
+		for j := range env.Containers {
+			env.Containers[j].Secrets = redact(env.Name, env.Containers[j].Name, env.Containers[j].Secrets)
+		}
+		environments[i] = env
+	}
+	p.Environments = environments
+	return p, secrets
+}
+
+// SetSecrets replaces the placeholders of the secrets with their values, from secrets or else from the environment
+// variable of the same key. It returns an error listing the secrets without a value.
+func (p *Plan) SetSecrets(secrets PlanSecrets, lookupEnv func(string) (string, bool)) error {
+	var missing []string
+	resolve := func(envName, serviceName string, values []Secret) {
+		for i, secret := range values {
+			if secret.Value != SecretPlaceholder {
+				continue
+			}
+			service := envName + "/" + serviceName
+			if value, ok := secrets[service][secret.Key]; ok {
+				values[i].Value = value
+			} else if value, ok := lookupEnv(secret.Key); ok {
+				values[i].Value = value
+			} else {
+				missing = append(missing, service+"/"+secret.Key)
+			}
+		}
+	}
+
+	for _, env := range p.Environments {
+		for _, application := range env.Applications {
+			resolve(env.Name, application.Name, application.Secrets)
+		}
+		for _, container := range env.Containers {
+			resolve(env.Name, container.Name, container.Secrets)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the value of %d secret(s) is not set, pass the secrets file written by \"prepare\" or set them in the environment: %s", len(missing), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Validate checks the plan has everything required to create the resources, E.g the Git repository of the applications
+func (p Plan) Validate() error {
+	var problems []string
+	if p.ProjectName == "" {
+		problems = append(problems, "project_name is required")
+	}
+
+	environments := map[string]bool{}
+	for _, env := range p.Environments {
+		if env.Name == "" {
+			problems = append(problems, "an environment has no name")
+			continue
+		}
+		if environments[env.Name] {
+			problems = append(problems, fmt.Sprintf("the environment %s is declared twice", env.Name))
+		}
+		environments[env.Name] = true
+
+		applications := map[string]bool{}
+		for _, application := range env.Applications {
+			applications[application.Name] = true
+			if application.GitRepository.URL == "" {
+				problems = append(problems, fmt.Sprintf("the application %s of %s has no git_repository.url", application.Name, env.Name))
+			}
+		}
+		for _, job := range env.Jobs {
+			if !applications[job.Application] {
+				problems = append(problems, fmt.Sprintf("the job %s of %s is built from the unknown application %s", job.Name, env.Name, job.Application))
+			}
+		}
+		if len(env.Containers) > 0 && p.ContainerRegistryID == "" {
+			problems = append(problems, fmt.Sprintf("container_registry_id is required for the containers of %s", env.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid plan: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Action is a change made, or to be made in dry-run, by Applier
+type Action struct {
+	// Verb is create, update or unchanged
+	Verb string
+	// Kind is the kind of the resource, E.g application or secret
+	Kind string
+	// Name is the path of the resource, E.g my-env/my-app/DATABASE_URL
+	Name string
+}
+
+func (a Action) String() string {
+	return fmt.Sprintf("%s %s %s", a.Verb, a.Kind, a.Name)
+}
+
+// ApplyResult is the outcome of a plan
+type ApplyResult struct {
+	Actions []Action
+	// Warnings are the parts of the plan which could not be applied, E.g a database alias without the built-in variable
+	Warnings []string
+}
+
+// Applier creates the resources of a plan with the Qovery API. It is idempotent: the existing resources are looked up
+// by name and updated. The dependencies are created first: project, environments, databases, applications and jobs.
+type Applier struct {
+	Client *Client
+	// DryRun only lists the actions, nothing is created or updated
+	DryRun bool
+}
+
+// Apply creates or updates the resources of the plan
+func (a *Applier) Apply(ctx context.Context, plan Plan) (*ApplyResult, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	result := &ApplyResult{}
+
+	organizationID := plan.OrganizationID
+	if organizationID == "" {
+		organizations, err := a.Client.ListOrganizations(ctx)
+		if err != nil {
+			return result, fmt.Errorf("error listing the Qovery organizations: %w", err)
+		}
+		if len(organizations) == 0 {
+			return result, fmt.Errorf("the Qovery API key has no access to any organization")
+		}
+		organizationID = organizations[0].ID
+	}
+
+	projects, err := a.Client.ListProjects(ctx, organizationID)
+	if err != nil {
+		return result, fmt.Errorf("error listing the Qovery projects: %w", err)
+	}
+	projectID := ""
+	for _, project := range projects {
+		if project.Name == plan.ProjectName {
+			projectID = project.ID
+		}
+	}
+	if projectID == "" {
+		result.record("create", "project", plan.ProjectName)
+		if !a.DryRun {
+			project, err := a.Client.CreateProject(ctx, organizationID, plan.ProjectName)
+			if err != nil {
+				return result, fmt.Errorf("error creating the project %s: %w", plan.ProjectName, err)
+			}
+			projectID = project.ID
+		}
+	} else {
+		result.record("unchanged", "project", plan.ProjectName)
+	}
+
+	for _, env := range plan.Environments {
+		if err := a.applyEnvironment(ctx, plan, projectID, env, result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (a *Applier) applyEnvironment(ctx context.Context, plan Plan, projectID string, env Environment, result *ApplyResult) error {
+	environmentID := ""
+	if projectID != "" {
+		environments, err := a.Client.ListEnvironments(ctx, projectID)
+		if err != nil {
+			return fmt.Errorf("error listing the environments of %s: %w", plan.ProjectName, err)
+		}
+		for _, environment := range environments {
+			if environment.Name == env.Name {
+				environmentID = environment.ID
+			}
+		}
+	}
+	if environmentID == "" {
+		if plan.ClusterID == "" {
+			return fmt.Errorf("cluster_id is required to create the environment %s", env.Name)
+		}
+		result.record("create", "environment", env.Name)
+		if !a.DryRun {
+			environment, err := a.Client.CreateEnvironment(ctx, projectID, env.Name, plan.ClusterID, env.Mode)
+			if err != nil {
+				return fmt.Errorf("error creating the environment %s: %w", env.Name, err)
+			}
+			environmentID = environment.ID
+		}
+	} else {
+		result.record("unchanged", "environment", env.Name)
+	}
+
+	for _, database := range env.Databases {
+		if _, err := a.applyService(ctx, environmentID, ServiceDatabase, env.Name, database.Name, databaseRequest(database), result); err != nil {
+			return err
+		}
+	}
+
+	for _, container := range env.Containers {
+		containerID, err := a.applyService(ctx, environmentID, ServiceContainer, env.Name, container.Name, containerRequest(container, plan.ContainerRegistryID), result)
+		if err != nil {
+			return err
+		}
+		name := env.Name + "/" + container.Name
+		if err := a.applyVariables(ctx, ServiceContainer, containerID, name, container.EnvironmentVariables, container.Secrets, env.Databases, result); err != nil {
+			return err
+		}
+	}
+
+	applications := map[string]Application{}
+	for _, application := range env.Applications {
+		applications[application.Name] = application
+		applicationID, err := a.applyService(ctx, environmentID, ServiceApplication, env.Name, application.Name, applicationRequest(application), result)
+		if err != nil {
+			return err
+		}
+		name := env.Name + "/" + application.Name
+		if err := a.applyVariables(ctx, ServiceApplication, applicationID, name, application.EnvironmentVariables, application.Secrets, env.Databases, result); err != nil {
+			return err
+		}
+		if err := a.applyCustomDomains(ctx, applicationID, name, application.CustomDomains, result); err != nil {
+			return err
+		}
+	}
+
+	for _, job := range env.Jobs {
+		// a job runs the code of its application, with the same variables
+		application := applications[job.Application]
+		jobID, err := a.applyService(ctx, environmentID, ServiceJob, env.Name, job.Name, jobRequest(job, application), result)
+		if err != nil {
+			return err
+		}
+		name := env.Name + "/" + job.Name
+		if err := a.applyVariables(ctx, ServiceJob, jobID, name, application.EnvironmentVariables, application.Secrets, env.Databases, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyService creates the service, or updates it if a service of the environment has the same name, and returns its ID.
+// The ID is empty in dry-run for a new service.
+func (a *Applier) applyService(ctx context.Context, environmentID, kind, environmentName, name string, request interface{}, result *ApplyResult) (string, error) {
+	serviceID := ""
+	if environmentID != "" {
+		services, err := a.Client.ListServices(ctx, environmentID, kind)
+		if err != nil {
+			return "", fmt.Errorf("error listing the %ss of %s: %w", kind, environmentName, err)
+		}
+		for _, service := range services {
+			if service.Name == name {
+				serviceID = service.ID
+			}
+		}
+	}
+
+	path := environmentName + "/" + name
+	if serviceID == "" {
+		result.record("create", kind, path)
+		if a.DryRun {
+			return "", nil
+		}
+		service, err := a.Client.CreateService(ctx, environmentID, kind, request)
+		if err != nil {
+			return "", fmt.Errorf("error creating the %s %s: %w", kind, path, err)
+		}
+		return service.ID, nil
+	}
+
+	result.record("update", kind, path)
+	if !a.DryRun {
+		if err := a.Client.UpdateService(ctx, kind, serviceID, request); err != nil {
+			return "", fmt.Errorf("error updating the %s %s: %w", kind, path, err)
+		}
+	}
+	return serviceID, nil
+}
+
+// applyVariables sets the environment variables and the secrets of a service, and aliases the built-in variables of
+// the databases with their connection variables, E.g DATABASE_URL
+func (a *Applier) applyVariables(ctx context.Context, kind, serviceID, name string, variables []EnvironmentVariable, secrets []Secret,
+	databases []Database, result *ApplyResult) error {
+
+	var existingVariables, existingSecrets []Variable
+	if serviceID != "" {
+		var err error
+		existingVariables, err = a.Client.ListVariables(ctx, kind, serviceID, false)
+		if err != nil {
+			return fmt.Errorf("error listing the environment variables of %s: %w", name, err)
+		}
+		existingSecrets, err = a.Client.ListVariables(ctx, kind, serviceID, true)
+		if err != nil {
+			return fmt.Errorf("error listing the secrets of %s: %w", name, err)
+		}
+	}
+	scope := strings.ToUpper(kind)
+
+	for _, variable := range variables {
+		existing, ok := findVariable(existingVariables, variable.Key, scope)
+		switch {
+		case !ok:
+			result.record("create", "environment variable", name+"/"+variable.Key)
+			if !a.DryRun {
+				if err := a.Client.CreateVariable(ctx, kind, serviceID, false, variable.Key, variable.Value); err != nil {
+					return fmt.Errorf("error creating the environment variable %s of %s: %w", variable.Key, name, err)
+				}
+			}
+		case existing.Value == variable.Value:
+			result.record("unchanged", "environment variable", name+"/"+variable.Key)
+		default:
+			result.record("update", "environment variable", name+"/"+variable.Key)
+			if !a.DryRun {
+				if err := a.Client.UpdateVariable(ctx, kind, serviceID, false, existing.ID, variable.Key, variable.Value); err != nil {
+					return fmt.Errorf("error updating the environment variable %s of %s: %w", variable.Key, name, err)
+				}
+			}
+		}
+	}
+
+	// the values of the secrets can't be read, the existing ones are always updated
+	for _, secret := range secrets {
+		existing, ok := findVariable(existingSecrets, secret.Key, scope)
+		if !ok {
+			result.record("create", "secret", name+"/"+secret.Key)
+			if !a.DryRun {
+				if err := a.Client.CreateVariable(ctx, kind, serviceID, true, secret.Key, secret.Value); err != nil {
+					return fmt.Errorf("error creating the secret %s of %s: %w", secret.Key, name, err)
+				}
+			}
+			continue
+		}
+		result.record("update", "secret", name+"/"+secret.Key)
+		if !a.DryRun {
+			if err := a.Client.UpdateVariable(ctx, kind, serviceID, true, existing.ID, secret.Key, secret.Value); err != nil {
+				return fmt.Errorf("error updating the secret %s of %s: %w", secret.Key, name, err)
+			}
+		}
+	}
+
+	for _, database := range databases {
+		for _, key := range database.ConnectionVariables {
+			if _, ok := findVariable(existingVariables, key, scope); ok {
+				result.record("unchanged", "alias", name+"/"+key)
+				continue
+			}
+			if a.DryRun {
+				result.record("create", "alias", name+"/"+key)
+				continue
+			}
+			builtIn, ok := databaseURLVariable(existingVariables, database.Name)
+			if !ok {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("the connection URI of the database %s was not found, create the alias %s of %s from the console", database.Name, key, name))
+				continue
+			}
+			result.record("create", "alias", name+"/"+key)
+			if err := a.Client.CreateAlias(ctx, kind, serviceID, builtIn.ID, key); err != nil {
+				return fmt.Errorf("error creating the alias %s of %s: %w", key, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Applier) applyCustomDomains(ctx context.Context, applicationID, name string, customDomains []CustomDomain, result *ApplyResult) error {
+	var existing []string
+	if applicationID != "" {
+		var err error
+		existing, err = a.Client.ListCustomDomains(ctx, applicationID)
+		if err != nil {
+			return fmt.Errorf("error listing the custom domains of %s: %w", name, err)
+		}
+	}
+
+	for _, customDomain := range customDomains {
+		if containsString(existing, customDomain.Domain) {
+			result.record("unchanged", "custom domain", name+"/"+customDomain.Domain)
+			continue
+		}
+		result.record("create", "custom domain", name+"/"+customDomain.Domain)
+		if !a.DryRun {
+			if err := a.Client.CreateCustomDomain(ctx, applicationID, customDomain.Domain); err != nil {
+				return fmt.Errorf("error creating the custom domain %s of %s: %w", customDomain.Domain, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *ApplyResult) record(verb, kind, name string) {
+	r.Actions = append(r.Actions, Action{Verb: verb, Kind: kind, Name: name})
+}
+
+// findVariable returns the variable of the key declared on the service itself, the inherited ones are ignored
+func findVariable(variables []Variable, key, scope string) (Variable, bool) {
+	for _, variable := range variables {
+		if variable.Key == key && variable.Scope == scope {
+			return variable, true
+		}
+	}
+	return Variable{}, false
+}
+
+// databaseURLVariable returns the built-in variable of the internal connection URI of a database,
+// E.g QOVERY_POSTGRESQL_Z1234_DATABASE_URL_INTERNAL
+func databaseURLVariable(variables []Variable, databaseName string) (Variable, bool) {
+	for _, variable := range variables {
+		if variable.VariableType == "BUILT_IN" && variable.ServiceName == databaseName && strings.HasSuffix(variable.Key, "_DATABASE_URL_INTERNAL") {
+			return variable, true
+		}
+	}
+	return Variable{}, false
+}
+
+func databaseRequest(database Database) map[string]interface{} {
+	version := database.Version
+	if version == "" {
+		version = defaultDatabaseVersions[database.Type]
+	}
+	return map[string]interface{}{
+		"name":          database.Name,
+		"type":          database.Type,
+		"version":       version,
+		"mode":          database.Mode,
+		"accessibility": "PRIVATE",
+	}
+}
+
+func applicationRequest(application Application) map[string]interface{} {
+	request := map[string]interface{}{
+		"name":                  application.Name,
+		"build_mode":            "DOCKER",
+		"dockerfile_path":       application.DockerfilePath,
+		"git_repository":        application.GitRepository,
+		"cpu":                   application.Resources.CPU,
+		"memory":                application.Resources.Memory,
+		"min_running_instances": application.Resources.MinRunningInstances,
+		"max_running_instances": application.Resources.MaxRunningInstances,
+		"arguments":             nonNil(application.Arguments),
+		"ports":                 nonNilPorts(application.Ports),
+	}
+	if application.Healthcheck != nil {
+		request["healthchecks"] = healthchecksRequest(*application.Healthcheck)
+	}
+	return request
+}
+
+func containerRequest(container Container, registryID string) map[string]interface{} {
+	request := map[string]interface{}{
+		"name":                  container.Name,
+		"registry_id":           registryID,
+		"image_name":            container.ImageName,
+		"tag":                   container.Tag,
+		"cpu":                   container.Resources.CPU,
+		"memory":                container.Resources.Memory,
+		"min_running_instances": container.Resources.MinRunningInstances,
+		"max_running_instances": container.Resources.MaxRunningInstances,
+		"arguments":             nonNil(container.Arguments),
+		"ports":                 nonNilPorts(container.Ports),
+	}
+	if container.Healthcheck != nil {
+		request["healthchecks"] = healthchecksRequest(*container.Healthcheck)
+	}
+	return request
+}
+
+func jobRequest(job Job, application Application) map[string]interface{} {
+	schedule := map[string]interface{}{}
+	if job.OnStart {
+		schedule["on_start"] = map[string]interface{}{"arguments": nonNil(job.Arguments)}
+	} else {
+		schedule["cronjob"] = map[string]interface{}{"scheduled_at": job.Schedule, "arguments": nonNil(job.Arguments)}
+	}
+	return map[string]interface{}{
+		"name":   job.Name,
+		"cpu":    job.Resources.CPU,
+		"memory": job.Resources.Memory,
+		"source": map[string]interface{}{
+			"docker": map[string]interface{}{
+				"git_repository":  application.GitRepository,
+				"dockerfile_path": application.DockerfilePath,
+			},
+		},
+		"schedule": schedule,
+	}
+}
+
+// healthchecksRequest returns the readiness and liveness probes of a healthcheck
+func healthchecksRequest(healthcheck Healthcheck) map[string]interface{} {
+	probeType := map[string]interface{}{"tcp": map[string]interface{}{"port": healthcheck.Port}}
+	if healthcheck.Type == "HTTP" {
+		probeType = map[string]interface{}{"http": map[string]interface{}{"port": healthcheck.Port, "path": healthcheck.Path, "scheme": "HTTP"}}
+	}
+	probe := map[string]interface{}{
+		"type":                  probeType,
+		"initial_delay_seconds": 30,
+		"period_seconds":        10,
+		"timeout_seconds":       5,
+		"success_threshold":     1,
+		"failure_threshold":     3,
+	}
+	return map[string]interface{}{"readiness_probe": probe, "liveness_probe": probe}
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func nonNilPorts(ports []Port) []Port {
+	if ports == nil {
+		return []Port{}
+	}
+	return ports
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package qovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAPI is an in-memory Qovery API: the resources are created in collections by path, E.g /environment/env-1/database,
+// and updated by ID. The applications and jobs get the built-in variables of the databases of their environment.
+type stubAPI struct {
+	mu          sync.Mutex
+	collections map[string][]map[string]interface{}
+	nextID      int
+	writes      []string
+}
+
+func newStubAPI(t *testing.T) (*stubAPI, *Client) {
+	stub := &stubAPI{collections: map[string][]map[string]interface{}{
+		"/organization":               {{"id": "org-1", "name": "Acme"}},
+		"/organization/org-1/project": {},
+	}}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	client := NewClient("fake-api-key")
+	client.BaseURL = server.URL
+	return stub, client
+}
+
+func (s *stubAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	var body map[string]interface{}
+	if r.Method != http.MethodGet {
+		s.writes = append(s.writes, r.Method+" "+path)
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": s.collections[path]})
+	case http.MethodPost:
+		if strings.HasSuffix(path, "/alias") {
+			// /application/{id}/environmentVariable/{variableID}/alias
+			parts := strings.Split(path, "/")
+			path = strings.Join(parts[:len(parts)-2], "/")
+			body["value"] = ""
+			body["variable_type"] = "ALIAS"
+		}
+		s.nextID++
+		body["id"] = fmt.Sprintf("id-%d", s.nextID)
+		parts := strings.Split(path, "/")
+		if kind := parts[len(parts)-1]; kind == "environmentVariable" || kind == "secret" {
+			body["scope"] = strings.ToUpper(parts[1])
+		}
+		s.collections[path] = append(s.collections[path], body)
+		s.addBuiltInVariables(path, body)
+		_ = json.NewEncoder(w).Encode(body)
+	case http.MethodPut:
+		id := path[strings.LastIndex(path, "/")+1:]
+		for _, items := range s.collections {
+			for _, item := range items {
+				if item["id"] == id {
+					for k, v := range body {
+						item[k] = v
+					}
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+func (s *stubAPI) addBuiltInVariables(path string, service map[string]interface{}) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 4 || parts[1] != "environment" || (parts[3] != ServiceApplication && parts[3] != ServiceJob) {
+		return
+	}
+	for _, database := range s.collections[fmt.Sprintf("/environment/%s/database", parts[2])] {
+		variablesPath := fmt.Sprintf("/%s/%s/environmentVariable", parts[3], service["id"])
+		s.collections[variablesPath] = append(s.collections[variablesPath], map[string]interface{}{
+			"id":            "builtin-" + database["id"].(string),
+			"key":           fmt.Sprintf("QOVERY_POSTGRESQL_Z%s_DATABASE_URL_INTERNAL", database["id"]),
+			"value":         "postgresql://internal",
+			"scope":         "BUILT_IN",
+			"variable_type": "BUILT_IN",
+			"service_name":  database["name"],
+		})
+	}
+}
+
+func (s *stubAPI) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.collections[path])
+}
+
+func testPlan() Plan {
+	application := publicApplication("my-app", defaultResources)
+	application.GitRepository.URL = "https://github.com/acme/my-app.git"
+	application.EnvironmentVariables = []EnvironmentVariable{{Key: "RAILS_ENV", Value: "production"}}
+	application.Secrets = []Secret{{Key: "STRIPE_API_KEY", Value: "sk_live_123"}}
+	application.CustomDomains = []CustomDomain{{Domain: "www.example.com"}}
+
+	return Plan{
+		ProjectName: "Migration",
+		ClusterID:   "cluster-1",
+		Environments: []Environment{{
+			Name:         "my-app",
+			Mode:         "PRODUCTION",
+			Applications: []Application{application},
+			Databases:    []Database{{Name: "postgresql", Type: "POSTGRESQL", Mode: "MANAGED", ConnectionVariables: []string{"DATABASE_URL"}}},
+			Jobs:         []Job{{Name: "my-app-release", Application: "my-app", Arguments: []string{"sh", "-c", "rake db:migrate"}, OnStart: true, Resources: defaultResources}},
+		}},
+	}
+}
+
+func actionsByVerb(result *ApplyResult) map[string][]string {
+	actions := map[string][]string{}
+	for _, action := range result.Actions {
+		actions[action.Verb] = append(actions[action.Verb], action.Kind+" "+action.Name)
+	}
+	return actions
+}
+
+func TestApplierApply(t *testing.T) {
+	stub, client := newStubAPI(t)
+	applier := &Applier{Client: client}
+
+	result, err := applier.Apply(context.Background(), testPlan())
+	require.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+	assert.Equal(t, []string{
+		"project Migration",
+		"environment my-app",
+		"database my-app/postgresql",
+		"application my-app/my-app",
+		"environment variable my-app/my-app/RAILS_ENV",
+		"secret my-app/my-app/STRIPE_API_KEY",
+		"alias my-app/my-app/DATABASE_URL",
+		"custom domain my-app/my-app/www.example.com",
+		"job my-app/my-app-release",
+		"environment variable my-app/my-app-release/RAILS_ENV",
+		"secret my-app/my-app-release/STRIPE_API_KEY",
+		"alias my-app/my-app-release/DATABASE_URL",
+	}, actionsByVerb(result)["create"])
+
+	// the second run finds the resources by name and updates them
+	writes := len(stub.writes)
+	result, err = applier.Apply(context.Background(), testPlan())
+	require.NoError(t, err)
+	actions := actionsByVerb(result)
+	assert.Empty(t, actions["create"])
+	assert.Contains(t, actions["update"], "application my-app/my-app")
+	assert.Contains(t, actions["update"], "secret my-app/my-app/STRIPE_API_KEY")
+	assert.Contains(t, actions["unchanged"], "environment variable my-app/my-app/RAILS_ENV")
+	assert.Contains(t, actions["unchanged"], "alias my-app/my-app/DATABASE_URL")
+	for _, write := range stub.writes[writes:] {
+		assert.True(t, strings.HasPrefix(write, "PUT "), write)
+	}
+	assert.Equal(t, 1, stub.count("/organization/org-1/project"))
+	assert.Equal(t, 1, stub.count("/environment/id-2/application"))
+}
+
+func TestApplierDryRun(t *testing.T) {
+	stub, client := newStubAPI(t)
+	applier := &Applier{Client: client, DryRun: true}
+
+	result, err := applier.Apply(context.Background(), testPlan())
+	require.NoError(t, err)
+	assert.Len(t, actionsByVerb(result)["create"], 12)
+	assert.Empty(t, stub.writes)
+}
+
+func TestLoadPlan(t *testing.T) {
+	plan := testPlan()
+	plan.Environments[0].Applications[0].GitRepository.URL = ""
+	plan.Environments[0].Jobs[0].Application = "unknown"
+	content, err := json.Marshal(plan)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, os.WriteFile(path, content, 0644))
+
+	_, err = LoadPlan(path)
+	assert.ErrorContains(t, err, "the application my-app of my-app has no git_repository.url")
+	assert.ErrorContains(t, err, "the job my-app-release of my-app is built from the unknown application unknown")
+
+	content, err = json.Marshal(testPlan())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	loaded, err := LoadPlan(path)
+	require.NoError(t, err)
+	assert.Equal(t, testPlan(), loaded)
+}
+
+func TestPlanSecrets(t *testing.T) {
+	plan := testPlan()
+	plan.Environments[0].Containers = []Container{{Name: "worker", Secrets: []Secret{{Key: "STRIPE_API_KEY", Value: "sk_live_456"}, {Key: "SENTRY_DSN", Value: "https://sentry"}}}}
+
+	redacted, secrets := plan.WithoutSecrets()
+	assert.Equal(t, []Secret{{Key: "STRIPE_API_KEY", Value: SecretPlaceholder}}, redacted.Environments[0].Applications[0].Secrets)
+	assert.Equal(t, SecretPlaceholder, redacted.Environments[0].Containers[0].Secrets[1].Value)
+	assert.Equal(t, "sk_live_123", plan.Environments[0].Applications[0].Secrets[0].Value, "the plan is not modified")
+	assert.Equal(t, PlanSecrets{
+		"my-app/my-app": {"STRIPE_API_KEY": "sk_live_123"},
+		"my-app/worker": {"STRIPE_API_KEY": "sk_live_456", "SENTRY_DSN": "https://sentry"},
+	}, secrets)
+
+	content, err := json.Marshal(secrets)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	loaded, err := LoadPlanSecrets(path)
+	require.NoError(t, err)
+	delete(loaded["my-app/worker"], "SENTRY_DSN")
+
+	noEnv := func(string) (string, bool) { return "", false }
+	err = redacted.SetSecrets(loaded, noEnv)
+	assert.EqualError(t, err, "the value of 1 secret(s) is not set, pass the secrets file written by \"prepare\" or set them in the environment: my-app/worker/SENTRY_DSN")
+
+	env := func(key string) (string, bool) { return "https://sentry.env", key == "SENTRY_DSN" }
+	require.NoError(t, redacted.SetSecrets(loaded, env))
+	assert.Equal(t, "sk_live_123", redacted.Environments[0].Applications[0].Secrets[0].Value)
+	assert.Equal(t, []Secret{{Key: "STRIPE_API_KEY", Value: "sk_live_456"}, {Key: "SENTRY_DSN", Value: "https://sentry.env"}}, redacted.Environments[0].Containers[0].Secrets)
+}
@@ -0,0 +1,315 @@
+package qovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultAPIURL is the URL of the Qovery API
+const DefaultAPIURL = "https://api.qovery.com"
+
+// Client is a client of the Qovery API, authenticated with an API token
+type Client struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewClient creates a Qovery API client with the given API token
+func NewClient(apiKey string) *Client {
+	return &Client{
+		APIKey:  apiKey,
+		BaseURL: DefaultAPIURL,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Organization is a Qovery organization
+type Organization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Project is a project of an organization
+type Project struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// EnvironmentSummary is an existing environment of a project, deployed on a cluster
+type EnvironmentSummary struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	ClusterID string `json:"cluster_id"`
+	ProjectID string `json:"-"`
+}
+
+// Cluster is a Kubernetes cluster of an organization
+type Cluster struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// CloudProvider is the cloud provider of the cluster, E.g AWS, GCP or SCW
+	CloudProvider string `json:"cloud_provider"`
+	Region        string `json:"region"`
+}
+
+// ContainerRegistry is a container registry of an organization, E.g ECR or DOCKER_HUB
+type ContainerRegistry struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// APIError is an error response of the Qovery API
+type APIError struct {
+	StatusCode int
+	Path       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Qovery API error on %s: %d %s", e.Path, e.StatusCode, e.Message)
+}
+
+// IsPermissionError returns true if the API key is not allowed to read the resource
+func IsPermissionError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
+
+// ListOrganizations returns the organizations the API key has access to
+func (c *Client) ListOrganizations(ctx context.Context) ([]Organization, error) {
+	var organizations []Organization
+	err := c.list(ctx, "/organization", &organizations)
+	return organizations, err
+}
+
+// ListProjects returns the projects of the organization
+func (c *Client) ListProjects(ctx context.Context, organizationID string) ([]Project, error) {
+	var projects []Project
+	err := c.list(ctx, fmt.Sprintf("/organization/%s/project", organizationID), &projects)
+	return projects, err
+}
+
+// ListEnvironments returns the environments of the project
+func (c *Client) ListEnvironments(ctx context.Context, projectID string) ([]EnvironmentSummary, error) {
+	var environments []EnvironmentSummary
+	err := c.list(ctx, fmt.Sprintf("/project/%s/environment", projectID), &environments)
+	for i := range environments {
+		environments[i].ProjectID = projectID
+	}
+	return environments, err
+}
+
+// ListClusters returns the clusters of the organization
+func (c *Client) ListClusters(ctx context.Context, organizationID string) ([]Cluster, error) {
+	var clusters []Cluster
+	err := c.list(ctx, fmt.Sprintf("/organization/%s/cluster", organizationID), &clusters)
+	return clusters, err
+}
+
+// ListContainerRegistries returns the container registries of the organization
+func (c *Client) ListContainerRegistries(ctx context.Context, organizationID string) ([]ContainerRegistry, error) {
+	var registries []ContainerRegistry
+	err := c.list(ctx, fmt.Sprintf("/organization/%s/containerRegistry", organizationID), &registries)
+	return registries, err
+}
+
+// Service kinds of the API paths, E.g /environment/{id}/application
+const (
+	ServiceApplication = "application"
+	ServiceContainer   = "container"
+	ServiceDatabase    = "database"
+	ServiceJob         = "job"
+)
+
+// Service is an application, container, database or job of an environment
+type Service struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Variable is an environment variable or a secret of a service, the value of a secret is never returned
+type Variable struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Scope is the level the variable is declared at, E.g APPLICATION, ENVIRONMENT or BUILT_IN
+	Scope string `json:"scope"`
+	// VariableType is VALUE, ALIAS, OVERRIDE or BUILT_IN
+	VariableType string `json:"variable_type"`
+	// ServiceName is the service a built-in variable comes from, E.g a database
+	ServiceName string `json:"service_name"`
+}
+
+// CreateProject creates a project in the organization
+func (c *Client) CreateProject(ctx context.Context, organizationID, name string) (Project, error) {
+	var project Project
+	err := c.send(ctx, http.MethodPost, fmt.Sprintf("/organization/%s/project", organizationID), map[string]string{"name": name}, &project)
+	return project, err
+}
+
+// CreateEnvironment creates an environment of the project on the cluster, mode is PRODUCTION, STAGING or DEVELOPMENT
+func (c *Client) CreateEnvironment(ctx context.Context, projectID, name, clusterID, mode string) (EnvironmentSummary, error) {
+	var environment EnvironmentSummary
+	err := c.send(ctx, http.MethodPost, fmt.Sprintf("/project/%s/environment", projectID), map[string]string{
+		"name":    name,
+		"cluster": clusterID,
+		"mode":    mode,
+	}, &environment)
+	environment.ProjectID = projectID
+	return environment, err
+}
+
+// ListServices returns the services of a kind of the environment, E.g its databases
+func (c *Client) ListServices(ctx context.Context, environmentID, kind string) ([]Service, error) {
+	var services []Service
+	err := c.list(ctx, fmt.Sprintf("/environment/%s/%s", environmentID, kind), &services)
+	return services, err
+}
+
+// CreateService creates a service of a kind in the environment
+func (c *Client) CreateService(ctx context.Context, environmentID, kind string, request interface{}) (Service, error) {
+	var service Service
+	err := c.send(ctx, http.MethodPost, fmt.Sprintf("/environment/%s/%s", environmentID, kind), request, &service)
+	return service, err
+}
+
+// UpdateService replaces the settings of a service
+func (c *Client) UpdateService(ctx context.Context, kind, serviceID string, request interface{}) error {
+	return c.send(ctx, http.MethodPut, fmt.Sprintf("/%s/%s", kind, serviceID), request, nil)
+}
+
+// ListVariables returns the environment variables, or the secrets, visible by a service, including the inherited ones
+func (c *Client) ListVariables(ctx context.Context, kind, serviceID string, secret bool) ([]Variable, error) {
+	var variables []Variable
+	err := c.list(ctx, variablesPath(kind, serviceID, secret), &variables)
+	return variables, err
+}
+
+// CreateVariable creates an environment variable, or a secret, of a service
+func (c *Client) CreateVariable(ctx context.Context, kind, serviceID string, secret bool, key, value string) error {
+	return c.send(ctx, http.MethodPost, variablesPath(kind, serviceID, secret), map[string]string{"key": key, "value": value}, nil)
+}
+
+// UpdateVariable updates the value of an environment variable, or a secret, of a service
+func (c *Client) UpdateVariable(ctx context.Context, kind, serviceID string, secret bool, variableID, key, value string) error {
+	return c.send(ctx, http.MethodPut, variablesPath(kind, serviceID, secret)+"/"+variableID, map[string]string{"key": key, "value": value}, nil)
+}
+
+// CreateAlias creates an environment variable of a service aliasing another one, E.g DATABASE_URL for a built-in variable
+func (c *Client) CreateAlias(ctx context.Context, kind, serviceID, variableID, key string) error {
+	return c.send(ctx, http.MethodPost, fmt.Sprintf("%s/%s/alias", variablesPath(kind, serviceID, false), variableID), map[string]string{"key": key}, nil)
+}
+
+// ListCustomDomains returns the custom domains of an application
+func (c *Client) ListCustomDomains(ctx context.Context, applicationID string) ([]string, error) {
+	var customDomains []struct {
+		Domain string `json:"domain"`
+	}
+	err := c.list(ctx, fmt.Sprintf("/application/%s/customDomain", applicationID), &customDomains)
+	domains := make([]string, len(customDomains))
+	for i, customDomain := range customDomains {
+		domains[i] = customDomain.Domain
+	}
+	return domains, err
+}
+
+// CreateCustomDomain adds a custom domain to an application
+func (c *Client) CreateCustomDomain(ctx context.Context, applicationID, domain string) error {
+	return c.send(ctx, http.MethodPost, fmt.Sprintf("/application/%s/customDomain", applicationID), map[string]string{"domain": domain}, nil)
+}
+
+func variablesPath(kind, serviceID string, secret bool) string {
+	if secret {
+		return fmt.Sprintf("/%s/%s/secret", kind, serviceID)
+	}
+	return fmt.Sprintf("/%s/%s/environmentVariable", kind, serviceID)
+}
+
+// list sends a GET request and decodes the results of the response, E.g {"results": [...]}
+func (c *Client) list(ctx context.Context, path string, results interface{}) error {
+	body, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	response := struct {
+		Results interface{} `json:"results"`
+	}{Results: results}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("error decoding Qovery API response of %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, path, nil)
+}
+
+// send sends a POST or PUT request with a JSON body and decodes the response into result, if not nil
+func (c *Client) send(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	responseBody, err := c.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(responseBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(responseBody, result); err != nil {
+		return fmt.Errorf("error decoding Qovery API response of %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var requestBody io.Reader
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request body: %w", err)
+		}
+		requestBody = bytes.NewReader(bodyJSON)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Token %s", c.APIKey))
+	req.Header.Add("Accept", "application/json")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to the Qovery API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		}
+		message := string(responseBody)
+		if err := json.Unmarshal(responseBody, &apiErr); err == nil && (apiErr.Message != "" || apiErr.Detail != "") {
+			message = apiErr.Message + apiErr.Detail
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Path: path, Message: message}
+	}
+	return responseBody, nil
+}
@@ -0,0 +1,157 @@
+package qovery
+
+// Environment is the Qovery environment of a migrated application, with the services it is made of.
+// It is the intermediate representation shared by the Terraform generation, the validation and the reports.
+type Environment struct {
+	Name string `json:"name"`
+	// Mode is the Qovery environment mode: PRODUCTION, STAGING or DEVELOPMENT
+	Mode string `json:"mode"`
+	// PreviewEnvironments is true when the source platform creates an environment per pull request, E.g Heroku review apps
+	PreviewEnvironments bool          `json:"preview_environments,omitempty"`
+	Applications        []Application `json:"applications,omitempty"`
+	Containers          []Container   `json:"containers,omitempty"`
+	Databases           []Database    `json:"databases,omitempty"`
+	Jobs                []Job         `json:"jobs,omitempty"`
+	// Unmapped are the parts of the source configuration without a Qovery equivalent, E.g an unknown addon
+	Unmapped []string `json:"unmapped,omitempty"`
+}
+
+// Application is an application built from its Git repository with a Dockerfile
+type Application struct {
+	Name string `json:"name"`
+	// GitRepository is unknown on the source platforms, it must be set to create the application with "apply"
+	GitRepository  GitRepository `json:"git_repository"`
+	DockerfilePath string        `json:"dockerfile_path"`
+	// Arguments is the command of the application, the CMD of the Dockerfile if empty
+	Arguments            []string              `json:"arguments,omitempty"`
+	Resources            Resources             `json:"resources"`
+	Ports                []Port                `json:"ports,omitempty"`
+	Healthcheck          *Healthcheck          `json:"healthcheck,omitempty"`
+	EnvironmentVariables []EnvironmentVariable `json:"environment_variables,omitempty"`
+	Secrets              []Secret              `json:"secrets,omitempty"`
+	CustomDomains        []CustomDomain        `json:"custom_domains,omitempty"`
+}
+
+// GitRepository is the repository and the branch an application is built from
+type GitRepository struct {
+	URL    string `json:"url"`
+	Branch string `json:"branch"`
+	// RootPath is the directory of the application in the repository
+	RootPath string `json:"root_path"`
+}
+
+// Container is an application deployed from an image of a container registry, E.g DockerHub
+type Container struct {
+	Name                 string                `json:"name"`
+	ImageName            string                `json:"image_name"`
+	Tag                  string                `json:"tag"`
+	Arguments            []string              `json:"arguments,omitempty"`
+	Resources            Resources             `json:"resources"`
+	Ports                []Port                `json:"ports,omitempty"`
+	Healthcheck          *Healthcheck          `json:"healthcheck,omitempty"`
+	EnvironmentVariables []EnvironmentVariable `json:"environment_variables,omitempty"`
+	Secrets              []Secret              `json:"secrets,omitempty"`
+}
+
+// Database is a database of the environment
+type Database struct {
+	Name string `json:"name"`
+	// Type is the Qovery database type: POSTGRESQL, MYSQL, MONGODB or REDIS
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+	// Mode is MANAGED for a database of the cloud provider, E.g RDS, or CONTAINER
+	Mode string `json:"mode"`
+	// Source is the database on the source platform, E.g heroku-postgresql:essential-0
+	Source string `json:"source,omitempty"`
+	// ConnectionVariables are the environment variables the applications read the connection from, E.g DATABASE_URL
+	ConnectionVariables []string `json:"connection_variables,omitempty"`
+}
+
+// Job runs a command of an application, on each deployment or on a schedule
+type Job struct {
+	Name string `json:"name"`
+	// Application is the name of the application the job is built from
+	Application string   `json:"application"`
+	Arguments   []string `json:"arguments"`
+	// OnStart is true for a job running before each deployment, E.g a release command
+	OnStart bool `json:"on_start,omitempty"`
+	// Schedule is the cron expression (UTC) of a scheduled job
+	Schedule  string    `json:"schedule,omitempty"`
+	Resources Resources `json:"resources"`
+}
+
+// Resources are the resources of a service instance and its number of instances
+type Resources struct {
+	// CPU is in millicores
+	CPU int `json:"cpu"`
+	// Memory is in MB
+	Memory              int `json:"memory"`
+	MinRunningInstances int `json:"min_running_instances"`
+	MaxRunningInstances int `json:"max_running_instances"`
+}
+
+// EnvironmentVariable is a non-sensitive environment variable of a service
+type EnvironmentVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Secret is a sensitive environment variable of a service, it is exported to a Terraform variable
+type Secret struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// CustomDomain is a domain of an application served by Qovery
+type CustomDomain struct {
+	Domain string `json:"domain"`
+}
+
+// Port is a port a service listens on
+type Port struct {
+	Name         string `json:"name"`
+	InternalPort int    `json:"internal_port"`
+	ExternalPort int    `json:"external_port,omitempty"`
+	// Protocol is HTTP, GRPC, TCP or UDP
+	Protocol           string `json:"protocol"`
+	PubliclyAccessible bool   `json:"publicly_accessible"`
+}
+
+// Healthcheck is the readiness and liveness probe of a service
+type Healthcheck struct {
+	// Type is HTTP or TCP
+	Type string `json:"type"`
+	Port int    `json:"port"`
+	// Path is the path of the HTTP probes
+	Path string `json:"path,omitempty"`
+}
+
+// ServiceCount returns the number of services of the environment
+func (e Environment) ServiceCount() int {
+	return len(e.Applications) + len(e.Containers) + len(e.Databases) + len(e.Jobs)
+}
+
+// TotalResources returns the resources of all the instances of the applications, containers and jobs, databases excluded
+func (e Environment) TotalResources() Resources {
+	var total Resources
+	add := func(resources Resources) {
+		instances := resources.MaxRunningInstances
+		if instances < 1 {
+			instances = 1
+		}
+		total.CPU += resources.CPU * instances
+		total.Memory += resources.Memory * instances
+		total.MinRunningInstances += resources.MinRunningInstances
+		total.MaxRunningInstances += instances
+	}
+	for _, application := range e.Applications {
+		add(application.Resources)
+	}
+	for _, container := range e.Containers {
+		add(container.Resources)
+	}
+	for _, job := range e.Jobs {
+		add(job.Resources)
+	}
+	return total
+}
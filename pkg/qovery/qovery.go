@@ -1,21 +1,267 @@
 package qovery
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
+)
+
+// ErrDestinationMismatch is returned when the organization has clusters but none on the destination cloud provider
+var ErrDestinationMismatch = errors.New("no Qovery cluster on the destination cloud provider")
+
+// destinationCloudProviders are the Qovery cloud providers of the destinations, E.g aws is AWS
+var destinationCloudProviders = map[string]string{
+	"aws":      "AWS",
+	"gcp":      "GCP",
+	"scaleway": "SCW",
+}
+
 // QoveryProvider represents a client for interacting with Qovery
 type QoveryProvider struct {
-	// for later use to fetch the configuration from current qovery account
 	APIKey string
+	// OrganizationID is the organization to migrate to, the first organization of the API key if empty
+	OrganizationID string
+	Client         *Client
 }
 
 // NewQoveryProvider creates a new QoveryProvider with the given API key
 func NewQoveryProvider(apiKey string) *QoveryProvider {
-	return &QoveryProvider{APIKey: apiKey}
+	return &QoveryProvider{APIKey: apiKey, Client: NewClient(apiKey)}
+}
+
+// TranslatedApp is the configuration of an app given to the Terraform generation: the Qovery environment it is
+// translated to, and the source configuration for the settings the translation doesn't cover
+type TranslatedApp struct {
+	AppName     string                 `json:"app_name"`
+	Destination string                 `json:"destination"`
+	Target      Environment            `json:"target"`
+	Stack       map[string]interface{} `json:"stack"`
 }
 
 // TranslateConfig translates a PaaS configuration to a Qovery configuration
-func (q *QoveryProvider) TranslateConfig(appName string, configMap map[string]interface{}, destination string) map[string]interface{} {
-	return map[string]interface{}{
-		"app_name":    appName,
-		"destination": destination,
-		"stack":       configMap,
+func (q *QoveryProvider) TranslateConfig(app sources.AppConfig, destination string) TranslatedApp {
+	return TranslatedApp{
+		AppName:     app.Name(),
+		Destination: destination,
+		Target:      Translate(app, destination),
+		Stack:       app.Map(),
+	}
+}
+
+// Inventory is the content of the organization the applications are migrated to
+type Inventory struct {
+	Organization        Organization
+	Projects            []Project
+	Environments        []EnvironmentSummary
+	Clusters            []Cluster
+	ContainerRegistries []ContainerRegistry
+	// Warnings are the resources the API key is not allowed to list, or the choices made for the user
+	Warnings []string
+}
+
+// FetchInventory lists the projects, environments, clusters and container registries of the organization.
+// The resources the API key is not allowed to list are reported in the warnings.
+func (q *QoveryProvider) FetchInventory(ctx context.Context) (*Inventory, error) {
+	organizations, err := q.Client.ListOrganizations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the Qovery organizations: %w", err)
+	}
+	if len(organizations) == 0 {
+		return nil, fmt.Errorf("the Qovery API key has no access to any organization")
+	}
+
+	inventory := &Inventory{}
+	if q.OrganizationID == "" {
+		inventory.Organization = organizations[0]
+		if len(organizations) > 1 {
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("the API key has access to %d organizations, %s is used", len(organizations), organizations[0].Name))
+		}
+	} else {
+		for _, organization := range organizations {
+			if organization.ID == q.OrganizationID {
+				inventory.Organization = organization
+			}
+		}
+		if inventory.Organization.ID == "" {
+			return nil, fmt.Errorf("the Qovery API key has no access to the organization %s", q.OrganizationID)
+		}
+	}
+	organization := inventory.Organization
+
+	// permissionWarning records a warning if the API key is not allowed to list the resources, other errors are returned
+	permissionWarning := func(resources string, err error) error {
+		if err == nil {
+			return nil
+		}
+		if IsPermissionError(err) {
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("the API key has insufficient permissions to list the %s of %s: %v", resources, organization.Name, err))
+			return nil
+		}
+		return fmt.Errorf("error listing the Qovery %s: %w", resources, err)
+	}
+
+	inventory.Projects, err = q.Client.ListProjects(ctx, organization.ID)
+	if err := permissionWarning("projects", err); err != nil {
+		return nil, err
+	}
+	for _, project := range inventory.Projects {
+		environments, err := q.Client.ListEnvironments(ctx, project.ID)
+		if err := permissionWarning("environments of the project "+project.Name, err); err != nil {
+			return nil, err
+		}
+		inventory.Environments = append(inventory.Environments, environments...)
+	}
+
+	inventory.Clusters, err = q.Client.ListClusters(ctx, organization.ID)
+	if err := permissionWarning("clusters", err); err != nil {
+		return nil, err
+	}
+
+	inventory.ContainerRegistries, err = q.Client.ListContainerRegistries(ctx, organization.ID)
+	if err := permissionWarning("container registries", err); err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+// ClusterFor returns the first cluster on the cloud provider of the destination (aws, gcp or scaleway).
+// ErrDestinationMismatch is returned if the organization has clusters, but none on this cloud provider.
+func (i *Inventory) ClusterFor(destination string) (Cluster, error) {
+	cloudProvider, ok := destinationCloudProviders[destination]
+	if !ok {
+		return Cluster{}, fmt.Errorf("unknown destination %s", destination)
+	}
+	if len(i.Clusters) == 0 {
+		return Cluster{}, fmt.Errorf("no cluster found in the Qovery organization %s", i.Organization.Name)
+	}
+
+	var existing []string
+	for _, cluster := range i.Clusters {
+		if strings.EqualFold(cluster.CloudProvider, cloudProvider) {
+			return cluster, nil
+		}
+		existing = append(existing, fmt.Sprintf("%s (%s)", cluster.Name, cluster.CloudProvider))
+	}
+	return Cluster{}, fmt.Errorf("%w: the destination is %s but the clusters of %s are %s", ErrDestinationMismatch, destination, i.Organization.Name, strings.Join(existing, ", "))
+}
+
+// TerraformVars are the IDs of the Qovery resources the generated configurations are deployed to. The environment is
+// only pre-filled when it is the only one of the project on the cluster, the user chooses it otherwise.
+type TerraformVars struct {
+	OrganizationID   string
+	OrganizationName string
+	ProjectID        string
+	ProjectName      string
+	EnvironmentID    string
+	EnvironmentName  string
+	ClusterID        string
+	ClusterName      string
+	// ContainerRegistryID is the registry of the container images, it is not a variable of the configurations
+	ContainerRegistryID   string
+	ContainerRegistryName string
+}
+
+// Values returns the IDs by Terraform variable name, E.g project_id, without the unknown ones
+func (v TerraformVars) Values() map[string]string {
+	values := map[string]string{}
+	for name, value := range map[string]string{
+		"project_id":     v.ProjectID,
+		"environment_id": v.EnvironmentID,
+		"cluster_id":     v.ClusterID,
+	} {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// TerraformVars returns the IDs to deploy to the cluster: the project of the first environment running on the cluster,
+// or the first project if no environment runs on it, and the environment if it is the only one of the project on the
+// cluster. The container registry is Docker Hub if the organization has it, the first registry otherwise. It returns a
+// warning for each ID picked among several, and for environment_id when it is left to the user.
+func (i *Inventory) TerraformVars(cluster Cluster) (TerraformVars, []string) {
+	vars := TerraformVars{
+		OrganizationID:   i.Organization.ID,
+		OrganizationName: i.Organization.Name,
+		ClusterID:        cluster.ID,
+		ClusterName:      cluster.Name,
+	}
+	var warnings []string
+
+	if cluster.ID != "" {
+		candidates := 0
+		for _, other := range i.Clusters {
+			if strings.EqualFold(other.CloudProvider, cluster.CloudProvider) {
+				candidates++
+			}
+		}
+		if candidates > 1 {
+			warnings = append(warnings, fmt.Sprintf("the cluster %s was picked among %d clusters on %s, check cluster_id", cluster.Name, candidates, cluster.CloudProvider))
+		}
+	}
+
+	for _, environment := range i.Environments {
+		if cluster.ID != "" && environment.ClusterID != cluster.ID {
+			continue
+		}
+		for _, project := range i.Projects {
+			if project.ID == environment.ProjectID {
+				vars.ProjectID = project.ID
+				vars.ProjectName = project.Name
+			}
+		}
+		if vars.ProjectID != "" && len(i.Projects) > 1 {
+			warnings = append(warnings, fmt.Sprintf("the project %s was picked among %d projects as the project of the environment %s running on the cluster, check project_id", vars.ProjectName, len(i.Projects), environment.Name))
+		}
+		return i.withEnvironment(vars, warnings)
+	}
+
+	if len(i.Projects) > 0 {
+		vars.ProjectID = i.Projects[0].ID
+		vars.ProjectName = i.Projects[0].Name
+		if len(i.Projects) > 1 {
+			warnings = append(warnings, fmt.Sprintf("the project %s was picked among %d projects as the first one of the organization, check project_id", vars.ProjectName, len(i.Projects)))
+		}
+	}
+	return i.withEnvironment(vars, warnings)
+}
+
+// withEnvironment sets the environment if it is the only one of the project on the cluster, and the container registry
+func (i *Inventory) withEnvironment(vars TerraformVars, warnings []string) (TerraformVars, []string) {
+	var environments []EnvironmentSummary
+	for _, environment := range i.Environments {
+		if vars.ProjectID != "" && vars.ClusterID != "" && environment.ProjectID == vars.ProjectID && environment.ClusterID == vars.ClusterID {
+			environments = append(environments, environment)
+		}
+	}
+	switch len(environments) {
+	case 1:
+		vars.EnvironmentID = environments[0].ID
+		vars.EnvironmentName = environments[0].Name
+	case 0:
+		warnings = append(warnings, "environment_id is not pre-filled, set the ID of the environment the applications are migrated to")
+	default:
+		warnings = append(warnings, fmt.Sprintf("environment_id is not pre-filled, %d environments of the project %s run on the cluster, set the ID of the environment the applications are migrated to", len(environments), vars.ProjectName))
+	}
+
+	if len(i.ContainerRegistries) > 0 {
+		registry := i.ContainerRegistries[0]
+		for _, other := range i.ContainerRegistries {
+			if other.Kind == "DOCKER_HUB" {
+				registry = other
+				break
+			}
+		}
+		vars.ContainerRegistryID = registry.ID
+		vars.ContainerRegistryName = registry.Name
+		if len(i.ContainerRegistries) > 1 {
+			warnings = append(warnings, fmt.Sprintf("the container registry %s was picked among %d registries, check container_registry_id in plan.json", registry.Name, len(i.ContainerRegistries)))
+		}
 	}
+	return vars, warnings
 }
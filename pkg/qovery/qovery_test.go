@@ -1,22 +1,118 @@
 package qovery
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/sources"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestQoveryProvider_TranslateConfig(t *testing.T) {
 	provider := NewQoveryProvider("fake-api-key")
 
-	herokuConfig := map[string]interface{}{
+	herokuConfig := sources.NewHerokuAppConfig(map[string]interface{}{
 		"name":  "test-app",
 		"stack": "heroku-20",
-	}
+	})
 
 	qoveryConfig := provider.TranslateConfig(herokuConfig, "aws")
 
-	assert.Equal(t, "test-app", qoveryConfig["app_name"])
-	assert.Equal(t, "aws", qoveryConfig["destination"])
-	assert.Equal(t, "heroku-20", qoveryConfig["stack"])
+	assert.Equal(t, "test-app", qoveryConfig.AppName)
+	assert.Equal(t, "aws", qoveryConfig.Destination)
+	assert.Equal(t, "test-app", qoveryConfig.Target.Name)
+	assert.Equal(t, herokuConfig.Map(), qoveryConfig.Stack)
+}
+
+// testProvider returns a provider calling a fake Qovery API serving the responses by path
+func testProvider(t *testing.T, responses map[string]string) *QoveryProvider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Token fake-api-key", r.Header.Get("Authorization"))
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "Forbidden"}`))
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	provider := NewQoveryProvider("fake-api-key")
+	provider.Client.BaseURL = server.URL
+	return provider
+}
+
+func TestFetchInventory(t *testing.T) {
+	provider := testProvider(t, map[string]string{
+		"/organization":                  `{"results": [{"id": "org-1", "name": "Acme"}]}`,
+		"/organization/org-1/project":    `{"results": [{"id": "project-1", "name": "Shop"}, {"id": "project-2", "name": "Blog"}]}`,
+		"/project/project-1/environment": `{"results": [{"id": "env-1", "name": "production", "mode": "PRODUCTION", "cluster_id": "cluster-gcp"}]}`,
+		"/project/project-2/environment": `{"results": [{"id": "env-2", "name": "staging", "mode": "STAGING", "cluster_id": "cluster-aws"}]}`,
+		"/organization/org-1/cluster":    `{"results": [{"id": "cluster-gcp", "name": "gke", "cloud_provider": "GCP", "region": "europe-west1"}, {"id": "cluster-aws", "name": "eks", "cloud_provider": "AWS", "region": "us-east-2"}]}`,
+	})
+
+	inventory, err := provider.FetchInventory(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", inventory.Organization.Name)
+	assert.Len(t, inventory.Environments, 2)
+	assert.Len(t, inventory.Clusters, 2)
+	require.Len(t, inventory.Warnings, 1)
+	assert.Contains(t, inventory.Warnings[0], "insufficient permissions to list the container registries")
+
+	cluster, err := inventory.ClusterFor("aws")
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-aws", cluster.ID)
+	vars, warnings := inventory.TerraformVars(cluster)
+	assert.Equal(t, map[string]string{
+		"project_id":     "project-2",
+		"environment_id": "env-2",
+		"cluster_id":     "cluster-aws",
+	}, vars.Values())
+	assert.Equal(t, []string{
+		"the project Blog was picked among 2 projects as the project of the environment staging running on the cluster, check project_id",
+	}, warnings)
+
+	// the environment is not picked among several, Docker Hub is the default container registry
+	inventory.Environments = append(inventory.Environments, EnvironmentSummary{ID: "env-3", Name: "review", ClusterID: "cluster-aws", ProjectID: "project-2"})
+	inventory.ContainerRegistries = []ContainerRegistry{{ID: "registry-1", Name: "ecr", Kind: "ECR"}, {ID: "registry-2", Name: "Docker Hub", Kind: "DOCKER_HUB"}}
+	vars, warnings = inventory.TerraformVars(cluster)
+	assert.Equal(t, map[string]string{
+		"project_id": "project-2",
+		"cluster_id": "cluster-aws",
+	}, vars.Values())
+	assert.Equal(t, "registry-2", vars.ContainerRegistryID)
+	assert.Equal(t, []string{
+		"the project Blog was picked among 2 projects as the project of the environment staging running on the cluster, check project_id",
+		"environment_id is not pre-filled, 2 environments of the project Blog run on the cluster, set the ID of the environment the applications are migrated to",
+		"the container registry Docker Hub was picked among 2 registries, check container_registry_id in plan.json",
+	}, warnings)
+	inventory.ContainerRegistries = nil
+
+	// the first project is picked if no environment runs on the cluster
+	inventory.Clusters = append(inventory.Clusters, Cluster{ID: "cluster-aws-2", Name: "eks-2", CloudProvider: "AWS"})
+	vars, warnings = inventory.TerraformVars(Cluster{ID: "cluster-aws-2", Name: "eks-2", CloudProvider: "AWS"})
+	assert.Equal(t, map[string]string{
+		"project_id": "project-1",
+		"cluster_id": "cluster-aws-2",
+	}, vars.Values())
+	assert.Equal(t, []string{
+		"the cluster eks-2 was picked among 2 clusters on AWS, check cluster_id",
+		"the project Shop was picked among 2 projects as the first one of the organization, check project_id",
+		"environment_id is not pre-filled, set the ID of the environment the applications are migrated to",
+	}, warnings)
+
+	_, err = inventory.ClusterFor("scaleway")
+	assert.ErrorIs(t, err, ErrDestinationMismatch)
+	assert.ErrorContains(t, err, "gke (GCP), eks (AWS)")
+}
+
+func TestFetchInventoryWithoutPermissions(t *testing.T) {
+	provider := testProvider(t, map[string]string{})
+
+	_, err := provider.FetchInventory(context.Background())
+	assert.True(t, IsPermissionError(err))
 }
@@ -4,5 +4,18 @@ type AppConfig interface {
 	App() map[string]interface{}
 	Name() string
 	Cost() float64
+	Build() BuildInfo
 	Map() map[string]interface{}
 }
+
+// BuildInfo describes how an app is built and started on the source platform
+type BuildInfo struct {
+	Buildpacks []string `json:"buildpacks,omitempty"`
+	Stack      string   `json:"stack,omitempty"`
+	// Language is the language/framework detected by the source platform (E.g "Ruby/Rails", "node")
+	Language string `json:"language,omitempty"`
+	// LanguageVersion is only set on Clever Cloud, Heroku doesn't expose the version resolved by the buildpack
+	LanguageVersion string            `json:"language_version,omitempty"`
+	ProcessTypes    map[string]string `json:"process_types,omitempty"`
+	ReleaseCommand  string            `json:"release_command,omitempty"`
+}
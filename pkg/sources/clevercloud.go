@@ -70,7 +70,7 @@ type CleverCloudAddonConfig struct {
 func (c CleverCloudAppConfig) App() map[string]interface{} {
 	return map[string]interface{}{
 		"id":            c.ID,
-		"name":          c.Name,
+		"name":          c.MName,
 		"description":   c.Description,
 		"zone":          c.Zone,
 		"instance":      c.Instance,
@@ -93,10 +93,23 @@ func (c CleverCloudAppConfig) Cost() float64 {
 	return 0
 }
 
+func (c CleverCloudAppConfig) Build() BuildInfo {
+	buildInfo := BuildInfo{}
+	if variant, ok := c.Instance["variant"].(map[string]interface{}); ok {
+		buildInfo.Language, _ = variant["slug"].(string)
+	}
+	if buildInfo.Language == "" {
+		buildInfo.Language, _ = c.Instance["type"].(string)
+	}
+	buildInfo.LanguageVersion, _ = c.Instance["version"].(string)
+	return buildInfo
+}
+
 func (c CleverCloudAppConfig) Map() map[string]interface{} {
 	return map[string]interface{}{
-		"app":  c.App(),
-		"cost": c.Cost(),
+		"app":   c.App(),
+		"cost":  c.Cost(),
+		"build": c.Build(),
 	}
 }
 
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
 	herokuAPIRootURL = "https://api.heroku.com"
+	// herokuSchedulerAPIRootURL is the API used by the Heroku dashboard to manage Heroku Scheduler jobs
+	herokuSchedulerAPIRootURL = "https://particleboard.heroku.com"
 )
 
 // HerokuProvider represents a client for interacting with the Heroku API
@@ -21,7 +25,7 @@ type HerokuProvider struct {
 
 // HerokuAppConfig represents the configuration for a Heroku app, including costs, pipeline info, and review apps
 type HerokuAppConfig struct {
-	mApp          map[string]interface{} `json:"app,omitempty"`
+	mApp          map[string]interface{}
 	Config        map[string]string
 	Addons        []map[string]interface{} `json:"addons,omitempty"`
 	Domains       []Domain                 `json:"domains,omitempty"`
@@ -29,6 +33,15 @@ type HerokuAppConfig struct {
 	Stage         string                   `json:"stage,omitempty"`
 	ReviewApps    []map[string]interface{} `json:"review_apps,omitempty"`
 	ReviewAppConf map[string]interface{}   `json:"review_app_conf,omitempty"`
+	Processes     []Process                `json:"processes,omitempty"`
+	ScheduledJobs []ScheduledJob           `json:"scheduled_jobs,omitempty"`
+	BuildInfo     BuildInfo                `json:"build,omitempty"`
+}
+
+// NewHerokuAppConfig returns the configuration of the app returned by the Heroku API, E.g {"name": "my-app"},
+// without its config vars, addons or formation
+func NewHerokuAppConfig(app map[string]interface{}) HerokuAppConfig {
+	return HerokuAppConfig{mApp: app}
 }
 
 func (a HerokuAppConfig) App() map[string]interface{} {
@@ -39,6 +52,10 @@ func (a HerokuAppConfig) Cost() float64 {
 	return a.TotalCost
 }
 
+func (a HerokuAppConfig) Build() BuildInfo {
+	return a.BuildInfo
+}
+
 // Map returns a map representation of the AppConfig
 func (a HerokuAppConfig) Map() map[string]interface{} {
 	return map[string]interface{}{
@@ -50,6 +67,9 @@ func (a HerokuAppConfig) Map() map[string]interface{} {
 		"stage":           a.Stage,
 		"review_apps":     a.ReviewApps,
 		"review_app_conf": a.ReviewAppConf,
+		"processes":       a.Processes,
+		"scheduled_jobs":  a.ScheduledJobs,
+		"build":           a.BuildInfo,
 	}
 }
 
@@ -59,15 +79,41 @@ func (a HerokuAppConfig) Name() string {
 }
 
 type Domain struct {
-	Cname string `json:"cname,omitempty"`
+	// Hostname is the custom domain, E.g www.example.com
+	Hostname string `json:"hostname,omitempty"`
+	Cname    string `json:"cname,omitempty"`
 }
 
 func (d Domain) Map() map[string]interface{} {
 	return map[string]interface{}{
-		"cname": d.Cname,
+		"hostname": d.Hostname,
+		"cname":    d.Cname,
 	}
 }
 
+// Process represents a process type of the app formation (web, worker, etc.) as declared in the Procfile
+type Process struct {
+	Type     string `json:"type"`
+	Command  string `json:"command"`
+	Size     string `json:"size"`
+	Quantity int    `json:"quantity"`
+}
+
+// IsWeb returns true if the process receives HTTP traffic from the Heroku router
+func (p Process) IsWeb() bool {
+	return p.Type == "web"
+}
+
+// ScheduledJob represents a job configured in the Heroku Scheduler addon
+type ScheduledJob struct {
+	Command   string `json:"command"`
+	Frequency string `json:"frequency"`
+	At        string `json:"at,omitempty"`
+	DynoSize  string `json:"dyno_size,omitempty"`
+	// Schedule is the cron expression (UTC) equivalent to Frequency and At
+	Schedule string `json:"schedule"`
+}
+
 // HerokuError represents an error returned by the Heroku API
 type HerokuError struct {
 	ID      string `json:"id"`
@@ -123,11 +169,13 @@ func (h *HerokuProvider) GetAllAppsConfig() ([]AppConfig, error) {
 				fmt.Printf("Error fetching domains for app %s: %v\n", appName, err)
 				return
 			}
-			cost, err := h.getAppCost(appName)
+			formations, err := h.getAppFormation(appName)
 			if err != nil {
-				fmt.Printf("Error fetching cost for app %s: %v\n", appName, err)
+				fmt.Printf("Error fetching formation for app %s: %v\n", appName, err)
 				return
 			}
+			cost := formationCost(formations)
+			processes := formationProcesses(formations)
 			pipelineCoupling, err := h.getAppPipelineCoupling(appName)
 			if err != nil {
 				fmt.Printf("Error fetching pipeline coupling for app %s: %v\n", appName, err)
@@ -158,13 +206,29 @@ func (h *HerokuProvider) GetAllAppsConfig() ([]AppConfig, error) {
 			for _, domain := range domains {
 				if cname, ok := domain["cname"].(string); ok {
 					if len(cname) > 0 {
+						hostname, _ := domain["hostname"].(string)
 						mDomains = append(mDomains, Domain{
-							Cname: cname,
+							Hostname: hostname,
+							Cname:    cname,
 						})
 					}
 				}
 			}
 
+			var scheduledJobs []ScheduledJob
+			if hasSchedulerAddon(addons) {
+				scheduledJobs, err = h.getAppScheduledJobs(appName)
+				if err != nil {
+					// the Scheduler API is not always reachable with the account API key
+					fmt.Printf("Error fetching scheduled jobs for app %s: %v\n", appName, err)
+				}
+			}
+
+			buildInfo, err := h.getAppBuildInfo(app)
+			if err != nil {
+				fmt.Printf("Error fetching build info for app %s: %v\n", appName, err)
+			}
+
 			configs[i] = HerokuAppConfig{
 				mApp:          app,
 				Config:        config,
@@ -174,6 +238,9 @@ func (h *HerokuProvider) GetAllAppsConfig() ([]AppConfig, error) {
 				Stage:         stage,
 				ReviewApps:    reviewApps,
 				ReviewAppConf: reviewAppConf,
+				Processes:     processes,
+				ScheduledJobs: scheduledJobs,
+				BuildInfo:     buildInfo,
 			}
 		}(i, app)
 	}
@@ -203,15 +270,15 @@ func (h *HerokuProvider) getAppDomains(appName string) ([]map[string]interface{}
 	return h.makeRequest(url)
 }
 
-func (h *HerokuProvider) getAppCost(appName string) (float64, error) {
-	now := time.Now()
-	startOfPeriod := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+func (h *HerokuProvider) getAppFormation(appName string) ([]map[string]interface{}, error) {
 	url := fmt.Sprintf("%s/apps/%s/formation", herokuAPIRootURL, appName)
+	return h.makeRequest(url)
+}
 
-	formations, err := h.makeRequest(url)
-	if err != nil {
-		return 0, err
-	}
+// formationCost returns the cost of the formation for the current billing period
+func formationCost(formations []map[string]interface{}) float64 {
+	now := time.Now()
+	startOfPeriod := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 
 	var totalCost float64
 	daysInPeriod := float64(now.Sub(startOfPeriod).Hours() / 24)
@@ -227,7 +294,201 @@ func (h *HerokuProvider) getAppCost(appName string) (float64, error) {
 		totalCost += dailyCost * daysInPeriod
 	}
 
-	return totalCost, nil
+	return totalCost
+}
+
+// formationProcesses extracts the process types (web, worker, etc.) from the app formation
+func formationProcesses(formations []map[string]interface{}) []Process {
+	var processes []Process
+	for _, formation := range formations {
+		processType, _ := formation["type"].(string)
+		if processType == "" {
+			continue
+		}
+
+		command, _ := formation["command"].(string)
+		quantity, _ := formation["quantity"].(float64)
+
+		// size is a plain string in the formation API, but kept as an object in the cost payload
+		size, _ := formation["size"].(string)
+		if sizeMap, ok := formation["size"].(map[string]interface{}); ok {
+			size, _ = sizeMap["name"].(string)
+		}
+
+		processes = append(processes, Process{
+			Type:     processType,
+			Command:  command,
+			Size:     size,
+			Quantity: int(quantity),
+		})
+	}
+	return processes
+}
+
+func hasSchedulerAddon(addons []map[string]interface{}) bool {
+	for _, addon := range addons {
+		service, _ := addon["addon_service"].(map[string]interface{})
+		if name, _ := service["name"].(string); name == "scheduler" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HerokuProvider) getAppScheduledJobs(appName string) ([]ScheduledJob, error) {
+	url := fmt.Sprintf("%s/apps/%s/jobs", herokuSchedulerAPIRootURL, appName)
+	results, err := h.makeRequest(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []ScheduledJob
+	for _, result := range results {
+		command, _ := result["command"].(string)
+		frequency, _ := result["frequency"].(string)
+		at, _ := result["at"].(string)
+		dynoSize, _ := result["dyno_size"].(string)
+
+		schedule, err := schedulerCronExpression(frequency, at)
+		if err != nil {
+			fmt.Printf("Skipping scheduled job %q for app %s: %v\n", command, appName, err)
+			continue
+		}
+
+		jobs = append(jobs, ScheduledJob{
+			Command:   command,
+			Frequency: frequency,
+			At:        at,
+			DynoSize:  dynoSize,
+			Schedule:  schedule,
+		})
+	}
+
+	return jobs, nil
+}
+
+// schedulerCronExpression converts a Heroku Scheduler frequency into a cron expression.
+// "at" is "HH:MM" for daily jobs and ":MM" (or "MM") for hourly jobs.
+func schedulerCronExpression(frequency, at string) (string, error) {
+	hour, minute := 0, 0
+	if at != "" {
+		parts := strings.SplitN(at, ":", 2)
+		var err error
+		if len(parts) == 2 {
+			if parts[0] != "" {
+				if hour, err = strconv.Atoi(parts[0]); err != nil {
+					return "", fmt.Errorf("invalid hour in %q", at)
+				}
+			}
+			if minute, err = strconv.Atoi(parts[1]); err != nil {
+				return "", fmt.Errorf("invalid minute in %q", at)
+			}
+		} else if minute, err = strconv.Atoi(parts[0]); err != nil {
+			return "", fmt.Errorf("invalid minute in %q", at)
+		}
+	}
+
+	switch frequency {
+	case "every_ten_minutes":
+		return "*/10 * * * *", nil
+	case "every_hour":
+		return fmt.Sprintf("%d * * * *", minute), nil
+	case "every_day":
+		return fmt.Sprintf("%d %d * * *", minute, hour), nil
+	default:
+		return "", fmt.Errorf("unsupported frequency %q", frequency)
+	}
+}
+
+// getAppBuildInfo retrieves the buildpacks, the stack and the process types of the slug of the latest release
+func (h *HerokuProvider) getAppBuildInfo(app map[string]interface{}) (BuildInfo, error) {
+	appName, _ := app["name"].(string)
+
+	buildInfo := BuildInfo{}
+	if stack, ok := app["stack"].(map[string]interface{}); ok {
+		buildInfo.Stack, _ = stack["name"].(string)
+	}
+
+	buildpacks, err := h.getAppBuildpackInstallations(appName)
+	if err != nil {
+		return buildInfo, err
+	}
+	for _, installation := range buildpacks {
+		buildpack, _ := installation["buildpack"].(map[string]interface{})
+		name, _ := buildpack["name"].(string)
+		if name == "" {
+			name, _ = buildpack["url"].(string)
+		}
+		if name != "" {
+			buildInfo.Buildpacks = append(buildInfo.Buildpacks, name)
+		}
+	}
+
+	release, err := h.getAppLatestRelease(appName)
+	if err != nil {
+		return buildInfo, err
+	}
+	slug, _ := release["slug"].(map[string]interface{})
+	slugID, _ := slug["id"].(string)
+	if slugID == "" {
+		return buildInfo, nil // App has never been deployed
+	}
+
+	slugDetails, err := h.getAppSlug(appName, slugID)
+	if err != nil {
+		return buildInfo, err
+	}
+	if slugDetails == nil {
+		return buildInfo, nil
+	}
+
+	buildInfo.Language, _ = slugDetails["buildpack_provided_description"].(string)
+	if stack, ok := slugDetails["stack"].(map[string]interface{}); ok {
+		if name, _ := stack["name"].(string); name != "" {
+			buildInfo.Stack = name
+		}
+	}
+	if processTypes, ok := slugDetails["process_types"].(map[string]interface{}); ok {
+		buildInfo.ProcessTypes = make(map[string]string)
+		for processType, command := range processTypes {
+			if cmd, ok := command.(string); ok {
+				buildInfo.ProcessTypes[processType] = cmd
+			}
+		}
+		// the release phase is declared as the "release" process type in the Procfile
+		buildInfo.ReleaseCommand = buildInfo.ProcessTypes["release"]
+	}
+
+	return buildInfo, nil
+}
+
+func (h *HerokuProvider) getAppBuildpackInstallations(appName string) ([]map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/apps/%s/buildpack-installations", herokuAPIRootURL, appName)
+	return h.makeRequest(url)
+}
+
+func (h *HerokuProvider) getAppLatestRelease(appName string) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/apps/%s/releases", herokuAPIRootURL, appName)
+	results, err := h.makeRequestWithRange(url, "version ..; order=desc, max=1")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+func (h *HerokuProvider) getAppSlug(appName, slugID string) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/apps/%s/slugs/%s", herokuAPIRootURL, appName, slugID)
+	results, err := h.makeRequest(url)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
 }
 
 func (h *HerokuProvider) getPipelines() ([]map[string]interface{}, error) {
@@ -265,6 +526,11 @@ func (h *HerokuProvider) getPipelineReviewAppConfig(pipelineID string) (map[stri
 }
 
 func (h *HerokuProvider) makeRequest(url string) ([]map[string]interface{}, error) {
+	return h.makeRequestWithRange(url, "")
+}
+
+// makeRequestWithRange sends a request with the given Range header (used for ordering and pagination), if any
+func (h *HerokuProvider) makeRequestWithRange(url, contentRange string) ([]map[string]interface{}, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
@@ -272,6 +538,9 @@ func (h *HerokuProvider) makeRequest(url string) ([]map[string]interface{}, erro
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", h.APIKey))
 	req.Header.Add("Accept", "application/vnd.heroku+json; version=3")
+	if contentRange != "" {
+		req.Header.Add("Range", contentRange)
+	}
 
 	resp, err := h.Client.Do(req)
 	if err != nil {
@@ -284,7 +553,8 @@ func (h *HerokuProvider) makeRequest(url string) ([]map[string]interface{}, erro
 		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	// 206 Partial Content is returned when there are more results than the requested range
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		var herokuErr HerokuError
 		if err := json.Unmarshal(body, &herokuErr); err == nil && herokuErr.ID == "not_found" {
 			return []map[string]interface{}{}, nil // Return empty list for "not found" cases
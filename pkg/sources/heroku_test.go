@@ -0,0 +1,130 @@
+package sources
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerCronExpression(t *testing.T) {
+	tests := []struct {
+		frequency string
+		at        string
+		expected  string
+	}{
+		{"every_ten_minutes", "", "*/10 * * * *"},
+		{"every_hour", ":30", "30 * * * *"},
+		{"every_hour", "15", "15 * * * *"},
+		{"every_day", "01:30", "30 1 * * *"},
+		{"every_day", "", "0 0 * * *"},
+	}
+
+	for _, tt := range tests {
+		schedule, err := schedulerCronExpression(tt.frequency, tt.at)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, schedule, "%s at %s", tt.frequency, tt.at)
+	}
+
+	_, err := schedulerCronExpression("every_week", "")
+	assert.Error(t, err)
+}
+
+func TestFormationProcesses(t *testing.T) {
+	formations := []map[string]interface{}{
+		{"type": "web", "command": "bundle exec puma -C config/puma.rb", "size": "Standard-1X", "quantity": float64(2)},
+		{"type": "worker", "command": "bundle exec sidekiq", "size": map[string]interface{}{"name": "Standard-2X"}, "quantity": float64(1)},
+	}
+
+	processes := formationProcesses(formations)
+
+	assert.Len(t, processes, 2)
+	assert.True(t, processes[0].IsWeb())
+	assert.Equal(t, 2, processes[0].Quantity)
+	assert.False(t, processes[1].IsWeb())
+	assert.Equal(t, "bundle exec sidekiq", processes[1].Command)
+	assert.Equal(t, "Standard-2X", processes[1].Size)
+}
+
+// herokuTestProvider returns a provider whose Heroku API requests are answered with the given responses by path
+func herokuTestProvider(t *testing.T, responses map[string]interface{}) *HerokuProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(HerokuError{ID: "not_found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	provider := NewHerokuProvider("api-key")
+	provider.Client = &http.Client{Transport: rewriteHostTransport{host: serverURL.Host}}
+	return provider
+}
+
+// rewriteHostTransport sends the requests to the given host over HTTP
+type rewriteHostTransport struct {
+	host string
+}
+
+func (r rewriteHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = r.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGetAppBuildInfo(t *testing.T) {
+	app := map[string]interface{}{"name": "my-app", "stack": map[string]interface{}{"name": "heroku-20"}}
+
+	t.Run("undeployed app", func(t *testing.T) {
+		provider := herokuTestProvider(t, map[string]interface{}{
+			"/apps/my-app/buildpack-installations": []interface{}{},
+			"/apps/my-app/releases":                []interface{}{map[string]interface{}{"version": 1, "slug": nil}},
+		})
+
+		buildInfo, err := provider.getAppBuildInfo(app)
+
+		require.NoError(t, err)
+		assert.Equal(t, BuildInfo{Stack: "heroku-20"}, buildInfo)
+	})
+
+	t.Run("deployed app", func(t *testing.T) {
+		provider := herokuTestProvider(t, map[string]interface{}{
+			"/apps/my-app/buildpack-installations": []interface{}{
+				map[string]interface{}{"ordinal": 0, "buildpack": map[string]interface{}{"name": "heroku/nodejs", "url": "heroku/nodejs"}},
+				// buildpacks which are not registered in the buildpack registry only have a URL
+				map[string]interface{}{"ordinal": 1, "buildpack": map[string]interface{}{"name": nil, "url": "https://github.com/heroku/heroku-buildpack-ruby"}},
+			},
+			"/apps/my-app/releases": []interface{}{map[string]interface{}{"version": 3, "slug": map[string]interface{}{"id": "slug-1"}}},
+			"/apps/my-app/slugs/slug-1": map[string]interface{}{
+				"id":                             "slug-1",
+				"buildpack_provided_description": "Ruby/Rails",
+				"stack":                          map[string]interface{}{"name": "heroku-22"},
+				"process_types": map[string]interface{}{
+					"web":     "bundle exec puma -C config/puma.rb",
+					"release": "bundle exec rails db:migrate",
+				},
+			},
+		})
+
+		buildInfo, err := provider.getAppBuildInfo(app)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"heroku/nodejs", "https://github.com/heroku/heroku-buildpack-ruby"}, buildInfo.Buildpacks)
+		assert.Equal(t, "heroku-22", buildInfo.Stack)
+		assert.Equal(t, "Ruby/Rails", buildInfo.Language)
+		assert.Empty(t, buildInfo.LanguageVersion)
+		assert.Equal(t, "bundle exec puma -C config/puma.rb", buildInfo.ProcessTypes["web"])
+		assert.Equal(t, "bundle exec rails db:migrate", buildInfo.ReleaseCommand)
+	})
+}
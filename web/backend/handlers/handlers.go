@@ -3,6 +3,7 @@ package handlers
 import (
 	"archive/zip"
 	"backend/services"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,29 +13,48 @@ import (
 	"time"
 
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
 	"github.com/Qovery/qovery-migration-ai-agent/pkg/migration"
 	"github.com/gin-gonic/gin"
 )
 
+// Config is the configuration of the handlers. It holds no Qovery API key: the IDs of the Qovery organization written
+// in the migration assets must only come from a key sent by the user.
 type Config struct {
-	QoveryAPIKey           string
-	GitHubToken            string
+	KnowledgeBundle        *kb.Bundle
 	S3AccessKeyId          string
 	S3SecretAccessKey      string
+	S3SessionToken         string
 	S3Bucket               string
 	S3Region               string
 	BedrockAccessKeyId     string
 	BedrockSecretAccessKey string
+	BedrockSessionToken    string
 	BedrockRegion          string
 	BedrockModelArn        string
+	SkipTerraformCLI       bool
+	PromptContext          migration.PromptContextOptions
+	MaxLLMCost             float64
+	LLMPricing             map[string]bedrock.ModelPrice
+	Metrics                *Metrics
+	RateLimiter            *bedrock.RateLimiter
+	BedrockFallbackModels  []bedrock.ModelTarget
+	Jobs                   *Jobs
 }
 
 type HerokuMigrationRequest struct {
 	Source       string `json:"source"`
 	Destination  string `json:"destination"`
 	HerokuAPIKey string `json:"herokuApiKey"`
+	// QoveryAPIKey is optional, the IDs of the Qovery organization of the key are pre-filled in the assets if it is set
+	QoveryAPIKey string `json:"qoveryApiKey"`
+	// JobID is generated by the client to stream the progress of the migration from /api/migrate/progress/:jobId
+	JobID string `json:"jobId"`
 }
 
+// generateHerokuMigrationAssets is replaced in the tests
+var generateHerokuMigrationAssets = migration.GenerateHerokuMigrationAssets
+
 func HerokuMigrateHandler(config Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req HerokuMigrationRequest
@@ -48,38 +68,78 @@ func HerokuMigrateHandler(config Config) gin.HandlerFunc {
 			return
 		}
 
+		job, err := config.Jobs.start(req.JobID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Create a temporary directory
 		tempDir, err := ioutil.TempDir("", "heroku-migration-")
 		if err != nil {
+			config.Jobs.finish(req.JobID, job, "error")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temporary directory"})
 			return
 		}
 		defer os.RemoveAll(tempDir)
 
+		// the updates are streamed to the client by ProgressHandler until the migration is done
 		progressChan := make(chan migration.ProgressUpdate)
-		go func() {
-			for update := range progressChan {
-				// You can use this to send real-time updates to the client
-				_ = update // Placeholder to avoid unused variable error
-			}
-		}()
+		progressDone := job.consume(progressChan)
 
 		// Create Bedrock client configuration
 		bedrockClientConfig := bedrock.DefaultConfig()
 		bedrockClientConfig.AWSRegion = config.BedrockRegion
 		bedrockClientConfig.InferenceProfileARN = config.BedrockModelArn
+		bedrockClientConfig.AWSSessionToken = config.BedrockSessionToken
+		bedrockClientConfig.MaxCost = config.MaxLLMCost
+		bedrockClientConfig.RateLimiter = config.RateLimiter
+		bedrockClientConfig.Fallbacks = config.BedrockFallbackModels
+		if config.LLMPricing != nil {
+			bedrockClientConfig.Pricing = config.LLMPricing
+		}
+
+		validationConfig := migration.DefaultValidationConfig()
+		if config.SkipTerraformCLI {
+			validationConfig.TerraformCLI = false
+		}
 
 		// Use your Go library to generate Terraform manifests and Dockerfiles
-		assets, err := migration.GenerateHerokuMigrationAssets(
+		assets, err := generateHerokuMigrationAssets(
 			req.HerokuAPIKey,
 			config.BedrockAccessKeyId,
 			config.BedrockSecretAccessKey,
-			config.QoveryAPIKey,
-			config.GitHubToken,
+			req.QoveryAPIKey,
 			req.Destination,
+			config.KnowledgeBundle,
 			bedrockClientConfig,
+			validationConfig,
+			config.PromptContext,
+			nil,
 			progressChan,
 		)
+		close(progressChan)
+		<-progressDone
+
+		status := "success"
+		if errors.Is(err, bedrock.ErrBudgetExceeded) {
+			status = "budget_exceeded"
+		} else if err != nil {
+			status = "error"
+		}
+		config.Jobs.finish(req.JobID, job, status)
+		if config.Metrics != nil {
+			var usage bedrock.UsageSummary
+			if assets != nil {
+				usage = assets.LLMUsage
+			}
+			config.Metrics.RecordMigration(status, usage)
+		}
+
+		if err != nil && assets == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		if err != nil {
 			// Error occurred, let's zip the assets and upload to S3
@@ -92,7 +152,7 @@ func HerokuMigrateHandler(config Config) gin.HandlerFunc {
 				if zipErr := createZip(tempDir, errorZipPath); zipErr == nil {
 					// Upload the error zip file to S3
 					if config.S3Bucket != "" && config.S3Region != "" {
-						_, uploadErr := services.UploadZipToS3(errorZipPath, config.S3Bucket, config.S3Region, config.S3AccessKeyId, config.S3SecretAccessKey)
+						_, uploadErr := services.UploadZipToS3(errorZipPath, config.S3Bucket, config.S3Region, config.S3AccessKeyId, config.S3SecretAccessKey, config.S3SessionToken)
 						if uploadErr != nil {
 							fmt.Printf("Failed to upload error zip to S3: %v\n", uploadErr)
 						} else {
@@ -124,7 +184,7 @@ func HerokuMigrateHandler(config Config) gin.HandlerFunc {
 
 		if config.S3Bucket != "" && config.S3Region != "" {
 			// Upload the zip file to S3
-			_, err := services.UploadZipToS3(zipPath, config.S3Bucket, config.S3Region, config.S3AccessKeyId, config.S3SecretAccessKey)
+			_, err := services.UploadZipToS3(zipPath, config.S3Bucket, config.S3Region, config.S3AccessKeyId, config.S3SecretAccessKey, config.S3SessionToken)
 			if err != nil {
 				fmt.Printf("Failed to upload zip to S3: %v\n", err)
 			} else {
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/migration"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHerokuMigrateHandlerQoveryAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// the key of the operator must never be used to pre-fill the assets of a user
+	t.Setenv("QOVERY_API_KEY", "server-key")
+
+	var qoveryAPIKeys []string
+	generate := generateHerokuMigrationAssets
+	generateHerokuMigrationAssets = func(herokuAPIKey, awsKey, awsSecret, qoveryAPIKey, destination string, knowledgeBundle *kb.Bundle, bedrockClientConfig bedrock.ClientConfig, validationConfig migration.ValidationConfig, promptContextOptions migration.PromptContextOptions, run *migration.Run, progressChan chan<- migration.ProgressUpdate) (*migration.Assets, error) {
+		qoveryAPIKeys = append(qoveryAPIKeys, qoveryAPIKey)
+		return nil, errors.New("stopped by the test")
+	}
+	t.Cleanup(func() { generateHerokuMigrationAssets = generate })
+
+	router := gin.New()
+	router.POST("/api/migrate/heroku", HerokuMigrateHandler(Config{Jobs: NewJobs()}))
+
+	for _, body := range []string{
+		`{"source": "heroku", "destination": "aws", "herokuApiKey": "heroku-key"}`,
+		`{"source": "heroku", "destination": "aws", "herokuApiKey": "heroku-key", "qoveryApiKey": "user-key"}`,
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/migrate/heroku", strings.NewReader(body)))
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	}
+
+	assert.Equal(t, []string{"", "user-key"}, qoveryAPIKeys)
+}
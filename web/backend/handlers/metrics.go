@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics are the counters of the migrations and of their LLM usage, exposed in the Prometheus text format
+type Metrics struct {
+	mu           sync.Mutex
+	migrations   map[string]int
+	llmCalls     map[string]int
+	inputTokens  map[string]int
+	outputTokens map[string]int
+	llmCost      map[string]float64
+}
+
+// NewMetrics creates the metrics with all the counters at 0
+func NewMetrics() *Metrics {
+	return &Metrics{
+		migrations:   map[string]int{},
+		llmCalls:     map[string]int{},
+		inputTokens:  map[string]int{},
+		outputTokens: map[string]int{},
+		llmCost:      map[string]float64{},
+	}
+}
+
+// RecordMigration adds a migration with its status (E.g success, error, budget_exceeded) and its LLM usage per stage
+func (m *Metrics) RecordMigration(status string, usage bedrock.UsageSummary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.migrations[status]++
+	for _, group := range usage.Groups {
+		m.llmCalls[group.Stage] += group.Calls
+		m.inputTokens[group.Stage] += group.InputTokens
+		m.outputTokens[group.Stage] += group.OutputTokens
+		m.llmCost[group.Stage] += group.Cost
+	}
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format
+func MetricsHandler(metrics *Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.String(http.StatusOK, metrics.text())
+	}
+}
+
+func (m *Metrics) text() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	writeCounter(&sb, "migrations_total", "Number of migrations by status", "status", toFloat(m.migrations))
+	writeCounter(&sb, "llm_calls_total", "Number of LLM requests by stage", "stage", toFloat(m.llmCalls))
+	writeCounter(&sb, "llm_input_tokens_total", "Number of LLM input tokens by stage", "stage", toFloat(m.inputTokens))
+	writeCounter(&sb, "llm_output_tokens_total", "Number of LLM output tokens by stage", "stage", toFloat(m.outputTokens))
+	writeCounter(&sb, "llm_cost_usd_total", "Estimated LLM spend in USD by stage", "stage", m.llmCost)
+	return sb.String()
+}
+
+func writeCounter(sb *strings.Builder, name, help, label string, values map[string]float64) {
+	sb.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s counter\n", name, help, name))
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("%s{%s=%q} %g\n", name, label, key, values[key]))
+	}
+}
+
+func toFloat(values map[string]int) map[string]float64 {
+	floats := make(map[string]float64, len(values))
+	for key, value := range values {
+		floats[key] = float64(value)
+	}
+	return floats
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/migration"
+	"github.com/gin-gonic/gin"
+)
+
+// jobRetention is how long the progress of a finished migration can still be read
+const jobRetention = 5 * time.Minute
+
+// jobIDRegexp matches the IDs of the jobs generated by the clients, E.g a UUID
+var jobIDRegexp = regexp.MustCompile(`^[A-Za-z0-9-]{16,64}$`)
+
+// Jobs are the migrations in progress by job ID, the ID is generated by the client and sent with the migration request
+type Jobs struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobs creates an empty set of jobs
+func NewJobs() *Jobs {
+	return &Jobs{jobs: map[string]*Job{}}
+}
+
+// JobStatus is the live progress of a migration
+type JobStatus struct {
+	Stage    string  `json:"stage"`
+	Progress float64 `json:"progress"`
+	// Apps are the estimated tokens generated by app and by LLM stage, E.g Generating main.tf
+	Apps map[string]map[string]int `json:"apps"`
+	Done bool                      `json:"done"`
+	// Result is success, error or budget_exceeded once the migration is done
+	Result string `json:"result,omitempty"`
+}
+
+// Job is the progress of a migration. It is nil for a migration requested without a job ID, its updates are then
+// dropped.
+type Job struct {
+	mu     sync.Mutex
+	status JobStatus
+	// changed is closed and replaced on each update, to wake up the streams of the job
+	changed chan struct{}
+}
+
+// start registers the job of a migration, the ID of a migration in progress can't be reused. The job is nil without an
+// ID or without jobs.
+func (j *Jobs) start(id string) (*Job, error) {
+	if j == nil || id == "" {
+		return nil, nil
+	}
+	if !jobIDRegexp.MatchString(id) {
+		return nil, fmt.Errorf("invalid job ID %q", id)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.jobs[id]; ok {
+		return nil, fmt.Errorf("the job %s already exists", id)
+	}
+	job := &Job{status: JobStatus{Apps: map[string]map[string]int{}}, changed: make(chan struct{})}
+	j.jobs[id] = job
+	return job, nil
+}
+
+// finish marks the job as done, it is removed after jobRetention
+func (j *Jobs) finish(id string, job *Job, result string) {
+	if job == nil {
+		return
+	}
+	job.notify(func(status *JobStatus) {
+		status.Done = true
+		status.Result = result
+	})
+	time.AfterFunc(jobRetention, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		delete(j.jobs, id)
+	})
+}
+
+func (j *Jobs) get(id string) *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jobs[id]
+}
+
+// consume applies the updates of progressChan to the job until the channel is closed, the returned channel is then
+// closed
+func (job *Job) consume(progressChan <-chan migration.ProgressUpdate) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for update := range progressChan {
+			job.update(update)
+		}
+	}()
+	return done
+}
+
+func (job *Job) update(update migration.ProgressUpdate) {
+	if job == nil {
+		return
+	}
+	job.notify(func(status *JobStatus) {
+		if update.AppName == "" {
+			status.Stage = update.Stage
+			status.Progress = update.Progress
+			return
+		}
+		if status.Apps[update.AppName] == nil {
+			status.Apps[update.AppName] = map[string]int{}
+		}
+		status.Apps[update.AppName][update.Stage] = update.Tokens
+	})
+}
+
+func (job *Job) notify(change func(status *JobStatus)) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	change(&job.status)
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// snapshot returns a copy of the status and the channel closed on the next update
+func (job *Job) snapshot() (JobStatus, <-chan struct{}) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := job.status
+	status.Apps = map[string]map[string]int{}
+	for app, stages := range job.status.Apps {
+		status.Apps[app] = map[string]int{}
+		for stage, tokens := range stages {
+			status.Apps[app][stage] = tokens
+		}
+	}
+	return status, job.changed
+}
+
+// ProgressHandler streams the progress of a migration as server-sent events, a progress event with the JobStatus on
+// each update. The stream ends once the migration is done. A job which has not started yet is retried by the client.
+func ProgressHandler(jobs *Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+
+		job := jobs.get(c.Param("jobId"))
+		if job == nil {
+			// the stream may be opened before the migration request is received, the EventSource of the client
+			// reconnects after the retry delay
+			c.Status(http.StatusOK)
+			_, _ = fmt.Fprint(c.Writer, "retry: 1000\n\n")
+			c.Writer.Flush()
+			return
+		}
+
+		for {
+			status, changed := job.snapshot()
+			c.SSEvent("progress", status)
+			c.Writer.Flush()
+			if status.Done {
+				return
+			}
+			select {
+			case <-changed:
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
@@ -3,27 +3,106 @@ package main
 import (
 	"backend/handlers"
 	"fmt"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/bedrock"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/kb"
+	"github.com/Qovery/qovery-migration-ai-agent/pkg/migration"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 func main() {
+	knowledgeBundle, err := kb.LoadOrEmbedded(os.Getenv("KNOWLEDGE_BUNDLE_PATH"))
+	if err != nil {
+		log.Fatal("Failed to load the knowledge bundle:", err)
+	}
+	log.Printf("Using the knowledge bundle %s (Qovery provider %s)", knowledgeBundle.Origin, knowledgeBundle.Manifest.ProviderVersion)
+
+	promptContext := migration.DefaultPromptContextOptions()
+	promptContext.IncludeDocs = os.Getenv("PROMPT_INCLUDE_DOCS") != "false"
+	promptContext.IncludeExamples = os.Getenv("PROMPT_INCLUDE_EXAMPLES") != "false"
+	promptContext.CustomInstructionsFile = os.Getenv("PROMPT_INSTRUCTIONS_FILE")
+	promptContext.GitHubToken = os.Getenv("GITHUB_TOKEN")
+	promptContext.PromptsDir = os.Getenv("PROMPTS_DIR")
+	if value := os.Getenv("PROMPT_EXTRA_EXAMPLE_REPOS"); value != "" {
+		promptContext.ExtraExampleRepos = strings.Split(value, ",")
+	}
+	if value := os.Getenv("MAX_CONTEXT_TOKENS"); value != "" {
+		promptContext.MaxContextTokens, err = strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("Invalid MAX_CONTEXT_TOKENS:", err)
+		}
+	}
+
+	maxLLMCost := 0.0
+	if value := os.Getenv("MAX_LLM_COST"); value != "" {
+		maxLLMCost, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatal("Invalid MAX_LLM_COST:", err)
+		}
+	}
+
+	var llmPricing map[string]bedrock.ModelPrice
+	if value := os.Getenv("LLM_PRICING_FILE"); value != "" {
+		llmPricing, err = bedrock.LoadPricing(value)
+		if err != nil {
+			log.Fatal("Failed to load the LLM pricing:", err)
+		}
+	}
+
+	// The rate limiter is shared by all the jobs, to respect the account-wide Bedrock quotas
+	defaultBedrockConfig := bedrock.DefaultConfig()
+	maxRequestsPerMinute := defaultBedrockConfig.MaxRequestsPerMinute
+	if value := os.Getenv("BEDROCK_MAX_REQUESTS_PER_MINUTE"); value != "" {
+		maxRequestsPerMinute, err = strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("Invalid BEDROCK_MAX_REQUESTS_PER_MINUTE:", err)
+		}
+	}
+	maxTokensPerMinute := defaultBedrockConfig.MaxTokensPerMinute
+	if value := os.Getenv("BEDROCK_MAX_TOKENS_PER_MINUTE"); value != "" {
+		maxTokensPerMinute, err = strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("Invalid BEDROCK_MAX_TOKENS_PER_MINUTE:", err)
+		}
+	}
+	rateLimiter := bedrock.NewRateLimiter(maxRequestsPerMinute, maxTokensPerMinute)
+
+	var fallbackModels []bedrock.ModelTarget
+	if value := os.Getenv("BEDROCK_FALLBACK_MODELS"); value != "" {
+		fallbackModels, err = bedrock.ParseModelTargets(strings.Split(value, ","))
+		if err != nil {
+			log.Fatal("Invalid BEDROCK_FALLBACK_MODELS:", err)
+		}
+	}
+
+	metrics := handlers.NewMetrics()
+
 	config := handlers.Config{
-		QoveryAPIKey:           os.Getenv("QOVERY_API_KEY"),
-		GitHubToken:            os.Getenv("GITHUB_TOKEN"),
+		KnowledgeBundle:        knowledgeBundle,
 		S3AccessKeyId:          os.Getenv("S3_ACCESS_KEY_ID"),
 		S3SecretAccessKey:      os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3SessionToken:         os.Getenv("S3_SESSION_TOKEN"),
 		S3Bucket:               os.Getenv("S3_BUCKET"),
 		S3Region:               os.Getenv("S3_REGION"),
 		BedrockAccessKeyId:     os.Getenv("BEDROCK_ACCESS_KEY_ID"),
 		BedrockSecretAccessKey: os.Getenv("BEDROCK_SECRET_ACCESS_KEY"),
+		BedrockSessionToken:    os.Getenv("BEDROCK_SESSION_TOKEN"),
 		BedrockRegion:          os.Getenv("BEDROCK_REGION"),
 		BedrockModelArn:        os.Getenv("BEDROCK_MODEL_ARN"),
+		SkipTerraformCLI:       os.Getenv("SKIP_TERRAFORM_CLI") == "true",
+		PromptContext:          promptContext,
+		MaxLLMCost:             maxLLMCost,
+		LLMPricing:             llmPricing,
+		Metrics:                metrics,
+		RateLimiter:            rateLimiter,
+		BedrockFallbackModels:  fallbackModels,
+		Jobs:                   handlers.NewJobs(),
 	}
 
 	r := gin.Default()
@@ -53,6 +132,8 @@ func main() {
 
 	// Routes
 	r.POST("/api/migrate/heroku", handlers.HerokuMigrateHandler(config))
+	r.GET("/api/migrate/progress/:jobId", handlers.ProgressHandler(config.Jobs))
+	r.GET("/metrics", handlers.MetricsHandler(metrics))
 
 	// Handle preflight requests
 	r.OPTIONS("/*path", func(c *gin.Context) {
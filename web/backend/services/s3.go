@@ -13,12 +13,21 @@ import (
 	"github.com/google/uuid"
 )
 
-// UploadZipToS3 uploads a zip file to an S3 bucket and returns the object key
-func UploadZipToS3(filename, bucketName, region, accessKeyID, secretAccessKey string) (string, error) {
-	// Create a new AWS session with provided credentials
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+// UploadZipToS3 uploads a zip file to an S3 bucket and returns the object key. The static credentials are used if
+// they are set, with the session token of temporary credentials if any, the default AWS credential chain otherwise
+// (environment, shared profiles, web identity, instance roles).
+func UploadZipToS3(filename, bucketName, region, accessKeyID, secretAccessKey, sessionToken string) (string, error) {
+	config := &aws.Config{
+		Region: aws.String(region),
+	}
+	if accessKeyID != "" && secretAccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(accessKeyID, secretAccessKey, sessionToken)
+	}
+
+	// Create a new AWS session, the shared config is enabled for the profiles and the web identity
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create session: %v", err)
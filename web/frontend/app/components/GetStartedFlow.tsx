@@ -4,7 +4,7 @@ import {Select, SelectContent, SelectItem, SelectTrigger, SelectValue} from "@/a
 import {Input} from "@/app/components/ui/input"
 import {Alert, AlertDescription, AlertTitle} from "@/app/components/ui/alert"
 import {HelpCircle, Loader2} from "lucide-react"
-import {generateMigrationFiles} from "@/app/lib/api"
+import {generateMigrationFiles, MigrationProgress} from "@/app/lib/api"
 import Link from 'next/link'
 import {
     SiClevercloud,
@@ -71,6 +71,7 @@ export default function GetStartedFlow() {
     const [successMessage, setSuccessMessage] = useState("")
     const [migrationProgress, setMigrationProgress] = useState(0)
     const [currentMigrationStep, setCurrentMigrationStep] = useState(0)
+    const [liveProgress, setLiveProgress] = useState<MigrationProgress | null>(null)
 
     const ArrowDown = () => (
         <svg className="w-8 h-8 mx-auto my-4" viewBox="0 0 24 24" fill="none" xmlns="http://www.w3.org/2000/svg">
@@ -81,7 +82,8 @@ export default function GetStartedFlow() {
 
     useEffect(() => {
         let interval: ReturnType<typeof setInterval> | undefined;
-        if (isLoading && currentMigrationStep < migrationSteps.length) {
+        // the heuristic steps are only shown until the live progress of the backend is received
+        if (isLoading && liveProgress === null && currentMigrationStep < migrationSteps.length) {
             interval = setInterval(() => {
                 setCurrentMigrationStep(prev => {
                     if (prev < migrationSteps.length - 1) {
@@ -100,11 +102,12 @@ export default function GetStartedFlow() {
                 clearInterval(interval)
             }
         }
-    }, [isLoading, currentMigrationStep])
+    }, [isLoading, currentMigrationStep, liveProgress])
 
     const handleSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
         e.preventDefault()
         setMigrationProgress(0)
+        setLiveProgress(null)
 
         if (step === 1) {
             setStep(2)
@@ -131,7 +134,12 @@ export default function GetStartedFlow() {
                         ...(selectedPaas === "clevercloud" && {cleverCloudToken, cleverCloudSecret}),
                     };
 
-                    const result = await generateMigrationFiles(migrationRequest)
+                    const result = await generateMigrationFiles(migrationRequest, (progress) => {
+                        setLiveProgress(progress)
+                        if (progress.stage !== "") {
+                            setMigrationProgress(progress.progress * 100)
+                        }
+                    })
 
                     // Stop the migration progress animation
                     setIsLoading(false)
@@ -341,8 +349,17 @@ export default function GetStartedFlow() {
                                 <h3 className="text-lg font-semibold mb-2 text-gray-800">Processing in Progress</h3>
                                 <Progress value={migrationProgress} className="w-full mb-4"/>
                                 <p className="text-sm text-gray-600">
-                                    {migrationSteps[currentMigrationStep]}...
+                                    {liveProgress !== null && liveProgress.stage !== "" ? liveProgress.stage : migrationSteps[currentMigrationStep]}...
                                 </p>
+                                {liveProgress !== null && (
+                                    <ul className="mt-2 text-xs text-gray-500">
+                                        {Object.entries(liveProgress.apps).map(([app, stages]) => (
+                                            <li key={app}>
+                                                {app}: {Object.entries(stages).map(([stage, tokens]) => `${stage} (~${tokens} tokens)`).join(", ")}
+                                            </li>
+                                        ))}
+                                    </ul>
+                                )}
                             </div>
                         )}
                     </div>
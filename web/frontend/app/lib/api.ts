@@ -13,14 +13,42 @@ interface MigrationResponse {
     filename: string;
 }
 
-export async function generateMigrationFiles(migrationRequest: MigrationRequest): Promise<MigrationResponse> {
-    const response = await fetch(`${API_HOST_URL}/api/migrate/${migrationRequest.source}`, {
-        method: 'POST',
-        headers: {
-            'Content-Type': 'application/json',
-        },
-        body: JSON.stringify(migrationRequest),
-    });
+export interface MigrationProgress {
+    stage: string;
+    progress: number;
+    // estimated tokens generated by app and by LLM stage
+    apps: Record<string, Record<string, number>>;
+    done: boolean;
+    result?: string;
+}
+
+export async function generateMigrationFiles(migrationRequest: MigrationRequest, onProgress?: (progress: MigrationProgress) => void): Promise<MigrationResponse> {
+    // the progress of the migration is streamed while the request is running
+    const jobId = crypto.randomUUID();
+    let progressSource: EventSource | undefined;
+    if (onProgress) {
+        progressSource = new EventSource(`${API_HOST_URL}/api/migrate/progress/${jobId}`);
+        progressSource.addEventListener('progress', (event) => {
+            const progress: MigrationProgress = JSON.parse((event as MessageEvent).data);
+            onProgress(progress);
+            if (progress.done) {
+                progressSource?.close();
+            }
+        });
+    }
+
+    let response: Response;
+    try {
+        response = await fetch(`${API_HOST_URL}/api/migrate/${migrationRequest.source}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({...migrationRequest, jobId}),
+        });
+    } finally {
+        progressSource?.close();
+    }
 
     if (!response.ok) {
         const errorMessage = await getErrorMessage(response);